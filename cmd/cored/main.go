@@ -8,11 +8,13 @@ import (
 	"expvar"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
@@ -25,18 +27,23 @@ import (
 	"chain/core/blocksigner"
 	"chain/core/config"
 	"chain/core/fetch"
+	"chain/core/filestore"
 	"chain/core/generator"
 	"chain/core/leader"
 	"chain/core/migrate"
 	"chain/core/mockhsm"
 	"chain/core/pin"
 	"chain/core/query"
+	"chain/core/refdata"
 	"chain/core/rpc"
+	"chain/core/schedule"
 	"chain/core/txbuilder"
 	"chain/core/txdb"
 	"chain/core/txfeed"
+	"chain/core/txstatus"
 	"chain/crypto/ed25519"
 	"chain/database/sql"
+	"chain/encoding/jsonschema"
 	"chain/env"
 	"chain/errors"
 	chainlog "chain/log"
@@ -69,6 +76,27 @@ var (
 	rpsToken      = env.Int("RATELIMIT_TOKEN", 0)       // reqs/sec
 	rpsRemoteAddr = env.Int("RATELIMIT_REMOTE_ADDR", 0) // reqs/sec
 	indexTxs      = env.Bool("INDEX_TRANSACTIONS", true)
+	lightMode     = env.Bool("LIGHT_MODE", false)     // sync headers and local txs only
+	fetchPeers    = env.StringSlice("FETCH_PEERS")    // URLs of other cores to fetch blocks from
+	blockStoreDir = env.String("BLOCK_STORE_DIR", "") // store blocks in files here; config, pins, and keys stay in Postgres
+	retainBlocks  = env.Int("BLOCK_RETENTION", 0)     // blocks to keep below the tip; 0 keeps all
+
+	// out-of-process transaction annotators
+	annotatorURLs    = env.StringSlice("ANNOTATOR_URLS") // called in order for each block
+	annotatorTimeout = env.Duration("ANNOTATOR_TIMEOUT", 5*time.Second)
+	annotatorFailure = env.String("ANNOTATOR_FAILURE", "retry") // "retry" or "skip"
+
+	// generator admission policies; empty means no limit
+	denyAssets     = env.StringSlice("GENERATOR_DENY_ASSETS")     // asset IDs
+	denyPrograms   = env.StringSlice("GENERATOR_DENY_PROGRAMS")   // hex control programs
+	issuanceLimits = env.StringSlice("GENERATOR_ISSUANCE_LIMITS") // assetid:amount[:window]
+
+	// block signer policies; empty or zero means no limit
+	signerMaxIssuance   = env.StringSlice("SIGNER_MAX_ISSUANCE")  // assetid:amount
+	signerMaxTimeSkew   = env.Duration("SIGNER_MAX_TIME_SKEW", 0) // in either direction
+	signerDenyAssets    = env.StringSlice("SIGNER_DENY_ASSETS")   // asset IDs
+	signerDenyPrograms  = env.StringSlice("SIGNER_DENY_PROGRAMS") // hex control programs
+	signerRefDataSchema = env.String("SIGNER_REFDATA_SCHEMA", "") // path to a JSON schema file
 
 	// build vars; initialized by the linker
 	buildTag    = "dev"
@@ -78,8 +106,10 @@ var (
 	race          []interface{} // initialized in race.go
 	httpsRedirect = true        // initialized in insecure.go
 
-	blockPeriod              = time.Second
 	expireReservationsPeriod = time.Second
+	pruneBlocksPeriod        = 10 * time.Minute
+	resubmitTxsPeriod        = 10 * time.Second
+	scheduledTxsPeriod       = time.Second
 )
 
 func init() {
@@ -200,10 +230,13 @@ func main() {
 }
 
 func launchConfiguredCore(ctx context.Context, db *sql.DB, conf *config.Config, processID string) http.Handler {
-	pool := mempool.New()
-
+	var gate *generator.Gate
 	var submitter txbuilder.Submitter
 	var remoteGenerator *rpc.Client
+	var peers *fetch.Peers
+	if *lightMode && (conf.IsGenerator || conf.IsSigner) {
+		chainlog.Fatal(ctx, chainlog.KeyError, "light mode is only for participant cores")
+	}
 	if !conf.IsGenerator {
 		remoteGenerator = &rpc.Client{
 			BaseURL:      conf.GeneratorURL,
@@ -214,15 +247,46 @@ func launchConfiguredCore(ctx context.Context, db *sql.DB, conf *config.Config,
 			BlockchainID: conf.BlockchainID.String(),
 		}
 		submitter = &txbuilder.RemoteGenerator{Peer: remoteGenerator}
+		peers = fetch.NewPeers(remoteGenerator, peerClients(ctx, processID, conf)...)
 	} else {
-		submitter = pool
+		gate = generator.NewGate(mempool.New(), generatorPolicies(ctx)...)
+		submitter = gate
 	}
 
-	heights, err := txdb.ListenBlocks(ctx, *dbURL)
+	var (
+		store   core.BlockStore
+		heights <-chan uint64
+		err     error
+	)
+	if *blockStoreDir != "" && *retainBlocks > 0 {
+		chainlog.Fatal(ctx, chainlog.KeyError, "block pruning requires blocks to be stored in Postgres")
+	}
+	if *blockStoreDir != "" {
+		// The files are local to this process, so the
+		// Core must not be a generator, whose blocks other
+		// processes need to see, and must not share its
+		// database with other cored processes.
+		if conf.IsGenerator {
+			chainlog.Fatal(ctx, chainlog.KeyError, "BLOCK_STORE_DIR is only for signer and participant cores")
+		}
+		var other string
+		other, err = leader.Other(ctx, db, *listenAddr)
+		if err != nil {
+			chainlog.Fatal(ctx, chainlog.KeyError, err)
+		}
+		if other != "" {
+			chainlog.Fatal(ctx, chainlog.KeyError, "BLOCK_STORE_DIR requires a single cored process, but "+other+" is running")
+		}
+		// Only this process reads and writes the files,
+		// so there are no new heights to listen for.
+		store, err = filestore.Open(*blockStoreDir)
+	} else {
+		heights, err = txdb.ListenBlocks(ctx, *dbURL)
+		store = txdb.NewStore(db)
+	}
 	if err != nil {
 		chainlog.Fatal(ctx, chainlog.KeyError, err)
 	}
-	store := txdb.NewStore(db)
 	c, err := protocol.NewChain(ctx, conf.BlockchainID, store, heights)
 	if err != nil {
 		chainlog.Fatal(ctx, chainlog.KeyError, err)
@@ -243,12 +307,17 @@ func launchConfiguredCore(ctx context.Context, db *sql.DB, conf *config.Config,
 
 	assets := asset.NewRegistry(db, c, pinStore)
 	accounts := account.NewManager(db, c, pinStore)
+	refData := &refdata.Registry{DB: db}
 	if *indexTxs {
 		go pinStore.Listen(ctx, query.TxPinName, *dbURL)
 		indexer.RegisterAnnotator(assets.AnnotateTxs)
 		indexer.RegisterAnnotator(accounts.AnnotateTxs)
+		for _, annotator := range httpAnnotators(ctx) {
+			indexer.RegisterAnnotator(annotator)
+		}
 		assets.IndexAssets(indexer)
 		accounts.IndexAccounts(indexer)
+		indexer.CheckReferenceData(refData)
 	}
 
 	hsm := mockhsm.New(db)
@@ -259,7 +328,7 @@ func launchConfiguredCore(ctx context.Context, db *sql.DB, conf *config.Config,
 		if err != nil {
 			chainlog.Fatal(ctx, chainlog.KeyError, err)
 		}
-		s := blocksigner.New(blockPub, hsm, db, c)
+		s := blocksigner.New(blockPub, hsm, db, c, signerPolicies(ctx)...)
 		generatorSigners = append(generatorSigners, s) // "local" signer
 		signBlockHandler = func(ctx context.Context, b *bc.Block) ([]byte, error) {
 			sig, err := s.ValidateAndSignBlock(ctx, b)
@@ -276,10 +345,21 @@ func launchConfiguredCore(ctx context.Context, db *sql.DB, conf *config.Config,
 		}
 		c.MaxIssuanceWindow = conf.MaxIssuanceWindow
 	}
+	c.SetBlockLimits(protocol.BlockLimits{MaxTxs: conf.MaxBlockTxs, MaxBytes: conf.MaxBlockBytes})
+	if gate != nil {
+		gate.SetBlockLimits(c.BlockLimits)
+	}
 
 	// GC old submitted txs periodically.
 	go core.CleanupSubmittedTxs(ctx, db)
 
+	// Only the generator has a pool to report on.
+	var pool txstatus.Pool
+	if gate != nil {
+		pool = gate
+	}
+	txStatus := txstatus.NewTracker(db, c, pinStore, pool)
+
 	h := &core.Handler{
 		Chain:        c,
 		Store:        store,
@@ -289,11 +369,16 @@ func launchConfiguredCore(ctx context.Context, db *sql.DB, conf *config.Config,
 		HSM:          hsm,
 		Submitter:    submitter,
 		TxFeeds:      &txfeed.Tracker{DB: db},
+		TxStatus:     txStatus,
+		Schedule:     &schedule.Scheduler{DB: db},
+		RefData:      refData,
 		Indexer:      indexer,
 		AccessTokens: &accesstoken.CredentialStore{DB: db},
 		Config:       conf,
 		DB:           db,
 		Addr:         *listenAddr,
+		IndexTxs:     *indexTxs,
+		LightMode:    *lightMode,
 		Signer:       signBlockHandler,
 		AltAuth:      authLoopbackInDev,
 	}
@@ -335,23 +420,42 @@ func launchConfiguredCore(ctx context.Context, db *sql.DB, conf *config.Config,
 		if err != nil {
 			chainlog.Fatal(ctx, chainlog.KeyError, err)
 		}
+		err = pinStore.CreatePin(ctx, txstatus.PinName, height)
+		if err != nil {
+			chainlog.Fatal(ctx, chainlog.KeyError, err)
+		}
 	}()
 
 	// Note, it's important for any services that will install blockchain
 	// callbacks to be initialized before leader.Run() and the http server,
 	// otherwise there's a data race within protocol.Chain.
 	go leader.Run(db, *listenAddr, func(ctx context.Context) {
+		// Another process may have changed the block
+		// parameters while this one was not leader.
+		err := h.LoadBlockParams(ctx)
+		if err != nil {
+			chainlog.Fatal(ctx, chainlog.KeyError, err)
+		}
+
 		go h.Accounts.ExpireReservations(ctx, expireReservationsPeriod)
 		if conf.IsGenerator {
-			go generator.Generate(ctx, c, pool, generatorSigners, db, blockPeriod, genhealth)
+			go generator.Generate(ctx, c, gate, generatorSigners, db, h.BlockPeriod, genhealth)
+		} else if *lightMode {
+			go fetch.FetchLight(ctx, c, peers, h.Accounts.ControlPrograms, fetchhealth)
 		} else {
-			go fetch.Fetch(ctx, c, remoteGenerator, fetchhealth)
+			go fetch.Fetch(ctx, c, peers, fetchhealth)
 		}
 		go h.Accounts.ProcessBlocks(ctx)
 		go h.Assets.ProcessBlocks(ctx)
+		go h.TxStatus.ProcessBlocks(ctx)
+		go h.TxStatus.Resubmit(ctx, submitter, resubmitTxsPeriod)
+		go h.RunSchedule(ctx, scheduledTxsPeriod)
 		if *indexTxs {
 			go h.Indexer.ProcessBlocks(ctx)
 		}
+		if *retainBlocks > 0 {
+			go store.(*txdb.Store).PruneBlocks(ctx, uint64(*retainBlocks), pruneBlocksPeriod)
+		}
 	})
 
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
@@ -389,6 +493,36 @@ func remoteSignerInfo(ctx context.Context, processID, buildTag, blockchainID str
 	return a
 }
 
+// peerClients returns clients for the cores in FETCH_PEERS,
+// from which blocks can be fetched in addition to the generator.
+// A peer's access token, if any, is given as the userinfo
+// part of its URL.
+func peerClients(ctx context.Context, processID string, conf *config.Config) (a []*rpc.Client) {
+	for _, s := range *fetchPeers {
+		u, err := url.Parse(s)
+		if err != nil {
+			chainlog.Fatal(ctx, chainlog.KeyError, errors.Wrap(err, "parsing FETCH_PEERS"))
+		}
+		var token string
+		if u.User != nil {
+			token = u.User.Username()
+			if pass, ok := u.User.Password(); ok {
+				token += ":" + pass
+			}
+			u.User = nil
+		}
+		a = append(a, &rpc.Client{
+			BaseURL:      u.String(),
+			AccessToken:  token,
+			Username:     processID,
+			CoreID:       conf.ID,
+			BuildTag:     buildTag,
+			BlockchainID: conf.BlockchainID.String(),
+		})
+	}
+	return a
+}
+
 func (s *remoteSigner) SignBlock(ctx context.Context, b *bc.Block) (signature []byte, err error) {
 	// TODO(kr): We might end up serializing b multiple
 	// times in multiple calls to different remoteSigners.
@@ -401,6 +535,137 @@ func (s *remoteSigner) String() string {
 	return s.Client.BaseURL
 }
 
+// generatorPolicies returns the transaction admission policies
+// configured in the environment.
+func generatorPolicies(ctx context.Context) (policies []generator.Policy) {
+	deny := &generator.DenyList{
+		Assets:          mustParseAssetIDs(ctx, "GENERATOR_DENY_ASSETS", *denyAssets),
+		ControlPrograms: mustParsePrograms(ctx, "GENERATOR_DENY_PROGRAMS", *denyPrograms),
+	}
+	if len(deny.Assets) > 0 || len(deny.ControlPrograms) > 0 {
+		policies = append(policies, deny)
+	}
+
+	for _, s := range *issuanceLimits {
+		limit, err := parseIssuanceLimit(s)
+		if err != nil {
+			chainlog.Fatal(ctx, chainlog.KeyError, errors.Wrap(err, "parsing GENERATOR_ISSUANCE_LIMITS"))
+		}
+		policies = append(policies, limit)
+	}
+	return policies
+}
+
+// signerPolicies returns the block signing policies
+// configured in the environment.
+func signerPolicies(ctx context.Context) (policies []blocksigner.Policy) {
+	if len(*signerMaxIssuance) > 0 {
+		max := make(blocksigner.MaxIssuance)
+		for _, s := range *signerMaxIssuance {
+			limit, err := parseIssuanceLimit(s)
+			if err != nil || limit.Window != 0 {
+				chainlog.Fatal(ctx, chainlog.KeyError, fmt.Errorf("parsing SIGNER_MAX_ISSUANCE: bad limit %q", s))
+			}
+			max[limit.AssetID] = limit.Amount
+		}
+		policies = append(policies, max)
+	}
+
+	if *signerMaxTimeSkew > 0 {
+		policies = append(policies, blocksigner.TimeSkew{Past: *signerMaxTimeSkew, Future: *signerMaxTimeSkew})
+	}
+
+	deny := &blocksigner.OutputDenyList{
+		Assets:          mustParseAssetIDs(ctx, "SIGNER_DENY_ASSETS", *signerDenyAssets),
+		ControlPrograms: mustParsePrograms(ctx, "SIGNER_DENY_PROGRAMS", *signerDenyPrograms),
+	}
+	if len(deny.Assets) > 0 || len(deny.ControlPrograms) > 0 {
+		policies = append(policies, deny)
+	}
+
+	if *signerRefDataSchema != "" {
+		b, err := ioutil.ReadFile(*signerRefDataSchema)
+		if err != nil {
+			chainlog.Fatal(ctx, chainlog.KeyError, errors.Wrap(err, "reading SIGNER_REFDATA_SCHEMA"))
+		}
+		schema, err := jsonschema.Parse(b)
+		if err != nil {
+			chainlog.Fatal(ctx, chainlog.KeyError, err, "at", "parsing SIGNER_REFDATA_SCHEMA")
+		}
+		policies = append(policies, blocksigner.RefDataSchema{Schema: schema})
+	}
+	return policies
+}
+
+func httpAnnotators(ctx context.Context) (annotators []query.Annotator) {
+	var policy query.FailurePolicy
+	switch *annotatorFailure {
+	case "retry":
+		policy = query.RetryOnFailure
+	case "skip":
+		policy = query.SkipOnFailure
+	default:
+		chainlog.Fatal(ctx, chainlog.KeyError, fmt.Errorf("parsing ANNOTATOR_FAILURE: want retry or skip, got %q", *annotatorFailure))
+	}
+	for _, u := range *annotatorURLs {
+		annotator, err := query.NewHTTPAnnotator(u, *annotatorTimeout, policy)
+		if err != nil {
+			chainlog.Fatal(ctx, chainlog.KeyError, err, "at", "parsing ANNOTATOR_URLS")
+		}
+		annotators = append(annotators, annotator)
+	}
+	return annotators
+}
+
+func mustParseAssetIDs(ctx context.Context, name string, a []string) (assetIDs []bc.AssetID) {
+	for _, s := range a {
+		var assetID bc.AssetID
+		err := assetID.UnmarshalText([]byte(s))
+		if err != nil {
+			chainlog.Fatal(ctx, chainlog.KeyError, errors.Wrap(err, "parsing "+name))
+		}
+		assetIDs = append(assetIDs, assetID)
+	}
+	return assetIDs
+}
+
+func mustParsePrograms(ctx context.Context, name string, a []string) (progs [][]byte) {
+	for _, s := range a {
+		prog, err := hex.DecodeString(s)
+		if err != nil {
+			chainlog.Fatal(ctx, chainlog.KeyError, errors.Wrap(err, "parsing "+name))
+		}
+		progs = append(progs, prog)
+	}
+	return progs
+}
+
+// parseIssuanceLimit parses an issuance limit of the form
+// assetid:amount or assetid:amount:window, where window is a
+// duration such as 24h.
+func parseIssuanceLimit(s string) (*generator.IssuanceLimit, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 && len(parts) != 3 {
+		return nil, fmt.Errorf("bad issuance limit %q", s)
+	}
+	limit := new(generator.IssuanceLimit)
+	err := limit.AssetID.UnmarshalText([]byte(parts[0]))
+	if err != nil {
+		return nil, err
+	}
+	limit.Amount, err = strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) == 3 {
+		limit.Window, err = time.ParseDuration(parts[2])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return limit, nil
+}
+
 func logWriter() io.Writer {
 	dropmsg := []byte("\nlog data dropped\n")
 	rotation := &errlog{w: rotation.Create(logFile, *logSize, *logCount)}
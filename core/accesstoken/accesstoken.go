@@ -11,6 +11,7 @@ import (
 
 	"chain/crypto/sha3pool"
 	"chain/database/pg"
+	"chain/database/sql"
 	"chain/errors"
 )
 
@@ -106,6 +107,20 @@ func (cs *CredentialStore) Check(ctx context.Context, id, typ string, secret []b
 	return valid, nil
 }
 
+// Get returns the access token with the given ID,
+// without its secret.
+func (cs *CredentialStore) Get(ctx context.Context, id string) (*Token, error) {
+	const q = `SELECT type, sort_id, created FROM access_tokens WHERE id=$1`
+	t := &Token{ID: id}
+	err := cs.DB.QueryRow(ctx, q, id).Scan(&t.Type, &t.sortID, &t.Created)
+	if err == sql.ErrNoRows {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "access token id %s", id)
+	} else if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return t, nil
+}
+
 // List lists all access tokens.
 func (cs *CredentialStore) List(ctx context.Context, typ, after string, limit int) ([]*Token, string, error) {
 	if limit == 0 {
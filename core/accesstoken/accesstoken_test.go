@@ -9,6 +9,7 @@ import (
 
 	"github.com/davecgh/go-spew/spew"
 
+	"chain/database/pg"
 	"chain/database/pg/pgtest"
 	"chain/errors"
 )
@@ -143,6 +144,24 @@ func TestDelete(t *testing.T) {
 	}
 }
 
+func TestGet(t *testing.T) {
+	ctx := context.Background()
+	cs := &CredentialStore{DB: pgtest.NewTx(t)}
+
+	token := mustCreateToken(t, ctx, cs, "x", "client")
+	got, err := cs.Get(ctx, "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != token.ID || got.Type != token.Type || !got.Created.Equal(token.Created) {
+		t.Errorf("Get(x) = %+v want %+v", got, token)
+	}
+	_, err = cs.Get(ctx, "y")
+	if errors.Root(err) != pg.ErrUserInputNotFound {
+		t.Errorf("Get(y) error = %v want %s", err, pg.ErrUserInputNotFound)
+	}
+}
+
 func mustCreateToken(t *testing.T, ctx context.Context, cs *CredentialStore, id, typ string) *Token {
 	token, err := cs.Create(ctx, id, typ)
 	if err != nil {
@@ -25,7 +25,17 @@ import (
 
 const maxAccountCache = 1000
 
-var ErrDuplicateAlias = errors.New("duplicate account alias")
+var (
+	ErrDuplicateAlias = errors.New("duplicate account alias")
+
+	// ErrVersionMismatch is returned by Update when the
+	// account has changed since the given version.
+	ErrVersionMismatch = errors.New("account version mismatch")
+
+	// ErrArchived is returned when building a transaction
+	// that spends from or pays to an archived account.
+	ErrArchived = errors.New("account is archived")
+)
 
 func NewManager(db *sql.DB, chain *protocol.Chain, pinStore *pin.Store) *Manager {
 	return &Manager{
@@ -34,8 +44,9 @@ func NewManager(db *sql.DB, chain *protocol.Chain, pinStore *pin.Store) *Manager
 		utxoDB:      newReserver(db, chain, pinStore),
 		pinStore:    pinStore,
 		cache:       lru.New(maxAccountCache),
-		aliasCache:  lru.New(maxAccountCache),
 		delayedACPs: make(map[*txbuilder.TemplateBuilder][]*controlProgram),
+
+		policySpends: make(map[*txbuilder.TemplateBuilder][]*policySpend),
 	}
 }
 
@@ -47,13 +58,17 @@ type Manager struct {
 	indexer  Saver
 	pinStore *pin.Store
 
-	cacheMu    sync.Mutex
-	cache      *lru.Cache
-	aliasCache *lru.Cache
+	// Accounts' signers never change, so they're cached.
+	// Aliases can change, so they're always looked up.
+	cacheMu sync.Mutex
+	cache   *lru.Cache
 
 	delayedACPsMu sync.Mutex
 	delayedACPs   map[*txbuilder.TemplateBuilder][]*controlProgram
 
+	policySpendsMu sync.Mutex
+	policySpends   map[*txbuilder.TemplateBuilder][]*policySpend
+
 	acpMu        sync.Mutex
 	acpIndexNext uint64 // next acp index in our block
 	acpIndexCap  uint64 // points to end of block
@@ -83,8 +98,10 @@ func (m *Manager) ExpireReservations(ctx context.Context, period time.Duration)
 
 type Account struct {
 	*signers.Signer
-	Alias string
-	Tags  map[string]interface{}
+	Alias    string
+	Tags     map[string]interface{}
+	Version  uint64
+	Archived bool
 }
 
 // Create creates a new Account.
@@ -107,8 +124,13 @@ func (m *Manager) Create(ctx context.Context, xpubs []string, quorum int, alias
 	const q = `
 		INSERT INTO accounts (account_id, alias, tags) VALUES ($1, $2, $3)
 		ON CONFLICT (account_id) DO UPDATE SET alias = $2, tags = $3
+		RETURNING version, archived
 	`
-	_, err = m.db.Exec(ctx, q, signer.ID, aliasSQL, tagsParam)
+	var (
+		version  uint64
+		archived bool
+	)
+	err = m.db.QueryRow(ctx, q, signer.ID, aliasSQL, tagsParam).Scan(&version, &archived)
 	if pg.IsUniqueViolation(err) {
 		return nil, errors.WithDetail(ErrDuplicateAlias, "an account with the provided alias already exists")
 	} else if err != nil {
@@ -116,9 +138,11 @@ func (m *Manager) Create(ctx context.Context, xpubs []string, quorum int, alias
 	}
 
 	account := &Account{
-		Signer: signer,
-		Alias:  alias,
-		Tags:   tags,
+		Signer:   signer,
+		Alias:    alias,
+		Tags:     tags,
+		Version:  version,
+		Archived: archived,
 	}
 
 	err = m.indexAnnotatedAccount(ctx, account)
@@ -132,26 +156,152 @@ func (m *Manager) Create(ctx context.Context, xpubs []string, quorum int, alias
 // FindByAlias retrieves an account's Signer record by its alias
 func (m *Manager) FindByAlias(ctx context.Context, alias string) (*signers.Signer, error) {
 	var accountID string
+	const q = `SELECT account_id FROM accounts WHERE alias=$1`
+	err := m.db.QueryRow(ctx, q, alias).Scan(&accountID)
+	if err == stdsql.ErrNoRows {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "alias: %s", alias)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return m.findByID(ctx, accountID)
+}
 
-	m.cacheMu.Lock()
-	cachedID, ok := m.aliasCache.Get(alias)
-	m.cacheMu.Unlock()
-	if ok {
-		accountID = cachedID.(string)
-	} else {
-		const q = `SELECT account_id FROM accounts WHERE alias=$1`
-		err := m.db.QueryRow(ctx, q, alias).Scan(&accountID)
-		if err == stdsql.ErrNoRows {
-			return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "alias: %s", alias)
+// Update changes the alias and tags of the account with the given
+// ID, provided it is still at the given version. A nil alias or tags
+// leaves that field unchanged; an empty alias removes the alias.
+// It re-indexes the annotated account and returns the updated account
+// with its new version. If backfill is true, it also updates the
+// account annotations of indexed transactions and outputs.
+func (m *Manager) Update(ctx context.Context, id string, version uint64, alias *string, tags *map[string]interface{}, backfill bool) (*Account, error) {
+	signer, err := m.findByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	const selectQ = `SELECT alias, tags, version, archived FROM accounts WHERE account_id = $1`
+	var (
+		account  = &Account{Signer: signer}
+		oldAlias stdsql.NullString
+		oldTags  []byte
+	)
+	err = m.db.QueryRow(ctx, selectQ, id).Scan(&oldAlias, &oldTags, &account.Version, &account.Archived)
+	if err == stdsql.ErrNoRows {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "account id: %s", id)
+	} else if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	if account.Version != version {
+		return nil, errors.WithDetailf(ErrVersionMismatch, "account is at version %d", account.Version)
+	}
+
+	account.Alias = oldAlias.String
+	if alias != nil {
+		account.Alias = *alias
+	}
+	if tags != nil {
+		account.Tags = *tags
+	} else if len(oldTags) > 0 {
+		err = json.Unmarshal(oldTags, &account.Tags)
+		if err != nil {
+			return nil, errors.Wrap(err)
+		}
+	}
+
+	tagsParam, err := tagsToNullString(account.Tags)
+	if err != nil {
+		return nil, err
+	}
+	aliasSQL := stdsql.NullString{
+		String: account.Alias,
+		Valid:  account.Alias != "",
+	}
+
+	const updateQ = `
+		UPDATE accounts SET alias = $3, tags = $4, version = version + 1
+		WHERE account_id = $1 AND version = $2
+		RETURNING version
+	`
+	err = m.db.QueryRow(ctx, updateQ, id, version, aliasSQL, tagsParam).Scan(&account.Version)
+	if pg.IsUniqueViolation(err) {
+		return nil, errors.WithDetail(ErrDuplicateAlias, "an account with the provided alias already exists")
+	} else if err == stdsql.ErrNoRows {
+		// Another update won the race.
+		return nil, errors.WithDetail(ErrVersionMismatch, "account was updated concurrently")
+	} else if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	err = m.indexAnnotatedAccount(ctx, account)
+	if err != nil {
+		return nil, errors.Wrap(err, "indexing annotated account")
+	}
+	if backfill && m.indexer != nil {
+		err = m.indexer.Reannotate(ctx, "account_id", id, []string{"account_alias", "account_tags"}, accountAnnotations(account))
+		if err != nil {
+			return nil, errors.Wrap(err, "back-filling account annotations")
 		}
+	}
+	return account, nil
+}
+
+// SetArchived archives or unarchives the account with the given ID.
+// Transactions can't be built to spend from or pay to an archived
+// account, but its history is kept, and it can be unarchived.
+// SetArchived re-indexes the annotated account and returns the
+// account with its new version.
+func (m *Manager) SetArchived(ctx context.Context, id string, archived bool) (*Account, error) {
+	signer, err := m.findByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	const q = `
+		UPDATE accounts SET archived = $2, version = version + 1
+		WHERE account_id = $1
+		RETURNING alias, tags, version
+	`
+	var (
+		account = &Account{Signer: signer, Archived: archived}
+		alias   stdsql.NullString
+		tags    []byte
+	)
+	err = m.db.QueryRow(ctx, q, id, archived).Scan(&alias, &tags, &account.Version)
+	if err == stdsql.ErrNoRows {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "account id: %s", id)
+	} else if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	account.Alias = alias.String
+	if len(tags) > 0 {
+		err = json.Unmarshal(tags, &account.Tags)
 		if err != nil {
 			return nil, errors.Wrap(err)
 		}
-		m.cacheMu.Lock()
-		m.aliasCache.Add(alias, accountID)
-		m.cacheMu.Unlock()
 	}
-	return m.findByID(ctx, accountID)
+
+	err = m.indexAnnotatedAccount(ctx, account)
+	if err != nil {
+		return nil, errors.Wrap(err, "indexing annotated account")
+	}
+	return account, nil
+}
+
+// checkActive returns ErrArchived if the account
+// with the given ID is archived.
+func (m *Manager) checkActive(ctx context.Context, id string) error {
+	const q = `SELECT archived FROM accounts WHERE account_id = $1`
+	var archived bool
+	err := m.db.QueryRow(ctx, q, id).Scan(&archived)
+	if err == stdsql.ErrNoRows {
+		return errors.WithDetailf(pg.ErrUserInputNotFound, "account id: %s", id)
+	} else if err != nil {
+		return errors.Wrap(err)
+	}
+	if archived {
+		return errors.WithDetailf(ErrArchived, "account id: %s", id)
+	}
+	return nil
 }
 
 // findByID returns an account's Signer record by its ID.
@@ -220,6 +370,18 @@ func (m *Manager) CreateControlProgram(ctx context.Context, accountID string, ch
 	return cp.controlProgram, nil
 }
 
+// ControlPrograms returns every control program created
+// for an account on this core. A light client uses them to
+// select the transactions it needs.
+func (m *Manager) ControlPrograms(ctx context.Context) ([][]byte, error) {
+	const q = `SELECT control_program FROM account_control_programs`
+	var progs [][]byte
+	err := pg.ForQueryRows(ctx, m.db, q, func(prog []byte) {
+		progs = append(progs, prog)
+	})
+	return progs, errors.Wrap(err, "listing account control programs")
+}
+
 func (m *Manager) insertAccountControlProgram(ctx context.Context, progs ...*controlProgram) error {
 	const q = `
 		INSERT INTO account_control_programs (signer_id, key_index, control_program, change)
@@ -6,8 +6,11 @@ import (
 	"reflect"
 	"testing"
 
+	"chain/core/txbuilder"
+	"chain/database/pg"
 	"chain/database/pg/pgtest"
 	"chain/errors"
+	"chain/protocol/bc"
 	"chain/protocol/prottest"
 	"chain/protocol/vm"
 	"chain/testutil"
@@ -147,3 +150,77 @@ func TestFindByAlias(t *testing.T) {
 		t.Errorf("expected found account to be %v, instead found %v", account, found)
 	}
 }
+
+func TestUpdateAccount(t *testing.T) {
+	_, db := pgtest.NewDB(t, pgtest.SchemaPath)
+	m := NewManager(db, prottest.NewChain(t), nil)
+	ctx := context.Background()
+
+	account, err := m.Create(ctx, []string{dummyXPub}, 1, "satoshi", map[string]interface{}{"dept": "a"}, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	alias := "nakamoto"
+	updated, err := m.Update(ctx, account.ID, account.Version, &alias, nil, false)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if updated.Alias != alias || updated.Version != account.Version+1 {
+		t.Errorf("got alias %q version %d, want %q version %d", updated.Alias, updated.Version, alias, account.Version+1)
+	}
+	if !reflect.DeepEqual(updated.Tags, account.Tags) {
+		t.Errorf("got tags %v, want unchanged %v", updated.Tags, account.Tags)
+	}
+
+	// An update from the old version fails.
+	tags := map[string]interface{}{"dept": "b"}
+	_, err = m.Update(ctx, account.ID, account.Version, nil, &tags, false)
+	if errors.Root(err) != ErrVersionMismatch {
+		t.Errorf("got error %v, want %s", err, ErrVersionMismatch)
+	}
+
+	if _, err = m.FindByAlias(ctx, "satoshi"); errors.Root(err) != pg.ErrUserInputNotFound {
+		t.Errorf("found account by old alias, err = %v", err)
+	}
+	found, err := m.FindByAlias(ctx, alias)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if found.ID != account.ID {
+		t.Errorf("found account %s by new alias, want %s", found.ID, account.ID)
+	}
+}
+
+func TestArchiveAccount(t *testing.T) {
+	_, db := pgtest.NewDB(t, pgtest.SchemaPath)
+	m := NewManager(db, prottest.NewChain(t), nil)
+	ctx := context.Background()
+
+	account, err := m.Create(ctx, []string{dummyXPub}, 1, "", nil, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	control := m.NewControlAction(bc.AssetAmount{AssetID: bc.AssetID{1}, Amount: 1}, account.ID, nil)
+
+	archived, err := m.SetArchived(ctx, account.ID, true)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if !archived.Archived || archived.Version != account.Version+1 {
+		t.Errorf("got archived %t version %d, want true version %d", archived.Archived, archived.Version, account.Version+1)
+	}
+	err = control.Build(ctx, new(txbuilder.TemplateBuilder))
+	if errors.Root(err) != ErrArchived {
+		t.Errorf("got error %v, want %s", err, ErrArchived)
+	}
+
+	_, err = m.SetArchived(ctx, account.ID, false)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = control.Build(ctx, new(txbuilder.TemplateBuilder))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+}
@@ -111,3 +111,17 @@ func (m *Manager) AnnotateTxs(ctx context.Context, txs []map[string]interface{})
 
 	return nil
 }
+
+// accountAnnotations returns the annotations that
+// AnnotateTxs adds for a to the inputs and outputs
+// that it controls.
+func accountAnnotations(a *Account) map[string]interface{} {
+	m := make(map[string]interface{})
+	if len(a.Tags) > 0 {
+		m["account_tags"] = a.Tags
+	}
+	if a.Alias != "" {
+		m["account_alias"] = a.Alias
+	}
+	return m
+}
@@ -34,6 +34,10 @@ type spendAction struct {
 	AccountID     string        `json:"account_id"`
 	ReferenceData chainjson.Map `json:"reference_data"`
 	ClientToken   *string       `json:"client_token"`
+
+	// ApprovalID is required for spends above
+	// the account's approval threshold.
+	ApprovalID *string `json:"approval_id"`
 }
 
 func (a *spendAction) Build(ctx context.Context, b *txbuilder.TemplateBuilder) error {
@@ -52,6 +56,10 @@ func (a *spendAction) Build(ctx context.Context, b *txbuilder.TemplateBuilder) e
 	if err != nil {
 		return errors.Wrap(err, "get account info")
 	}
+	err = a.accounts.checkActive(ctx, a.AccountID)
+	if err != nil {
+		return err
+	}
 
 	src := source{
 		AssetID:   a.AssetID,
@@ -65,6 +73,11 @@ func (a *spendAction) Build(ctx context.Context, b *txbuilder.TemplateBuilder) e
 	// Cancel the reservation if the build gets rolled back.
 	b.OnRollback(canceler(ctx, a.accounts, res.ID))
 
+	err = a.accounts.checkPolicy(ctx, b, a.AccountID, a.AssetAmount, res.ID, a.ApprovalID)
+	if err != nil {
+		return err
+	}
+
 	for _, r := range res.UTXOs {
 		txInput, sigInst, err := utxoToInputs(ctx, acct, r, a.ReferenceData)
 		if err != nil {
@@ -114,6 +127,7 @@ type spendUTXOAction struct {
 
 	ReferenceData chainjson.Map `json:"reference_data"`
 	ClientToken   *string       `json:"client_token"`
+	ApprovalID    *string       `json:"approval_id"`
 }
 
 func (a *spendUTXOAction) Build(ctx context.Context, b *txbuilder.TemplateBuilder) error {
@@ -128,7 +142,18 @@ func (a *spendUTXOAction) Build(ctx context.Context, b *txbuilder.TemplateBuilde
 		return txbuilder.MissingFieldsError(missing...)
 	}
 
+	// Check the output's account before reserving it,
+	// so a spend from an archived account reserves nothing.
 	out := bc.Outpoint{Hash: *a.TxHash, Index: *a.TxOut}
+	u, err := findSpecificUTXO(ctx, a.accounts.db, out)
+	if err != nil {
+		return err
+	}
+	err = a.accounts.checkActive(ctx, u.AccountID)
+	if err != nil {
+		return err
+	}
+
 	res, err := a.accounts.utxoDB.ReserveUTXO(ctx, out, a.ClientToken, b.MaxTime())
 	if err != nil {
 		return err
@@ -139,6 +164,10 @@ func (a *spendUTXOAction) Build(ctx context.Context, b *txbuilder.TemplateBuilde
 	if err != nil {
 		return err
 	}
+	err = a.accounts.checkPolicy(ctx, b, res.Source.AccountID, res.UTXOs[0].AssetAmount, res.ID, a.ApprovalID)
+	if err != nil {
+		return err
+	}
 	txInput, sigInst, err := utxoToInputs(ctx, acct, res.UTXOs[0], a.ReferenceData)
 	if err != nil {
 		return err
@@ -209,6 +238,11 @@ func (a *controlAction) Build(ctx context.Context, b *txbuilder.TemplateBuilder)
 		return txbuilder.MissingFieldsError(missing...)
 	}
 
+	err := a.accounts.checkActive(ctx, a.AccountID)
+	if err != nil {
+		return err
+	}
+
 	// Produce a control program, but don't insert it into the database yet.
 	acp, err := a.accounts.createControlProgram(ctx, a.AccountID, false)
 	if err != nil {
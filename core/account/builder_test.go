@@ -14,6 +14,7 @@ import (
 	"chain/core/txbuilder"
 	"chain/database/pg"
 	"chain/database/pg/pgtest"
+	"chain/errors"
 	"chain/protocol/bc"
 	"chain/protocol/mempool"
 	"chain/protocol/prottest"
@@ -118,6 +119,50 @@ func TestAccountSourceUTXOReserve(t *testing.T) {
 	}
 }
 
+func TestAccountSourceUTXOArchived(t *testing.T) {
+	var (
+		_, db    = pgtest.NewDB(t, pgtest.SchemaPath)
+		ctx      = context.Background()
+		c        = prottest.NewChain(t)
+		p        = mempool.New()
+		pinStore = pin.NewStore(db)
+		accounts = account.NewManager(db, c, pinStore)
+		assets   = asset.NewRegistry(db, c, pinStore)
+		indexer  = query.NewIndexer(db, c, pinStore)
+
+		accID = coretest.CreateAccount(ctx, t, accounts, "", nil)
+		asset = coretest.CreateAsset(ctx, t, assets, nil, "", nil)
+		out   = coretest.IssueAssets(ctx, t, c, p, assets, accounts, asset, 2, accID)
+	)
+
+	coretest.CreatePins(ctx, t, pinStore)
+	assets.IndexAssets(indexer)
+	accounts.IndexAccounts(indexer)
+	go accounts.ProcessBlocks(ctx)
+	prottest.MakeBlock(t, c, p.Dump(ctx))
+	<-pinStore.PinWaiter(account.PinName, c.Height())
+
+	_, err := accounts.SetArchived(ctx, accID, true)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	source := accounts.NewSpendUTXOAction(out.Outpoint)
+	err = source.Build(ctx, new(txbuilder.TemplateBuilder))
+	if errors.Root(err) != account.ErrArchived {
+		t.Fatalf("got error %v, want %s", err, account.ErrArchived)
+	}
+
+	// The failed build must not have left the output reserved.
+	_, err = accounts.SetArchived(ctx, accID, false)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = source.Build(ctx, new(txbuilder.TemplateBuilder))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+}
+
 func TestAccountSourceReserveIdempotency(t *testing.T) {
 	var (
 		_, db    = pgtest.NewDB(t, pgtest.SchemaPath)
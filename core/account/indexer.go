@@ -20,9 +20,13 @@ const PinName = "account"
 // A Saver is responsible for saving an annotated account object.
 // for indexing and retrieval.
 // If the Core is configured not to provide search services,
-// SaveAnnotatedAccount can be a no-op.
+// SaveAnnotatedAccount and Reannotate can be no-ops.
 type Saver interface {
 	SaveAnnotatedAccount(context.Context, string, map[string]interface{}) error
+
+	// Reannotate updates the annotations of indexed
+	// transactions and outputs. See query.Indexer.
+	Reannotate(ctx context.Context, key, value string, remove []string, set map[string]interface{}) error
 }
 
 func (m *Manager) indexAnnotatedAccount(ctx context.Context, a *Account) error {
@@ -42,12 +46,18 @@ func (m *Manager) indexAnnotatedAccount(ctx context.Context, a *Account) error {
 			"account_derivation_path": jsonPath,
 		})
 	}
+	isArchived := "no"
+	if a.Archived {
+		isArchived = "yes"
+	}
 	return m.indexer.SaveAnnotatedAccount(ctx, a.ID, map[string]interface{}{
-		"id":     a.ID,
-		"alias":  a.Alias,
-		"keys":   keys,
-		"tags":   a.Tags,
-		"quorum": a.Quorum,
+		"id":          a.ID,
+		"alias":       a.Alias,
+		"keys":        keys,
+		"tags":        a.Tags,
+		"quorum":      a.Quorum,
+		"version":     a.Version,
+		"is_archived": isArchived,
 	})
 }
 
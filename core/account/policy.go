@@ -0,0 +1,809 @@
+package account
+
+import (
+	"bytes"
+	"context"
+	stdsql "database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+
+	"chain/core/txbuilder"
+	"chain/database/pg"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/log"
+	"chain/math/checked"
+	"chain/protocol/bc"
+)
+
+var (
+	// ErrPolicy is returned when building a transaction
+	// that spends from an account in a way its policy
+	// doesn't allow.
+	ErrPolicy = errors.New("spend violates account policy")
+
+	// ErrApprovalRequired is returned when building a
+	// transaction that spends more than an account's
+	// approval threshold without an approval.
+	ErrApprovalRequired = errors.New("spend requires approval")
+
+	// ErrBadApproval is returned when an approval can't
+	// be used, because it's unapproved, expired, already
+	// used, or for a different spend.
+	ErrBadApproval = errors.New("invalid spend approval")
+
+	// ErrSelfApproval is returned when a client tries to
+	// approve a request it made, or a request made before
+	// the client's access token was created.
+	ErrSelfApproval = errors.New("request must be approved by a different client")
+
+	// ErrBadPolicy is returned by SetPolicy for
+	// an invalid policy.
+	ErrBadPolicy = errors.New("invalid account policy")
+
+	// ErrPolicyApprovalRequired is returned by SetPolicy
+	// when a policy would loosen the account's current
+	// policy and no approval is given.
+	ErrPolicyApprovalRequired = errors.New("policy change requires approval")
+
+	// ErrBadPolicyApproval is returned when a policy approval
+	// can't be used, because it's unapproved, expired, already
+	// used, or for a different policy.
+	ErrBadPolicyApproval = errors.New("invalid policy approval")
+)
+
+// Policy restricts spending from an account. It applies to
+// the spend and spend-UTXO actions of transactions built after
+// it's set. The zero Policy allows any spend.
+type Policy struct {
+	// MaxAmounts is the most of each asset a single
+	// transaction can spend, across all its actions.
+	MaxAmounts map[bc.AssetID]uint64 `json:"max_amounts,omitempty"`
+
+	// VelocityLimits are the most of an asset the account can
+	// spend within a rolling window. Spends count from when
+	// their transaction is built until the window has passed,
+	// whether or not the transaction is submitted.
+	VelocityLimits []VelocityLimit `json:"velocity_limits,omitempty"`
+
+	// AllowedAccounts and AllowedControlPrograms, if either is
+	// set, are the only destinations, besides the account itself,
+	// of outputs in a transaction that spends from the account,
+	// including the outputs of a base transaction. So that outputs
+	// can't be added later, the transaction must pay out all of
+	// each asset spent from the account in the same build.
+	AllowedAccounts        []string             `json:"allowed_accounts,omitempty"`
+	AllowedControlPrograms []chainjson.HexBytes `json:"allowed_control_programs,omitempty"`
+
+	// ApprovalThresholds is the most of each asset a single
+	// transaction can spend without an approval; see
+	// RequestApproval.
+	ApprovalThresholds map[bc.AssetID]uint64 `json:"approval_thresholds,omitempty"`
+}
+
+// VelocityLimit limits the amount of an asset spent within a window.
+type VelocityLimit struct {
+	AssetID bc.AssetID         `json:"asset_id"`
+	Amount  uint64             `json:"amount"`
+	Window  chainjson.Duration `json:"window"`
+}
+
+// SetPolicy sets the policy of the account with the given ID,
+// replacing any policy it had. A nil policy removes it.
+//
+// A policy that allows a spend the current policy doesn't
+// can only be set with the ID of an approval of exactly that
+// policy; see RequestPolicyApproval. The approval is used up.
+// Tightening a policy needs no approval, and approvalID is
+// ignored.
+func (m *Manager) SetPolicy(ctx context.Context, accountID string, p *Policy, approvalID *string) error {
+	policyJSON, err := encodePolicy(p)
+	if err != nil {
+		return err
+	}
+
+	const (
+		lockQ = `SELECT spend_policy FROM accounts WHERE account_id = $1 FOR UPDATE`
+		useQ  = `
+			UPDATE policy_approvals SET used = true
+			WHERE id = $1 AND account_id = $2 AND policy IS NOT DISTINCT FROM $3::jsonb
+				AND approved_by IS NOT NULL AND expires_at > now() AND NOT used
+		`
+		setQ = `UPDATE accounts SET spend_policy = $2 WHERE account_id = $1`
+	)
+
+	// Locking the account keeps a concurrent change
+	// from loosening the policy compared here.
+	dbtx, err := m.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "begin transaction")
+	}
+	defer dbtx.Rollback(ctx)
+
+	var oldJSON []byte
+	err = dbtx.QueryRow(ctx, lockQ, accountID).Scan(&oldJSON)
+	if err == stdsql.ErrNoRows {
+		return errors.WithDetailf(pg.ErrUserInputNotFound, "account id: %s", accountID)
+	} else if err != nil {
+		return errors.Wrap(err, "locking account")
+	}
+	old, err := decodePolicy(oldJSON)
+	if err != nil {
+		return err
+	}
+	if !p.atLeastAsStrict(old) {
+		if approvalID == nil {
+			return errors.WithDetailf(ErrPolicyApprovalRequired, "loosening the policy of account %s requires an approval_id", accountID)
+		}
+		res, err := dbtx.Exec(ctx, useQ, *approvalID, accountID, policyJSON)
+		if err != nil {
+			return errors.Wrap(err, "using policy approval")
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return errors.Wrap(err)
+		}
+		if n == 0 {
+			return errors.WithDetailf(ErrBadPolicyApproval, "approval %s is not an unused, unexpired approval of this policy", *approvalID)
+		}
+	}
+	_, err = dbtx.Exec(ctx, setQ, accountID, policyJSON)
+	if err != nil {
+		return errors.Wrap(err, "saving account policy")
+	}
+	err = dbtx.Commit(ctx)
+	if err != nil {
+		return errors.Wrap(err, "commit transaction")
+	}
+	return nil
+}
+
+// GetPolicy returns the policy of the account with the given ID.
+// If it has none, it returns the zero Policy.
+func (m *Manager) GetPolicy(ctx context.Context, accountID string) (*Policy, error) {
+	const q = `SELECT spend_policy FROM accounts WHERE account_id = $1`
+	var policyJSON []byte
+	err := m.db.QueryRow(ctx, q, accountID).Scan(&policyJSON)
+	if err == stdsql.ErrNoRows {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "account id: %s", accountID)
+	} else if err != nil {
+		return nil, errors.Wrap(err, "loading account policy")
+	}
+	return decodePolicy(policyJSON)
+}
+
+// encodePolicy checks p and returns its JSON,
+// or nil if p is nil.
+func encodePolicy(p *Policy) ([]byte, error) {
+	if p == nil {
+		return nil, nil
+	}
+	for i, l := range p.VelocityLimits {
+		if l.Window.Duration <= 0 {
+			return nil, errors.WithDetailf(ErrBadPolicy, "velocity limit %d has no window", i)
+		}
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return b, nil
+}
+
+// decodePolicy decodes a policy stored as JSON.
+// Empty JSON is the zero Policy.
+func decodePolicy(b []byte) (*Policy, error) {
+	p := new(Policy)
+	if len(b) > 0 {
+		err := json.Unmarshal(b, p)
+		if err != nil {
+			return nil, errors.Wrap(err, "decoding account policy")
+		}
+	}
+	return p, nil
+}
+
+// atLeastAsStrict reports whether p, which may be nil, allows
+// no spend that old forbids, so that replacing old with p
+// doesn't loosen the account's policy. It's conservative:
+// each of old's limits must be matched by a limit of p at
+// least as tight.
+func (p *Policy) atLeastAsStrict(old *Policy) bool {
+	if p == nil {
+		p = new(Policy)
+	}
+	for assetID, max := range old.MaxAmounts {
+		if newMax, ok := p.MaxAmounts[assetID]; !ok || newMax > max {
+			return false
+		}
+	}
+	for assetID, threshold := range old.ApprovalThresholds {
+		if newThreshold, ok := p.ApprovalThresholds[assetID]; !ok || newThreshold > threshold {
+			return false
+		}
+	}
+	for _, l := range old.VelocityLimits {
+		var ok bool
+		for _, newL := range p.VelocityLimits {
+			// A smaller amount over a longer window
+			// bounds every window of the old length.
+			if newL.AssetID == l.AssetID && newL.Amount <= l.Amount && newL.Window.Duration >= l.Window.Duration {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if len(old.AllowedAccounts) > 0 || len(old.AllowedControlPrograms) > 0 {
+		if len(p.AllowedAccounts) == 0 && len(p.AllowedControlPrograms) == 0 {
+			return false
+		}
+		allowed := make(map[string]bool)
+		for _, id := range old.AllowedAccounts {
+			allowed[id] = true
+		}
+		for _, id := range p.AllowedAccounts {
+			if !allowed[id] {
+				return false
+			}
+		}
+		for _, prog := range p.AllowedControlPrograms {
+			var ok bool
+			for _, oldProg := range old.AllowedControlPrograms {
+				if bytes.Equal(prog, oldProg) {
+					ok = true
+					break
+				}
+			}
+			if !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// PolicyApproval is a request to set an account's policy to one
+// that's looser than its current policy. Once approved, by a
+// client other than the one that requested it, it can be used
+// once, by SetPolicy with exactly its policy, before it expires.
+type PolicyApproval struct {
+	ID          string    `json:"id"`
+	AccountID   string    `json:"account_id"`
+	Policy      *Policy   `json:"policy"`
+	RequestedBy string    `json:"requested_by"`
+	RequestedAt time.Time `json:"requested_at"`
+	ApprovedBy  *string   `json:"approved_by"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Used        bool      `json:"used"`
+}
+
+// RequestPolicyApproval records a request, by the client
+// requestedBy, to set the policy of the account with the
+// given ID to p. It expires after ttl, approved or not.
+func (m *Manager) RequestPolicyApproval(ctx context.Context, accountID string, p *Policy, requestedBy string, ttl time.Duration) (*PolicyApproval, error) {
+	policyJSON, err := encodePolicy(p)
+	if err != nil {
+		return nil, err
+	}
+	_, err = m.findByID(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &PolicyApproval{
+		AccountID:   accountID,
+		Policy:      p,
+		RequestedBy: requestedBy,
+		ExpiresAt:   time.Now().Add(ttl),
+	}
+	const q = `
+		INSERT INTO policy_approvals (account_id, policy, requested_by, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, requested_at
+	`
+	err = m.db.QueryRow(ctx, q, accountID, policyJSON, requestedBy, a.ExpiresAt).Scan(&a.ID, &a.RequestedAt)
+	if err != nil {
+		return nil, errors.Wrap(err, "saving policy approval request")
+	}
+	return a, nil
+}
+
+// ApprovePolicy approves the policy approval request with the
+// given ID on behalf of the client approvedBy, subject to the
+// same rules as Approve.
+func (m *Manager) ApprovePolicy(ctx context.Context, id, approvedBy string, approverCreated time.Time) (*PolicyApproval, error) {
+	const (
+		findQ = `
+			SELECT account_id, policy, requested_by, requested_at, expires_at, used
+			FROM policy_approvals WHERE id = $1
+		`
+		approveQ = `
+			UPDATE policy_approvals SET approved_by = $2
+			WHERE id = $1 AND approved_by IS NULL AND expires_at > now()
+		`
+	)
+	var (
+		a          = &PolicyApproval{ID: id}
+		policyJSON []byte
+	)
+	err := m.db.QueryRow(ctx, findQ, id).Scan(&a.AccountID, &policyJSON, &a.RequestedBy, &a.RequestedAt, &a.ExpiresAt, &a.Used)
+	if err == stdsql.ErrNoRows {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "policy approval id: %s", id)
+	} else if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	if len(policyJSON) > 0 {
+		a.Policy, err = decodePolicy(policyJSON)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = checkApprover(id, a.RequestedBy, a.RequestedAt, approvedBy, approverCreated)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := m.db.Exec(ctx, approveQ, id, approvedBy)
+	if err != nil {
+		return nil, errors.Wrap(err, "approving policy")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	if n == 0 {
+		return nil, errors.WithDetailf(ErrBadPolicyApproval, "approval %s is already approved or expired", id)
+	}
+	a.ApprovedBy = &approvedBy
+	return a, nil
+}
+
+// checkApprover checks that the client approvedBy, whose
+// access token was created at approverCreated, may approve
+// the request with the given ID, made by requestedBy at
+// requestedAt. A client can't approve its own requests, nor
+// requests made before its token existed, so a client can't
+// approve its own request with a token it just created.
+func checkApprover(id, requestedBy string, requestedAt time.Time, approvedBy string, approverCreated time.Time) error {
+	if approvedBy == requestedBy {
+		return errors.WithDetailf(ErrSelfApproval, "approval %s was requested by %q", id, approvedBy)
+	}
+	if !approverCreated.Before(requestedAt) {
+		return errors.WithDetailf(ErrSelfApproval, "access token %q was created after approval %s was requested", approvedBy, id)
+	}
+	return nil
+}
+
+// Approval is a request to spend more of an asset from an
+// account than its policy's approval threshold. Once approved,
+// by a client other than the one that requested it, it can be
+// used once, by a transaction spending at most its amount, before
+// it expires.
+type Approval struct {
+	ID        string `json:"id"`
+	AccountID string `json:"account_id"`
+	bc.AssetAmount
+	RequestedBy string    `json:"requested_by"`
+	RequestedAt time.Time `json:"requested_at"`
+	ApprovedBy  *string   `json:"approved_by"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Used        bool      `json:"used"`
+}
+
+// RequestApproval records a request, by the client requestedBy,
+// to spend amt from the account with the given ID. It expires
+// after ttl, approved or not.
+func (m *Manager) RequestApproval(ctx context.Context, accountID string, amt bc.AssetAmount, requestedBy string, ttl time.Duration) (*Approval, error) {
+	_, err := m.findByID(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Approval{
+		AccountID:   accountID,
+		AssetAmount: amt,
+		RequestedBy: requestedBy,
+		ExpiresAt:   time.Now().Add(ttl),
+	}
+	const q = `
+		INSERT INTO spend_approvals (account_id, asset_id, amount, requested_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, requested_at
+	`
+	err = m.db.QueryRow(ctx, q, accountID, amt.AssetID, amt.Amount, requestedBy, a.ExpiresAt).Scan(&a.ID, &a.RequestedAt)
+	if err != nil {
+		return nil, errors.Wrap(err, "saving approval request")
+	}
+	return a, nil
+}
+
+// Approve approves the approval request with the given ID on
+// behalf of the client approvedBy, whose access token was
+// created at approverCreated. The client must not be the one
+// that requested it, and its token must predate the request.
+func (m *Manager) Approve(ctx context.Context, id, approvedBy string, approverCreated time.Time) (*Approval, error) {
+	a, err := m.findApproval(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	err = checkApprover(id, a.RequestedBy, a.RequestedAt, approvedBy, approverCreated)
+	if err != nil {
+		return nil, err
+	}
+
+	const q = `
+		UPDATE spend_approvals SET approved_by = $2
+		WHERE id = $1 AND approved_by IS NULL AND expires_at > now()
+	`
+	res, err := m.db.Exec(ctx, q, id, approvedBy)
+	if err != nil {
+		return nil, errors.Wrap(err, "approving spend")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	if n == 0 {
+		return nil, errors.WithDetailf(ErrBadApproval, "approval %s is already approved or expired", id)
+	}
+	a.ApprovedBy = &approvedBy
+	return a, nil
+}
+
+func (m *Manager) findApproval(ctx context.Context, id string) (*Approval, error) {
+	const q = `
+		SELECT account_id, asset_id, amount, requested_by, requested_at, approved_by, expires_at, used
+		FROM spend_approvals WHERE id = $1
+	`
+	var (
+		a          = &Approval{ID: id}
+		approvedBy stdsql.NullString
+	)
+	err := m.db.QueryRow(ctx, q, id).Scan(&a.AccountID, &a.AssetID, &a.Amount, &a.RequestedBy, &a.RequestedAt, &approvedBy, &a.ExpiresAt, &a.Used)
+	if err == stdsql.ErrNoRows {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "approval id: %s", id)
+	} else if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	if approvedBy.Valid {
+		a.ApprovedBy = &approvedBy.String
+	}
+	return a, nil
+}
+
+// policySpend is the total of an asset spent from an
+// account by the actions of a transaction being built.
+type policySpend struct {
+	accountID  string
+	amt        bc.AssetAmount
+	policy     *Policy
+	rid        uint64 // reservation of the first spend action
+	approvalID *string
+}
+
+// checkPolicy enforces the policy of the account with the given
+// ID on a spend of amt being built with b. The spent UTXOs must
+// already be reserved, under reservation rid, so that they're
+// released if the policy forbids the spend. Any approval used,
+// and the spend's contribution to velocity limits, are undone
+// if the build is rolled back.
+//
+// Limits that apply per transaction are checked once all
+// actions are built, against the total spent by the actions
+// from the account.
+func (m *Manager) checkPolicy(ctx context.Context, b *txbuilder.TemplateBuilder, accountID string, amt bc.AssetAmount, rid uint64, approvalID *string) error {
+	p, err := m.GetPolicy(ctx, accountID)
+	if err != nil {
+		return err
+	}
+
+	err = m.recordSpend(ctx, b, p, accountID, amt, rid)
+	if err != nil {
+		return err
+	}
+
+	m.policySpendsMu.Lock()
+	defer m.policySpendsMu.Unlock()
+	spends, ok := m.policySpends[b]
+	if !ok {
+		b.OnRollback(func() {
+			m.policySpendsMu.Lock()
+			delete(m.policySpends, b)
+			m.policySpendsMu.Unlock()
+		})
+		b.OnBuild(func() error {
+			m.policySpendsMu.Lock()
+			spends := m.policySpends[b]
+			delete(m.policySpends, b)
+			m.policySpendsMu.Unlock()
+			return m.checkTxPolicies(ctx, b, spends)
+		})
+	}
+	for _, s := range spends {
+		if s.accountID != accountID || s.amt.AssetID != amt.AssetID {
+			continue
+		}
+		if approvalID != nil {
+			if s.approvalID != nil && *s.approvalID != *approvalID {
+				return errors.WithDetailf(ErrBadApproval, "spends of asset %s from account %s give different approvals", amt.AssetID, accountID)
+			}
+			s.approvalID = approvalID
+		}
+		s.amt.Amount, ok = checked.AddUint64(s.amt.Amount, amt.Amount)
+		if !ok {
+			return errors.WithDetailf(txbuilder.ErrBadAmount, "spends of asset %s from account %s overflow", amt.AssetID, accountID)
+		}
+		return nil
+	}
+	m.policySpends[b] = append(spends, &policySpend{
+		accountID:  accountID,
+		amt:        amt,
+		policy:     p,
+		rid:        rid,
+		approvalID: approvalID,
+	})
+	return nil
+}
+
+// checkTxPolicies enforces, on the transaction built with b,
+// the per-transaction limits of the policies of the accounts
+// it spends from.
+func (m *Manager) checkTxPolicies(ctx context.Context, b *txbuilder.TemplateBuilder, spends []*policySpend) error {
+	for _, s := range spends {
+		p, accountID, amt := s.policy, s.accountID, s.amt
+
+		if max, ok := p.MaxAmounts[amt.AssetID]; ok && amt.Amount > max {
+			return errors.WithDetailf(ErrPolicy, "account %s can spend at most %d of asset %s in a transaction", accountID, max, amt.AssetID)
+		}
+
+		if threshold, ok := p.ApprovalThresholds[amt.AssetID]; ok && amt.Amount > threshold {
+			if s.approvalID == nil {
+				return errors.WithDetailf(ErrApprovalRequired, "spending more than %d of asset %s from account %s requires an approval_id", threshold, amt.AssetID, accountID)
+			}
+			err := m.useApproval(ctx, b, *s.approvalID, accountID, amt, s.rid)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(p.AllowedAccounts) > 0 || len(p.AllowedControlPrograms) > 0 {
+			err := checkPaidOut(b, accountID, amt.AssetID)
+			if err != nil {
+				return err
+			}
+			err = m.checkDestinations(ctx, b, accountID, p)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// useApproval marks the approval with the given ID as used by a
+// spend of amt from the account, under the reservation ID rid,
+// and marks it unused again if the build is rolled back. Using
+// it again under the same ID, as when a build is retried with
+// the same client token, has no effect.
+func (m *Manager) useApproval(ctx context.Context, b *txbuilder.TemplateBuilder, id, accountID string, amt bc.AssetAmount, rid uint64) error {
+	const (
+		useQ = `
+			UPDATE spend_approvals SET used = true, used_by = $5
+			WHERE id = $1 AND account_id = $2 AND asset_id = $3 AND amount >= $4
+				AND approved_by IS NOT NULL AND expires_at > now() AND NOT used
+		`
+		usedQ = `SELECT 1 FROM spend_approvals WHERE id = $1 AND used_by = $2`
+	)
+	res, err := m.db.Exec(ctx, useQ, id, accountID, amt.AssetID, amt.Amount, rid)
+	if err != nil {
+		return errors.Wrap(err, "using approval")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if n == 0 {
+		var one int
+		err = m.db.QueryRow(ctx, usedQ, id, rid).Scan(&one)
+		if err == stdsql.ErrNoRows {
+			return errors.WithDetailf(ErrBadApproval, "approval %s is not an unused, unexpired approval of this spend", id)
+		} else if err != nil {
+			return errors.Wrap(err, "checking approval")
+		}
+		// This is a retry; the approval
+		// belongs to the original build.
+		return nil
+	}
+
+	b.OnRollback(func() {
+		const q = `UPDATE spend_approvals SET used = false, used_by = NULL WHERE id = $1`
+		_, err := m.db.Exec(ctx, q, id)
+		if err != nil {
+			log.Error(ctx, err, "releasing approval ", id)
+		}
+	})
+	return nil
+}
+
+// checkPaidOut checks that the transaction built with b pays
+// out at least as much of the given asset as it spends, so that
+// the account's spend can't be completed with outputs added in
+// a later build.
+func checkPaidOut(b *txbuilder.TemplateBuilder, accountID string, assetID bc.AssetID) error {
+	var in, out uint64
+	ok := true
+	for _, txin := range b.Inputs() {
+		if ok && txin.AssetID() == assetID {
+			in, ok = checked.AddUint64(in, txin.Amount())
+		}
+	}
+	for _, txout := range b.Outputs() {
+		if ok && txout.AssetID == assetID {
+			out, ok = checked.AddUint64(out, txout.Amount)
+		}
+	}
+	if !ok {
+		return errors.WithDetailf(txbuilder.ErrBadAmount, "amounts of asset %s overflow", assetID)
+	}
+	if in > out {
+		return errors.WithDetailf(ErrPolicy, "a transaction spending asset %s from account %s must pay all of it to outputs", assetID, accountID)
+	}
+	return nil
+}
+
+// recordSpend checks the spend of amt against the account's
+// velocity limits for its asset and, if they allow it, records
+// it under the reservation ID rid. Recording it again under the
+// same ID, as when a build is retried with the same client
+// token, has no effect.
+func (m *Manager) recordSpend(ctx context.Context, b *txbuilder.TemplateBuilder, p *Policy, accountID string, amt bc.AssetAmount, rid uint64) error {
+	var (
+		limits  []VelocityLimit
+		longest time.Duration
+	)
+	for _, l := range p.VelocityLimits {
+		if l.AssetID != amt.AssetID {
+			continue
+		}
+		limits = append(limits, l)
+		if l.Window.Duration > longest {
+			longest = l.Window.Duration
+		}
+	}
+	if len(limits) == 0 {
+		return nil
+	}
+
+	const (
+		lockQ  = `SELECT 1 FROM accounts WHERE account_id = $1 FOR UPDATE`
+		pruneQ = `
+			DELETE FROM account_spends
+			WHERE account_id = $1 AND asset_id = $2 AND spent_at < now() - $3 * interval '1 microsecond'
+		`
+		sumQ = `
+			SELECT COALESCE(SUM(amount), 0) FROM account_spends
+			WHERE account_id = $1 AND asset_id = $2 AND reservation_id <> $3
+				AND spent_at >= now() - $4 * interval '1 microsecond'
+		`
+		insertQ = `
+			INSERT INTO account_spends (reservation_id, account_id, asset_id, amount)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (reservation_id) DO NOTHING
+		`
+	)
+
+	// Locking the account serializes concurrent
+	// spends from it, so none can exceed a limit.
+	dbtx, err := m.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "begin transaction")
+	}
+	defer dbtx.Rollback(ctx)
+
+	var one int
+	err = dbtx.QueryRow(ctx, lockQ, accountID).Scan(&one)
+	if err != nil {
+		return errors.Wrap(err, "locking account")
+	}
+	_, err = dbtx.Exec(ctx, pruneQ, accountID, amt.AssetID, int64(longest/time.Microsecond))
+	if err != nil {
+		return errors.Wrap(err, "pruning spends")
+	}
+	for _, l := range limits {
+		var spent uint64
+		err = dbtx.QueryRow(ctx, sumQ, accountID, amt.AssetID, rid, int64(l.Window.Duration/time.Microsecond)).Scan(&spent)
+		if err != nil {
+			return errors.Wrap(err, "summing spends")
+		}
+		if amt.Amount > l.Amount || spent > l.Amount-amt.Amount {
+			return errors.WithDetailf(ErrPolicy, "account %s can spend at most %d of asset %s every %s; %d already spent", accountID, l.Amount, amt.AssetID, l.Window.Duration, spent)
+		}
+	}
+	res, err := dbtx.Exec(ctx, insertQ, rid, accountID, amt.AssetID, amt.Amount)
+	if err != nil {
+		return errors.Wrap(err, "recording spend")
+	}
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	err = dbtx.Commit(ctx)
+	if err != nil {
+		return errors.Wrap(err, "commit transaction")
+	}
+	if inserted == 0 {
+		// This is a retry; the spend
+		// belongs to the original build.
+		return nil
+	}
+
+	b.OnRollback(func() {
+		const q = `DELETE FROM account_spends WHERE reservation_id = $1`
+		_, err := m.db.Exec(ctx, q, rid)
+		if err != nil {
+			log.Error(ctx, err, "deleting spend ", rid)
+		}
+	})
+	return nil
+}
+
+// checkDestinations checks that every output of the transaction
+// built with b pays to a destination allowed by p, the policy of
+// the account with the given ID. It runs once all actions are built, so the
+// outputs are known. Control programs created by this build
+// may or may not have been saved yet, so they're looked up both
+// among the delayed control programs and in the database.
+func (m *Manager) checkDestinations(ctx context.Context, b *txbuilder.TemplateBuilder, accountID string, p *Policy) error {
+	allowedAccounts := map[string]bool{accountID: true}
+	for _, id := range p.AllowedAccounts {
+		allowedAccounts[id] = true
+	}
+	allowedProgram := func(prog []byte) bool {
+		for _, allowed := range p.AllowedControlPrograms {
+			if bytes.Equal(prog, allowed) {
+				return true
+			}
+		}
+		return false
+	}
+
+	owners := make(map[string]string) // control program -> account ID
+	m.delayedACPsMu.Lock()
+	for _, acp := range m.delayedACPs[b] {
+		owners[string(acp.controlProgram)] = acp.accountID
+	}
+	m.delayedACPsMu.Unlock()
+
+	var unknown pq.ByteaArray
+	for _, out := range b.Outputs() {
+		_, ok := owners[string(out.ControlProgram)]
+		if !ok && !allowedProgram(out.ControlProgram) {
+			unknown = append(unknown, out.ControlProgram)
+		}
+	}
+	if len(unknown) > 0 {
+		const q = `
+			SELECT control_program, signer_id FROM account_control_programs
+			WHERE control_program = ANY($1::bytea[])
+		`
+		err := pg.ForQueryRows(ctx, m.db, q, unknown, func(prog []byte, owner string) {
+			owners[string(prog)] = owner
+		})
+		if err != nil {
+			return errors.Wrap(err, "looking up control programs")
+		}
+	}
+
+	for i, out := range b.Outputs() {
+		if allowedProgram(out.ControlProgram) || allowedAccounts[owners[string(out.ControlProgram)]] {
+			continue
+		}
+		return errors.WithDetailf(ErrPolicy, "output %d pays to a destination not allowed by the policy of account %s", i, accountID)
+	}
+	return nil
+}
@@ -0,0 +1,282 @@
+package account_test
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"chain/core/account"
+	"chain/core/asset"
+	"chain/core/coretest"
+	"chain/core/pin"
+	"chain/core/query"
+	"chain/core/txbuilder"
+	"chain/database/pg/pgtest"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/mempool"
+	"chain/protocol/prottest"
+	"chain/testutil"
+)
+
+func TestSpendPolicy(t *testing.T) {
+	var (
+		_, db    = pgtest.NewDB(t, pgtest.SchemaPath)
+		ctx      = context.Background()
+		c        = prottest.NewChain(t)
+		p        = mempool.New()
+		pinStore = pin.NewStore(db)
+		accounts = account.NewManager(db, c, pinStore)
+		assets   = asset.NewRegistry(db, c, pinStore)
+		indexer  = query.NewIndexer(db, c, pinStore)
+
+		accID   = coretest.CreateAccount(ctx, t, accounts, "", nil)
+		otherID = coretest.CreateAccount(ctx, t, accounts, "", nil)
+		assetID = coretest.CreateAsset(ctx, t, assets, nil, "", nil)
+		_       = coretest.IssueAssets(ctx, t, c, p, assets, accounts, assetID, 5, accID)
+		_       = coretest.IssueAssets(ctx, t, c, p, assets, accounts, assetID, 5, accID)
+		_       = coretest.IssueAssets(ctx, t, c, p, assets, accounts, assetID, 5, accID)
+	)
+
+	coretest.CreatePins(ctx, t, pinStore)
+	assets.IndexAssets(indexer)
+	accounts.IndexAccounts(indexer)
+	go accounts.ProcessBlocks(ctx)
+	prottest.MakeBlock(t, c, p.Dump(ctx))
+	<-pinStore.PinWaiter(account.PinName, c.Height())
+
+	// spendAction spends amount from accID, using the given
+	// approval and client token if they're not empty.
+	spendAction := func(amount uint64, approvalID, clientToken string) txbuilder.Action {
+		req := map[string]interface{}{"account_id": accID, "asset_id": assetID, "amount": amount}
+		if approvalID != "" {
+			req["approval_id"] = approvalID
+		}
+		if clientToken != "" {
+			req["client_token"] = clientToken
+		}
+		reqJSON, err := json.Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a, err := accounts.DecodeSpendAction(reqJSON)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+	// build builds a transaction with the given actions,
+	// returning the first action's error if any failed.
+	build := func(actions ...txbuilder.Action) error {
+		_, err := txbuilder.Build(ctx, nil, actions, time.Now().Add(time.Minute))
+		if errs, ok := errors.Data(err)["actions"].([]error); ok {
+			err = errs[0]
+		}
+		return err
+	}
+	pay := func(amount uint64) txbuilder.Action {
+		return accounts.NewControlAction(bc.AssetAmount{AssetID: assetID, Amount: amount}, otherID, nil)
+	}
+	// spend builds a transaction paying amount from accID to
+	// otherID, using the given approval if it's not empty.
+	spend := func(amount uint64, approvalID string) error {
+		return build(spendAction(amount, approvalID, ""), pay(amount))
+	}
+
+	// loosen sets accID's policy to p, with an
+	// approval requested by alice and approved by bob.
+	loosen := func(p *account.Policy) error {
+		approval, err := accounts.RequestPolicyApproval(ctx, accID, p, "alice", time.Hour)
+		if err != nil {
+			return err
+		}
+		_, err = accounts.ApprovePolicy(ctx, approval.ID, "bob", time.Time{})
+		if err != nil {
+			return err
+		}
+		return accounts.SetPolicy(ctx, accID, p, &approval.ID)
+	}
+
+	err := accounts.SetPolicy(ctx, accID, &account.Policy{
+		MaxAmounts:     map[bc.AssetID]uint64{assetID: 4},
+		VelocityLimits: []account.VelocityLimit{{AssetID: assetID, Amount: 5, Window: chainjson.Duration{Duration: time.Hour}}},
+	}, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = spend(5, "")
+	if errors.Root(err) != account.ErrPolicy {
+		t.Errorf("spend over max amount: got error %v want %s", err, account.ErrPolicy)
+	}
+	err = build(spendAction(2, "", ""), spendAction(3, "", ""), pay(5))
+	if errors.Root(err) != account.ErrPolicy {
+		t.Errorf("split spend over max amount: got error %v want %s", err, account.ErrPolicy)
+	}
+	err = spend(3, "")
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = spend(3, "")
+	if errors.Root(err) != account.ErrPolicy {
+		t.Errorf("spend over velocity limit: got error %v want %s", err, account.ErrPolicy)
+	}
+
+	err = loosen(&account.Policy{AllowedAccounts: []string{accID}})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = spend(1, "")
+	if errors.Root(err) != account.ErrPolicy {
+		t.Errorf("spend to disallowed account: got error %v want %s", err, account.ErrPolicy)
+	}
+	// Without outputs, the spend could be paid
+	// anywhere in a later build.
+	err = build(spendAction(1, "", ""))
+	if errors.Root(err) != account.ErrPolicy {
+		t.Errorf("spend without outputs: got error %v want %s", err, account.ErrPolicy)
+	}
+
+	err = loosen(&account.Policy{ApprovalThresholds: map[bc.AssetID]uint64{assetID: 1}})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = spend(2, "")
+	if errors.Root(err) != account.ErrApprovalRequired {
+		t.Errorf("spend over threshold: got error %v want %s", err, account.ErrApprovalRequired)
+	}
+	err = build(spendAction(1, "", ""), spendAction(1, "", ""), pay(2))
+	if errors.Root(err) != account.ErrApprovalRequired {
+		t.Errorf("split spend over threshold: got error %v want %s", err, account.ErrApprovalRequired)
+	}
+	approval, err := accounts.RequestApproval(ctx, accID, bc.AssetAmount{AssetID: assetID, Amount: 2}, "alice", time.Hour)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = spend(2, approval.ID)
+	if errors.Root(err) != account.ErrBadApproval {
+		t.Errorf("spend with unapproved approval: got error %v want %s", err, account.ErrBadApproval)
+	}
+	_, err = accounts.Approve(ctx, approval.ID, "alice", time.Time{})
+	if errors.Root(err) != account.ErrSelfApproval {
+		t.Errorf("self-approval: got error %v want %s", err, account.ErrSelfApproval)
+	}
+	_, err = accounts.Approve(ctx, approval.ID, "carol", time.Now().Add(time.Hour))
+	if errors.Root(err) != account.ErrSelfApproval {
+		t.Errorf("approval with a newer token: got error %v want %s", err, account.ErrSelfApproval)
+	}
+	_, err = accounts.Approve(ctx, approval.ID, "bob", time.Time{})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = build(spendAction(2, approval.ID, "token"), pay(2))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	// Retrying with the same client token
+	// reuses the original spend's approval.
+	err = build(spendAction(2, approval.ID, "token"), pay(2))
+	if err != nil {
+		t.Errorf("retried spend: got error %v", err)
+	}
+	err = spend(2, approval.ID)
+	if errors.Root(err) != account.ErrBadApproval {
+		t.Errorf("reused approval: got error %v want %s", err, account.ErrBadApproval)
+	}
+}
+
+func TestSetPolicyApproval(t *testing.T) {
+	var (
+		_, db    = pgtest.NewDB(t, pgtest.SchemaPath)
+		ctx      = context.Background()
+		accounts = account.NewManager(db, prottest.NewChain(t), nil)
+		accID    = coretest.CreateAccount(ctx, t, accounts, "", nil)
+		otherID  = coretest.CreateAccount(ctx, t, accounts, "", nil)
+		assetID  = bc.AssetID{1}
+		hour     = chainjson.Duration{Duration: time.Hour}
+	)
+
+	strict := &account.Policy{
+		MaxAmounts:      map[bc.AssetID]uint64{assetID: 5},
+		VelocityLimits:  []account.VelocityLimit{{AssetID: assetID, Amount: 10, Window: hour}},
+		AllowedAccounts: []string{accID, otherID},
+	}
+	err := accounts.SetPolicy(ctx, accID, strict, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	tighter := &account.Policy{
+		MaxAmounts:         map[bc.AssetID]uint64{assetID: 4},
+		VelocityLimits:     []account.VelocityLimit{{AssetID: assetID, Amount: 10, Window: chainjson.Duration{Duration: 2 * time.Hour}}},
+		AllowedAccounts:    []string{otherID},
+		ApprovalThresholds: map[bc.AssetID]uint64{assetID: 1},
+	}
+	err = accounts.SetPolicy(ctx, accID, tighter, nil)
+	if err != nil {
+		t.Errorf("tightening: got error %v", err)
+	}
+
+	looser := []*account.Policy{
+		nil,
+		{VelocityLimits: tighter.VelocityLimits, AllowedAccounts: tighter.AllowedAccounts, ApprovalThresholds: tighter.ApprovalThresholds},
+		{MaxAmounts: map[bc.AssetID]uint64{assetID: 5}, VelocityLimits: tighter.VelocityLimits, AllowedAccounts: tighter.AllowedAccounts, ApprovalThresholds: tighter.ApprovalThresholds},
+		{MaxAmounts: tighter.MaxAmounts, VelocityLimits: []account.VelocityLimit{{AssetID: assetID, Amount: 10, Window: hour}}, AllowedAccounts: tighter.AllowedAccounts, ApprovalThresholds: tighter.ApprovalThresholds},
+		{MaxAmounts: tighter.MaxAmounts, VelocityLimits: tighter.VelocityLimits, AllowedAccounts: []string{accID, otherID}, ApprovalThresholds: tighter.ApprovalThresholds},
+		{MaxAmounts: tighter.MaxAmounts, VelocityLimits: tighter.VelocityLimits, ApprovalThresholds: tighter.ApprovalThresholds},
+		{MaxAmounts: tighter.MaxAmounts, VelocityLimits: tighter.VelocityLimits, AllowedAccounts: tighter.AllowedAccounts},
+	}
+	for i, p := range looser {
+		err = accounts.SetPolicy(ctx, accID, p, nil)
+		if errors.Root(err) != account.ErrPolicyApprovalRequired {
+			t.Errorf("looser policy %d: got error %v want %s", i, err, account.ErrPolicyApprovalRequired)
+		}
+	}
+
+	approval, err := accounts.RequestPolicyApproval(ctx, accID, strict, "alice", time.Hour)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = accounts.SetPolicy(ctx, accID, strict, &approval.ID)
+	if errors.Root(err) != account.ErrBadPolicyApproval {
+		t.Errorf("unapproved approval: got error %v want %s", err, account.ErrBadPolicyApproval)
+	}
+	_, err = accounts.ApprovePolicy(ctx, approval.ID, "alice", time.Time{})
+	if errors.Root(err) != account.ErrSelfApproval {
+		t.Errorf("self-approval: got error %v want %s", err, account.ErrSelfApproval)
+	}
+	_, err = accounts.ApprovePolicy(ctx, approval.ID, "carol", time.Now().Add(time.Hour))
+	if errors.Root(err) != account.ErrSelfApproval {
+		t.Errorf("approval with a newer token: got error %v want %s", err, account.ErrSelfApproval)
+	}
+	_, err = accounts.ApprovePolicy(ctx, approval.ID, "bob", time.Time{})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = accounts.SetPolicy(ctx, accID, nil, &approval.ID)
+	if errors.Root(err) != account.ErrBadPolicyApproval {
+		t.Errorf("approval of a different policy: got error %v want %s", err, account.ErrBadPolicyApproval)
+	}
+	err = accounts.SetPolicy(ctx, accID, strict, &approval.ID)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	got, err := accounts.GetPolicy(ctx, accID)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if !reflect.DeepEqual(got, strict) {
+		t.Errorf("policy = %+v want %+v", got, strict)
+	}
+
+	err = accounts.SetPolicy(ctx, accID, tighter, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = accounts.SetPolicy(ctx, accID, strict, &approval.ID)
+	if errors.Root(err) != account.ErrBadPolicyApproval {
+		t.Errorf("reused approval: got error %v want %s", err, account.ErrBadPolicyApproval)
+	}
+}
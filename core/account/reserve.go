@@ -2,19 +2,18 @@ package account
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
-	"sync"
-	"sync/atomic"
 	"time"
 
+	"github.com/lib/pq"
+
 	"chain/core/pin"
 	"chain/database/pg"
+	"chain/database/sql"
 	"chain/errors"
 	"chain/protocol"
 	"chain/protocol/bc"
 	"chain/protocol/state"
-	"chain/sync/idempotency"
 )
 
 var (
@@ -31,8 +30,17 @@ var (
 	// new change outputs will be created
 	// in sufficient amounts to satisfy the request.
 	ErrReserved = errors.New("reservation found outputs already reserved")
+
+	// ErrSpentReservation is returned when a reservation is
+	// retried with its client token after some of its outputs
+	// have been spent, as when its transaction was submitted.
+	ErrSpentReservation = errors.New("reserved outputs already spent")
 )
 
+// maxReserveAttempts is how many times Reserve selects utxos
+// when others are reserved concurrently.
+const maxReserveAttempts = 3
+
 // utxo describes an individual account utxo.
 type utxo struct {
 	bc.Outpoint
@@ -54,7 +62,7 @@ type source struct {
 }
 
 // reservation describes a reservation of a set of UTXOs belonging
-// to a particular account. Reservations are immutable.
+// to a particular account. Reservations are immutable once saved.
 type reservation struct {
 	ID          uint64
 	Source      source
@@ -64,330 +72,320 @@ type reservation struct {
 	ClientToken *string
 }
 
-func newReserver(db pg.DB, c *protocol.Chain, pinStore *pin.Store) *reserver {
-	return &reserver{
-		c:            c,
-		db:           db,
-		pinStore:     pinStore,
-		reservations: make(map[uint64]*reservation),
-		sources:      make(map[source]*sourceReserver),
-	}
+func newReserver(db *sql.DB, c *protocol.Chain, pinStore *pin.Store) *reserver {
+	return &reserver{c: c, db: db, pinStore: pinStore}
 }
 
 // reserver implements a utxo reserver that stores reservations
-// in-memory. It relies on the account_utxos table for the source of
-// truth of valid UTXOs but tracks which of those UTXOs are reserved
-// in-memory.
-//
-// To reduce latency and prevent deadlock, no two mutexes (either on
-// reserver or sourceReserver) should be held at the same time
+// in the database, so that any cored process can reserve utxos.
+// It relies on the account_utxos table for the source of truth
+// of valid UTXOs, and on the reserved_utxos table for which of
+// those UTXOs are reserved. Reserved UTXOs are available again
+// once ExpireReservations removes their reservation.
 //
 // reserver ensures idempotency of reservations until the reservation
 // expiration.
 type reserver struct {
-	c                 *protocol.Chain
-	db                pg.DB
-	pinStore          *pin.Store
-	nextReservationID uint64
-	idempotency       idempotency.Group
-
-	reservationsMu sync.Mutex
-	reservations   map[uint64]*reservation
-
-	sourcesMu sync.Mutex
-	sources   map[source]*sourceReserver
+	c        *protocol.Chain
+	db       *sql.DB
+	pinStore *pin.Store
 }
 
 // Reserve selects and reserves UTXOs according to the criteria provided
 // in source. The resulting reservation expires at exp.
 func (re *reserver) Reserve(ctx context.Context, src source, amount uint64, clientToken *string, exp time.Time) (*reservation, error) {
-	if clientToken == nil {
-		return re.reserve(ctx, src, amount, clientToken, exp)
+	if clientToken != nil {
+		res, err := re.findByClientToken(ctx, *clientToken)
+		if err != nil || res != nil {
+			return res, err
+		}
 	}
 
-	untypedRes, err := re.idempotency.Once(*clientToken, func() (interface{}, error) {
-		return re.reserve(ctx, src, amount, clientToken, exp)
-	})
-	return untypedRes.(*reservation), err
+	// Another process may reserve some of the selected utxos
+	// first. Try again with the remaining ones.
+	for attempt := 1; ; attempt++ {
+		res, err := re.reserve(ctx, src, amount, clientToken, exp)
+		if err != ErrReserved || attempt == maxReserveAttempts {
+			return res, err
+		}
+	}
 }
 
-func (re *reserver) reserve(ctx context.Context, src source, amount uint64, clientToken *string, exp time.Time) (res *reservation, err error) {
-	sourceReserver := re.source(src)
-
-	// Try to reserve the right amount.
-	rid := atomic.AddUint64(&re.nextReservationID, 1)
-	reserved, total, err := sourceReserver.reserve(ctx, rid, amount)
+func (re *reserver) reserve(ctx context.Context, src source, amount uint64, clientToken *string, exp time.Time) (*reservation, error) {
+	unspent, err := re.utxoChecker(ctx)
+	if err != nil {
+		return nil, err
+	}
+	utxos, reserved, err := findMatchingUTXOs(ctx, re.db, src)
 	if err != nil {
 		return nil, err
 	}
 
-	res = &reservation{
-		ID:          rid,
+	var total, unavailable uint64
+	var selected []*utxo
+	for i, u := range utxos {
+		// If the UTXO is already reserved, skip it.
+		if reserved[i] {
+			unavailable += u.Amount
+			continue
+		}
+		// The index isn't guaranteed to be up to date; the utxo
+		// may have been spent.
+		if !unspent(u) {
+			continue
+		}
+
+		total += u.Amount
+		selected = append(selected, u)
+		if total >= amount {
+			break
+		}
+	}
+	if total+unavailable < amount {
+		// Even if everything was available, this account wouldn't have
+		// enough to satisfy the request.
+		return nil, ErrInsufficient
+	}
+	if total < amount {
+		// The account has enough for the request, but some is tied up in
+		// other reservations.
+		return nil, ErrReserved
+	}
+
+	res := &reservation{
 		Source:      src,
-		UTXOs:       reserved,
+		UTXOs:       selected,
+		Change:      total - amount,
 		Expiry:      exp,
 		ClientToken: clientToken,
 	}
-
-	// Save the successful reservation.
-	re.reservationsMu.Lock()
-	defer re.reservationsMu.Unlock()
-	re.reservations[rid] = res
-
-	// Make change if necessary
-	if total > amount {
-		res.Change = total - amount
-	}
-	return res, nil
+	return re.save(ctx, res)
 }
 
 // ReserveUTXO reserves a specific utxo for spending. The resulting
 // reservation expires at exp.
 func (re *reserver) ReserveUTXO(ctx context.Context, out bc.Outpoint, clientToken *string, exp time.Time) (*reservation, error) {
-	if clientToken == nil {
-		return re.reserveUTXO(ctx, out, exp, nil)
+	if clientToken != nil {
+		res, err := re.findByClientToken(ctx, *clientToken)
+		if err != nil || res != nil {
+			return res, err
+		}
 	}
 
-	untypedRes, err := re.idempotency.Once(*clientToken, func() (interface{}, error) {
-		return re.reserveUTXO(ctx, out, exp, clientToken)
-	})
-	return untypedRes.(*reservation), err
-}
-
-func (re *reserver) reserveUTXO(ctx context.Context, out bc.Outpoint, exp time.Time, clientToken *string) (*reservation, error) {
-	u, err := findSpecificUTXO(ctx, re.db, out)
+	unspent, err := re.utxoChecker(ctx)
 	if err != nil {
 		return nil, err
 	}
-	if !re.checkUTXO(u) {
-		return nil, pg.ErrUserInputNotFound
-	}
-
-	rid := atomic.AddUint64(&re.nextReservationID, 1)
-	err = re.source(u.source()).reserveUTXO(rid, u)
+	u, err := findSpecificUTXO(ctx, re.db, out)
 	if err != nil {
 		return nil, err
 	}
+	if !unspent(u) {
+		return nil, pg.ErrUserInputNotFound
+	}
 
 	res := &reservation{
-		ID:          rid,
 		Source:      u.source(),
 		UTXOs:       []*utxo{u},
 		Expiry:      exp,
 		ClientToken: clientToken,
 	}
-	re.reservationsMu.Lock()
-	re.reservations[rid] = res
-	re.reservationsMu.Unlock()
-	return res, nil
+	return re.save(ctx, res)
 }
 
-// Cancel makes a best-effort attempt at canceling the reservation with
-// the provided ID.
-func (re *reserver) Cancel(ctx context.Context, rid uint64) error {
-	re.reservationsMu.Lock()
-	res, ok := re.reservations[rid]
-	delete(re.reservations, rid)
-	re.reservationsMu.Unlock()
-	if !ok {
-		return fmt.Errorf("couldn't find reservation %d", rid)
+// save records res and reserves its utxos, setting res.ID.
+// If any of the utxos is already reserved, it returns ErrReserved
+// and saves nothing. If a reservation with the same client token
+// was saved concurrently, it returns that reservation instead.
+func (re *reserver) save(ctx context.Context, res *reservation) (*reservation, error) {
+	const (
+		insertReservationQ = `
+			INSERT INTO reservations (account_id, asset_id, change, expiry, client_token)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (client_token) DO NOTHING
+			RETURNING reservation_id
+		`
+		reserveUTXOsQ = `
+			INSERT INTO reserved_utxos (tx_hash, index, reservation_id)
+			SELECT unnest($1::text[]), unnest($2::integer[]), $3
+			ON CONFLICT (tx_hash, index) DO NOTHING
+		`
+	)
+
+	var (
+		txHashes pq.StringArray
+		indexes  pg.Uint32s
+	)
+	for _, u := range res.UTXOs {
+		txHashes = append(txHashes, u.Hash.String())
+		indexes = append(indexes, u.Index)
 	}
-	re.source(res.Source).cancel(res)
-	if res.ClientToken != nil {
-		re.idempotency.Forget(*res.ClientToken)
+
+	dbtx, err := re.db.Begin(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "begin transaction")
 	}
-	return nil
-}
+	defer dbtx.Rollback(ctx)
 
-// ExpireReservations cleans up all reservations that have expired,
-// making their UTXOs available for reservation again.
-func (re *reserver) ExpireReservations(ctx context.Context) error {
-	// Remove records of any reservations that have expired.
-	now := time.Now()
-	var canceled []*reservation
-	re.reservationsMu.Lock()
-	for rid, res := range re.reservations {
-		if res.Expiry.Before(now) {
-			canceled = append(canceled, res)
-			delete(re.reservations, rid)
+	err = dbtx.QueryRow(ctx, insertReservationQ, res.Source.AccountID, res.Source.AssetID, res.Change, res.Expiry, res.ClientToken).Scan(&res.ID)
+	if err == sql.ErrNoRows {
+		// Another reservation with the same client token
+		// was saved since Reserve checked for one.
+		dbtx.Rollback(ctx)
+		existing, err := re.findByClientToken(ctx, *res.ClientToken)
+		if err != nil {
+			return nil, err
 		}
-	}
-	re.reservationsMu.Unlock()
-
-	// If we removed any expired reservations, update the corresponding
-	// source reservers.
-	for _, res := range canceled {
-		re.source(res.Source).cancel(res)
-		if res.ClientToken != nil {
-			re.idempotency.Forget(*res.ClientToken)
+		if existing == nil {
+			// It was canceled in the meantime.
+			return nil, ErrReserved
 		}
+		return existing, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "saving reservation")
 	}
 
-	// TODO(jackson): Cleanup any source reservers that don't have
-	// anything reserved. It'll be a little tricky because of our
-	// locking scheme.
-	return nil
-}
-
-func (re *reserver) checkUTXO(u *utxo) bool {
-	_, s := re.c.State()
-	return s.Tree.ContainsKey(state.OutputKey(u.Outpoint))
-}
-
-func (re *reserver) source(src source) *sourceReserver {
-	re.sourcesMu.Lock()
-	defer re.sourcesMu.Unlock()
-
-	sr, ok := re.sources[src]
-	if ok {
-		return sr
+	dbres, err := dbtx.Exec(ctx, reserveUTXOsQ, txHashes, indexes, res.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "reserving utxos")
 	}
-
-	sr = &sourceReserver{
-		db:      re.db,
-		src:     src,
-		validFn: re.checkUTXO,
-		heightFn: func() uint64 {
-			return re.pinStore.Height(PinName)
-		},
-		cached:   make(map[bc.Outpoint]*utxo),
-		reserved: make(map[bc.Outpoint]uint64),
+	n, err := dbres.RowsAffected()
+	if err != nil {
+		return nil, errors.Wrap(err, "reserving utxos")
 	}
-	re.sources[src] = sr
-	return sr
-}
-
-type sourceReserver struct {
-	db       pg.DB
-	src      source
-	validFn  func(u *utxo) bool
-	heightFn func() uint64
-
-	mu         sync.Mutex
-	cached     map[bc.Outpoint]*utxo
-	reserved   map[bc.Outpoint]uint64
-	lastHeight uint64
-}
-
-func (sr *sourceReserver) reserve(ctx context.Context, rid uint64, amount uint64) ([]*utxo, uint64, error) {
-	reservedUTXOs, reservedAmount, err := sr.reserveFromCache(rid, amount)
-	if err == nil {
-		return reservedUTXOs, reservedAmount, nil
+	if n < int64(len(res.UTXOs)) {
+		// Another process reserved some of the utxos since
+		// they were selected.
+		return nil, ErrReserved
 	}
 
-	// Find the set of UTXOs that match this source.
-	err = sr.refillCache(ctx)
+	err = dbtx.Commit(ctx)
 	if err != nil {
-		return nil, 0, err
+		return nil, errors.Wrap(err, "commit transaction")
 	}
-
-	return sr.reserveFromCache(rid, amount)
+	return res, nil
 }
 
-func (sr *sourceReserver) reserveFromCache(rid uint64, amount uint64) ([]*utxo, uint64, error) {
-	var (
-		reserved, unavailable uint64
-		reservedUTXOs         []*utxo
-	)
-	sr.mu.Lock()
-	defer sr.mu.Unlock()
-
-	for o, u := range sr.cached {
-		// If the UTXO is already reserved, skip it.
-		if _, ok := sr.reserved[u.Outpoint]; ok {
-			unavailable += u.Amount
-			continue
-		}
-		// Cached utxos aren't guaranteed to still be valid; they may
-		// have been spent. Verify that that the outputs are still in
-		// the state tree.
-		if !sr.validFn(u) {
-			delete(sr.cached, o)
-			continue
-		}
-
-		reserved += u.Amount
-		reservedUTXOs = append(reservedUTXOs, u)
-		if reserved >= amount {
-			break
-		}
-	}
-	if reserved+unavailable < amount {
-		// Even if everything was available, this account wouldn't have
-		// enough to satisfy the request.
-		return nil, 0, ErrInsufficient
-	}
-	if reserved < amount {
-		// The account has enough for the request, but some is tied up in
-		// other reservations.
-		return nil, 0, ErrReserved
+// findByClientToken returns the reservation with the
+// given client token, or nil if there is none. If any of
+// its utxos has since been spent, it returns
+// ErrSpentReservation.
+func (re *reserver) findByClientToken(ctx context.Context, clientToken string) (*reservation, error) {
+	const q = `
+		SELECT reservation_id, account_id, asset_id, change, expiry,
+			(SELECT COUNT(*) FROM reserved_utxos r WHERE r.reservation_id = reservations.reservation_id)
+		FROM reservations
+		WHERE client_token = $1
+	`
+	var nreserved int
+	res := &reservation{ClientToken: &clientToken}
+	err := re.db.QueryRow(ctx, q, clientToken).Scan(&res.ID, &res.Source.AccountID, &res.Source.AssetID, &res.Change, &res.Expiry, &nreserved)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "looking up reservation")
 	}
 
-	// We've found enough to satisfy the request.
-	for _, u := range reservedUTXOs {
-		sr.reserved[u.Outpoint] = rid
+	const utxosQ = `
+		SELECT u.tx_hash, u.index, u.amount, u.control_program_index, u.control_program
+		FROM reserved_utxos r
+		JOIN account_utxos u ON (u.tx_hash, u.index) = (r.tx_hash, r.index)
+		WHERE r.reservation_id = $1
+	`
+	err = pg.ForQueryRows(ctx, re.db, utxosQ, res.ID,
+		func(txHash bc.Hash, index uint32, amount uint64, cpIndex uint64, controlProg []byte) {
+			res.UTXOs = append(res.UTXOs, &utxo{
+				Outpoint: bc.Outpoint{
+					Hash:  txHash,
+					Index: index,
+				},
+				AssetAmount: bc.AssetAmount{
+					Amount:  amount,
+					AssetID: res.Source.AssetID,
+				},
+				ControlProgram:      controlProg,
+				AccountID:           res.Source.AccountID,
+				ControlProgramIndex: cpIndex,
+			})
+		})
+	if err != nil {
+		return nil, errors.Wrap(err, "looking up reserved utxos")
 	}
-
-	return reservedUTXOs, reserved, nil
+	if len(res.UTXOs) < nreserved {
+		return nil, errors.WithDetailf(ErrSpentReservation, "reservation with client token %q", clientToken)
+	}
+	return res, nil
 }
 
-func (sr *sourceReserver) reserveUTXO(rid uint64, utxo *utxo) error {
-	sr.mu.Lock()
-	defer sr.mu.Unlock()
-
-	_, isReserved := sr.reserved[utxo.Outpoint]
-	if isReserved {
-		return ErrReserved
+// Cancel makes a best-effort attempt at canceling the reservation with
+// the provided ID.
+func (re *reserver) Cancel(ctx context.Context, rid uint64) error {
+	const q = `DELETE FROM reservations WHERE reservation_id = $1`
+	dbres, err := re.db.Exec(ctx, q, rid)
+	if err != nil {
+		return errors.Wrap(err, "canceling reservation")
+	}
+	n, err := dbres.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "canceling reservation")
+	}
+	if n == 0 {
+		return fmt.Errorf("couldn't find reservation %d", rid)
 	}
-
-	sr.reserved[utxo.Outpoint] = rid
 	return nil
 }
 
-func (sr *sourceReserver) cancel(res *reservation) {
-	sr.mu.Lock()
-	defer sr.mu.Unlock()
-	for _, utxo := range res.UTXOs {
-		delete(sr.reserved, utxo.Outpoint)
-	}
+// ExpireReservations cleans up all reservations that have expired,
+// making their UTXOs available for reservation again.
+func (re *reserver) ExpireReservations(ctx context.Context) error {
+	const q = `DELETE FROM reservations WHERE expiry < CURRENT_TIMESTAMP`
+	_, err := re.db.Exec(ctx, q)
+	return errors.Wrap(err, "deleting expired reservations")
 }
 
-func (sr *sourceReserver) refillCache(ctx context.Context) error {
-	sr.mu.Lock()
-	lastHeight := sr.lastHeight
-	sr.mu.Unlock()
-
-	curHeight := sr.heightFn()
-	if lastHeight >= curHeight {
-		return nil
-	}
-
-	utxos, err := findMatchingUTXOs(ctx, sr.db, sr.src, lastHeight)
-	if err != nil {
-		return errors.Wrap(err)
+// utxoChecker returns a function that reports whether a utxo
+// found in account_utxos is unspent.
+//
+// The leader's state tree is current, so it checks utxos
+// against that. Other processes' state trees are stale or
+// missing, as is a light client's, so they instead wait for
+// account_utxos to be updated through the latest block, and
+// trust it.
+func (re *reserver) utxoChecker(ctx context.Context) (func(*utxo) bool, error) {
+	height := re.c.Height()
+	block, s := re.c.State()
+	if block != nil && s != nil && block.Height == height {
+		return func(u *utxo) bool {
+			return s.Tree.ContainsKey(state.OutputKey(u.Outpoint))
+		}, nil
 	}
 
-	sr.mu.Lock()
-	if curHeight > sr.lastHeight {
-		sr.lastHeight = curHeight
-	}
-	for _, u := range utxos {
-		sr.cached[u.Outpoint] = u
+	if re.pinStore != nil {
+		select {
+		case <-re.pinStore.PinWaiter(PinName, height):
+		case <-ctx.Done():
+			return nil, errors.Wrap(ctx.Err(), "waiting for account utxos")
+		}
 	}
-	sr.mu.Unlock()
-
-	return nil
+	return func(*utxo) bool { return true }, nil
 }
 
-func findMatchingUTXOs(ctx context.Context, db pg.DB, src source, height uint64) ([]*utxo, error) {
+// findMatchingUTXOs returns the utxos that match src,
+// and whether each is reserved.
+func findMatchingUTXOs(ctx context.Context, db pg.DB, src source) ([]*utxo, []bool, error) {
 	const q = `
-		SELECT tx_hash, index, amount, control_program_index, control_program
-		FROM account_utxos
-		WHERE account_id = $1 AND asset_id = $2 AND confirmed_in > $3
+		SELECT u.tx_hash, u.index, u.amount, u.control_program_index, u.control_program,
+			r.reservation_id IS NOT NULL
+		FROM account_utxos u
+		LEFT JOIN reserved_utxos r ON (r.tx_hash, r.index) = (u.tx_hash, u.index)
+		WHERE u.account_id = $1 AND u.asset_id = $2
 	`
-	var utxos []*utxo
-	err := pg.ForQueryRows(ctx, db, q, src.AccountID, src.AssetID, height,
-		func(txHash bc.Hash, index uint32, amount uint64, cpIndex uint64, controlProg []byte) {
+	var (
+		utxos    []*utxo
+		reserved []bool
+	)
+	err := pg.ForQueryRows(ctx, db, q, src.AccountID, src.AssetID,
+		func(txHash bc.Hash, index uint32, amount uint64, cpIndex uint64, controlProg []byte, isReserved bool) {
 			utxos = append(utxos, &utxo{
 				Outpoint: bc.Outpoint{
 					Hash:  txHash,
@@ -401,11 +399,12 @@ func findMatchingUTXOs(ctx context.Context, db pg.DB, src source, height uint64)
 				AccountID:           src.AccountID,
 				ControlProgramIndex: cpIndex,
 			})
+			reserved = append(reserved, isReserved)
 		})
 	if err != nil {
-		return nil, errors.Wrap(err)
+		return nil, nil, errors.Wrap(err)
 	}
-	return utxos, nil
+	return utxos, reserved, nil
 }
 
 func findSpecificUTXO(ctx context.Context, db pg.DB, out bc.Outpoint) (*utxo, error) {
@@ -5,8 +5,12 @@ import (
 	"testing"
 	"time"
 
+	"chain/core/pin"
 	"chain/database/pg/pgtest"
+	"chain/errors"
+	"chain/protocol"
 	"chain/protocol/bc"
+	"chain/protocol/memstore"
 	"chain/protocol/prottest"
 	"chain/protocol/state"
 )
@@ -74,3 +78,198 @@ func TestCancelReservation(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestReserveSharedAcrossReservers(t *testing.T) {
+	ctx := context.Background()
+	_, db := pgtest.NewDB(t, pgtest.SchemaPath)
+
+	_, err := db.Exec(ctx, sampleAccountUTXOs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var assetID bc.AssetID
+	err = assetID.UnmarshalText([]byte("df1df9d4f66437ab5be715e4d1faeb29d24c80a6dc8276d6a630f05c5f1f7693"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := source{AssetID: assetID, AccountID: "accEXAMPLE"}
+
+	// Reservers in two different cored processes: the
+	// leader, with a state tree, and another process
+	// sharing its store, without one.
+	store := memstore.New()
+	leader := prottest.NewChainWithStorage(t, store)
+	other, err := protocol.NewChain(ctx, leader.InitialBlockHash, store, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinStore := pin.NewStore(db)
+	err = pinStore.CreatePin(ctx, PinName, leader.Height())
+	if err != nil {
+		t.Fatal(err)
+	}
+	re1, re2 := newReserver(db, leader, pinStore), newReserver(db, other, pinStore)
+
+	// Fake the output in the state tree.
+	utxos, _, err := findMatchingUTXOs(ctx, db, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, s := leader.State()
+	err = s.Tree.Insert(state.OutputKey(utxos[0].Outpoint), []byte{0xc0, 0x01, 0xca, 0xfe})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := "a-client-token"
+	res, err := re1.Reserve(ctx, src, 600, &token, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Change != 400 {
+		t.Errorf("change = %d want 400", res.Change)
+	}
+
+	// The same client token gets the same reservation.
+	res2, err := re2.Reserve(ctx, src, 600, &token, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res2.ID != res.ID || len(res2.UTXOs) != 1 || res2.Change != res.Change {
+		t.Errorf("got reservation %d with %d utxos, want %d with 1", res2.ID, len(res2.UTXOs), res.ID)
+	}
+
+	_, err = re2.Reserve(ctx, src, 600, nil, time.Now().Add(time.Minute))
+	if err != ErrReserved {
+		t.Fatalf("got=%s want=%s", err, ErrReserved)
+	}
+
+	err = re2.Cancel(ctx, res.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = re2.Reserve(ctx, src, 600, nil, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReserveStaleState(t *testing.T) {
+	ctx := context.Background()
+	_, db := pgtest.NewDB(t, pgtest.SchemaPath)
+
+	_, err := db.Exec(ctx, sampleAccountUTXOs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var assetID bc.AssetID
+	err = assetID.UnmarshalText([]byte("df1df9d4f66437ab5be715e4d1faeb29d24c80a6dc8276d6a630f05c5f1f7693"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := source{AssetID: assetID, AccountID: "accEXAMPLE"}
+
+	// A deposed leader: its state tree is at block 1,
+	// but another process has since committed block 2.
+	store := memstore.New()
+	b1, err := protocol.NewInitialBlock(nil, 0, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	heights := make(chan uint64, 1)
+	c, err := protocol.NewChain(ctx, b1.Hash(), store, heights)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.CommitBlock(ctx, b1, state.Empty())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2, _, err := c.GenerateBlock(ctx, b1, state.Empty(), time.Now(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.SaveBlock(ctx, b2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	heights <- 2
+	<-c.BlockWaiter(2)
+
+	// Until account_utxos is up to date, the
+	// reserver must wait.
+	pinStore := pin.NewStore(db)
+	err = pinStore.CreatePin(ctx, PinName, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	re := newReserver(db, c, pinStore)
+	waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = re.Reserve(waitCtx, src, 600, nil, time.Now().Add(time.Minute))
+	if errors.Root(err) != context.DeadlineExceeded {
+		t.Fatalf("got=%v want=%s", err, context.DeadlineExceeded)
+	}
+
+	// The utxo, from block 2, isn't in the stale state
+	// tree. Once account_utxos is up to date, it is
+	// trusted instead.
+	re = newReserver(db, c, nil)
+	res, err := re.Reserve(ctx, src, 600, nil, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.UTXOs) != 1 {
+		t.Errorf("got %d utxos, want 1", len(res.UTXOs))
+	}
+}
+
+func TestReserveSpentReplay(t *testing.T) {
+	ctx := context.Background()
+	c := prottest.NewChain(t)
+	_, db := pgtest.NewDB(t, pgtest.SchemaPath)
+
+	_, err := db.Exec(ctx, sampleAccountUTXOs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var assetID bc.AssetID
+	err = assetID.UnmarshalText([]byte("df1df9d4f66437ab5be715e4d1faeb29d24c80a6dc8276d6a630f05c5f1f7693"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := source{AssetID: assetID, AccountID: "accEXAMPLE"}
+	re := newReserver(db, c, nil)
+
+	// Fake the output in the state tree.
+	utxos, _, err := findMatchingUTXOs(ctx, db, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, s := c.State()
+	err = s.Tree.Insert(state.OutputKey(utxos[0].Outpoint), []byte{0xc0, 0x01, 0xca, 0xfe})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := "a-client-token"
+	_, err = re.Reserve(ctx, src, 600, &token, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Spend the utxo, as when the reservation's
+	// transaction lands in a block.
+	_, err = db.Exec(ctx, `DELETE FROM account_utxos`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = re.Reserve(ctx, src, 600, &token, time.Now().Add(time.Minute))
+	if errors.Root(err) != ErrSpentReservation {
+		t.Fatalf("got=%v want=%s", err, ErrSpentReservation)
+	}
+}
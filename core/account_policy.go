@@ -0,0 +1,163 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"chain/core/accesstoken"
+	"chain/core/account"
+	"chain/core/txbuilder"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/net/http/httpjson"
+	"chain/protocol/bc"
+)
+
+// defaultApprovalTTL is how long a spend or policy
+// approval request lasts if the request doesn't say.
+const defaultApprovalTTL = 24 * time.Hour
+
+// Account policies and approvals separate the duties of clients,
+// which are identified by their access tokens. A client can
+// tighten a policy alone, but loosening one, or spending over an
+// approval threshold, needs the approval of another client whose
+// access token existed before the request was made, so a client
+// can't approve its own request with a token it creates. Any
+// client token can create tokens, sign with the MockHSM, and
+// submit transactions built elsewhere, so policies only separate
+// duties among clients that are given distinct tokens and don't
+// have those powers outside the Core; they don't stop one person
+// who holds two tokens.
+
+// POST /set-account-policy
+//
+// set-account-policy sets the spend policy of an account, replacing
+// any policy it had. /build-transaction rejects spend and spend-UTXO
+// actions from the account that exceed the policy's max_amounts or
+// velocity_limits, that pay to destinations outside its
+// allowed_accounts and allowed_control_programs, or that exceed its
+// approval_thresholds without an approval_id; see
+// /request-spend-approval. A missing policy removes the policy.
+//
+// A policy that would allow any spend the current policy forbids
+// needs the approval_id of an approval of exactly that policy; see
+// /request-account-policy-approval.
+func (h *Handler) setAccountPolicy(ctx context.Context, req struct {
+	AccountID  string          `json:"account_id"`
+	Policy     *account.Policy `json:"policy"`
+	ApprovalID *string         `json:"approval_id"`
+}) (*account.Policy, error) {
+	if req.AccountID == "" {
+		return nil, txbuilder.MissingFieldsError("account_id")
+	}
+	err := h.Accounts.SetPolicy(ctx, req.AccountID, req.Policy, req.ApprovalID)
+	if err != nil {
+		return nil, err
+	}
+	if req.Policy == nil {
+		return new(account.Policy), nil
+	}
+	return req.Policy, nil
+}
+
+// POST /get-account-policy
+func (h *Handler) getAccountPolicy(ctx context.Context, req struct {
+	AccountID string `json:"account_id"`
+}) (*account.Policy, error) {
+	if req.AccountID == "" {
+		return nil, txbuilder.MissingFieldsError("account_id")
+	}
+	return h.Accounts.GetPolicy(ctx, req.AccountID)
+}
+
+// POST /request-spend-approval
+//
+// request-spend-approval requests approval to spend more of an asset
+// from an account than its policy's approval threshold. Another
+// client, authenticated with a different access token, must approve
+// it with /approve-spend before its id can be used as the
+// approval_id of a spend action.
+func (h *Handler) requestSpendApproval(ctx context.Context, req struct {
+	AccountID string `json:"account_id"`
+	bc.AssetAmount
+	TTL chainjson.Duration `json:"ttl"`
+}) (*account.Approval, error) {
+	var missing []string
+	if req.AccountID == "" {
+		missing = append(missing, "account_id")
+	}
+	if req.AssetID == (bc.AssetID{}) {
+		missing = append(missing, "asset_id")
+	}
+	if len(missing) > 0 {
+		return nil, txbuilder.MissingFieldsError(missing...)
+	}
+	ttl := req.TTL.Duration
+	if ttl == 0 {
+		ttl = defaultApprovalTTL
+	}
+	requestedBy, _, _ := httpjson.Request(ctx).BasicAuth()
+	return h.Accounts.RequestApproval(ctx, req.AccountID, req.AssetAmount, requestedBy, ttl)
+}
+
+// POST /approve-spend
+func (h *Handler) approveSpend(ctx context.Context, req struct {
+	ID string `json:"id"`
+}) (*account.Approval, error) {
+	if req.ID == "" {
+		return nil, txbuilder.MissingFieldsError("id")
+	}
+	approver, err := h.approver(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.Accounts.Approve(ctx, req.ID, approver.ID, approver.Created)
+}
+
+// POST /request-account-policy-approval
+//
+// request-account-policy-approval requests approval to set an
+// account's policy to one that's looser than its current policy.
+// Another client, authenticated with a different access token,
+// must approve it with /approve-account-policy before its id can be
+// used as the approval_id of /set-account-policy.
+func (h *Handler) requestAccountPolicyApproval(ctx context.Context, req struct {
+	AccountID string             `json:"account_id"`
+	Policy    *account.Policy    `json:"policy"`
+	TTL       chainjson.Duration `json:"ttl"`
+}) (*account.PolicyApproval, error) {
+	if req.AccountID == "" {
+		return nil, txbuilder.MissingFieldsError("account_id")
+	}
+	ttl := req.TTL.Duration
+	if ttl == 0 {
+		ttl = defaultApprovalTTL
+	}
+	requestedBy, _, _ := httpjson.Request(ctx).BasicAuth()
+	return h.Accounts.RequestPolicyApproval(ctx, req.AccountID, req.Policy, requestedBy, ttl)
+}
+
+// POST /approve-account-policy
+func (h *Handler) approveAccountPolicy(ctx context.Context, req struct {
+	ID string `json:"id"`
+}) (*account.PolicyApproval, error) {
+	if req.ID == "" {
+		return nil, txbuilder.MissingFieldsError("id")
+	}
+	approver, err := h.approver(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.Accounts.ApprovePolicy(ctx, req.ID, approver.ID, approver.Created)
+}
+
+// approver returns the access token that authenticated
+// the request in ctx. Only requests made with an access
+// token can approve anything.
+func (h *Handler) approver(ctx context.Context) (*accesstoken.Token, error) {
+	id, _, ok := httpjson.Request(ctx).BasicAuth()
+	if !ok {
+		return nil, errors.WithDetail(errNotAuthenticated, "approvals require an access token")
+	}
+	return h.AccessTokens.Get(ctx, id)
+}
@@ -4,17 +4,21 @@ import (
 	"context"
 	"sync"
 
+	"chain/core/account"
 	"chain/core/signers"
+	"chain/core/txbuilder"
 	"chain/net/http/reqid"
 )
 
 // This type enforces JSON field ordering in API output.
 type accountResponse struct {
-	ID     interface{} `json:"id"`
-	Alias  interface{} `json:"alias"`
-	Keys   interface{} `json:"keys"`
-	Quorum interface{} `json:"quorum"`
-	Tags   interface{} `json:"tags"`
+	ID         interface{} `json:"id"`
+	Alias      interface{} `json:"alias"`
+	Keys       interface{} `json:"keys"`
+	Quorum     interface{} `json:"quorum"`
+	Tags       interface{} `json:"tags"`
+	IsArchived interface{} `json:"is_archived"`
+	Version    interface{} `json:"version"`
 }
 
 type accountKey struct {
@@ -51,25 +55,126 @@ func (h *Handler) createAccount(ctx context.Context, ins []struct {
 				responses[i] = err
 				return
 			}
-			path := signers.Path(acc.Signer, signers.AccountKeySpace)
-			var keys []accountKey
-			for _, xpub := range acc.XPubs {
-				keys = append(keys, accountKey{
-					RootXPub:              xpub,
-					AccountXPub:           xpub.Derive(path),
-					AccountDerivationPath: path,
-				})
+			responses[i] = newAccountResponse(acc)
+		}(i)
+	}
+
+	wg.Wait()
+	return responses
+}
+
+// POST /update-account
+//
+// update-account changes the alias and tags of accounts. Each
+// update must give the account's current version, as returned by
+// /create-account, /list-accounts or a previous update; if the
+// account has changed since, the update fails. A missing alias or
+// tags field is left unchanged. If backfill is true, the account
+// annotations of indexed transactions and outputs are updated too.
+func (h *Handler) updateAccount(ctx context.Context, ins []struct {
+	ID       string                  `json:"id"`
+	Version  uint64                  `json:"version"`
+	Alias    *string                 `json:"alias"`
+	Tags     *map[string]interface{} `json:"tags"`
+	Backfill bool                    `json:"backfill"`
+}) interface{} {
+	responses := make([]interface{}, len(ins))
+	var wg sync.WaitGroup
+	wg.Add(len(responses))
+
+	for i := range responses {
+		go func(i int) {
+			subctx := reqid.NewSubContext(ctx, reqid.New())
+			defer wg.Done()
+			defer batchRecover(subctx, &responses[i])
+
+			if ins[i].ID == "" {
+				responses[i] = txbuilder.MissingFieldsError("id")
+				return
+			}
+			acc, err := h.Accounts.Update(subctx, ins[i].ID, ins[i].Version, ins[i].Alias, ins[i].Tags, ins[i].Backfill)
+			if err != nil {
+				responses[i] = err
+				return
+			}
+			responses[i] = newAccountResponse(acc)
+		}(i)
+	}
+
+	wg.Wait()
+	return responses
+}
+
+// POST /archive-account
+//
+// archive-account archives accounts. Transactions can't be built
+// to spend from or pay to an archived account, but its history is
+// kept. Archived accounts can be excluded from /list-accounts with
+// the filter is_archived='no'.
+func (h *Handler) archiveAccount(ctx context.Context, ins []struct {
+	ID string `json:"id"`
+}) interface{} {
+	return h.setAccountsArchived(ctx, ins, true)
+}
+
+// POST /unarchive-account
+func (h *Handler) unarchiveAccount(ctx context.Context, ins []struct {
+	ID string `json:"id"`
+}) interface{} {
+	return h.setAccountsArchived(ctx, ins, false)
+}
+
+func (h *Handler) setAccountsArchived(ctx context.Context, ins []struct {
+	ID string `json:"id"`
+}, archived bool) interface{} {
+	responses := make([]interface{}, len(ins))
+	var wg sync.WaitGroup
+	wg.Add(len(responses))
+
+	for i := range responses {
+		go func(i int) {
+			subctx := reqid.NewSubContext(ctx, reqid.New())
+			defer wg.Done()
+			defer batchRecover(subctx, &responses[i])
+
+			if ins[i].ID == "" {
+				responses[i] = txbuilder.MissingFieldsError("id")
+				return
 			}
-			responses[i] = &accountResponse{
-				ID:     acc.ID,
-				Alias:  acc.Alias,
-				Keys:   keys,
-				Quorum: acc.Quorum,
-				Tags:   acc.Tags,
+			acc, err := h.Accounts.SetArchived(subctx, ins[i].ID, archived)
+			if err != nil {
+				responses[i] = err
+				return
 			}
+			responses[i] = newAccountResponse(acc)
 		}(i)
 	}
 
 	wg.Wait()
 	return responses
 }
+
+func newAccountResponse(acc *account.Account) *accountResponse {
+	path := signers.Path(acc.Signer, signers.AccountKeySpace)
+	var keys []accountKey
+	for _, xpub := range acc.XPubs {
+		keys = append(keys, accountKey{
+			RootXPub:              xpub,
+			AccountXPub:           xpub.Derive(path),
+			AccountDerivationPath: path,
+		})
+	}
+	isArchived := "no"
+	if acc.Archived {
+		isArchived = "yes"
+	}
+	return &accountResponse{
+		ID:         acc.ID,
+		Alias:      acc.Alias,
+		Keys:       keys,
+		Quorum:     acc.Quorum,
+		Tags:       acc.Tags,
+		IsArchived: isArchived,
+		Version:    acc.Version,
+	}
+}
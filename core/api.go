@@ -18,10 +18,13 @@ import (
 	"chain/core/mockhsm"
 	"chain/core/pin"
 	"chain/core/query"
+	"chain/core/refdata"
 	"chain/core/rpc"
+	"chain/core/schedule"
 	"chain/core/txbuilder"
 	"chain/core/txdb"
 	"chain/core/txfeed"
+	"chain/core/txstatus"
 	"chain/database/pg"
 	"chain/encoding/json"
 	"chain/errors"
@@ -49,21 +52,39 @@ var (
 	errLeaderElection = errors.New("no leader; pending election")
 )
 
+// BlockStore is the storage for blocks and state snapshots
+// that a Handler serves to other Cores. It is satisfied by
+// *txdb.Store and *filestore.Store.
+type BlockStore interface {
+	protocol.Store
+	GetRawBlock(ctx context.Context, height uint64) ([]byte, error)
+	LatestSnapshotInfo(ctx context.Context) (height uint64, size uint64, err error)
+	GetSnapshot(ctx context.Context, height uint64) ([]byte, error)
+	SnapshotChain(ctx context.Context, height uint64) ([]txdb.SnapshotPart, error)
+	GetSnapshotPart(ctx context.Context, height uint64) ([]byte, error)
+	PrunedHeight(ctx context.Context) (uint64, error)
+}
+
 // Handler serves the Chain HTTP API
 type Handler struct {
 	Chain         *protocol.Chain
-	Store         *txdb.Store
+	Store         BlockStore
 	PinStore      *pin.Store
 	Assets        *asset.Registry
 	Accounts      *account.Manager
 	HSM           *mockhsm.HSM
 	Indexer       *query.Indexer
 	TxFeeds       *txfeed.Tracker
+	TxStatus      *txstatus.Tracker
+	Schedule      *schedule.Scheduler
+	RefData       *refdata.Registry
 	AccessTokens  *accesstoken.CredentialStore
 	Config        *config.Config
 	Submitter     txbuilder.Submitter
 	DB            pg.DB
 	Addr          string
+	IndexTxs      bool
+	LightMode     bool
 	AltAuth       func(*http.Request) bool
 	Signer        func(context.Context, *bc.Block) ([]byte, error)
 	RequestLimits []RequestLimit
@@ -74,6 +95,8 @@ type Handler struct {
 
 	healthMu     sync.Mutex
 	healthErrors map[string]interface{}
+
+	blockParamsMu sync.Mutex // protects block parameters in Config
 }
 
 type RequestLimit struct {
@@ -99,9 +122,14 @@ func (h *Handler) init() {
 	h.actionDecoders = map[string]func(data []byte) (txbuilder.Action, error){
 		"control_account":                h.Accounts.DecodeControlAction,
 		"control_program":                txbuilder.DecodeControlProgramAction,
+		"control_time_lock":              txbuilder.DecodeControlTimeLockAction,
+		"control_hash_lock":              txbuilder.DecodeControlHashLockAction,
+		"control_escrow":                 txbuilder.DecodeControlEscrowAction,
+		"control_predicate":              txbuilder.DecodeControlPredicateAction,
 		"issue":                          h.Assets.DecodeIssueAction,
 		"spend_account":                  h.Accounts.DecodeSpendAction,
 		"spend_account_unspent_output":   h.Accounts.DecodeSpendUTXOAction,
+		"spend_contract":                 txbuilder.DecodeSpendContractAction,
 		"set_transaction_reference_data": txbuilder.DecodeSetTxRefDataAction,
 	}
 
@@ -113,13 +141,37 @@ func (h *Handler) init() {
 		}
 	}
 
+	// A core in light mode stores partial blocks
+	// and no snapshots, so it serves neither.
+	serveBlocks := func(handler http.Handler) http.Handler {
+		if h.LightMode {
+			return alwaysError(errLightMode)
+		}
+		return handler
+	}
+
 	m := http.NewServeMux()
 	m.Handle("/", alwaysError(errNotFound))
 
 	m.Handle("/create-account", needConfig(h.createAccount))
 	m.Handle("/create-asset", needConfig(h.createAsset))
+	m.Handle("/update-account", needConfig(h.updateAccount))
+	m.Handle("/update-asset", needConfig(h.updateAsset))
+	m.Handle("/archive-account", needConfig(h.archiveAccount))
+	m.Handle("/unarchive-account", needConfig(h.unarchiveAccount))
+	m.Handle("/set-account-policy", needConfig(h.setAccountPolicy))
+	m.Handle("/get-account-policy", needConfig(h.getAccountPolicy))
+	m.Handle("/request-spend-approval", needConfig(h.requestSpendApproval))
+	m.Handle("/approve-spend", needConfig(h.approveSpend))
+	m.Handle("/request-account-policy-approval", needConfig(h.requestAccountPolicyApproval))
+	m.Handle("/approve-account-policy", needConfig(h.approveAccountPolicy))
+	m.Handle("/archive-asset", needConfig(h.archiveAsset))
+	m.Handle("/unarchive-asset", needConfig(h.unarchiveAsset))
 	m.Handle("/build-transaction", needConfig(h.build))
 	m.Handle("/submit-transaction", needConfig(h.submit))
+	m.Handle("/get-transaction-status", needConfig(h.getTxStatus))
+	m.Handle("/create-offer", needConfig(h.createOffer))
+	m.Handle("/accept-offer", needConfig(h.acceptOffer))
 	m.Handle("/create-control-program", needConfig(h.createControlProgram))
 	m.Handle("/create-transaction-feed", needConfig(h.createTxFeed))
 	m.Handle("/get-transaction-feed", needConfig(h.getTxFeed))
@@ -136,20 +188,43 @@ func (h *Handler) init() {
 	m.Handle("/list-balances", needConfig(h.listBalances))
 	m.Handle("/list-unspent-outputs", needConfig(h.listUnspentOutputs))
 	m.Handle("/reset", needConfig(h.reset))
+	m.Handle("/update-block-parameters", needConfig(h.updateBlockParams))
+	m.Handle("/step-down", needConfig(h.stepDown))
+	m.Handle("/reindex-transactions", needConfig(h.reindexTransactions))
+	m.Handle("/set-reference-data-schema", needConfig(h.setRefDataSchema))
+	m.Handle("/delete-reference-data-schema", needConfig(h.deleteRefDataSchema))
+	m.Handle("/list-reference-data-schemas", needConfig(h.listRefDataSchemas))
+	m.Handle("/create-scheduled-transaction", needConfig(h.createScheduledTx))
+	m.Handle("/get-scheduled-transaction", needConfig(h.getScheduledTx))
+	m.Handle("/update-scheduled-transaction", needConfig(h.updateScheduledTx))
+	m.Handle("/delete-scheduled-transaction", needConfig(h.deleteScheduledTx))
+	m.Handle("/list-scheduled-transactions", needConfig(h.listScheduledTxs))
+	m.Handle("/list-scheduled-transaction-runs", needConfig(h.listScheduledTxRuns))
+	m.Handle("/get-output-proof", needConfig(h.getOutputProof))
+	m.Handle("/get-transaction-proof", needConfig(h.getTxProof))
 
 	m.Handle(networkRPCPrefix+"submit", needConfig(func(ctx context.Context, tx *bc.Tx) error {
 		return h.Submitter.Submit(ctx, tx)
 	}))
-	m.Handle(networkRPCPrefix+"get-blocks", needConfig(h.getBlocksRPC)) // DEPRECATED: use get-block instead
-	m.Handle(networkRPCPrefix+"get-block", needConfig(h.getBlockRPC))
-	m.Handle(networkRPCPrefix+"get-snapshot-info", needConfig(h.getSnapshotInfoRPC))
-	m.Handle(networkRPCPrefix+"get-snapshot", http.HandlerFunc(h.getSnapshotRPC))
+	m.Handle(networkRPCPrefix+"get-blocks", serveBlocks(needConfig(h.getBlocksRPC))) // DEPRECATED: use get-block instead
+	m.Handle(networkRPCPrefix+"get-block", serveBlocks(needConfig(h.getBlockRPC)))
+	m.Handle(networkRPCPrefix+"get-block-range", serveBlocks(http.HandlerFunc(h.getBlockRangeRPC)))
+	m.Handle(networkRPCPrefix+"get-light-block", serveBlocks(needConfig(h.getLightBlockRPC)))
+	m.Handle(networkRPCPrefix+"get-snapshot-info", serveBlocks(needConfig(h.getSnapshotInfoRPC)))
+	m.Handle(networkRPCPrefix+"get-snapshot", serveBlocks(http.HandlerFunc(h.getSnapshotRPC)))
+	m.Handle(networkRPCPrefix+"get-snapshot-part", serveBlocks(http.HandlerFunc(h.getSnapshotPartRPC)))
 	m.Handle(networkRPCPrefix+"signer/sign-block", needConfig(h.leaderSignHandler(h.Signer)))
-	m.Handle(networkRPCPrefix+"block-height", needConfig(func(ctx context.Context) map[string]uint64 {
-		h := h.Chain.Height()
-		return map[string]uint64{
-			"block_height": h,
+	m.Handle(networkRPCPrefix+"block-height", needConfig(func(ctx context.Context) (map[string]uint64, error) {
+		// Peers don't ask for blocks below
+		// pruned_height, except the initial block.
+		pruned, err := h.Store.PrunedHeight(ctx)
+		if err != nil {
+			return nil, err
 		}
+		return map[string]uint64{
+			"block_height":  h.Chain.Height(),
+			"pruned_height": pruned,
+		}, nil
 	}))
 
 	m.Handle("/create-access-token", jsonHandler(h.createAccessToken))
@@ -226,6 +301,10 @@ type requestQuery struct {
 
 	// Aliases is used to filter results from /mockshm/list-keys
 	Aliases []string `json:"aliases,omitempty"`
+
+	// ID is used to select the scheduled transaction
+	// whose runs /list-scheduled-transaction-runs lists
+	ID string `json:"id,omitempty"`
 }
 
 // Used as a response object for api queries
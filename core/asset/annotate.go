@@ -134,3 +134,17 @@ func (reg *Registry) AnnotateTxs(ctx context.Context, txs []map[string]interface
 	}
 	return nil
 }
+
+// assetAnnotations returns the annotations that
+// AnnotateTxs adds for a to the inputs and outputs
+// of its units.
+func assetAnnotations(a *Asset) map[string]interface{} {
+	m := map[string]interface{}{"asset_tags": a.Tags}
+	if a.Tags == nil {
+		m["asset_tags"] = map[string]interface{}{}
+	}
+	if a.Alias != nil {
+		m["asset_alias"] = *a.Alias
+	}
+	return m
+}
@@ -27,7 +27,17 @@ import (
 
 const maxAssetCache = 1000
 
-var ErrDuplicateAlias = errors.New("duplicate asset alias")
+var (
+	ErrDuplicateAlias = errors.New("duplicate asset alias")
+
+	// ErrVersionMismatch is returned by Update when the
+	// asset has changed since the given version.
+	ErrVersionMismatch = errors.New("asset version mismatch")
+
+	// ErrArchived is returned when building a transaction
+	// that issues an archived asset.
+	ErrArchived = errors.New("asset is archived")
+)
 
 func NewRegistry(db pg.DB, chain *protocol.Chain, pinStore *pin.Store) *Registry {
 	return &Registry{
@@ -36,7 +46,6 @@ func NewRegistry(db pg.DB, chain *protocol.Chain, pinStore *pin.Store) *Registry
 		initialBlockHash: chain.InitialBlockHash,
 		pinStore:         pinStore,
 		cache:            lru.New(maxAssetCache),
-		aliasCache:       lru.New(maxAssetCache),
 	}
 }
 
@@ -48,12 +57,13 @@ type Registry struct {
 	initialBlockHash bc.Hash
 	pinStore         *pin.Store
 
-	idGroup    singleflight.Group
-	aliasGroup singleflight.Group
+	idGroup singleflight.Group
 
-	cacheMu    sync.Mutex
-	cache      *lru.Cache
-	aliasCache *lru.Cache
+	// Assets' signers and issuance programs never change,
+	// so they're cached. The aliases, tags and versions of
+	// cached assets may be out of date.
+	cacheMu sync.Mutex
+	cache   *lru.Cache
 }
 
 func (reg *Registry) IndexAssets(indexer Saver) {
@@ -68,6 +78,8 @@ type Asset struct {
 	InitialBlockHash bc.Hash
 	Signer           *signers.Signer
 	Tags             map[string]interface{}
+	Version          uint64
+	Archived         bool
 	sortID           string
 }
 
@@ -147,28 +159,133 @@ func (reg *Registry) findByID(ctx context.Context, id bc.AssetID) (*Asset, error
 // FindByAlias retrieves an Asset record along with its signer,
 // given an asset alias.
 func (reg *Registry) FindByAlias(ctx context.Context, alias string) (*Asset, error) {
+	a, err := assetQuery(ctx, reg.db, "assets.alias=$1", alias)
+	if err != nil {
+		return nil, err
+	}
 	reg.cacheMu.Lock()
-	cachedID, ok := reg.aliasCache.Get(alias)
+	reg.cache.Add(a.AssetID, a)
 	reg.cacheMu.Unlock()
-	if ok {
-		return reg.findByID(ctx, cachedID.(bc.AssetID))
+	return a, nil
+}
+
+// Update changes the alias and tags of the asset with the given
+// ID, provided it is still at the given version. A nil alias or tags
+// leaves that field unchanged; an empty alias removes the alias.
+// It re-indexes the annotated asset and returns the updated asset
+// with its new version. If backfill is true, it also updates the
+// asset annotations of indexed transactions and outputs.
+func (reg *Registry) Update(ctx context.Context, id bc.AssetID, version uint64, alias *string, tags *map[string]interface{}, backfill bool) (*Asset, error) {
+	a, err := assetQuery(ctx, reg.db, "assets.id=$1", id)
+	if err != nil {
+		return nil, err
+	}
+	if a.Version != version {
+		return nil, errors.WithDetailf(ErrVersionMismatch, "asset is at version %d", a.Version)
+	}
+	if alias != nil {
+		a.Alias = alias
+		if *alias == "" {
+			a.Alias = nil
+		}
+	}
+	if tags != nil {
+		a.Tags = *tags
 	}
 
-	untypedAsset, err := reg.aliasGroup.Do(alias, func() (interface{}, error) {
-		asset, err := assetQuery(ctx, reg.db, "assets.alias=$1", alias)
-		return asset, err
-	})
+	tagsParam, err := mapToNullString(a.Tags)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	// The alias, which is in assets, and the tags,
+	// which are in asset_tags, change together.
+	const q = `
+		WITH updated AS (
+			UPDATE assets SET alias = $3, version = version + 1
+			WHERE id = $1 AND version = $2
+			RETURNING id, version
+		), tags AS (
+			INSERT INTO asset_tags (asset_id, tags) SELECT id, $4 FROM updated
+			ON CONFLICT (asset_id) DO UPDATE SET tags = EXCLUDED.tags
+		)
+		SELECT version FROM updated
+	`
+	err = reg.db.QueryRow(ctx, q, id, version, a.Alias, tagsParam).Scan(&a.Version)
+	if pg.IsUniqueViolation(err) {
+		return nil, errors.WithDetail(ErrDuplicateAlias, "an asset with the provided alias already exists")
+	} else if err == sql.ErrNoRows {
+		// Another update won the race.
+		return nil, errors.WithDetail(ErrVersionMismatch, "asset was updated concurrently")
+	} else if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	reg.cacheMu.Lock()
+	reg.cache.Add(a.AssetID, a)
+	reg.cacheMu.Unlock()
+
+	err = reg.indexAnnotatedAsset(ctx, a)
+	if err != nil {
+		return nil, errors.Wrap(err, "indexing annotated asset")
+	}
+	if backfill && reg.indexer != nil {
+		err = reg.indexer.Reannotate(ctx, "asset_id", a.AssetID.String(), []string{"asset_alias", "asset_tags"}, assetAnnotations(a))
+		if err != nil {
+			return nil, errors.Wrap(err, "back-filling asset annotations")
+		}
+	}
+	return a, nil
+}
+
+// SetArchived archives or unarchives the asset with the given ID.
+// An archived asset can't be issued, but existing units of it can
+// still be spent, and it can be unarchived. SetArchived re-indexes
+// the annotated asset and returns the asset with its new version.
+func (reg *Registry) SetArchived(ctx context.Context, id bc.AssetID, archived bool) (*Asset, error) {
+	a, err := assetQuery(ctx, reg.db, "assets.id=$1", id)
 	if err != nil {
 		return nil, err
 	}
 
-	a := untypedAsset.(*Asset)
+	const q = `
+		UPDATE assets SET archived = $2, version = version + 1
+		WHERE id = $1
+		RETURNING version
+	`
+	err = reg.db.QueryRow(ctx, q, id, archived).Scan(&a.Version)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	a.Archived = archived
+
 	reg.cacheMu.Lock()
-	reg.aliasCache.Add(alias, a.AssetID)
 	reg.cache.Add(a.AssetID, a)
 	reg.cacheMu.Unlock()
+
+	err = reg.indexAnnotatedAsset(ctx, a)
+	if err != nil {
+		return nil, errors.Wrap(err, "indexing annotated asset")
+	}
 	return a, nil
+}
 
+// checkActive returns ErrArchived if the asset with the given ID
+// is archived. Cached assets may be out of date, so it always
+// queries the database.
+func (reg *Registry) checkActive(ctx context.Context, id bc.AssetID) error {
+	const q = `SELECT archived FROM assets WHERE id = $1`
+	var archived bool
+	err := reg.db.QueryRow(ctx, q, id).Scan(&archived)
+	if err == sql.ErrNoRows {
+		return errors.WithDetailf(pg.ErrUserInputNotFound, "missing asset with ID %q", id)
+	} else if err != nil {
+		return errors.Wrap(err)
+	}
+	if archived {
+		return errors.WithDetailf(ErrArchived, "asset id: %s", id)
+	}
+	return nil
 }
 
 // insertAsset adds the asset to the database. If the asset has a client token,
@@ -180,7 +297,7 @@ func (reg *Registry) insertAsset(ctx context.Context, asset *Asset, clientToken
 			(id, alias, signer_id, initial_block_hash, issuance_program, definition, client_token)
 		VALUES($1, $2, $3, $4, $5, $6, $7)
 		ON CONFLICT (client_token) DO NOTHING
-		RETURNING sort_id
+		RETURNING sort_id, version
   `
 	defParams, err := mapToNullString(asset.Definition)
 	if err != nil {
@@ -197,7 +314,7 @@ func (reg *Registry) insertAsset(ctx context.Context, asset *Asset, clientToken
 		asset.AssetID, asset.Alias, signerID,
 		asset.InitialBlockHash, asset.IssuanceProgram,
 		defParams, clientToken,
-	).Scan(&asset.sortID)
+	).Scan(&asset.sortID, &asset.Version)
 
 	if pg.IsUniqueViolation(err) {
 		return nil, errors.WithDetail(ErrDuplicateAlias, "an asset with the provided alias already exists")
@@ -242,7 +359,7 @@ func assetByClientToken(ctx context.Context, db pg.DB, clientToken string) (*Ass
 func assetQuery(ctx context.Context, db pg.DB, pred string, args ...interface{}) (*Asset, error) {
 	const baseQ = `
 		SELECT assets.id, assets.alias, assets.issuance_program, assets.definition,
-			assets.initial_block_hash, assets.sort_id,
+			assets.initial_block_hash, assets.sort_id, assets.version, assets.archived,
 			signers.id, COALESCE(signers.type, ''), COALESCE(signers.xpubs, '{}'),
 			COALESCE(signers.quorum, 0), COALESCE(signers.key_index, 0),
 			asset_tags.tags
@@ -270,6 +387,8 @@ func assetQuery(ctx context.Context, db pg.DB, pred string, args ...interface{})
 		&definition,
 		&a.InitialBlockHash,
 		&a.sortID,
+		&a.Version,
+		&a.Archived,
 		&signerID,
 		&signerType,
 		(*pq.StringArray)(&xpubs),
@@ -5,7 +5,10 @@ import (
 	"reflect"
 	"testing"
 
+	"chain/core/txbuilder"
 	"chain/database/pg/pgtest"
+	"chain/errors"
+	"chain/protocol/bc"
 	"chain/protocol/prottest"
 	"chain/testutil"
 )
@@ -92,3 +95,66 @@ func TestAssetByClientToken(t *testing.T) {
 		t.Fatalf("assetByClientToken(\"test_token\")=%x, want %x", found.AssetID[:], asset.AssetID[:])
 	}
 }
+
+func TestUpdateAsset(t *testing.T) {
+	r := NewRegistry(pgtest.NewTx(t), prottest.NewChain(t), nil)
+	ctx := context.Background()
+
+	keys := []string{testutil.TestXPub.String()}
+	asset, err := r.Define(ctx, keys, 1, nil, "gold", map[string]interface{}{"unit": "oz"}, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	tags := map[string]interface{}{"unit": "g"}
+	updated, err := r.Update(ctx, asset.AssetID, asset.Version, nil, &tags, false)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if updated.Version != asset.Version+1 {
+		t.Errorf("version = %d want %d", updated.Version, asset.Version+1)
+	}
+
+	got, err := r.FindByAlias(ctx, "gold")
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if !reflect.DeepEqual(got.Tags, tags) || got.Version != updated.Version {
+		t.Errorf("got tags %v version %d, want %v version %d", got.Tags, got.Version, tags, updated.Version)
+	}
+
+	_, err = r.Update(ctx, asset.AssetID, asset.Version, nil, &tags, false)
+	if errors.Root(err) != ErrVersionMismatch {
+		t.Errorf("got error %v, want %s", err, ErrVersionMismatch)
+	}
+}
+
+func TestArchiveAsset(t *testing.T) {
+	r := NewRegistry(pgtest.NewTx(t), prottest.NewChain(t), nil)
+	ctx := context.Background()
+
+	keys := []string{testutil.TestXPub.String()}
+	asset, err := r.Define(ctx, keys, 1, nil, "", nil, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	issue := r.NewIssueAction(bc.AssetAmount{AssetID: asset.AssetID, Amount: 1}, nil)
+
+	_, err = r.SetArchived(ctx, asset.AssetID, true)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = issue.Build(ctx, new(txbuilder.TemplateBuilder))
+	if errors.Root(err) != ErrArchived {
+		t.Errorf("got error %v, want %s", err, ErrArchived)
+	}
+
+	_, err = r.SetArchived(ctx, asset.AssetID, false)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = issue.Build(ctx, new(txbuilder.TemplateBuilder))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+}
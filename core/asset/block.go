@@ -20,15 +20,23 @@ const PinName = "asset"
 // A Saver is responsible for saving an annotated asset object
 // for indexing and retrieval.
 // If the Core is configured not to provide search services,
-// SaveAnnotatedAsset can be a no-op.
+// SaveAnnotatedAsset and Reannotate can be no-ops.
 type Saver interface {
 	SaveAnnotatedAsset(context.Context, bc.AssetID, map[string]interface{}, string) error
+
+	// Reannotate updates the annotations of indexed
+	// transactions and outputs. See query.Indexer.
+	Reannotate(ctx context.Context, key, value string, remove []string, set map[string]interface{}) error
 }
 
 func (reg *Registry) indexAnnotatedAsset(ctx context.Context, a *Asset) error {
 	if reg.indexer == nil {
 		return nil
 	}
+	isArchived := "no"
+	if a.Archived {
+		isArchived = "yes"
+	}
 	m := map[string]interface{}{
 		"id":               a.AssetID,
 		"alias":            a.Alias,
@@ -36,6 +44,8 @@ func (reg *Registry) indexAnnotatedAsset(ctx context.Context, a *Asset) error {
 		"issuance_program": json.HexBytes(a.IssuanceProgram),
 		"tags":             a.Tags,
 		"is_local":         "no",
+		"version":          a.Version,
+		"is_archived":      isArchived,
 	}
 	if a.Signer != nil {
 		var keys []map[string]interface{}
@@ -141,7 +151,8 @@ func (reg *Registry) indexAssets(ctx context.Context, b *bc.Block) error {
 	// assets. We need to index them as annotated assets too.
 	for _, assetID := range newAssetIDs {
 		// TODO(jackson): Batch the asset lookups.
-		a, err := reg.findByID(ctx, assetID)
+		// Don't use the cache; its tags may be out of date.
+		a, err := assetQuery(ctx, reg.db, "assets.id=$1", assetID)
 		if err != nil {
 			return errors.Wrap(err, "looking up new asset")
 		}
@@ -20,6 +20,10 @@ func (f fakeSaver) SaveAnnotatedAsset(ctx context.Context, assetID bc.AssetID, o
 	return f(ctx, assetID, obj, sortID)
 }
 
+func (f fakeSaver) Reannotate(ctx context.Context, key, value string, remove []string, set map[string]interface{}) error {
+	return nil
+}
+
 func TestIndexNonLocalAssets(t *testing.T) {
 	r := NewRegistry(pgtest.NewTx(t), prottest.NewChain(t), nil)
 	ctx := context.Background()
@@ -94,6 +98,7 @@ func TestIndexNonLocalAssets(t *testing.T) {
 		},
 		IssuanceProgram:  issuanceProgram,
 		InitialBlockHash: r.initialBlockHash,
+		Version:          1,
 		sortID:           got.sortID,
 	}
 	if !reflect.DeepEqual(got, want) {
@@ -46,6 +46,10 @@ func (a *issueAction) Build(ctx context.Context, builder *txbuilder.TemplateBuil
 	if err != nil {
 		return err
 	}
+	err = a.assets.checkActive(ctx, a.AssetID)
+	if err != nil {
+		return err
+	}
 
 	var nonce [8]byte
 	_, err = rand.Read(nonce[:])
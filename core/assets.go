@@ -4,9 +4,12 @@ import (
 	"context"
 	"sync"
 
+	"chain/core/asset"
 	"chain/core/signers"
+	"chain/core/txbuilder"
 	"chain/encoding/json"
 	"chain/net/http/reqid"
+	"chain/protocol/bc"
 )
 
 // This type enforces JSON field ordering in API output.
@@ -19,6 +22,8 @@ type assetResponse struct {
 	Definition      interface{} `json:"definition"`
 	Tags            interface{} `json:"tags"`
 	IsLocal         interface{} `json:"is_local"`
+	IsArchived      interface{} `json:"is_archived"`
+	Version         interface{} `json:"version"`
 }
 
 type assetKey struct {
@@ -64,29 +69,132 @@ func (h *Handler) createAsset(ctx context.Context, ins []struct {
 				responses[i] = err
 				return
 			}
-			var keys []assetKey
-			for _, xpub := range asset.Signer.XPubs {
-				path := signers.Path(asset.Signer, signers.AssetKeySpace)
-				derived := xpub.Derive(path)
-				keys = append(keys, assetKey{
-					AssetPubkey:         json.HexBytes(derived[:]),
-					RootXPub:            xpub,
-					AssetDerivationPath: path,
-				})
+			responses[i] = newAssetResponse(asset)
+		}(i)
+	}
+
+	wg.Wait()
+	return responses, nil
+}
+
+// POST /update-asset
+//
+// update-asset changes the alias and tags of assets. Each update
+// must give the asset's current version, as returned by /create-asset,
+// /list-assets or a previous update; if the asset has changed since,
+// the update fails. A missing alias or tags field is left unchanged.
+// If backfill is true, the asset annotations of indexed transactions
+// and outputs are updated too.
+func (h *Handler) updateAsset(ctx context.Context, ins []struct {
+	ID       bc.AssetID              `json:"id"`
+	Version  uint64                  `json:"version"`
+	Alias    *string                 `json:"alias"`
+	Tags     *map[string]interface{} `json:"tags"`
+	Backfill bool                    `json:"backfill"`
+}) interface{} {
+	responses := make([]interface{}, len(ins))
+	var wg sync.WaitGroup
+	wg.Add(len(responses))
+
+	for i := range responses {
+		go func(i int) {
+			subctx := reqid.NewSubContext(ctx, reqid.New())
+			defer wg.Done()
+			defer batchRecover(subctx, &responses[i])
+
+			if ins[i].ID == (bc.AssetID{}) {
+				responses[i] = txbuilder.MissingFieldsError("id")
+				return
 			}
-			responses[i] = &assetResponse{
-				ID:              asset.AssetID,
-				Alias:           asset.Alias,
-				IssuanceProgram: asset.IssuanceProgram,
-				Keys:            keys,
-				Quorum:          asset.Signer.Quorum,
-				Definition:      asset.Definition,
-				Tags:            asset.Tags,
-				IsLocal:         "yes",
+			asset, err := h.Assets.Update(subctx, ins[i].ID, ins[i].Version, ins[i].Alias, ins[i].Tags, ins[i].Backfill)
+			if err != nil {
+				responses[i] = err
+				return
 			}
+			responses[i] = newAssetResponse(asset)
 		}(i)
 	}
 
 	wg.Wait()
-	return responses, nil
+	return responses
+}
+
+// POST /archive-asset
+//
+// archive-asset archives assets. An archived asset can't be issued,
+// but existing units of it can still be spent. Archived assets can
+// be excluded from /list-assets with the filter is_archived='no'.
+func (h *Handler) archiveAsset(ctx context.Context, ins []struct {
+	ID bc.AssetID `json:"id"`
+}) interface{} {
+	return h.setAssetsArchived(ctx, ins, true)
+}
+
+// POST /unarchive-asset
+func (h *Handler) unarchiveAsset(ctx context.Context, ins []struct {
+	ID bc.AssetID `json:"id"`
+}) interface{} {
+	return h.setAssetsArchived(ctx, ins, false)
+}
+
+func (h *Handler) setAssetsArchived(ctx context.Context, ins []struct {
+	ID bc.AssetID `json:"id"`
+}, archived bool) interface{} {
+	responses := make([]interface{}, len(ins))
+	var wg sync.WaitGroup
+	wg.Add(len(responses))
+
+	for i := range responses {
+		go func(i int) {
+			subctx := reqid.NewSubContext(ctx, reqid.New())
+			defer wg.Done()
+			defer batchRecover(subctx, &responses[i])
+
+			if ins[i].ID == (bc.AssetID{}) {
+				responses[i] = txbuilder.MissingFieldsError("id")
+				return
+			}
+			asset, err := h.Assets.SetArchived(subctx, ins[i].ID, archived)
+			if err != nil {
+				responses[i] = err
+				return
+			}
+			responses[i] = newAssetResponse(asset)
+		}(i)
+	}
+
+	wg.Wait()
+	return responses
+}
+
+func newAssetResponse(a *asset.Asset) *assetResponse {
+	r := &assetResponse{
+		ID:              a.AssetID,
+		Alias:           a.Alias,
+		IssuanceProgram: a.IssuanceProgram,
+		Definition:      a.Definition,
+		Tags:            a.Tags,
+		IsLocal:         "no",
+		IsArchived:      "no",
+		Version:         a.Version,
+	}
+	if a.Archived {
+		r.IsArchived = "yes"
+	}
+	if a.Signer != nil {
+		var keys []assetKey
+		for _, xpub := range a.Signer.XPubs {
+			path := signers.Path(a.Signer, signers.AssetKeySpace)
+			derived := xpub.Derive(path)
+			keys = append(keys, assetKey{
+				AssetPubkey:         json.HexBytes(derived[:]),
+				RootXPub:            xpub,
+				AssetDerivationPath: path,
+			})
+		}
+		r.Keys = keys
+		r.Quorum = a.Signer.Quorum
+		r.IsLocal = "yes"
+	}
+	return r
 }
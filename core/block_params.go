@@ -0,0 +1,104 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"chain/core/config"
+	"chain/core/leader"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol"
+)
+
+type blockParams struct {
+	BlockPeriod   chainjson.Duration `json:"block_period"`
+	MaxBlockTxs   int                `json:"max_block_txs"`
+	MaxBlockBytes int                `json:"max_block_bytes"`
+}
+
+// BlockPeriod returns the interval at which this core,
+// if it is the generator, makes blocks.
+func (h *Handler) BlockPeriod() time.Duration {
+	h.blockParamsMu.Lock()
+	defer h.blockParamsMu.Unlock()
+	return h.Config.BlockPeriod
+}
+
+// LoadBlockParams reloads the block parameters from the stored
+// configuration and applies them. Another process may have changed
+// them since this one started, so cored calls LoadBlockParams each
+// time it becomes leader.
+func (h *Handler) LoadBlockParams(ctx context.Context) error {
+	conf, err := config.Load(ctx, h.DB)
+	if err != nil {
+		return err
+	}
+	if conf == nil {
+		return errors.Wrap(errUnconfigured)
+	}
+	h.setBlockParams(conf.BlockPeriod, conf.MaxBlockTxs, conf.MaxBlockBytes)
+	return nil
+}
+
+func (h *Handler) setBlockParams(period time.Duration, maxTxs, maxBytes int) {
+	h.blockParamsMu.Lock()
+	defer h.blockParamsMu.Unlock()
+	h.Config.BlockPeriod = period
+	h.Config.MaxBlockTxs = maxTxs
+	h.Config.MaxBlockBytes = maxBytes
+	h.Chain.SetBlockLimits(protocol.BlockLimits{MaxTxs: maxTxs, MaxBytes: maxBytes})
+}
+
+func (h *Handler) getBlockParams() blockParams {
+	h.blockParamsMu.Lock()
+	defer h.blockParamsMu.Unlock()
+	return blockParams{
+		BlockPeriod:   chainjson.Duration{Duration: h.Config.BlockPeriod},
+		MaxBlockTxs:   h.Config.MaxBlockTxs,
+		MaxBlockBytes: h.Config.MaxBlockBytes,
+	}
+}
+
+// POST /update-block-parameters
+//
+// update-block-parameters changes the block period and block size
+// limits of this core. Omitted parameters are left unchanged. The
+// new parameters take effect immediately, without a restart. Size
+// limits apply to blocks this core generates, signs, or accepts
+// from a generator, so every core in a network should be given the
+// same limits.
+func (h *Handler) updateBlockParams(ctx context.Context, req struct {
+	BlockPeriod   *chainjson.Duration `json:"block_period"`
+	MaxBlockTxs   *int                `json:"max_block_txs"`
+	MaxBlockBytes *int                `json:"max_block_bytes"`
+}) (blockParams, error) {
+	if !leader.IsLeading() {
+		var resp blockParams
+		err := h.forwardToLeader(ctx, "/update-block-parameters", req, &resp)
+		return resp, err
+	}
+
+	cur := h.getBlockParams()
+	conf := &config.Config{
+		BlockPeriod:   cur.BlockPeriod.Duration,
+		MaxBlockTxs:   cur.MaxBlockTxs,
+		MaxBlockBytes: cur.MaxBlockBytes,
+	}
+	if req.BlockPeriod != nil {
+		conf.BlockPeriod = req.BlockPeriod.Duration
+	}
+	if req.MaxBlockTxs != nil {
+		conf.MaxBlockTxs = *req.MaxBlockTxs
+	}
+	if req.MaxBlockBytes != nil {
+		conf.MaxBlockBytes = *req.MaxBlockBytes
+	}
+
+	err := config.UpdateBlockParams(ctx, h.DB, conf)
+	if err != nil {
+		return blockParams{}, err
+	}
+	h.setBlockParams(conf.BlockPeriod, conf.MaxBlockTxs, conf.MaxBlockBytes)
+	return h.getBlockParams(), nil
+}
@@ -10,6 +10,7 @@ import (
 	"chain/crypto/ed25519"
 	"chain/database/pg"
 	"chain/errors"
+	"chain/log"
 	"chain/protocol"
 	"chain/protocol/bc"
 )
@@ -26,20 +27,22 @@ var ErrInvalidKey = errors.New("misconfigured signer public key")
 
 // Signer validates and signs blocks.
 type Signer struct {
-	Pub ed25519.PublicKey
-	hsm *mockhsm.HSM
-	db  pg.DB
-	c   *protocol.Chain
+	Pub      ed25519.PublicKey
+	hsm      *mockhsm.HSM
+	db       pg.DB
+	c        *protocol.Chain
+	policies []Policy
 }
 
 // New returns a new Signer that validates blocks with c and signs
-// them with k.
-func New(pub ed25519.PublicKey, hsm *mockhsm.HSM, db pg.DB, c *protocol.Chain) *Signer {
+// them with k, if they satisfy every one of policies.
+func New(pub ed25519.PublicKey, hsm *mockhsm.HSM, db pg.DB, c *protocol.Chain, policies ...Policy) *Signer {
 	return &Signer{
-		Pub: pub,
-		hsm: hsm,
-		db:  db,
-		c:   c,
+		Pub:      pub,
+		hsm:      hsm,
+		db:       db,
+		c:        c,
+		policies: policies,
 	}
 }
 
@@ -59,8 +62,9 @@ func (s *Signer) String() string {
 }
 
 // ValidateAndSignBlock validates the given block against the current blockchain
-// and, if valid, computes and returns a signature for the block.  It
-// is used as the httpjson handler for /rpc/signer/sign-block.
+// and, if valid and permitted by the signer's policies, computes and returns
+// a signature for the block.  It is used as the httpjson handler for
+// /rpc/signer/sign-block.
 //
 // This function fails if this node has ever signed a different block at the
 // same height as b.
@@ -86,6 +90,13 @@ func (s *Signer) ValidateAndSignBlock(ctx context.Context, b *bc.Block) ([]byte,
 	if err != nil {
 		return nil, errors.Wrap(err, "validating block for signature")
 	}
+	for _, p := range s.policies {
+		err = p.Check(ctx, b)
+		if err != nil {
+			log.Write(ctx, "at", "refusing to sign block", "height", b.Height, "block", b.Hash(), "reason", errors.Detail(err))
+			return nil, err
+		}
+	}
 	err = lockBlockHeight(ctx, s.db, b)
 	if err != nil {
 		return nil, errors.Wrap(err, "lock block height")
@@ -0,0 +1,114 @@
+package blocksigner
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"chain/encoding/jsonschema"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+// ErrRefused is returned from ValidateAndSignBlock when a
+// valid block is refused by one of the signer's policies.
+// The error's detail gives the reason.
+var ErrRefused = errors.New("block refused by signer policy")
+
+// A Policy decides whether a signer may sign a block.
+// Policies are checked after the block has been validated.
+// Check returns nil if b may be signed, or an error with
+// root ErrRefused and a detail explaining why not.
+type Policy interface {
+	Check(ctx context.Context, b *bc.Block) error
+}
+
+// MaxIssuance limits the amount of each listed asset
+// that may be issued in a single block.
+type MaxIssuance map[bc.AssetID]uint64
+
+func (m MaxIssuance) Check(ctx context.Context, b *bc.Block) error {
+	issued := make(map[bc.AssetID]uint64)
+	for _, tx := range b.Transactions {
+		for _, in := range tx.Inputs {
+			if !in.IsIssuance() {
+				continue
+			}
+			assetID := in.AssetID()
+			max, ok := m[assetID]
+			if !ok {
+				continue
+			}
+			issued[assetID] += in.Amount()
+			if issued[assetID] > max {
+				return errors.WithDetailf(ErrRefused, "block issues more than %d units of asset %s", max, assetID)
+			}
+		}
+	}
+	return nil
+}
+
+// TimeSkew bounds a block's timestamp relative to the
+// signer's clock. A zero field means no bound.
+type TimeSkew struct {
+	Past   time.Duration // how far the timestamp may lag the clock
+	Future time.Duration // how far the timestamp may lead the clock
+}
+
+func (s TimeSkew) Check(ctx context.Context, b *bc.Block) error {
+	now := time.Now()
+	t := b.Time()
+	if s.Past > 0 && t.Before(now.Add(-s.Past)) {
+		return errors.WithDetailf(ErrRefused, "block timestamp %s is more than %s in the past", t, s.Past)
+	}
+	if s.Future > 0 && t.After(now.Add(s.Future)) {
+		return errors.WithDetailf(ErrRefused, "block timestamp %s is more than %s in the future", t, s.Future)
+	}
+	return nil
+}
+
+// OutputDenyList refuses blocks containing outputs that pay
+// to any of ControlPrograms or that are of any of Assets.
+type OutputDenyList struct {
+	ControlPrograms [][]byte
+	Assets          []bc.AssetID
+}
+
+func (d *OutputDenyList) Check(ctx context.Context, b *bc.Block) error {
+	for _, tx := range b.Transactions {
+		for i, out := range tx.Outputs {
+			for _, assetID := range d.Assets {
+				if out.AssetID == assetID {
+					return errors.WithDetailf(ErrRefused, "tx %s output %d asset %s is deny-listed", tx.Hash, i, assetID)
+				}
+			}
+			for _, prog := range d.ControlPrograms {
+				if bytes.Equal(out.ControlProgram, prog) {
+					return errors.WithDetailf(ErrRefused, "tx %s output %d control program is deny-listed", tx.Hash, i)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// RefDataSchema requires the reference data of every
+// transaction in a block to conform to Schema. Empty
+// reference data is checked as an empty JSON object.
+type RefDataSchema struct {
+	Schema *jsonschema.Schema
+}
+
+func (r RefDataSchema) Check(ctx context.Context, b *bc.Block) error {
+	for _, tx := range b.Transactions {
+		refdata := tx.ReferenceData
+		if len(refdata) == 0 {
+			refdata = []byte(`{}`)
+		}
+		err := r.Schema.Validate(refdata)
+		if err != nil {
+			return errors.WithDetailf(ErrRefused, "tx %s reference data: %s", tx.Hash, errors.Detail(err))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package blocksigner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"chain/encoding/jsonschema"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+func TestPolicies(t *testing.T) {
+	ctx := context.Background()
+
+	issuance := bc.NewIssuanceInput([]byte{1}, 10, nil, bc.Hash{}, []byte{1}, nil)
+	assetID := issuance.AssetID()
+	tx := bc.NewTx(bc.TxData{
+		Version:       1,
+		Inputs:        []*bc.TxInput{issuance},
+		Outputs:       []*bc.TxOutput{bc.NewTxOutput(assetID, 10, []byte("prog"), nil)},
+		ReferenceData: []byte(`{"memo": "hi"}`),
+	})
+	block := &bc.Block{
+		BlockHeader:  bc.BlockHeader{TimestampMS: bc.Millis(time.Now())},
+		Transactions: []*bc.Tx{tx},
+	}
+
+	schema, err := jsonschema.Parse([]byte(`{"type": "object", "required": ["memo"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	strictSchema, err := jsonschema.Parse([]byte(`{"type": "object", "required": ["invoice"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		policy Policy
+		want   error
+	}{
+		{"issuance within limit", MaxIssuance{assetID: 10}, nil},
+		{"issuance over limit", MaxIssuance{assetID: 9}, ErrRefused},
+		{"issuance of other asset", MaxIssuance{bc.AssetID{}: 1}, nil},
+		{"timestamp within skew", TimeSkew{Past: time.Minute, Future: time.Minute}, nil},
+		{"denied asset", &OutputDenyList{Assets: []bc.AssetID{assetID}}, ErrRefused},
+		{"denied program", &OutputDenyList{ControlPrograms: [][]byte{[]byte("prog")}}, ErrRefused},
+		{"other program", &OutputDenyList{ControlPrograms: [][]byte{[]byte("other")}}, nil},
+		{"conforming refdata", RefDataSchema{schema}, nil},
+		{"nonconforming refdata", RefDataSchema{strictSchema}, ErrRefused},
+	}
+	for _, c := range cases {
+		err := c.policy.Check(ctx, block)
+		if errors.Root(err) != c.want {
+			t.Errorf("%s: got error %v want %v", c.name, err, c.want)
+		}
+	}
+
+	old := &bc.Block{BlockHeader: bc.BlockHeader{TimestampMS: bc.Millis(time.Now().Add(-time.Hour))}}
+	err = TimeSkew{Past: time.Minute}.Check(ctx, old)
+	if errors.Root(err) != ErrRefused {
+		t.Errorf("old block: got error %v want %v", err, ErrRefused)
+	}
+	future := &bc.Block{BlockHeader: bc.BlockHeader{TimestampMS: bc.Millis(time.Now().Add(time.Hour))}}
+	err = TimeSkew{Future: time.Minute}.Check(ctx, future)
+	if errors.Root(err) != ErrRefused {
+		t.Errorf("future block: got error %v want %v", err, ErrRefused)
+	}
+}
@@ -33,8 +33,13 @@ var (
 	ErrBadSignerURL    = errors.New("block signer URL is invalid")
 	ErrBadSignerPubkey = errors.New("block signer pubkey is invalid")
 	ErrBadQuorum       = errors.New("quorum must be greater than 0 if there are signers")
+	ErrBadBlockParams  = errors.New("block parameters are invalid")
 )
 
+// DefaultBlockPeriod is the block period of a generator
+// configured without one.
+const DefaultBlockPeriod = time.Second
+
 // Config encapsulates Core-level, persistent configuration options.
 type Config struct {
 	ID                   string  `json:"id"`
@@ -48,6 +53,12 @@ type Config struct {
 	Signers              []BlockSigner `json:"block_signer_urls"`
 	Quorum               int
 	MaxIssuanceWindow    time.Duration
+
+	// Block parameters. These can be changed after the
+	// core is configured; see UpdateBlockParams.
+	BlockPeriod   time.Duration `json:"block_period"`
+	MaxBlockTxs   int           `json:"max_block_txs"`   // 0 means the protocol default
+	MaxBlockBytes int           `json:"max_block_bytes"` // 0 means no limit
 }
 
 type BlockSigner struct {
@@ -61,7 +72,8 @@ func Load(ctx context.Context, db pg.DB) (*Config, error) {
 	const q = `
 			SELECT id, is_signer, is_generator,
 			blockchain_id, generator_url, generator_access_token, block_xpub,
-			remote_block_signers, max_issuance_window_ms, configured_at
+			remote_block_signers, max_issuance_window_ms, configured_at,
+			block_period_ms, max_block_txs, max_block_bytes
 			FROM config
 		`
 
@@ -69,6 +81,7 @@ func Load(ctx context.Context, db pg.DB) (*Config, error) {
 	var (
 		blockSignerData []byte
 		miw             int64
+		period          int64
 	)
 	err := db.QueryRow(ctx, q).Scan(
 		&c.ID,
@@ -81,6 +94,9 @@ func Load(ctx context.Context, db pg.DB) (*Config, error) {
 		&blockSignerData,
 		&miw,
 		&c.ConfiguredAt,
+		&period,
+		&c.MaxBlockTxs,
+		&c.MaxBlockBytes,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -96,6 +112,7 @@ func Load(ctx context.Context, db pg.DB) (*Config, error) {
 	}
 
 	c.MaxIssuanceWindow = time.Duration(miw) * time.Millisecond
+	c.BlockPeriod = time.Duration(period) * time.Millisecond
 	return c, nil
 }
 
@@ -112,7 +129,14 @@ func Load(ctx context.Context, db pg.DB) (*Config, error) {
 // Otherwise, c.IsGenerator is false, and Configure makes a test request
 // to GeneratorURL to detect simple configuration mistakes.
 func Configure(ctx context.Context, db pg.DB, c *Config) error {
-	var err error
+	if c.BlockPeriod == 0 {
+		c.BlockPeriod = DefaultBlockPeriod
+	}
+	err := checkBlockParams(c)
+	if err != nil {
+		return err
+	}
+
 	if !c.IsGenerator {
 		err = tryGenerator(
 			ctx,
@@ -208,8 +232,9 @@ func Configure(ctx context.Context, db pg.DB, c *Config) error {
 	const q = `
 		INSERT INTO config (id, is_signer, block_xpub, is_generator,
 			blockchain_id, generator_url, generator_access_token,
-			remote_block_signers, max_issuance_window_ms, configured_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW())
+			remote_block_signers, max_issuance_window_ms, configured_at,
+			block_period_ms, max_block_txs, max_block_bytes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW(), $10, $11, $12)
 	`
 	_, err = db.Exec(
 		ctx,
@@ -223,10 +248,42 @@ func Configure(ctx context.Context, db pg.DB, c *Config) error {
 		c.GeneratorAccessToken,
 		blockSignerData,
 		bc.DurationMillis(c.MaxIssuanceWindow),
+		bc.DurationMillis(c.BlockPeriod),
+		c.MaxBlockTxs,
+		c.MaxBlockBytes,
 	)
 	return err
 }
 
+// UpdateBlockParams stores the block period and block size
+// limits of c, which must already be configured.
+// The caller is responsible for applying the new parameters
+// to any running generator and protocol.Chain.
+func UpdateBlockParams(ctx context.Context, db pg.DB, c *Config) error {
+	err := checkBlockParams(c)
+	if err != nil {
+		return err
+	}
+	const q = `
+		UPDATE config SET block_period_ms = $1, max_block_txs = $2, max_block_bytes = $3
+	`
+	_, err = db.Exec(ctx, q, bc.DurationMillis(c.BlockPeriod), c.MaxBlockTxs, c.MaxBlockBytes)
+	return errors.Wrap(err, "updating block parameters")
+}
+
+func checkBlockParams(c *Config) error {
+	if c.BlockPeriod < time.Millisecond {
+		return errors.WithDetail(ErrBadBlockParams, "block period must be at least 1ms")
+	}
+	if c.MaxBlockTxs < 0 {
+		return errors.WithDetail(ErrBadBlockParams, "max block transactions must not be negative")
+	}
+	if c.MaxBlockBytes < 0 {
+		return errors.WithDetail(ErrBadBlockParams, "max block bytes must not be negative")
+	}
+	return nil
+}
+
 func tryGenerator(ctx context.Context, url, accessToken, blockchainID string) error {
 	client := &rpc.Client{
 		BaseURL:      url,
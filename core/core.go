@@ -21,6 +21,7 @@ var (
 	errUnconfigured      = errors.New("core is not configured")
 	errBadBlockPub       = errors.New("supplied block pub key is invalid")
 	errNoClientTokens    = errors.New("cannot enable client auth without client access tokens")
+	errLightMode         = errors.New("core is in light mode")
 	// errProdReset is returned when reset is called on a
 	// production system.
 	errProdReset = errors.New("reset called on production system")
@@ -69,6 +70,26 @@ func (h *Handler) info(ctx context.Context) (map[string]interface{}, error) {
 	}
 }
 
+// POST /step-down
+//
+// step-down makes the leader process of this core give up its
+// leadership. If to is given, it is the listen address of the
+// process to hand over to; only that process may become leader
+// for the next 30 seconds. Otherwise any other process may.
+func (h *Handler) stepDown(ctx context.Context, req struct {
+	To string `json:"to"`
+}) error {
+	if !leader.IsLeading() {
+		return h.forwardToLeader(ctx, "/step-down", req, nil)
+	}
+	err := leader.StepDown(ctx, req.To)
+	if err == leader.ErrNotLeader {
+		// Deposed since IsLeading returned.
+		return errLeaderElection
+	}
+	return err
+}
+
 func (h *Handler) leaderInfo(ctx context.Context) (map[string]interface{}, error) {
 	var (
 		generatorHeight  *uint64
@@ -119,6 +140,30 @@ func (h *Handler) leaderInfo(ctx context.Context) (map[string]interface{}, error
 		"build_commit":                      &buildCommit,
 		"build_date":                        &buildDate,
 		"health":                            h.health(),
+		"block_parameters":                  h.getBlockParams(),
+		"leader_address":                    h.Addr,
+		"leader_epoch":                      leader.Epoch(),
+	}
+
+	// Add the health of the peers we're fetching blocks from.
+	if peers := fetch.PeerStatuses(); peers != nil {
+		m["fetch_peers"] = peers
+	}
+
+	// Add the progress of the latest re-index, if any.
+	if reindex := h.reindexProgress(); reindex != nil {
+		var eta *time.Time
+		if t := reindex.ETA(); !t.IsZero() {
+			eta = &t
+		}
+		m["reindex"] = map[string]interface{}{
+			"from_height": reindex.FromHeight,
+			"to_height":   reindex.ToHeight,
+			"height":      reindex.Height,
+			"started_at":  reindex.StartedAt,
+			"in_progress": reindex.InProgress(),
+			"eta":         eta,
+		}
 	}
 
 	// Add in snapshot information if we're downloading a snapshot.
@@ -142,6 +187,9 @@ func (h *Handler) configure(ctx context.Context, x *config.Config) error {
 	if x.IsGenerator && x.MaxIssuanceWindow == 0 {
 		x.MaxIssuanceWindow = 24 * time.Hour
 	}
+	if x.BlockPeriod == 0 {
+		x.BlockPeriod = config.DefaultBlockPeriod
+	}
 
 	err := config.Configure(ctx, h.DB, x)
 	if err != nil {
@@ -8,14 +8,20 @@ import (
 	"chain/core/asset"
 	"chain/core/blocksigner"
 	"chain/core/config"
+	"chain/core/fetch"
+	"chain/core/generator"
 	"chain/core/mockhsm"
 	"chain/core/query"
 	"chain/core/query/filter"
+	"chain/core/refdata"
 	"chain/core/rpc"
+	"chain/core/schedule"
 	"chain/core/signers"
 	"chain/core/txbuilder"
+	"chain/core/txdb"
 	"chain/core/txfeed"
 	"chain/database/pg"
+	"chain/encoding/jsonschema"
 	"chain/errors"
 	"chain/net/http/httpjson"
 	"chain/protocol"
@@ -77,7 +83,12 @@ var (
 		asset.ErrDuplicateAlias:      errorInfo{400, "CH050", "Alias already exists"},
 		account.ErrDuplicateAlias:    errorInfo{400, "CH050", "Alias already exists"},
 		txfeed.ErrDuplicateAlias:     errorInfo{400, "CH050", "Alias already exists"},
+		schedule.ErrDuplicateAlias:   errorInfo{400, "CH050", "Alias already exists"},
 		mockhsm.ErrDuplicateKeyAlias: errorInfo{400, "CH050", "Alias already exists"},
+		asset.ErrVersionMismatch:     errorInfo{409, "CH051", "Object was changed by another request; fetch it and try again"},
+		account.ErrVersionMismatch:   errorInfo{409, "CH051", "Object was changed by another request; fetch it and try again"},
+		asset.ErrArchived:            errorInfo{400, "CH052", "Object is archived"},
+		account.ErrArchived:          errorInfo{400, "CH052", "Object is archived"},
 
 		// Core error namespace
 		errUnconfigured:                errorInfo{400, "CH100", "This core still needs to be configured"},
@@ -89,9 +100,15 @@ var (
 		config.ErrBadSignerURL:         errorInfo{400, "CH106", "Block signer URL is invalid"},
 		config.ErrBadSignerPubkey:      errorInfo{400, "CH107", "Block signer pubkey is invalid"},
 		config.ErrBadQuorum:            errorInfo{400, "CH108", "Quorum must be greater than 0 if there are signers"},
+		config.ErrBadBlockParams:       errorInfo{400, "CH109", "Block parameters are invalid"},
 		errProdReset:                   errorInfo{400, "CH110", "Reset can only be called in a development system"},
+		txdb.ErrPruned:                 errorInfo{400, "CH111", "Requested block has been pruned"},
+		errIndexingDisabled:            errorInfo{400, "CH112", "Transaction indexing is disabled"},
+		errLightMode:                   errorInfo{400, "CH113", "This core is in light mode and does not serve blocks"},
+		fetch.ErrBadFilter:             errorInfo{400, "CH114", "Invalid program filter"},
 		errNoClientTokens:              errorInfo{400, "CH120", "Cannot enable client authentication with no client tokens"},
 		blocksigner.ErrConsensusChange: errorInfo{400, "CH150", "Refuse to sign block with consensus change"},
+		blocksigner.ErrRefused:         errorInfo{400, "CH151", "Block refused by signer policy"},
 
 		// Signers error namespace (2xx)
 		signers.ErrBadQuorum: errorInfo{400, "CH200", "Quorum must be greater than 1 and less than or equal to the length of xpubs"},
@@ -110,16 +127,22 @@ var (
 		query.ErrBadAfter:               errorInfo{400, "CH600", "Malformed pagination parameter `after`"},
 		query.ErrParameterCountMismatch: errorInfo{400, "CH601", "Incorrect number of parameters to filter"},
 		filter.ErrBadFilter:             errorInfo{400, "CH602", "Malformed query filter"},
+		query.ErrBadReindexHeight:       errorInfo{400, "CH603", "Invalid re-index height"},
 
 		// Transaction error namespace (7xx)
 		// Build error namespace (70x)
-		txbuilder.ErrBadRefData: errorInfo{400, "CH700", "Reference data does not match previous transaction's reference data"},
-		errBadActionType:        errorInfo{400, "CH701", "Invalid action type"},
-		errBadAlias:             errorInfo{400, "CH702", "Invalid alias on action"},
-		errBadAction:            errorInfo{400, "CH703", "Invalid action object"},
-		txbuilder.ErrBadAmount:  errorInfo{400, "CH704", "Invalid asset amount"},
-		txbuilder.ErrBlankCheck: errorInfo{400, "CH705", "Unsafe transaction: leaves assets to be taken without requiring payment"},
-		txbuilder.ErrAction:     errorInfo{400, "CH706", "One or more actions had an error: see attached data"},
+		txbuilder.ErrBadRefData:  errorInfo{400, "CH700", "Reference data does not match previous transaction's reference data"},
+		errBadActionType:         errorInfo{400, "CH701", "Invalid action type"},
+		errBadAlias:              errorInfo{400, "CH702", "Invalid alias on action"},
+		errBadAction:             errorInfo{400, "CH703", "Invalid action object"},
+		txbuilder.ErrBadAmount:   errorInfo{400, "CH704", "Invalid asset amount"},
+		txbuilder.ErrBlankCheck:  errorInfo{400, "CH705", "Unsafe transaction: leaves assets to be taken without requiring payment"},
+		txbuilder.ErrAction:      errorInfo{400, "CH706", "One or more actions had an error: see attached data"},
+		txbuilder.ErrBadContract: errorInfo{400, "CH707", "Invalid contract"},
+		txbuilder.ErrBadOffer:    errorInfo{400, "CH708", "Invalid offer"},
+		errUnsignedTemplate:      errorInfo{400, "CH709", "Transaction template could not be fully signed by this core's MockHSM"},
+		refdata.ErrNonconforming: errorInfo{400, "CH710", "Reference data does not conform to its schema"},
+		jsonschema.ErrBadSchema:  errorInfo{400, "CH711", "Invalid JSON schema"},
 
 		// Submit error namespace (73x)
 		txbuilder.ErrMissingRawTx:          errorInfo{400, "CH730", "Missing raw transaction"},
@@ -128,10 +151,19 @@ var (
 		txbuilder.ErrBadWitnessComponent:   errorInfo{400, "CH733", "Invalid witness component"},
 		txbuilder.ErrRejected:              errorInfo{400, "CH735", "Transaction rejected"},
 		txbuilder.ErrNoTxSighashCommitment: errorInfo{400, "CH736", "Transaction is not final, additional actions still allowed"},
+		generator.ErrRefused:               errorInfo{400, "CH737", "Transaction refused by generator policy"},
 
 		// account action error namespace (76x)
-		account.ErrInsufficient: errorInfo{400, "CH760", "Insufficient funds for tx"},
-		account.ErrReserved:     errorInfo{400, "CH761", "Some outputs are reserved; try again"},
+		account.ErrInsufficient:           errorInfo{400, "CH760", "Insufficient funds for tx"},
+		account.ErrReserved:               errorInfo{400, "CH761", "Some outputs are reserved; try again"},
+		account.ErrPolicy:                 errorInfo{400, "CH762", "Spend violates the account's policy"},
+		account.ErrApprovalRequired:       errorInfo{400, "CH763", "Spend requires an approval"},
+		account.ErrBadApproval:            errorInfo{400, "CH764", "Spend approval is invalid, unapproved, expired or already used"},
+		account.ErrSelfApproval:           errorInfo{400, "CH765", "Request must be approved by a different, earlier access token"},
+		account.ErrBadPolicy:              errorInfo{400, "CH766", "Invalid account policy"},
+		account.ErrSpentReservation:       errorInfo{400, "CH767", "Outputs reserved with this client token were already spent"},
+		account.ErrPolicyApprovalRequired: errorInfo{400, "CH768", "Loosening the account's policy requires an approval"},
+		account.ErrBadPolicyApproval:      errorInfo{400, "CH769", "Policy approval is invalid, unapproved, expired or already used"},
 
 		// Mock HSM error namespace (80x)
 		mockhsm.ErrInvalidAfter:         errorInfo{400, "CH801", "Invalid `after` in query"},
@@ -3,6 +3,8 @@
 package fetch
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"io"
 	"io/ioutil"
@@ -15,15 +17,23 @@ import (
 
 	"chain/core/rpc"
 	"chain/core/txdb"
+	"chain/encoding/blockchain"
 	"chain/errors"
 	"chain/log"
 	"chain/protocol"
 	"chain/protocol/bc"
 	"chain/protocol/state"
+	"chain/protocol/validation"
 )
 
 const heightPollingPeriod = 3 * time.Second
 
+// maxBlockBytes bounds the serialized size of a block read
+// from a get-block-range response, far above that of any real
+// block, so a bad peer can't make this core allocate gigabytes
+// for one.
+const maxBlockBytes = 64 << 20
+
 var (
 	generatorHeight          uint64
 	generatorHeightFetchedAt time.Time
@@ -47,21 +57,25 @@ func SnapshotProgress() *Snapshot {
 	return downloadingSnapshot
 }
 
-// Fetch runs in a loop, fetching blocks from the configured
-// peer (e.g. the generator) and applying them to the local
-// Chain.
+// Fetch runs in a loop, fetching blocks from peers
+// (the generator and possibly other Cores) and applying
+// them to the local Chain.
 //
 // It returns when its context is canceled.
 // After each attempt to fetch and apply a block, it calls health
 // to report either an error or nil to indicate success.
-func Fetch(ctx context.Context, c *protocol.Chain, peer *rpc.Client, health func(error)) {
-	// Fetch the generator height periodically.
-	go pollGeneratorHeight(ctx, peer)
+func Fetch(ctx context.Context, c *protocol.Chain, peers *Peers, health func(error)) {
+	currentPeersMu.Lock()
+	currentPeers = peers
+	currentPeersMu.Unlock()
+
+	// Fetch the peers' heights periodically.
+	go peers.pollHeights(ctx)
 
 	if c.Height() == 0 {
 		const maxAttempts = 5
 		for attempt := 1; attempt <= maxAttempts; attempt++ {
-			err := fetchSnapshot(ctx, peer, c.Store(), attempt)
+			err := fetchSnapshot(ctx, c, peers, attempt)
 			health(err)
 			if err == nil {
 				break
@@ -88,22 +102,37 @@ func Fetch(ctx context.Context, c *protocol.Chain, peer *rpc.Client, health func
 		height = prevBlock.Height
 	}
 
-	blockch, errch := DownloadBlocks(ctx, peer, height+1)
+	downloadCtx, cancel := context.WithCancel(ctx)
+	blockch, errch := peers.download(downloadCtx, height+1)
 
 	var nfailures uint
 	for {
 		select {
 		case <-ctx.Done():
+			cancel()
 			log.Messagef(ctx, "Deposed, Fetch exiting")
 			return
 		case err = <-errch:
 			health(err)
 			logNetworkError(ctx, err)
-		case b := <-blockch:
+		case fb, ok := <-blockch:
+			if !ok {
+				continue // ctx is done
+			}
 			for {
-				prevSnapshot, prevBlock, err = applyBlock(ctx, c, prevSnapshot, prevBlock, b)
-				if err == protocol.ErrBadBlock {
-					log.Fatal(ctx, log.KeyError, err)
+				prevSnapshot, prevBlock, err = applyBlock(ctx, c, prevSnapshot, prevBlock, fb.block)
+				if errors.Root(err) == protocol.ErrBadBlock {
+					if peers.isGenerator(fb.peer) {
+						log.Fatal(ctx, log.KeyError, err)
+					}
+					// Another peer sent a bad block. Stop using
+					// it for a while and download the block again.
+					peers.penalize(fb.peer, err)
+					log.Error(ctx, err, "peer", fb.peer.client.BaseURL)
+					cancel()
+					downloadCtx, cancel = context.WithCancel(ctx)
+					blockch, errch = peers.download(downloadCtx, height+1)
+					break
 				} else if err != nil {
 					// This is a serious I/O error.
 					health(err)
@@ -113,12 +142,12 @@ func Fetch(ctx context.Context, c *protocol.Chain, peer *rpc.Client, health func
 					time.Sleep(backoffDur(nfailures))
 					continue
 				}
+
+				height++
+				health(nil)
+				nfailures = 0
 				break
 			}
-
-			height++
-			health(nil)
-			nfailures = 0
 		}
 	}
 }
@@ -131,71 +160,24 @@ func Fetch(ctx context.Context, c *protocol.Chain, peer *rpc.Client, health func
 // reading from both. DownloadBlocks will continue even if it encounters errors,
 // until its context is done.
 func DownloadBlocks(ctx context.Context, peer *rpc.Client, height uint64) (chan *bc.Block, chan error) {
+	peers := NewPeers(peer)
+	go peers.pollHeights(ctx)
+
+	fetched, errch := peers.download(ctx, height)
 	blockch := make(chan *bc.Block)
-	errch := make(chan error)
 	go func() {
-		var nfailures uint // for backoff
-		var ntimeouts uint // for backoff
-		for {
+		defer close(blockch)
+		for fb := range fetched {
 			select {
+			case blockch <- fb.block:
 			case <-ctx.Done():
-				close(blockch)
-				close(errch)
 				return
-			default:
-				block, err := getBlock(ctx, peer, height, timeoutBackoffDur(ntimeouts))
-				if err != nil {
-					errch <- err
-					nfailures++
-					time.Sleep(backoffDur(nfailures))
-					continue
-				}
-				if block == nil {
-					// Request time out. There might not have been any blocks published,
-					// or there was a network error or it just took too long to process the
-					// request.
-					ntimeouts++
-					continue
-				}
-
-				blockch <- block
-				ntimeouts, nfailures = 0, 0
-				height++
 			}
 		}
 	}()
 	return blockch, errch
 }
 
-func pollGeneratorHeight(ctx context.Context, peer *rpc.Client) {
-	updateGeneratorHeight(ctx, peer)
-
-	ticker := time.NewTicker(heightPollingPeriod)
-	for {
-		select {
-		case <-ctx.Done():
-			log.Messagef(ctx, "Deposed, fetchGeneratorHeight exiting")
-			ticker.Stop()
-			return
-		case <-ticker.C:
-			updateGeneratorHeight(ctx, peer)
-		}
-	}
-}
-
-func updateGeneratorHeight(ctx context.Context, peer *rpc.Client) {
-	gh, err := getHeight(ctx, peer)
-	if err != nil {
-		logNetworkError(ctx, err)
-		return
-	}
-
-	generatorLock.Lock()
-	defer generatorLock.Unlock()
-	generatorHeight = gh
-	generatorHeightFetchedAt = time.Now()
-}
-
 func applyBlock(ctx context.Context, c *protocol.Chain, prevSnap *state.Snapshot, prev *bc.Block, block *bc.Block) (*state.Snapshot, *bc.Block, error) {
 	snap, err := c.ValidateBlock(ctx, prevSnap, prev, block)
 	if err != nil {
@@ -241,20 +223,98 @@ func getBlock(ctx context.Context, peer *rpc.Client, height uint64, timeout time
 	return block, errors.Wrap(err, "get blocks rpc")
 }
 
+// getBlockRange sends a get-block-range RPC request to
+// another Core for the n blocks starting at height, and
+// calls f with each block as it arrives. The peer waits for
+// the first block to be created, but may send fewer than
+// n blocks. If no data arrives for the given timeout, the
+// request is abandoned and getBlockRange returns nil.
+func getBlockRange(ctx context.Context, peer *rpc.Client, height, n uint64, timeout time.Duration, f func(*bc.Block) error) error {
+	reqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var r progressReader
+	r.setTimeout(timeout, cancel)
+	defer r.timer.Stop()
+
+	req := struct {
+		Height uint64 `json:"height"`
+		Count  uint64 `json:"count"`
+	}{height, n}
+	body, err := peer.CallRaw(reqCtx, "/rpc/get-block-range", req)
+	if ctx.Err() == nil && reqCtx.Err() != nil {
+		return nil // timed out
+	} else if err != nil {
+		return errors.Wrap(err, "get block range rpc")
+	}
+	defer body.Close()
+
+	r.reader = body
+	br := bufio.NewReader(&r)
+	for {
+		data, err := readBlock(br)
+		if err == io.EOF {
+			return nil
+		} else if ctx.Err() == nil && reqCtx.Err() != nil {
+			return nil // timed out
+		} else if err != nil {
+			return errors.Wrap(err, "reading block range")
+		}
+		b := new(bc.Block)
+		err = b.UnmarshalBinary(data)
+		if err != nil {
+			return errors.Wrap(err, "decoding block")
+		}
+		err = f(b)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readBlock reads a block's serialization, prefixed with its
+// length as by blockchain.WriteVarstr31. It refuses lengths
+// over maxBlockBytes before allocating.
+func readBlock(r io.Reader) ([]byte, error) {
+	n, _, err := blockchain.ReadVarint31(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxBlockBytes {
+		return nil, errors.Wrapf(blockchain.ErrRange, "block of %d bytes, more than the maximum %d", n, maxBlockBytes)
+	}
+	data := make([]byte, n)
+	_, err = io.ReadFull(r, data)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return data, err
+}
+
+// unsupported reports whether err is the result of calling
+// an RPC that the remote Core doesn't have.
+func unsupported(err error) bool {
+	code, _, ok := rpc.ClientError(err)
+	return ok && code == "CH006"
+}
+
 // getHeight sends a get-height RPC request to another Core for
 // the latest height that that peer knows about.
-func getHeight(ctx context.Context, peer *rpc.Client) (uint64, error) {
+// getHeight returns the peer's block height and the height
+// below which it has pruned its blocks, other than the initial
+// block. Peers that don't prune don't report a pruned height.
+func getHeight(ctx context.Context, peer *rpc.Client) (height, pruned uint64, err error) {
 	var resp map[string]uint64
-	err := peer.Call(ctx, "/rpc/block-height", nil, &resp)
+	err = peer.Call(ctx, "/rpc/block-height", nil, &resp)
 	if err != nil {
-		return 0, errors.Wrap(err, "could not get remote block height")
+		return 0, 0, errors.Wrap(err, "could not get remote block height")
 	}
 	h, ok := resp["block_height"]
 	if !ok {
-		return 0, errors.New("unexpected response from generator")
+		return 0, 0, errors.New("unexpected response from generator")
 	}
 
-	return h, nil
+	return h, resp["pruned_height"], nil
 }
 
 func logNetworkError(ctx context.Context, err error) {
@@ -270,6 +330,7 @@ type Snapshot struct {
 	Attempt int
 	Height  uint64
 	Size    uint64
+	Parts   []txdb.SnapshotPart
 	progressReader
 
 	stopped   bool
@@ -288,20 +349,30 @@ func (s *Snapshot) done() {
 	s.stopped = true
 }
 
-// fetchSnapshot fetches the latest snapshot from the generator and applies it
-// to the store. It should only be called on freshly configured cores--
-// cores that have been operating should replay all transactions so that
-// they can index them properly.
-func fetchSnapshot(ctx context.Context, peer *rpc.Client, s protocol.Store, attempt int) error {
-	const getBlockTimeout = 30 * time.Second
+// fetchSnapshot fetches the latest snapshot from the healthiest peer and
+// applies it to the store. It should only be called on freshly configured
+// cores--cores that have been operating should replay all transactions so
+// that they can index them properly.
+//
+// The snapshot is accepted only if it matches the state root of a
+// block signed as required by the consensus program; see verifySnapshot.
+// Otherwise the peer is penalized, so the next attempt uses another.
+func fetchSnapshot(ctx context.Context, c *protocol.Chain, peers *Peers, attempt int) error {
 	const readSnapshotTimeout = 30 * time.Second
 
+	p := peers.pick(0, 0)
+	if p == nil {
+		return errors.New("no peer available to provide a snapshot")
+	}
+	start := time.Now()
 	info := &Snapshot{Attempt: attempt}
-	err := peer.Call(ctx, "/rpc/get-snapshot-info", nil, &info)
+	err := p.client.Call(ctx, "/rpc/get-snapshot-info", nil, &info)
 	if err != nil {
+		peers.report(p, time.Since(start), err)
 		return errors.Wrap(err, "getting snapshot info")
 	}
 	if info.Height == 0 {
+		peers.report(p, time.Since(start), nil)
 		return nil
 	}
 
@@ -311,64 +382,176 @@ func fetchSnapshot(ctx context.Context, peer *rpc.Client, s protocol.Store, atte
 
 	downloadCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
-	// Download the snapshot, recording our progress as we go.
-	body, err := peer.CallRaw(downloadCtx, "/rpc/get-snapshot", info.Height)
-	if err != nil {
-		return errors.Wrap(err, "getting snapshot")
+	info.progressReader.setTimeout(readSnapshotTimeout, cancel)
+	snapshot, err := downloadSnapshot(downloadCtx, p.client, info)
+	if err == nil {
+		var initialBlock, prevBlock, snapshotBlock *bc.Block
+		initialBlock, prevBlock, snapshotBlock, err = getSnapshotBlocks(ctx, p.client, info.Height)
+		if err == nil {
+			err = verifySnapshot(c.InitialBlockHash, initialBlock, prevBlock, snapshotBlock, info.Height, snapshot)
+		}
+		if err == nil {
+			peers.report(p, time.Since(start), nil)
+			return saveSnapshot(ctx, c.Store(), initialBlock, snapshotBlock, snapshot)
+		}
 	}
-	defer body.Close()
 
-	// Wrap the response body reader in our progress reader.
-	info.progressReader.reader = body
-	info.progressReader.setTimeout(readSnapshotTimeout, cancel)
-	b, err := ioutil.ReadAll(&info.progressReader)
+	if errors.Root(err) == errBadSnapshot {
+		peers.penalize(p, err)
+		log.Error(ctx, err, "peer", p.client.BaseURL)
+	} else {
+		peers.report(p, time.Since(start), err)
+	}
+	return err
+}
+
+// verifySnapshot checks that snapshot is the state after the block
+// at the given height, and that the block is signed as required by
+// the network. Its state root must be the root of snapshot's state
+// tree. Its header must be signed as required by the consensus
+// program of prev, the block before it, and that consensus program
+// must be the same as the initial block's, whose hash is the
+// blockchain ID.
+//
+// If the network has changed its consensus program since the
+// initial block, verifySnapshot can't check the snapshot without
+// the intervening headers, so it refuses it. The Core must then
+// replay the blockchain from the initial block.
+func verifySnapshot(initialBlockHash bc.Hash, initial, prev, block *bc.Block, height uint64, snapshot *state.Snapshot) error {
+	if initial.Height != 1 || initial.Hash() != initialBlockHash {
+		return errors.Wrap(errBadSnapshot, "initial block hash does not match blockchain ID")
+	}
+	if block.Height != height {
+		return errors.Wrapf(errBadSnapshot, "got block %d for snapshot at height %d", block.Height, height)
+	}
+	if height > 1 {
+		if prev.Height != height-1 || block.PreviousBlockHash != prev.Hash() {
+			return errors.Wrapf(errBadSnapshot, "block %d does not follow block %d", height, height-1)
+		}
+		if !bytes.Equal(prev.ConsensusProgram, initial.ConsensusProgram) {
+			return errors.Wrapf(errBadSnapshot, "consensus program has changed since the initial block; can't verify block %d", height)
+		}
+		err := validation.VerifyBlockSigs(&block.BlockHeader, prev.ConsensusProgram)
+		if err != nil {
+			return errors.Wrapf(errBadSnapshot, "block %d: %v", height, err)
+		}
+	}
+	if root := snapshot.Tree.RootHash(); block.AssetsMerkleRoot != root {
+		return errors.Wrapf(errBadSnapshot, "snapshot root %s does not match block %d assets merkle root %s", root, height, block.AssetsMerkleRoot)
+	}
+	return nil
+}
+
+// getSnapshotBlocks gets the blocks needed to check the snapshot
+// at height: the initial block, the snapshot's block, and the block
+// before it, whose consensus program the snapshot's block must satisfy.
+func getSnapshotBlocks(ctx context.Context, peer *rpc.Client, height uint64) (initial, prev, block *bc.Block, err error) {
+	const getBlockTimeout = 30 * time.Second
+
+	get := func(h uint64) (*bc.Block, error) {
+		b, err := getBlock(ctx, peer, h, getBlockTimeout)
+		if err == nil && b == nil {
+			// Something seriously funny is afoot.
+			err = errors.Wrapf(errBadSnapshot, "peer provided snapshot but could not provide block %d", h)
+		}
+		return b, err
+	}
+
+	initial, err = get(1)
+	if err != nil || height == 1 {
+		return initial, nil, initial, err
+	}
+	prev, err = get(height - 1)
 	if err != nil {
-		return err
+		return nil, nil, nil, err
 	}
-	snapshot, err := txdb.DecodeSnapshot(b)
+	block, err = get(height)
 	if err != nil {
-		return err
+		return nil, nil, nil, err
 	}
+	return initial, prev, block, nil
+}
+
+// saveSnapshot commits the snapshot, initial block and snapshot block.
+func saveSnapshot(ctx context.Context, s protocol.Store, initialBlock, snapshotBlock *bc.Block, snapshot *state.Snapshot) error {
 	// Delete the snapshot issuances because we don't have any commitment
 	// to them in the block. This means that Cores bootstrapping from a
 	// snapshot cannot guarantee uniqueness of issuances until the max
 	// issuance window has elapsed.
 	snapshot.PruneIssuances(math.MaxUint64)
 
-	// Next, get the initial block.
-	initialBlock, err := getBlock(ctx, peer, 1, getBlockTimeout)
+	err := s.SaveBlock(ctx, initialBlock)
 	if err != nil {
-		return err
-	}
-	if initialBlock == nil {
-		// Something seriously funny is afoot.
-		return errors.New("could not get initial block from generator")
+		return errors.Wrap(err, "saving the initial block")
 	}
-
-	// Also get the corresponding block.
-	snapshotBlock, err := getBlock(ctx, peer, info.Height, getBlockTimeout)
+	err = s.SaveBlock(ctx, snapshotBlock)
 	if err != nil {
-		return err
+		return errors.Wrap(err, "saving bootstrap block")
 	}
-	if snapshotBlock == nil {
-		// Something seriously funny is still afoot.
-		return errors.New("generator provided snapshot but could not provide block")
+	err = s.SaveSnapshot(ctx, snapshotBlock.Height, snapshot)
+	return errors.Wrap(err, "saving bootstrap snaphot")
+}
+
+var errBadSnapshot = errors.New("bad snapshot")
+
+// downloadSnapshot downloads the snapshot described by info from
+// peer, recording our progress in info as we go. If the peer lists
+// the parts of the snapshot, it downloads a full snapshot and the
+// deltas after it, and applies them. Otherwise it downloads the
+// whole snapshot at once.
+func downloadSnapshot(ctx context.Context, peer *rpc.Client, info *Snapshot) (*state.Snapshot, error) {
+	if len(info.Parts) == 0 {
+		b, err := readSnapshot(ctx, peer, "/rpc/get-snapshot", info.Height, &info.progressReader)
+		if err != nil {
+			return nil, err
+		}
+		snapshot, err := txdb.DecodeSnapshot(b)
+		if err != nil {
+			return nil, errors.Wrap(errBadSnapshot, err.Error())
+		}
+		return snapshot, nil
 	}
-	if snapshotBlock.AssetsMerkleRoot != snapshot.Tree.RootHash() {
-		return errors.New("snapshot merkle root doesn't match block")
+
+	if last := info.Parts[len(info.Parts)-1]; last.Height != info.Height {
+		return nil, errors.Wrapf(errBadSnapshot, "snapshot parts end at height %d, not %d", last.Height, info.Height)
 	}
+	var snapshot *state.Snapshot
+	for i, part := range info.Parts {
+		var baseHeight uint64
+		if i > 0 {
+			baseHeight = info.Parts[i-1].Height
+		}
+		if part.BaseHeight != baseHeight {
+			return nil, errors.Wrapf(errBadSnapshot, "snapshot part at height %d has base %d, not %d", part.Height, part.BaseHeight, baseHeight)
+		}
 
-	// Commit the snapshot, initial block and snapshot block.
-	err = s.SaveBlock(ctx, initialBlock)
-	if err != nil {
-		return errors.Wrap(err, "saving the initial block")
+		b, err := readSnapshot(ctx, peer, "/rpc/get-snapshot-part", part.Height, &info.progressReader)
+		if err != nil {
+			return nil, err
+		}
+		if snapshot == nil {
+			snapshot, err = txdb.DecodeSnapshot(b)
+		} else {
+			err = txdb.ApplySnapshotDelta(snapshot, baseHeight, b)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(errBadSnapshot, "snapshot part at height %d: %v", part.Height, err)
+		}
 	}
-	err = s.SaveBlock(ctx, snapshotBlock)
+	return snapshot, nil
+}
+
+// readSnapshot calls the snapshot RPC at path for the given height
+// and reads the response through r.
+func readSnapshot(ctx context.Context, peer *rpc.Client, path string, height uint64, r *progressReader) ([]byte, error) {
+	body, err := peer.CallRaw(ctx, path, height)
 	if err != nil {
-		return errors.Wrap(err, "saving bootstrap block")
+		return nil, errors.Wrap(err, "getting snapshot")
 	}
-	err = s.SaveSnapshot(ctx, snapshotBlock.Height, snapshot)
-	return errors.Wrap(err, "saving bootstrap snaphot")
+	defer body.Close()
+
+	r.reader = body
+	return ioutil.ReadAll(r)
 }
 
 type progressReader struct {
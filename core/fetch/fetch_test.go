@@ -0,0 +1,100 @@
+package fetch
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"chain/core/rpc"
+	"chain/crypto/ed25519"
+	"chain/encoding/blockchain"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/state"
+	"chain/protocol/vmutil"
+)
+
+func TestVerifySnapshot(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err := vmutil.BlockMultiSigProgram([]ed25519.PublicKey{pub}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, otherPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherProg, err := vmutil.BlockMultiSigProgram([]ed25519.PublicKey{otherPub}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot := state.Empty()
+	err = snapshot.Tree.Insert([]byte("sup"), []byte{0x01})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	initial := &bc.Block{BlockHeader: bc.BlockHeader{Version: 1, Height: 1, ConsensusProgram: prog}}
+	initialHash := initial.Hash()
+	makeBlock := func(prev *bc.Block, prog []byte, root bc.Hash, key ed25519.PrivateKey) *bc.Block {
+		b := &bc.Block{BlockHeader: bc.BlockHeader{
+			Version:           1,
+			Height:            prev.Height + 1,
+			PreviousBlockHash: prev.Hash(),
+			AssetsMerkleRoot:  root,
+			ConsensusProgram:  prog,
+		}}
+		hash := b.HashForSig()
+		b.Witness = [][]byte{ed25519.Sign(key, hash[:])}
+		return b
+	}
+	root := snapshot.Tree.RootHash()
+	prev := makeBlock(initial, prog, bc.Hash{}, priv)
+	changedPrev := makeBlock(initial, otherProg, bc.Hash{}, priv)
+
+	cases := []struct {
+		name        string
+		initial     *bc.Block
+		prev, block *bc.Block
+		wantErr     bool
+	}{
+		{"ok", initial, prev, makeBlock(prev, prog, root, priv), false},
+		{"wrong root", initial, prev, makeBlock(prev, prog, bc.Hash{1}, priv), true},
+		{"bad signature", initial, prev, makeBlock(prev, prog, root, otherPriv), true},
+		{"wrong initial block", prev, prev, makeBlock(prev, prog, root, priv), true},
+		{"not prev", initial, initial, makeBlock(prev, prog, root, priv), true},
+		{"changed program", initial, changedPrev, makeBlock(changedPrev, otherProg, root, otherPriv), true},
+	}
+	for _, c := range cases {
+		err := verifySnapshot(initialHash, c.initial, c.prev, c.block, 3, snapshot)
+		if c.wantErr && errors.Root(err) != errBadSnapshot {
+			t.Errorf("%s: got error %v want %v", c.name, err, errBadSnapshot)
+		} else if !c.wantErr && err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+		}
+	}
+}
+
+func TestGetBlockRangeTooBig(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// Claim a block of nearly 2 GiB.
+		blockchain.WriteVarint31(w, math.MaxInt32)
+	}))
+	defer server.Close()
+
+	peer := &rpc.Client{BaseURL: server.URL}
+	err := getBlockRange(context.Background(), peer, 1, 1, time.Minute, func(*bc.Block) error {
+		t.Error("got a block, want none")
+		return nil
+	})
+	if errors.Root(err) != blockchain.ErrRange {
+		t.Errorf("getBlockRange = %v want %s", err, blockchain.ErrRange)
+	}
+}
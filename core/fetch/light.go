@@ -0,0 +1,352 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"chain/core/rpc"
+	"chain/crypto/sha3pool"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/log"
+	"chain/protocol"
+	"chain/protocol/bc"
+	"chain/protocol/validation"
+)
+
+// ErrBadFilter is returned when a light block
+// request has an invalid program filter.
+var ErrBadFilter = errors.New("invalid program filter")
+
+var (
+	watchedTxs   = make(map[bc.Hash]int)
+	watchedTxsMu sync.Mutex
+)
+
+// WatchTx asks a light client to fetch the transaction with
+// the given hash when it is confirmed, whether or not it
+// involves a local account. It returns a function that
+// cancels the request.
+func WatchTx(hash bc.Hash) (unwatch func()) {
+	watchedTxsMu.Lock()
+	watchedTxs[hash]++
+	watchedTxsMu.Unlock()
+	return func() {
+		watchedTxsMu.Lock()
+		defer watchedTxsMu.Unlock()
+		watchedTxs[hash]--
+		if watchedTxs[hash] <= 0 {
+			delete(watchedTxs, hash)
+		}
+	}
+}
+
+func watched() []bc.Hash {
+	watchedTxsMu.Lock()
+	defer watchedTxsMu.Unlock()
+	hashes := make([]bc.Hash, 0, len(watchedTxs))
+	for h := range watchedTxs {
+		hashes = append(hashes, h)
+	}
+	return hashes
+}
+
+// LightBlockRequest asks a peer for the header of the block
+// at Height and those of its transactions that a light client
+// needs: transactions with an input or output using a control
+// program that may be in Filter, and transactions with any of
+// TxIDs.
+type LightBlockRequest struct {
+	Height uint64         `json:"height"`
+	Filter *ProgramFilter `json:"program_filter"`
+	TxIDs  []bc.Hash      `json:"transaction_ids"`
+}
+
+const (
+	filterBitsPerProgram = 10
+	filterHashes         = 7 // best for 10 bits per program
+	minFilterBytes       = 8
+	maxFilterBytes       = 1 << 16
+	maxFilterHashes      = 32
+)
+
+// ProgramFilter is a Bloom filter of control programs. It is
+// at most 64 KiB, however many programs it holds. Its false
+// positive rate is about 1% for up to 50,000 programs, and
+// grows beyond that; false positives only cost a light client
+// some transactions it doesn't need.
+type ProgramFilter struct {
+	Bits   chainjson.HexBytes `json:"bits"`
+	Hashes int                `json:"hashes"`
+}
+
+// NewProgramFilter returns a filter holding progs.
+func NewProgramFilter(progs [][]byte) *ProgramFilter {
+	n := (len(progs)*filterBitsPerProgram + 7) / 8
+	if n < minFilterBytes {
+		n = minFilterBytes
+	} else if n > maxFilterBytes {
+		n = maxFilterBytes
+	}
+	f := &ProgramFilter{Bits: make([]byte, n), Hashes: filterHashes}
+	for _, prog := range progs {
+		h1, h2 := filterHash(prog)
+		for i := 0; i < f.Hashes; i++ {
+			pos := f.bit(h1, h2, i)
+			f.Bits[pos/8] |= 1 << (pos % 8)
+		}
+	}
+	return f
+}
+
+// MayContain reports whether prog may be in f.
+// It is always true if prog is in f.
+func (f *ProgramFilter) MayContain(prog []byte) bool {
+	h1, h2 := filterHash(prog)
+	for i := 0; i < f.Hashes; i++ {
+		pos := f.bit(h1, h2, i)
+		if f.Bits[pos/8]&(1<<(pos%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *ProgramFilter) validate() error {
+	if len(f.Bits) < minFilterBytes || len(f.Bits) > maxFilterBytes {
+		return errors.WithDetailf(ErrBadFilter, "filter size must be between %d and %d bytes", minFilterBytes, maxFilterBytes)
+	}
+	if f.Hashes < 1 || f.Hashes > maxFilterHashes {
+		return errors.WithDetailf(ErrBadFilter, "filter hash count must be between 1 and %d", maxFilterHashes)
+	}
+	return nil
+}
+
+// bit returns the position in f of the ith of a
+// program's bits, given its hashes h1 and h2.
+func (f *ProgramFilter) bit(h1, h2 uint64, i int) uint64 {
+	return (h1 + uint64(i)*h2) % uint64(8*len(f.Bits))
+}
+
+func filterHash(prog []byte) (h1, h2 uint64) {
+	var h [16]byte
+	sha3pool.Sum256(h[:], prog)
+	return binary.LittleEndian.Uint64(h[:8]), binary.LittleEndian.Uint64(h[8:])
+}
+
+// LightBlock is a block header and some of the block's
+// transactions, each with a proof of its inclusion in
+// the block.
+type LightBlock struct {
+	Header       *bc.BlockHeader `json:"block_header"`
+	Transactions []*LightTx      `json:"transactions"`
+}
+
+// LightTx is a transaction in a LightBlock.
+type LightTx struct {
+	Tx    *bc.Tx              `json:"transaction"`
+	Proof *validation.TxProof `json:"proof"`
+}
+
+// MakeLightBlock returns the light block for b
+// requested by req.
+func MakeLightBlock(b *bc.Block, req *LightBlockRequest) (*LightBlock, error) {
+	if req.Filter != nil {
+		err := req.Filter.validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+	ids := make(map[bc.Hash]bool, len(req.TxIDs))
+	for _, id := range req.TxIDs {
+		ids[id] = true
+	}
+
+	lb := &LightBlock{Header: &b.BlockHeader}
+	for i, tx := range b.Transactions {
+		if !ids[tx.Hash] && (req.Filter == nil || !usesProgram(tx, req.Filter)) {
+			continue
+		}
+		proof, err := validation.CalcTxProof(b.Transactions, i)
+		if err != nil {
+			return nil, err
+		}
+		lb.Transactions = append(lb.Transactions, &LightTx{Tx: tx, Proof: proof})
+	}
+	return lb, nil
+}
+
+func usesProgram(tx *bc.Tx, f *ProgramFilter) bool {
+	for _, in := range tx.Inputs {
+		if !in.IsIssuance() && f.MayContain(in.ControlProgram()) {
+			return true
+		}
+	}
+	for _, out := range tx.Outputs {
+		if f.MayContain(out.ControlProgram) {
+			return true
+		}
+	}
+	return false
+}
+
+// verify checks lb as the successor to prev and returns
+// a block made of its header and transactions. The
+// block's transactions do not match its
+// TransactionsMerkleRoot unless lb has every transaction.
+func (lb *LightBlock) verify(initialBlockHash bc.Hash, prev *bc.BlockHeader) (*bc.Block, error) {
+	if lb.Header == nil {
+		return nil, errors.Wrap(protocol.ErrBadBlock, "missing block header")
+	}
+	err := validation.ValidateHeader(initialBlockHash, prev, lb.Header)
+	if err != nil {
+		return nil, errors.Wrapf(protocol.ErrBadBlock, "block %d: %v", lb.Header.Height, err)
+	}
+
+	b := &bc.Block{BlockHeader: *lb.Header}
+	lastPos := -1
+	for _, ltx := range lb.Transactions {
+		tx, p := ltx.Tx, ltx.Proof
+		if tx == nil || p == nil {
+			return nil, errors.Wrapf(protocol.ErrBadBlock, "block %d: missing transaction or proof", lb.Header.Height)
+		}
+		if p.TxID != tx.Hash || !bytes.Equal(p.WitnessDigests, tx.WitnessDigests()) {
+			return nil, errors.Wrapf(protocol.ErrBadBlock, "block %d: proof is not for tx %s", lb.Header.Height, tx.Hash)
+		}
+		if p.Position <= lastPos {
+			return nil, errors.Wrapf(protocol.ErrBadBlock, "block %d: transactions out of order", lb.Header.Height)
+		}
+		lastPos = p.Position
+		err = p.Verify(lb.Header.TransactionsMerkleRoot)
+		if err != nil {
+			return nil, errors.Wrapf(protocol.ErrBadBlock, "block %d tx %s: %v", lb.Header.Height, tx.Hash, err)
+		}
+		b.Transactions = append(b.Transactions, tx)
+	}
+	return b, nil
+}
+
+// FetchLight is like Fetch, for a core in light mode. Instead
+// of full blocks, it fetches block headers, verifying their
+// signatures, and just the transactions that involve the
+// control programs returned by programs or that have been
+// passed to WatchTx, verifying their inclusion in the block.
+// It sends the programs as a ProgramFilter, rebuilt only when
+// programs returns more of them, so the request stays small
+// however many there are; the peer may return some unrelated
+// transactions too. It stores these partial blocks and keeps
+// no state tree. The partial blocks must not be served to
+// other cores.
+//
+// Since a light client cannot see every transaction, it must
+// trust the peer not to withhold transactions that involve
+// it. It cannot be deceived into accepting a transaction or
+// block that the network did not confirm.
+//
+// It returns when its context is canceled.
+func FetchLight(ctx context.Context, c *protocol.Chain, peers *Peers, programs func(context.Context) ([][]byte, error), health func(error)) {
+	currentPeersMu.Lock()
+	currentPeers = peers
+	currentPeersMu.Unlock()
+
+	// Fetch the peers' heights periodically.
+	go peers.pollHeights(ctx)
+
+	prevBlock, err := c.RecoverHeaders(ctx)
+	if err != nil {
+		log.Fatal(ctx, log.KeyError, err)
+	}
+	var prev *bc.BlockHeader
+	if prevBlock != nil {
+		prev = &prevBlock.BlockHeader
+	}
+
+	var (
+		filter    *ProgramFilter
+		nprogs    = -1
+		nfailures uint // for backoff
+		ntimeouts uint // for backoff
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Messagef(ctx, "Deposed, FetchLight exiting")
+			return
+		default:
+		}
+
+		req := &LightBlockRequest{Height: 1, TxIDs: watched()}
+		if prev != nil {
+			req.Height = prev.Height + 1
+		}
+		progs, err := programs(ctx)
+		if err == nil && len(progs) != nprogs {
+			// Programs are only ever added.
+			filter, nprogs = NewProgramFilter(progs), len(progs)
+		}
+		req.Filter = filter
+		p := peers.pick(req.Height, req.Height)
+		if err == nil && p == nil {
+			err = errors.New("no peer available")
+		}
+		if err == nil {
+			start := time.Now()
+			var lb *LightBlock
+			lb, err = getLightBlock(ctx, p.client, req, timeoutBackoffDur(ntimeouts))
+			if err == nil && lb == nil {
+				// Request timed out; see Peers.downloadBlock.
+				ntimeouts++
+				continue
+			}
+			if err == nil {
+				err = applyLightBlock(ctx, c, prev, lb)
+				if errors.Root(err) == protocol.ErrBadBlock {
+					if peers.isGenerator(p) {
+						log.Fatal(ctx, log.KeyError, err)
+					}
+					peers.penalize(p, err)
+				} else {
+					peers.report(p, time.Since(start), err)
+				}
+				if err == nil {
+					prev = lb.Header
+				}
+			} else {
+				peers.report(p, time.Since(start), err)
+			}
+		}
+		health(err)
+		if err != nil {
+			logNetworkError(ctx, err)
+			nfailures++
+			time.Sleep(backoffDur(nfailures))
+			continue
+		}
+		ntimeouts, nfailures = 0, 0
+	}
+}
+
+func applyLightBlock(ctx context.Context, c *protocol.Chain, prev *bc.BlockHeader, lb *LightBlock) error {
+	b, err := lb.verify(c.InitialBlockHash, prev)
+	if err != nil {
+		return err
+	}
+	return c.CommitBlock(ctx, b, nil)
+}
+
+// getLightBlock sends a get-light-block RPC request to
+// another Core.
+func getLightBlock(ctx context.Context, peer *rpc.Client, req *LightBlockRequest, timeout time.Duration) (*LightBlock, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var lb *LightBlock
+	err := peer.Call(ctx, "/rpc/get-light-block", req, &lb)
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, nil
+	}
+	return lb, errors.Wrap(err, "get light block rpc")
+}
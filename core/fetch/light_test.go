@@ -0,0 +1,112 @@
+package fetch
+
+import (
+	"testing"
+
+	"chain/crypto/ed25519"
+	"chain/errors"
+	"chain/protocol"
+	"chain/protocol/bc"
+	"chain/protocol/validation"
+	"chain/protocol/vmutil"
+)
+
+func TestLightBlock(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err := vmutil.BlockMultiSigProgram([]ed25519.PublicKey{pub}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	initial := &bc.BlockHeader{Version: 1, Height: 1, ConsensusProgram: prog}
+
+	var txs []*bc.Tx
+	for i := 0; i < 5; i++ {
+		txs = append(txs, bc.NewTx(bc.TxData{
+			Version: 1,
+			Outputs: []*bc.TxOutput{bc.NewTxOutput(bc.AssetID{}, uint64(i+1), []byte{byte(i)}, nil)},
+		}))
+	}
+	b := &bc.Block{
+		BlockHeader: bc.BlockHeader{
+			Version:                1,
+			Height:                 2,
+			PreviousBlockHash:      initial.Hash(),
+			TransactionsMerkleRoot: validation.CalcMerkleRoot(txs),
+			ConsensusProgram:       prog,
+		},
+		Transactions: txs,
+	}
+	hash := b.HashForSig()
+	b.Witness = [][]byte{ed25519.Sign(priv, hash[:])}
+
+	req := &LightBlockRequest{
+		Height: 2,
+		Filter: NewProgramFilter([][]byte{{1}}),
+		TxIDs:  []bc.Hash{txs[3].Hash},
+	}
+	lb, err := MakeLightBlock(b, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := lb.verify(initial.Hash(), initial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Transactions) != 2 || got.Transactions[0] != txs[1] || got.Transactions[1] != txs[3] {
+		t.Errorf("light block has wrong transactions")
+	}
+
+	// A transaction substituted by the peer must be rejected.
+	lb.Transactions[0].Tx = txs[0]
+	_, err = lb.verify(initial.Hash(), initial)
+	if errors.Root(err) != protocol.ErrBadBlock {
+		t.Errorf("verify with substituted tx = %v want %v", err, protocol.ErrBadBlock)
+	}
+}
+
+func TestProgramFilter(t *testing.T) {
+	var progs [][]byte
+	for i := 0; i < 1000; i++ {
+		progs = append(progs, []byte{byte(i >> 8), byte(i)})
+	}
+	f := NewProgramFilter(progs)
+	for _, p := range progs {
+		if !f.MayContain(p) {
+			t.Fatalf("filter doesn't contain %x", p)
+		}
+	}
+	var falsePos int
+	for i := 1000; i < 11000; i++ {
+		if f.MayContain([]byte{byte(i >> 16), byte(i >> 8), byte(i)}) {
+			falsePos++
+		}
+	}
+	if falsePos > 200 {
+		t.Errorf("got %d false positives in 10000, want about 100", falsePos)
+	}
+
+	// However many programs it holds, the filter is bounded.
+	progs = make([][]byte, 1e6)
+	for i := range progs {
+		progs[i] = []byte{byte(i >> 16), byte(i >> 8), byte(i)}
+	}
+	if n := len(NewProgramFilter(progs).Bits); n != maxFilterBytes {
+		t.Errorf("filter of %d programs is %d bytes, want %d", len(progs), n, maxFilterBytes)
+	}
+
+	cases := []*ProgramFilter{
+		{Bits: make([]byte, maxFilterBytes+1), Hashes: 1},
+		{Bits: make([]byte, minFilterBytes-1), Hashes: 1},
+		{Bits: make([]byte, minFilterBytes), Hashes: 0},
+		{Bits: make([]byte, minFilterBytes), Hashes: maxFilterHashes + 1},
+	}
+	for _, f := range cases {
+		_, err := MakeLightBlock(&bc.Block{}, &LightBlockRequest{Filter: f})
+		if errors.Root(err) != ErrBadFilter {
+			t.Errorf("MakeLightBlock with %d-byte %d-hash filter = %v want %s", len(f.Bits), f.Hashes, err, ErrBadFilter)
+		}
+	}
+}
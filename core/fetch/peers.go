@@ -0,0 +1,436 @@
+package fetch
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"chain/core/rpc"
+	"chain/errors"
+	"chain/log"
+	"chain/protocol"
+	"chain/protocol/bc"
+)
+
+const (
+	// scoreDecay weights the most recent request against a
+	// peer's history in its health score.
+	scoreDecay = 0.8
+
+	maxPenalty = time.Minute
+
+	// downloadWindow is the number of block ranges that
+	// may be downloaded in parallel, ahead of the block
+	// being applied.
+	downloadWindow = 8
+
+	// blockRangeSize is the most blocks requested from
+	// a peer at once.
+	blockRangeSize = 64
+)
+
+// Peers is a set of Cores from which blocks and snapshots
+// can be downloaded. The first peer is the generator; the
+// others are participant Cores that replicate its blocks.
+//
+// Each peer has a health score between 0 and 1, a moving
+// average of the success of recent requests to it. A peer
+// whose requests fail is not used again for a while, for
+// longer after each consecutive failure. Blocks from any
+// peer are validated before they're applied, so a peer
+// that sends a bad block is only penalized.
+type Peers struct {
+	mu    sync.Mutex
+	peers []*peer
+}
+
+type peer struct {
+	client *rpc.Client
+
+	height   uint64 // last reported block height
+	pruned   uint64 // blocks below this are gone, except the initial block
+	score    float64
+	latency  time.Duration // moving average of successful requests
+	failures uint          // consecutive
+	retryAt  time.Time
+	lastErr  error
+	noRange  bool // peer doesn't support get-block-range
+}
+
+// PeerStatus describes the health of a peer, for display.
+type PeerStatus struct {
+	URL         string    `json:"url"`
+	IsGenerator bool      `json:"is_generator"`
+	BlockHeight uint64    `json:"block_height"`
+	Pruned      uint64    `json:"pruned_height,omitempty"`
+	Score       float64   `json:"score"`
+	LatencyMS   int64     `json:"latency_ms"`
+	Failures    uint      `json:"consecutive_failures"`
+	RetryAt     time.Time `json:"retry_at,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+var (
+	currentPeers   *Peers
+	currentPeersMu sync.Mutex
+)
+
+// PeerStatuses returns the health of the peers in use
+// by Fetch, or nil if Fetch is not running.
+func PeerStatuses() []PeerStatus {
+	currentPeersMu.Lock()
+	ps := currentPeers
+	currentPeersMu.Unlock()
+	if ps == nil {
+		return nil
+	}
+	return ps.Status()
+}
+
+// NewPeers returns a peer set with the given generator
+// and other peers.
+func NewPeers(generator *rpc.Client, others ...*rpc.Client) *Peers {
+	ps := new(Peers)
+	for _, c := range append([]*rpc.Client{generator}, others...) {
+		ps.peers = append(ps.peers, &peer{client: c, score: 1})
+	}
+	return ps
+}
+
+// Generator returns the generator's client.
+func (ps *Peers) Generator() *rpc.Client {
+	return ps.peers[0].client
+}
+
+// Status returns the health of each peer.
+func (ps *Peers) Status() []PeerStatus {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	var statuses []PeerStatus
+	for i, p := range ps.peers {
+		s := PeerStatus{
+			URL:         p.client.BaseURL,
+			IsGenerator: i == 0,
+			BlockHeight: p.height,
+			Pruned:      p.pruned,
+			Score:       p.score,
+			LatencyMS:   int64(p.latency / time.Millisecond),
+			Failures:    p.failures,
+		}
+		if p.failures > 0 {
+			s.RetryAt = p.retryAt
+		}
+		if p.lastErr != nil {
+			s.LastError = p.lastErr.Error()
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses
+}
+
+// pick returns the healthiest peer that can serve the blocks
+// from low to high, or nil if none can right now. A peer that
+// reports a height of at least high-1 can serve them, waiting
+// for the block to be created if necessary, unless it has pruned
+// low. The generator is always assumed to have high.
+func (ps *Peers) pick(low, high uint64) *peer {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	now := time.Now()
+	var best *peer
+	for i, p := range ps.peers {
+		if now.Before(p.retryAt) {
+			continue
+		}
+		if i > 0 && p.height+1 < high {
+			continue
+		}
+		if low > 1 && low < p.pruned {
+			continue
+		}
+		if best == nil || p.score > best.score || (p.score == best.score && p.latency < best.latency) {
+			best = p
+		}
+	}
+	return best
+}
+
+// maxHeight returns the highest block height reported by
+// any peer.
+func (ps *Peers) maxHeight() uint64 {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	var h uint64
+	for _, p := range ps.peers {
+		if p.height > h {
+			h = p.height
+		}
+	}
+	return h
+}
+
+// report records the outcome of a request to p
+// that took time d.
+func (ps *Peers) report(p *peer, d time.Duration, err error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if err == nil {
+		p.score = scoreDecay*p.score + (1 - scoreDecay)
+		p.latency = time.Duration(scoreDecay*float64(p.latency) + (1-scoreDecay)*float64(d))
+		p.failures = 0
+		p.retryAt = time.Time{}
+		return
+	}
+
+	p.score = scoreDecay * p.score
+	p.failures++
+	p.lastErr = err
+	penalty := time.Second << (p.failures - 1)
+	if p.failures > 7 || penalty > maxPenalty {
+		penalty = maxPenalty
+	}
+	p.retryAt = time.Now().Add(penalty)
+}
+
+// penalize records that p sent invalid data. Its score is
+// reset and it isn't used for the maximum penalty period.
+func (ps *Peers) penalize(p *peer, err error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	p.score = 0
+	p.failures++
+	p.lastErr = err
+	p.retryAt = time.Now().Add(maxPenalty)
+}
+
+func (ps *Peers) isGenerator(p *peer) bool {
+	return p == ps.peers[0]
+}
+
+// pollHeights polls each peer for its block height
+// periodically until ctx is done.
+func (ps *Peers) pollHeights(ctx context.Context) {
+	ps.updateHeights(ctx)
+
+	ticker := time.NewTicker(heightPollingPeriod)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Messagef(ctx, "Deposed, pollHeights exiting")
+			ticker.Stop()
+			return
+		case <-ticker.C:
+			ps.updateHeights(ctx)
+		}
+	}
+}
+
+func (ps *Peers) updateHeights(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i, p := range ps.peers {
+		wg.Add(1)
+		go func(i int, p *peer) {
+			defer wg.Done()
+			start := time.Now()
+			h, pruned, err := getHeight(ctx, p.client)
+			ps.report(p, time.Since(start), err)
+			if err != nil {
+				logNetworkError(ctx, err)
+				return
+			}
+			ps.mu.Lock()
+			p.height = h
+			p.pruned = pruned
+			ps.mu.Unlock()
+
+			if i == 0 {
+				generatorLock.Lock()
+				generatorHeight = h
+				generatorHeightFetchedAt = time.Now()
+				generatorLock.Unlock()
+			}
+		}(i, p)
+	}
+	wg.Wait()
+}
+
+type fetchedBlock struct {
+	block *bc.Block
+	peer  *peer // the peer that sent block
+}
+
+// download starts goroutines to download blocks from ps,
+// starting at the given height and incrementing from there.
+// While far behind the network, it requests ranges of up to
+// blockRangeSize blocks, with up to downloadWindow ranges in
+// flight at once, each from the healthiest peer that has it.
+// Blocks are sent on the returned channel in order. Errors
+// are sent on the other channel; progress will halt unless
+// callers are reading from both. Both channels are closed
+// once ctx is done.
+func (ps *Peers) download(ctx context.Context, height uint64) (chan fetchedBlock, chan error) {
+	blockch := make(chan fetchedBlock)
+	errch := make(chan error)
+	pending := make(chan chan fetchedBlock, downloadWindow)
+
+	var wg sync.WaitGroup
+	go func() {
+		defer close(pending)
+		for h, n := height, uint64(0); ; h += n {
+			// Don't request blocks far beyond the tip of the
+			// network. Only the next block is worth waiting for.
+			for h > height && h > ps.maxHeight()+1 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(heightPollingPeriod / 4):
+				}
+			}
+			n = 1
+			if tip := ps.maxHeight(); tip > h {
+				n = tip - h + 1
+				if n > blockRangeSize {
+					n = blockRangeSize
+				}
+			}
+
+			ch := make(chan fetchedBlock, n)
+			select {
+			case <-ctx.Done():
+				return
+			case pending <- ch:
+			}
+			wg.Add(1)
+			go func(h, n uint64) {
+				defer wg.Done()
+				defer close(ch)
+				ps.downloadRange(ctx, h, n, ch, errch)
+			}(h, n)
+		}
+	}()
+
+	go func() {
+		defer func() {
+			// Wait for all the workers to finish before
+			// closing the channels they send on.
+			for range pending {
+			}
+			wg.Wait()
+			close(blockch)
+			close(errch)
+		}()
+		for ch := range pending {
+			for fb := range ch {
+				select {
+				case <-ctx.Done():
+					return
+				case blockch <- fb:
+				}
+			}
+			// A worker only stops short when ctx is done.
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	}()
+	return blockch, errch
+}
+
+// downloadRange downloads the n blocks starting at the given
+// height and sends them on ch, which must have room for all
+// of them. It uses the healthiest available peer, failing over
+// to others, until it has every block or ctx is done.
+func (ps *Peers) downloadRange(ctx context.Context, height, n uint64, ch chan<- fetchedBlock, errch chan<- error) {
+	var nfailures uint // for backoff
+	var ntimeouts uint // for backoff
+	for n > 0 && ctx.Err() == nil {
+		p := ps.pick(height, height+n-1)
+		if p == nil {
+			// Every peer that has these blocks is penalized.
+			// Wait for one of them to become available.
+			nfailures++
+			time.Sleep(backoffDur(nfailures))
+			continue
+		}
+
+		var got uint64
+		start := time.Now()
+		err := ps.getBlocks(ctx, p, height, n, timeoutBackoffDur(ntimeouts), func(b *bc.Block) error {
+			if b.Height != height+got {
+				err := errors.Wrapf(protocol.ErrBadBlock, "peer sent block %d, want %d", b.Height, height+got)
+				ps.penalize(p, err)
+				return err
+			}
+			ch <- fetchedBlock{block: b, peer: p}
+			got++
+			return nil
+		})
+		if got > 0 {
+			ps.mu.Lock()
+			if p.height < height+got-1 {
+				p.height = height + got - 1
+			}
+			ps.mu.Unlock()
+		}
+		height += got
+		n -= got
+
+		if errors.Root(err) == protocol.ErrBadBlock {
+			// Already penalized.
+		} else if err == nil && got == 0 {
+			// Request time out. There might not have been any blocks published,
+			// or there was a network error or it just took too long to process the
+			// request. It's only the peer's fault if it said it had the block.
+			ntimeouts++
+			ps.mu.Lock()
+			had := p.height >= height
+			ps.mu.Unlock()
+			if had {
+				ps.report(p, time.Since(start), errors.New("get blocks timed out"))
+			}
+			continue
+		} else {
+			ps.report(p, time.Since(start), err)
+		}
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case errch <- err:
+			}
+			nfailures++
+			time.Sleep(backoffDur(nfailures))
+			continue
+		}
+		ntimeouts, nfailures = 0, 0
+	}
+}
+
+// getBlocks calls f with each block in the range of n
+// blocks starting at height, as sent by p. It may return
+// fewer blocks than requested, and none if the request
+// times out. Peers that don't support the get-block-range
+// RPC are sent get-block requests instead.
+func (ps *Peers) getBlocks(ctx context.Context, p *peer, height, n uint64, timeout time.Duration, f func(*bc.Block) error) error {
+	ps.mu.Lock()
+	noRange := p.noRange
+	ps.mu.Unlock()
+
+	if !noRange {
+		err := getBlockRange(ctx, p.client, height, n, timeout, f)
+		if !unsupported(err) {
+			return err
+		}
+		ps.mu.Lock()
+		p.noRange = true
+		ps.mu.Unlock()
+	}
+
+	b, err := getBlock(ctx, p.client, height, timeout)
+	if err != nil || b == nil {
+		return err
+	}
+	return f(b)
+}
@@ -0,0 +1,126 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"chain/core/rpc"
+	"chain/encoding/blockchain"
+	"chain/protocol/bc"
+)
+
+func TestPeersPick(t *testing.T) {
+	gen := &rpc.Client{BaseURL: "gen"}
+	a := &rpc.Client{BaseURL: "a"}
+	b := &rpc.Client{BaseURL: "b"}
+	ps := NewPeers(gen, a, b)
+	ps.peers[1].height = 10
+	ps.peers[2].height = 5
+
+	ps.report(ps.peers[0], time.Second, errors.New("boom"))
+	if p := ps.pick(11, 11); p.client != a {
+		t.Errorf("pick(11, 11) = %s want a", p.client.BaseURL)
+	}
+	// b is healthier but doesn't have block 8.
+	ps.report(ps.peers[1], time.Second, errors.New("boom"))
+	ps.peers[1].retryAt = time.Time{}
+	if p := ps.pick(8, 8); p.client != a {
+		t.Errorf("pick(8, 8) = %s want a", p.client.BaseURL)
+	}
+	if p := ps.pick(6, 6); p.client != b {
+		t.Errorf("pick(6, 6) = %s want b", p.client.BaseURL)
+	}
+
+	// b has pruned block 3, but still has the initial block.
+	ps.peers[2].pruned = 4
+	if p := ps.pick(3, 6); p.client != a {
+		t.Errorf("pick(3, 6) = %s want a", p.client.BaseURL)
+	}
+	if p := ps.pick(1, 1); p.client != b {
+		t.Errorf("pick(1, 1) = %s want b", p.client.BaseURL)
+	}
+
+	ps.penalize(ps.peers[1], errors.New("bad block"))
+	if p := ps.pick(11, 11); p != nil {
+		t.Errorf("pick(11, 11) = %s want nil", p.client.BaseURL)
+	}
+}
+
+func TestPeersDownload(t *testing.T) {
+	cases := []struct {
+		noRange bool // the peer only supports get-block
+		start   uint64
+	}{
+		{false, 3},
+		{true, 3},
+		{false, 1},
+	}
+	for _, c := range cases {
+		down := blockServer(true, false)
+		up := blockServer(false, c.noRange)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		ps := NewPeers(&rpc.Client{BaseURL: down.URL}, &rpc.Client{BaseURL: up.URL})
+		ps.updateHeights(ctx)
+		blockch, errch := ps.download(ctx, c.start)
+
+	loop:
+		for want := c.start; want <= 20; {
+			select {
+			case <-errch:
+			case fb := <-blockch:
+				if fb.block.Height != want {
+					t.Errorf("noRange=%t: got block %d want %d", c.noRange, fb.block.Height, want)
+					break loop
+				}
+				if fb.peer.client.BaseURL != up.URL {
+					t.Errorf("noRange=%t: block %d from %s want %s", c.noRange, want, fb.peer.client.BaseURL, up.URL)
+				}
+				want++
+			case <-time.After(10 * time.Second):
+				t.Errorf("noRange=%t: timed out", c.noRange)
+				break loop
+			}
+		}
+		cancel()
+		up.Close()
+		down.Close()
+	}
+}
+
+// blockServer returns a server with 20 blocks.
+func blockServer(fail, noRange bool) *httptest.Server {
+	const height = 20
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.URL.Path == "/rpc/block-height":
+			json.NewEncoder(w).Encode(map[string]uint64{"block_height": height})
+		case fail:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		case req.URL.Path == "/rpc/get-block":
+			var h uint64
+			json.NewDecoder(req.Body).Decode(&h)
+			json.NewEncoder(w).Encode(&bc.Block{BlockHeader: bc.BlockHeader{Height: h}})
+		case req.URL.Path == "/rpc/get-block-range" && !noRange:
+			var x struct{ Height, Count uint64 }
+			json.NewDecoder(req.Body).Decode(&x)
+			// Send at most 5 blocks, as if the rest
+			// had not yet been created.
+			for h := x.Height; h < x.Height+x.Count && h < x.Height+5 && h <= height; h++ {
+				b := &bc.Block{BlockHeader: bc.BlockHeader{Height: h}}
+				var buf bytes.Buffer
+				b.WriteTo(&buf)
+				blockchain.WriteVarstr31(w, buf.Bytes())
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":"CH006"}`))
+		}
+	}))
+}
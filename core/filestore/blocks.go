@@ -0,0 +1,252 @@
+package filestore
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+
+	"chain/core/txdb"
+	"chain/database/pg"
+	"chain/errors"
+)
+
+// Each record in the block file is a header followed by
+// the serialized block. The header holds the block's height,
+// the length of the block, and its CRC-32C checksum.
+//
+// The index file has an entry for each height h at offset
+// (h-1)*entrySize, holding the offset of the block's record
+// in the block file, its length, and its checksum. An entry
+// of all zeros means there is no block at that height.
+const (
+	headerSize = 16
+	entrySize  = 16
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+type entry struct {
+	offset int64
+	size   uint32
+	sum    uint32
+}
+
+// recover makes the index and the block file consistent
+// after the process stopped, possibly in the middle of
+// saving a block. It must be called before any other use
+// of the files.
+func (s *Store) recover() error {
+	fi, err := s.blocks.Stat()
+	if err != nil {
+		return errors.Wrap(err, "reading block file size")
+	}
+	s.end = fi.Size()
+	fi, err = s.index.Stat()
+	if err != nil {
+		return errors.Wrap(err, "reading index size")
+	}
+
+	// Find the last index entry whose block is intact.
+	// Entries are only written once their blocks are synced,
+	// so any entry after it was being written when the
+	// process stopped.
+	var end int64
+	n := uint64(fi.Size() / entrySize)
+	for ; n > 0; n-- {
+		e, err := s.readEntry(n)
+		if err != nil {
+			return err
+		}
+		if e.size == 0 {
+			continue
+		}
+		if _, err := s.readRecord(n, e); err == nil {
+			end = e.offset + headerSize + int64(e.size)
+			break
+		}
+	}
+	err = s.index.Truncate(int64(n) * entrySize)
+	if err != nil {
+		return errors.Wrap(err, "truncating index")
+	}
+	s.height = n
+
+	// Index any intact blocks after it. The process stopped
+	// before their entries were written. Anything after those
+	// is a partly written block.
+	for {
+		height, e, err := s.readHeader(end)
+		if err != nil || height <= s.height {
+			break
+		}
+		if _, err := s.readRecord(height, e); err != nil {
+			break
+		}
+		err = s.writeEntry(height, e)
+		if err != nil {
+			return err
+		}
+		s.height = height
+		end += headerSize + int64(e.size)
+	}
+	err = s.blocks.Truncate(end)
+	if err != nil {
+		return errors.Wrap(err, "truncating block file")
+	}
+	s.end = end
+
+	err = s.findLow()
+	if err != nil {
+		return err
+	}
+	err = s.blocks.Sync()
+	if err != nil {
+		return errors.Wrap(err, "syncing block file")
+	}
+	err = s.index.Sync()
+	return errors.Wrap(err, "syncing index")
+}
+
+// appendBlock writes the serialized block at the given height
+// to the end of the block file, then adds it to the index.
+func (s *Store) appendBlock(height uint64, data []byte) error {
+	e := entry{
+		offset: s.end,
+		size:   uint32(len(data)),
+		sum:    crc32.Checksum(data, castagnoli),
+	}
+	rec := make([]byte, headerSize+len(data))
+	binary.BigEndian.PutUint64(rec[0:8], height)
+	binary.BigEndian.PutUint32(rec[8:12], e.size)
+	binary.BigEndian.PutUint32(rec[12:16], e.sum)
+	copy(rec[headerSize:], data)
+
+	// If any of these steps fails, the next block
+	// overwrites whatever was written.
+	_, err := s.blocks.WriteAt(rec, s.end)
+	if err != nil {
+		return errors.Wrap(err, "writing block")
+	}
+	err = s.blocks.Sync()
+	if err != nil {
+		return errors.Wrap(err, "syncing block file")
+	}
+	err = s.writeEntry(height, e)
+	if err != nil {
+		return err
+	}
+	err = s.index.Sync()
+	if err != nil {
+		return errors.Wrap(err, "syncing index")
+	}
+	s.end += int64(len(rec))
+	s.height = height
+	if s.low == 0 && height > 1 {
+		s.low = height
+	}
+	return nil
+}
+
+// readBlock returns the serialized block at the given height.
+func (s *Store) readBlock(height uint64) ([]byte, error) {
+	if height == 0 || height > s.height {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "no block at height %d", height)
+	}
+	e, err := s.readEntry(height)
+	if err != nil {
+		return nil, err
+	}
+	if e.size == 0 {
+		// Only the blocks before the first one saved
+		// after the initial block can be missing.
+		return nil, errors.WithDetailf(txdb.ErrPruned, "block %d is not stored; this core has no blocks below height %d except the initial block", height, s.low)
+	}
+	return s.readRecord(height, e)
+}
+
+// findLow sets s.low to the lowest height above 1 with a block.
+func (s *Store) findLow() error {
+	s.low = 0
+	if s.height < 2 {
+		return nil
+	}
+	r := bufio.NewReader(io.NewSectionReader(s.index, entrySize, int64(s.height-1)*entrySize))
+	var buf [entrySize]byte
+	for h := uint64(2); h <= s.height; h++ {
+		_, err := io.ReadFull(r, buf[:])
+		if err != nil {
+			return errors.Wrap(err, "reading index")
+		}
+		if binary.BigEndian.Uint32(buf[8:12]) != 0 {
+			s.low = h
+			return nil
+		}
+	}
+	return nil
+}
+
+// readRecord reads the block record described by e and
+// checks that it matches e and has the given height.
+func (s *Store) readRecord(height uint64, e entry) ([]byte, error) {
+	h, got, err := s.readHeader(e.offset)
+	if err != nil {
+		return nil, errors.Wrapf(err, "block %d", height)
+	}
+	if h != height || got != e {
+		return nil, errors.Wrapf(errCorrupt, "block %d: record does not match index", height)
+	}
+	data := make([]byte, e.size)
+	_, err = s.blocks.ReadAt(data, e.offset+headerSize)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading block %d", height)
+	}
+	if crc32.Checksum(data, castagnoli) != e.sum {
+		return nil, errors.Wrapf(errCorrupt, "block %d: bad checksum", height)
+	}
+	return data, nil
+}
+
+// readHeader reads the header of the block record at the
+// given offset, returning the block's height and an index
+// entry for it.
+func (s *Store) readHeader(offset int64) (uint64, entry, error) {
+	var hdr [headerSize]byte
+	_, err := s.blocks.ReadAt(hdr[:], offset)
+	if err == io.EOF {
+		return 0, entry{}, errors.Wrap(errCorrupt, "short block record")
+	} else if err != nil {
+		return 0, entry{}, errors.Wrap(err, "reading block record")
+	}
+	e := entry{
+		offset: offset,
+		size:   binary.BigEndian.Uint32(hdr[8:12]),
+		sum:    binary.BigEndian.Uint32(hdr[12:16]),
+	}
+	if offset+headerSize+int64(e.size) > s.end {
+		return 0, entry{}, errors.Wrap(errCorrupt, "short block record")
+	}
+	return binary.BigEndian.Uint64(hdr[0:8]), e, nil
+}
+
+func (s *Store) readEntry(height uint64) (entry, error) {
+	var buf [entrySize]byte
+	_, err := s.index.ReadAt(buf[:], int64(height-1)*entrySize)
+	if err != nil {
+		return entry{}, errors.Wrapf(err, "reading index entry %d", height)
+	}
+	return entry{
+		offset: int64(binary.BigEndian.Uint64(buf[0:8])),
+		size:   binary.BigEndian.Uint32(buf[8:12]),
+		sum:    binary.BigEndian.Uint32(buf[12:16]),
+	}, nil
+}
+
+func (s *Store) writeEntry(height uint64, e entry) error {
+	var buf [entrySize]byte
+	binary.BigEndian.PutUint64(buf[0:8], uint64(e.offset))
+	binary.BigEndian.PutUint32(buf[8:12], e.size)
+	binary.BigEndian.PutUint32(buf[12:16], e.sum)
+	_, err := s.index.WriteAt(buf[:], int64(height-1)*entrySize)
+	return errors.Wrapf(err, "writing index entry %d", height)
+}
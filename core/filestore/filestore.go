@@ -0,0 +1,187 @@
+// Package filestore provides a Store implementation that keeps
+// blocks and state snapshots in files in a local directory,
+// instead of in Postgres. A Core using it still keeps its
+// config, pins, and MockHSM keys in Postgres, but its blocks
+// are local to one process, so it must be a signer or
+// participant run as a single cored process.
+//
+// Blocks are appended to a single block file. An index file
+// holds a fixed-size entry for each height, giving the location
+// and checksum of its block in the block file. Each snapshot is
+// written to a temporary file and renamed into place.
+//
+// Every write is synced before the call that made it returns,
+// and the block file is written and synced before the index.
+// When a Store is opened, any block or index entry that was only
+// partly written is discarded, and blocks that are in the block
+// file but missing from the index are indexed again, so the
+// store is consistent no matter when the process stopped.
+//
+// A directory may only be used by one process at a time. Open
+// takes an exclusive lock on a lock file in the directory, and
+// fails if another process holds it.
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"chain/core/txdb"
+	"chain/errors"
+	"chain/protocol"
+	"chain/protocol/bc"
+)
+
+var errCorrupt = errors.New("corrupt data")
+
+// ErrLocked is returned by Open when another
+// process is using the store's directory.
+var ErrLocked = errors.New("store directory is in use")
+
+// Store satisfies the protocol.Store interface.
+type Store struct {
+	dir  string
+	lock *os.File // held while the store is open
+
+	mu     sync.Mutex
+	blocks *os.File // append-only block records
+	index  *os.File // one entry per height
+	height uint64
+	end    int64  // where the next block record goes
+	low    uint64 // lowest height above 1 with a block
+
+	snapshotMu sync.Mutex
+}
+
+var _ protocol.Store = (*Store)(nil)
+
+// Open opens the store in dir, creating it if necessary,
+// and recovers from any write that was interrupted.
+func Open(dir string) (*Store, error) {
+	err := os.MkdirAll(filepath.Join(dir, snapshotDir), 0700)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating store directory")
+	}
+
+	s := &Store{dir: dir}
+	s.lock, err = lockFile(filepath.Join(dir, "lock"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "locking %s", dir)
+	}
+	s.blocks, err = os.OpenFile(filepath.Join(dir, "blocks"), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		s.lock.Close()
+		return nil, errors.Wrap(err, "opening block file")
+	}
+	s.index, err = os.OpenFile(filepath.Join(dir, "index"), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		s.blocks.Close()
+		s.lock.Close()
+		return nil, errors.Wrap(err, "opening index file")
+	}
+
+	err = s.recover()
+	if err == nil {
+		err = s.removeTempSnapshots()
+	}
+	if err == nil {
+		err = syncDir(dir)
+	}
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close closes the store's files, releasing
+// its lock on the directory.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.blocks.Close()
+	if err1 := s.index.Close(); err == nil {
+		err = err1
+	}
+	if err1 := s.lock.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+func (s *Store) Height(context.Context) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.height, nil
+}
+
+func (s *Store) GetBlock(ctx context.Context, height uint64) (*bc.Block, error) {
+	data, err := s.GetRawBlock(ctx, height)
+	if err != nil {
+		return nil, err
+	}
+	b := new(bc.Block)
+	err = b.UnmarshalBinary(data)
+	return b, errors.Wrapf(err, "decoding block %d", height)
+}
+
+// GetRawBlock returns the serialized block at the provided height.
+func (s *Store) GetRawBlock(ctx context.Context, height uint64) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.readBlock(height)
+}
+
+// SaveBlock appends a block to the store. Blocks must be
+// saved in increasing order of height, but the heights need
+// not be consecutive, as when a Core starts from a snapshot.
+// Saving a block that is already stored does nothing.
+func (s *Store) SaveBlock(ctx context.Context, b *bc.Block) error {
+	var buf bytes.Buffer
+	_, err := b.WriteTo(&buf)
+	if err != nil {
+		return errors.Wrap(err, "serializing block")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b.Height <= s.height {
+		data, err := s.readBlock(b.Height)
+		if errors.Root(err) == txdb.ErrPruned {
+			return errors.Wrapf(errors.New("out of order block"), "block %d is below height %d", b.Height, s.height)
+		} else if err != nil {
+			return err
+		}
+		existing := new(bc.Block)
+		err = existing.UnmarshalBinary(data)
+		if err != nil {
+			return errors.Wrapf(err, "decoding block %d", b.Height)
+		}
+		if existing.Hash() != b.Hash() {
+			return errors.Wrapf(errors.New("conflicting block"), "already have a block at height %d", b.Height)
+		}
+		return nil
+	}
+	return s.appendBlock(b.Height, buf.Bytes())
+}
+
+// PrunedHeight returns the height below which this store has
+// no blocks, other than the initial block, or 0 if it has every
+// block up to its height. Blocks are missing if the Core started
+// from a snapshot.
+func (s *Store) PrunedHeight(context.Context) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.low <= 2 {
+		return 0, nil
+	}
+	return s.low, nil
+}
+
+// FinalizeBlock does nothing. SaveBlock already made the
+// block durable, and no other process reads the store.
+func (s *Store) FinalizeBlock(context.Context, uint64) error { return nil }
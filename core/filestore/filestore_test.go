@@ -0,0 +1,276 @@
+package filestore
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/davecgh/go-spew/spew"
+
+	"chain/core/txdb"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/state"
+)
+
+func TestSaveBlocks(t *testing.T) {
+	ctx := context.Background()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Start from a snapshot, leaving a gap.
+	for _, h := range []uint64{1, 5, 6} {
+		err = s.SaveBlock(ctx, newBlock(h))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = s.SaveBlock(ctx, newBlock(5))
+	if err != nil {
+		t.Errorf("saving block 5 again: %v", err)
+	}
+	conflict := newBlock(6)
+	conflict.TimestampMS++
+	if err = s.SaveBlock(ctx, conflict); err == nil {
+		t.Error("saved a conflicting block 6")
+	}
+	if err = s.SaveBlock(ctx, newBlock(3)); err == nil {
+		t.Error("saved block 3 below height 6")
+	}
+	s.Close()
+
+	s, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	checkBlocks(t, s, 6, 1, 5, 6)
+	if _, err := s.GetBlock(ctx, 3); errors.Root(err) != txdb.ErrPruned {
+		t.Errorf("got error %v for block 3, want %s", err, txdb.ErrPruned)
+	}
+	if pruned, _ := s.PrunedHeight(ctx); pruned != 5 {
+		t.Errorf("pruned height = %d want 5", pruned)
+	}
+}
+
+func TestLock(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Open(dir)
+	if errors.Root(err) != ErrLocked {
+		t.Errorf("opening a store in use = %v want %s", err, ErrLocked)
+	}
+
+	s.Close()
+	s, err = Open(dir)
+	if err != nil {
+		t.Fatalf("opening the store after closing it: %v", err)
+	}
+	s.Close()
+}
+
+func TestRecover(t *testing.T) {
+	cases := []struct {
+		name   string
+		damage func(dir string) error
+		want   []uint64
+	}{{
+		name: "partial block",
+		damage: func(dir string) error {
+			return appendFile(filepath.Join(dir, "blocks"), []byte{0, 0, 0, 0, 0, 0, 0, 4, 0, 0})
+		},
+		want: []uint64{1, 2, 3},
+	}, {
+		name: "partial index entry",
+		damage: func(dir string) error {
+			return appendFile(filepath.Join(dir, "index"), []byte{0, 0, 0})
+		},
+		want: []uint64{1, 2, 3},
+	}, {
+		name: "missing index entries",
+		damage: func(dir string) error {
+			return os.Truncate(filepath.Join(dir, "index"), entrySize)
+		},
+		want: []uint64{1, 2, 3},
+	}, {
+		name: "bad index entry",
+		damage: func(dir string) error {
+			f, err := os.OpenFile(filepath.Join(dir, "index"), os.O_RDWR, 0)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = f.WriteAt([]byte{0xff, 0xff}, 2*entrySize+8)
+			return err
+		},
+		want: []uint64{1, 2, 3},
+	}, {
+		name: "torn last block",
+		damage: func(dir string) error {
+			name := filepath.Join(dir, "blocks")
+			fi, err := os.Stat(name)
+			if err != nil {
+				return err
+			}
+			return os.Truncate(name, fi.Size()-1)
+		},
+		want: []uint64{1, 2},
+	}}
+
+	ctx := context.Background()
+	for _, c := range cases {
+		dir := tempDir(t)
+		s, err := Open(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for h := uint64(1); h <= 3; h++ {
+			err = s.SaveBlock(ctx, newBlock(h))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		s.Close()
+
+		err = c.damage(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err = Open(dir)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		height := c.want[len(c.want)-1]
+		checkBlocks(t, s, height, c.want...)
+
+		// The store should work normally after recovering.
+		err = s.SaveBlock(ctx, newBlock(height+1))
+		if err != nil {
+			t.Errorf("%s: saving block %d: %v", c.name, height+1, err)
+		}
+		s.Close()
+		s, err = Open(dir)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		checkBlocks(t, s, height+1, append(c.want, height+1)...)
+		s.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	ctx := context.Background()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	snapshot, height, err := s.LatestSnapshot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != 0 || snapshot.Tree.RootHash() != (bc.Hash{}) {
+		t.Errorf("got snapshot at height %d, want empty snapshot", height)
+	}
+
+	snapshots := make(map[uint64]*state.Snapshot)
+	for h := uint64(1); h <= 3; h++ {
+		snapshots[h] = state.Empty()
+		err = snapshots[h].Tree.Insert([]byte{byte(h)}, []byte{byte(h)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.SaveSnapshot(ctx, h, snapshots[h])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.GetSnapshot(ctx, 1); err == nil {
+		t.Error("got snapshot 1, want it removed")
+	}
+	snapshot, height, err = s.LatestSnapshot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != 3 || snapshot.Tree.RootHash() != snapshots[3].Tree.RootHash() {
+		t.Errorf("got snapshot at height %d, want 3", height)
+	}
+
+	// A damaged snapshot falls back to the previous one.
+	err = appendFile(s.snapshotPath(3), []byte{0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot, height, err = s.LatestSnapshot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != 2 || snapshot.Tree.RootHash() != snapshots[2].Tree.RootHash() {
+		t.Errorf("got snapshot at height %d, want 2", height)
+	}
+}
+
+func checkBlocks(t *testing.T, s *Store, height uint64, want ...uint64) {
+	ctx := context.Background()
+	got, err := s.Height(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != height {
+		t.Errorf("height = %d want %d", got, height)
+	}
+	for _, h := range want {
+		b, err := s.GetBlock(ctx, h)
+		if err != nil {
+			t.Errorf("getting block %d: %v", h, err)
+			continue
+		}
+		if b.Hash() != newBlock(h).Hash() {
+			t.Errorf("block %d:\ngot:  %s\nwant: %s", h, spew.Sdump(b), spew.Sdump(newBlock(h)))
+		}
+	}
+}
+
+func newBlock(height uint64) *bc.Block {
+	return &bc.Block{
+		BlockHeader: bc.BlockHeader{
+			Version:     1,
+			Height:      height,
+			TimestampMS: 1000 * height,
+		},
+	}
+}
+
+func appendFile(name string, data []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(data)
+	return err
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "filestore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
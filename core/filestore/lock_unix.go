@@ -0,0 +1,28 @@
+//+build linux darwin
+
+package filestore
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile opens the file at path, creating it if necessary,
+// and takes an exclusive lock on it. The lock is released
+// when the file is closed or the process exits. If another
+// open file holds the lock, lockFile returns ErrLocked.
+func lockFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, ErrLocked
+		}
+		return nil, err
+	}
+	return f, nil
+}
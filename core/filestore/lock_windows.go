@@ -0,0 +1,28 @@
+package filestore
+
+import (
+	"os"
+	"syscall"
+)
+
+// errorSharingViolation is the Windows error
+// ERROR_SHARING_VIOLATION.
+const errorSharingViolation syscall.Errno = 32
+
+// lockFile opens the file at path, creating it if necessary,
+// with no sharing, so no one else can open it until the file
+// is closed or the process exits. If the file is already
+// open, lockFile returns ErrLocked.
+func lockFile(path string) (*os.File, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	h, err := syscall.CreateFile(p, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil, syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err == errorSharingViolation {
+		return nil, ErrLocked
+	} else if err != nil {
+		return nil, err
+	}
+	return os.NewFile(uintptr(h), path), nil
+}
@@ -0,0 +1,231 @@
+package filestore
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"chain/core/txdb"
+	"chain/database/pg"
+	"chain/errors"
+	"chain/log"
+	"chain/protocol/state"
+)
+
+const (
+	snapshotDir = "snapshots"
+
+	// keepSnapshots is the number of snapshots kept
+	// in the store, so that peers can finish downloading
+	// the previous one after a new one is saved.
+	keepSnapshots = 2
+)
+
+// Each snapshot is stored in its own file, named by its
+// height, holding the CRC-32C checksum of the snapshot
+// followed by the snapshot in Chain Core's binary,
+// protobuf representation.
+
+// SaveSnapshot saves a state snapshot to the store,
+// removing older snapshots. See keepSnapshots.
+func (s *Store) SaveSnapshot(ctx context.Context, height uint64, snapshot *state.Snapshot) error {
+	data, err := txdb.EncodeSnapshot(snapshot)
+	if err != nil {
+		return err
+	}
+
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+
+	dir := filepath.Join(s.dir, snapshotDir)
+	f, err := ioutil.TempFile(dir, "tmp-")
+	if err != nil {
+		return errors.Wrap(err, "creating snapshot file")
+	}
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.Checksum(data, castagnoli))
+	_, err = f.Write(sum[:])
+	if err == nil {
+		_, err = f.Write(data)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), s.snapshotPath(height))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return errors.Wrap(err, "writing snapshot file")
+	}
+	err = syncDir(dir)
+	if err != nil {
+		return err
+	}
+
+	heights, err := s.snapshotHeights()
+	if err != nil {
+		return err
+	}
+	for i, h := range heights {
+		if i >= keepSnapshots {
+			err = os.Remove(s.snapshotPath(h))
+			if err != nil {
+				// It can be removed next time.
+				log.Error(ctx, err)
+			}
+		}
+	}
+	return nil
+}
+
+// LatestSnapshot returns the most recent intact state
+// snapshot and its height, or an empty snapshot if there
+// is none.
+func (s *Store) LatestSnapshot(ctx context.Context) (*state.Snapshot, uint64, error) {
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+
+	heights, err := s.snapshotHeights()
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, height := range heights {
+		data, err := s.readSnapshot(height)
+		if err == nil {
+			var snapshot *state.Snapshot
+			snapshot, err = txdb.DecodeSnapshot(data)
+			if err == nil {
+				return snapshot, height, nil
+			}
+		}
+		// Fall back to an older snapshot. The
+		// blocks since then will be replayed.
+		log.Error(ctx, errors.Wrapf(err, "loading snapshot at height %d", height))
+	}
+	return state.Empty(), 0, nil
+}
+
+// LatestSnapshotInfo returns the height and size of the most
+// recent state snapshot in the store.
+func (s *Store) LatestSnapshotInfo(ctx context.Context) (height uint64, size uint64, err error) {
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+
+	heights, err := s.snapshotHeights()
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(heights) == 0 {
+		return 0, 0, errors.WithDetail(pg.ErrUserInputNotFound, "no state snapshot")
+	}
+	fi, err := os.Stat(s.snapshotPath(heights[0]))
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "reading snapshot size")
+	}
+	return heights[0], uint64(fi.Size()) - 4, nil
+}
+
+// GetSnapshot returns the state snapshot stored at the provided height,
+// in Chain Core's binary protobuf representation. If no snapshot exists
+// at the provided height, an error is returned.
+func (s *Store) GetSnapshot(ctx context.Context, height uint64) ([]byte, error) {
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+	return s.readSnapshot(height)
+}
+
+// SnapshotChain returns the parts needed to restore the snapshot
+// at the provided height. Snapshots are always stored in full,
+// so there is only one.
+func (s *Store) SnapshotChain(ctx context.Context, height uint64) ([]txdb.SnapshotPart, error) {
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+
+	fi, err := os.Stat(s.snapshotPath(height))
+	if os.IsNotExist(err) {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "no state snapshot at height %d", height)
+	} else if err != nil {
+		return nil, errors.Wrap(err, "reading snapshot size")
+	}
+	return []txdb.SnapshotPart{{Height: height, Size: uint64(fi.Size()) - 4}}, nil
+}
+
+// GetSnapshotPart is the same as GetSnapshot, since
+// snapshots are always stored in full.
+func (s *Store) GetSnapshotPart(ctx context.Context, height uint64) ([]byte, error) {
+	return s.GetSnapshot(ctx, height)
+}
+
+func (s *Store) readSnapshot(height uint64) ([]byte, error) {
+	data, err := ioutil.ReadFile(s.snapshotPath(height))
+	if os.IsNotExist(err) {
+		return nil, pg.ErrUserInputNotFound
+	} else if err != nil {
+		return nil, errors.Wrap(err, "reading snapshot file")
+	}
+	if len(data) < 4 || crc32.Checksum(data[4:], castagnoli) != binary.BigEndian.Uint32(data) {
+		return nil, errors.Wrapf(errCorrupt, "snapshot %d: bad checksum", height)
+	}
+	return data[4:], nil
+}
+
+func (s *Store) snapshotPath(height uint64) string {
+	return filepath.Join(s.dir, snapshotDir, fmt.Sprintf("%020d", height))
+}
+
+// snapshotHeights returns the heights of the stored
+// snapshots, most recent first.
+func (s *Store) snapshotHeights() ([]uint64, error) {
+	fis, err := ioutil.ReadDir(filepath.Join(s.dir, snapshotDir))
+	if err != nil {
+		return nil, errors.Wrap(err, "listing snapshots")
+	}
+	var heights []uint64
+	for i := len(fis) - 1; i >= 0; i-- { // sorted by name
+		h, err := strconv.ParseUint(fis[i].Name(), 10, 64)
+		if err == nil {
+			heights = append(heights, h)
+		}
+	}
+	return heights, nil
+}
+
+// removeTempSnapshots removes the files of snapshots
+// that were being written when the process stopped.
+func (s *Store) removeTempSnapshots() error {
+	dir := filepath.Join(s.dir, snapshotDir)
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return errors.Wrap(err, "listing snapshots")
+	}
+	for _, fi := range fis {
+		if strings.HasPrefix(fi.Name(), "tmp-") {
+			err = os.Remove(filepath.Join(dir, fi.Name()))
+			if err != nil {
+				return errors.Wrap(err, "removing temporary snapshot file")
+			}
+		}
+	}
+	return nil
+}
+
+// syncDir syncs a directory, making the creation,
+// renaming, and removal of files in it durable.
+func syncDir(name string) error {
+	d, err := os.Open(name)
+	if err != nil {
+		return errors.Wrap(err, "opening directory")
+	}
+	defer d.Close()
+	return errors.Wrap(d.Sync(), "syncing directory")
+}
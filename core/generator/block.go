@@ -6,6 +6,7 @@ import (
 	"sync"
 	"time"
 
+	"chain/core/leader"
 	"chain/crypto/ed25519"
 	"chain/database/pg"
 	"chain/database/sql"
@@ -43,8 +44,20 @@ func (g *generator) makeBlock(ctx context.Context) error {
 	t0 := time.Now()
 	defer recordSince(t0)
 
-	txs := g.pool.Dump(ctx)
-	b, s, err := g.chain.GenerateBlock(ctx, g.latestBlock, g.latestSnapshot, time.Now(), txs)
+	// Defer transactions beyond the chain's block limits to later
+	// blocks, rather than letting GenerateBlock drop them.
+	limits := sizePolicies(g.chain.BlockLimits())
+
+	now := time.Now()
+	txs, deferred := g.gate.admit(ctx, g.latestBlock.Height+1, now, g.gate.pool.Dump(ctx), limits...)
+	for _, tx := range deferred {
+		err := g.gate.pool.Submit(ctx, tx)
+		if err != nil {
+			return errors.Wrap(err, "deferring tx")
+		}
+	}
+
+	b, s, err := g.chain.GenerateBlock(ctx, g.latestBlock, g.latestSnapshot, now, txs)
 	if err != nil {
 		return errors.Wrap(err, "generate")
 	}
@@ -71,6 +84,7 @@ func (g *generator) commitBlock(ctx context.Context, b *bc.Block, s *state.Snaps
 
 	g.latestBlock = b
 	g.latestSnapshot = s
+	g.gate.committed(b)
 	return nil
 }
 
@@ -163,12 +177,25 @@ func getPendingBlock(ctx context.Context, db pg.DB) (*bc.Block, error) {
 
 // savePendingBlock persists a pending, uncommitted block to the database.
 // The generator should save a pending block *before* asking signers to
-// sign the block.
+// sign the block. If ctx belongs to a leader that has since been
+// deposed, it returns leader.ErrFenced, and the block must not be
+// signed.
 func savePendingBlock(ctx context.Context, db pg.DB, b *bc.Block) error {
-	const q = `
-		INSERT INTO generator_pending_block (data) VALUES($1)
-		ON CONFLICT (singleton) DO UPDATE SET data = $1;
+	fence, fenceArgs := leader.Fence(ctx, 2)
+	q := `
+		INSERT INTO generator_pending_block (data) SELECT $1::bytea WHERE ` + fence + `
+		ON CONFLICT (singleton) DO UPDATE SET data = EXCLUDED.data;
 	`
-	_, err := db.Exec(ctx, q, b)
-	return errors.Wrap(err, "generator_pending_block insert query")
+	res, err := db.Exec(ctx, q, append([]interface{}{b}, fenceArgs...)...)
+	if err != nil {
+		return errors.Wrap(err, "generator_pending_block insert query")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "generator_pending_block insert query")
+	}
+	if n == 0 {
+		return errors.Wrap(leader.ErrFenced, "saving pending block")
+	}
+	return nil
 }
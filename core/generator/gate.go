@@ -0,0 +1,172 @@
+package generator
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"chain/errors"
+	"chain/log"
+	"chain/protocol"
+	"chain/protocol/bc"
+	"chain/protocol/mempool"
+)
+
+// maxRefusals limits the number of refused transactions a Gate
+// remembers.
+const maxRefusals = 1000
+
+// Gate is the generator's transaction pool, guarded by its
+// admission policies. It satisfies the txbuilder.Submitter
+// interface.
+type Gate struct {
+	pool     *mempool.MemPool
+	policies []Policy
+	limits   func() protocol.BlockLimits // nil means no size limits
+
+	mu       sync.Mutex
+	refused  map[bc.Hash]error
+	refusals []bc.Hash // in order refused, for eviction
+}
+
+// NewGate returns a Gate that admits transactions to pool
+// subject to policies.
+func NewGate(pool *mempool.MemPool, policies ...Policy) *Gate {
+	return &Gate{
+		pool:     pool,
+		policies: policies,
+		refused:  make(map[bc.Hash]error),
+	}
+}
+
+// Submit adds tx to the pool, unless a policy refuses it. If tx
+// was refused earlier, while the generator was making a block,
+// Submit returns the reason it was refused. Core resubmits pending
+// transactions after each block, so this is how a submitter learns
+// that its transaction will never be included.
+func (g *Gate) Submit(ctx context.Context, tx *bc.Tx) error {
+	if err := g.Refusal(tx.Hash); err != nil {
+		return err
+	}
+	var policies []Policy
+	if g.limits != nil {
+		policies = sizePolicies(g.limits())
+	}
+	policies = append(policies, g.policies...)
+	b := &PendingBlock{Time: time.Now(), Issued: make(map[bc.AssetID]uint64)}
+	for _, p := range policies {
+		err := p.Admit(ctx, b, tx)
+		if errors.Root(err) == ErrRefused {
+			return g.refuse(tx.Hash, err)
+		}
+		// Any other error means the tx can't be admitted right now,
+		// which the generator rechecks when it makes a block.
+	}
+	return g.pool.Submit(ctx, tx)
+}
+
+// Contains returns whether the transaction with
+// the given hash is waiting in the pool.
+func (g *Gate) Contains(hash bc.Hash) bool {
+	return g.pool.Contains(hash)
+}
+
+// SetBlockLimits makes g refuse, when they're submitted,
+// transactions too big for any block within the limits
+// returned by limits, which is called on each submission.
+func (g *Gate) SetBlockLimits(limits func() protocol.BlockLimits) {
+	g.limits = limits
+}
+
+// sizePolicies returns the policies that keep
+// blocks within limits.
+func sizePolicies(limits protocol.BlockLimits) []Policy {
+	policies := []Policy{MaxBlockTxs(limits.MaxTxs)}
+	if limits.MaxBytes > 0 {
+		policies = append(policies, MaxBlockBytes(limits.MaxBytes))
+	}
+	return policies
+}
+
+// Refusal returns the error with which the transaction with the
+// given hash was refused, or nil if it has not been.
+func (g *Gate) Refusal(hash bc.Hash) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.refused[hash]
+}
+
+func (g *Gate) refuse(hash bc.Hash, err error) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.refused[hash]; ok {
+		return err
+	}
+	if len(g.refusals) >= maxRefusals {
+		delete(g.refused, g.refusals[0])
+		g.refusals = g.refusals[1:]
+	}
+	g.refused[hash] = err
+	g.refusals = append(g.refusals, hash)
+	return err
+}
+
+// admit selects, in order, the transactions from txs that every
+// policy, including extra, admits to a block with the given height
+// and time. It returns the admitted transactions and the ones
+// deferred to a later block. Refused transactions, and any
+// transactions spending their outputs, are recorded and dropped.
+func (g *Gate) admit(ctx context.Context, height uint64, t time.Time, txs []*bc.Tx, extra ...Policy) (admitted, deferred []*bc.Tx) {
+	policies := append(append([]Policy(nil), extra...), g.policies...)
+	b := &PendingBlock{Height: height, Time: t, Issued: make(map[bc.AssetID]uint64)}
+	skipped := make(map[bc.Hash]error) // deferred or refused
+	for _, tx := range txs {
+		err := admitTx(ctx, policies, b, tx, skipped)
+		switch errors.Root(err) {
+		case nil:
+			b.add(tx)
+			continue
+		case ErrRefused:
+			log.Write(ctx, "at", "refusing transaction", "tx", tx.Hash, "reason", errors.Detail(err))
+			g.refuse(tx.Hash, err)
+		case ErrBlockFull:
+			deferred = append(deferred, tx)
+		default:
+			log.Error(ctx, err, "admitting transaction", tx.Hash)
+			deferred = append(deferred, tx)
+		}
+		skipped[tx.Hash] = err
+	}
+	return b.Txs, deferred
+}
+
+func admitTx(ctx context.Context, policies []Policy, b *PendingBlock, tx *bc.Tx, skipped map[bc.Hash]error) error {
+	for _, in := range tx.Inputs {
+		if in.IsIssuance() {
+			continue
+		}
+		prev := in.Outpoint().Hash
+		if err, ok := skipped[prev]; ok {
+			if errors.Root(err) == ErrRefused {
+				return errors.WithDetailf(ErrRefused, "spends output of refused transaction %s", prev)
+			}
+			return errors.WithDetailf(ErrBlockFull, "spends output of deferred transaction %s", prev)
+		}
+	}
+	for _, p := range policies {
+		err := p.Admit(ctx, b, tx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// committed tells every BlockObserver policy about b.
+func (g *Gate) committed(b *bc.Block) {
+	for _, p := range g.policies {
+		if o, ok := p.(BlockObserver); ok {
+			o.Committed(b)
+		}
+	}
+}
@@ -12,7 +12,6 @@ import (
 	"chain/log"
 	"chain/protocol"
 	"chain/protocol/bc"
-	"chain/protocol/mempool"
 	"chain/protocol/state"
 	"chain/protocol/validation"
 )
@@ -30,7 +29,7 @@ type generator struct {
 	// config
 	db      pg.DB
 	chain   *protocol.Chain
-	pool    *mempool.MemPool
+	gate    *Gate
 	signers []BlockSigner
 
 	// latestBlock and latestSnapshot are current as long as this
@@ -42,17 +41,19 @@ type generator struct {
 }
 
 // Generate runs in a loop, making one new block
-// every block period. It returns when its context
-// is canceled.
+// every block period from the transactions admitted
+// by gate. It calls period before each block, so the
+// block period may change while Generate runs.
+// It returns when its context is canceled.
 // After each attempt to make a block, it calls health
 // to report either an error or nil to indicate success.
 func Generate(
 	ctx context.Context,
 	c *protocol.Chain,
-	pool *mempool.MemPool,
+	gate *Gate,
 	s []BlockSigner,
 	db pg.DB,
-	period time.Duration,
+	period func() time.Duration,
 	health func(error),
 ) {
 	// This process just became leader, so it's responsible
@@ -65,7 +66,7 @@ func Generate(
 	g := &generator{
 		db:             db,
 		chain:          c,
-		pool:           pool,
+		gate:           gate,
 		signers:        s,
 		latestBlock:    recoveredBlock,
 		latestSnapshot: recoveredSnapshot,
@@ -92,13 +93,19 @@ func Generate(
 		}
 	}
 
-	ticks := time.Tick(period)
+	next := time.Now()
 	for {
+		next = next.Add(period())
+		if now := time.Now(); next.Before(now) {
+			next = now // don't try to catch up on missed blocks
+		}
+		timer := time.NewTimer(next.Sub(time.Now()))
 		select {
 		case <-ctx.Done():
+			timer.Stop()
 			log.Messagef(ctx, "Deposed, Generate exiting")
 			return
-		case <-ticks:
+		case <-timer.C:
 			err := g.makeBlock(ctx)
 			health(err)
 			if err != nil {
@@ -37,7 +37,7 @@ func TestGeneratorRecovery(t *testing.T) {
 	// Start Generate which should notice the pending block and commit it.
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
-	go Generate(ctx, c, mempool.New(), nil, dbtx, time.Second, func(error) {})
+	go Generate(ctx, c, NewGate(mempool.New()), nil, dbtx, func() time.Duration { return time.Second }, func(error) {})
 
 	// Wait for the block to land, and then make sure it's the same block
 	// that was pending before we ran Generate.
@@ -68,7 +68,7 @@ func TestGetAndAddBlockSignatures(t *testing.T) {
 	signer := testSigner{pubKey, privKey}
 	g := &generator{
 		chain:          c,
-		pool:           mempool.New(),
+		gate:           NewGate(mempool.New()),
 		signers:        []BlockSigner{signer},
 		latestBlock:    b1,
 		latestSnapshot: state.Empty(),
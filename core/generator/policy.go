@@ -0,0 +1,214 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+var (
+	// ErrBlockFull is returned by a Policy to defer a transaction
+	// to a later block, for example because the pending block has
+	// reached a size limit.
+	ErrBlockFull = errors.New("block is full")
+
+	// ErrRefused is returned by a Policy to refuse a transaction
+	// outright. The error's detail gives the reason, which is
+	// reported back to the submitter.
+	ErrRefused = errors.New("transaction refused by generator policy")
+)
+
+// PendingBlock describes the block the generator is assembling,
+// as seen by a Policy.
+type PendingBlock struct {
+	Height uint64
+	Time   time.Time
+
+	// Txs holds the transactions admitted to the block so far.
+	Txs []*bc.Tx
+
+	// TxBytes is the total serialized size of Txs.
+	TxBytes int
+
+	// Issued is the amount of each asset issued by Txs.
+	Issued map[bc.AssetID]uint64
+}
+
+func (b *PendingBlock) add(tx *bc.Tx) {
+	b.Txs = append(b.Txs, tx)
+	b.TxBytes += tx.SerializedSize()
+	for assetID, amt := range issuances(tx) {
+		b.Issued[assetID] += amt
+	}
+}
+
+// A Policy decides which pending transactions the generator admits
+// into blocks. Admit is called for each candidate transaction in
+// turn. It returns nil to admit tx to b, an error with root
+// ErrBlockFull to leave tx in the pool for a later block, or an
+// error with root ErrRefused to drop tx.
+//
+// Policies are also consulted when a transaction is submitted, with
+// an empty b, so that a transaction that could never be admitted is
+// refused immediately.
+type Policy interface {
+	Admit(ctx context.Context, b *PendingBlock, tx *bc.Tx) error
+}
+
+// A BlockObserver is a Policy that is told about each block the
+// generator commits, for enforcing limits that span several blocks.
+// Observed history is kept in memory only, so it starts empty when
+// a new generator process becomes leader.
+type BlockObserver interface {
+	Policy
+	Committed(*bc.Block)
+}
+
+// MaxBlockTxs limits the number of transactions in each block.
+type MaxBlockTxs int
+
+func (n MaxBlockTxs) Admit(ctx context.Context, b *PendingBlock, tx *bc.Tx) error {
+	if len(b.Txs) >= int(n) {
+		return errors.WithDetailf(ErrBlockFull, "block has %d transactions", len(b.Txs))
+	}
+	return nil
+}
+
+// MaxBlockBytes limits the total serialized size of the
+// transactions in each block.
+type MaxBlockBytes int
+
+func (n MaxBlockBytes) Admit(ctx context.Context, b *PendingBlock, tx *bc.Tx) error {
+	size := tx.SerializedSize()
+	if size > int(n) {
+		return errors.WithDetailf(ErrRefused, "transaction size %d exceeds maximum block size %d", size, n)
+	}
+	if b.TxBytes+size > int(n) {
+		return errors.WithDetailf(ErrBlockFull, "block has %d bytes of transactions", b.TxBytes)
+	}
+	return nil
+}
+
+// DenyList refuses transactions that spend from or pay to any of
+// ControlPrograms, or that issue, spend or pay any of Assets.
+type DenyList struct {
+	ControlPrograms [][]byte
+	Assets          []bc.AssetID
+}
+
+func (d *DenyList) Admit(ctx context.Context, b *PendingBlock, tx *bc.Tx) error {
+	for i, in := range tx.Inputs {
+		if d.deniedAsset(in.AssetID()) {
+			return errors.WithDetailf(ErrRefused, "input %d asset %s is deny-listed", i, in.AssetID())
+		}
+		if !in.IsIssuance() && d.deniedProgram(in.ControlProgram()) {
+			return errors.WithDetailf(ErrRefused, "input %d control program is deny-listed", i)
+		}
+	}
+	for i, out := range tx.Outputs {
+		if d.deniedAsset(out.AssetID) {
+			return errors.WithDetailf(ErrRefused, "output %d asset %s is deny-listed", i, out.AssetID)
+		}
+		if d.deniedProgram(out.ControlProgram) {
+			return errors.WithDetailf(ErrRefused, "output %d control program is deny-listed", i)
+		}
+	}
+	return nil
+}
+
+func (d *DenyList) deniedAsset(assetID bc.AssetID) bool {
+	for _, a := range d.Assets {
+		if a == assetID {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *DenyList) deniedProgram(prog []byte) bool {
+	for _, p := range d.ControlPrograms {
+		if bytes.Equal(p, prog) {
+			return true
+		}
+	}
+	return false
+}
+
+// IssuanceLimit limits the amount of an asset that may be issued
+// within any period of length Window. If Window is zero, the limit
+// applies to each block.
+type IssuanceLimit struct {
+	AssetID bc.AssetID
+	Amount  uint64
+	Window  time.Duration
+
+	mu      sync.Mutex
+	history []issuance // committed issuances within the window, oldest first
+}
+
+type issuance struct {
+	time   time.Time
+	amount uint64
+}
+
+func (l *IssuanceLimit) Admit(ctx context.Context, b *PendingBlock, tx *bc.Tx) error {
+	amt := issuances(tx)[l.AssetID]
+	if amt == 0 {
+		return nil
+	}
+	if amt > l.Amount {
+		return errors.WithDetailf(ErrRefused, "issuance of %d units of asset %s exceeds limit of %d", amt, l.AssetID, l.Amount)
+	}
+
+	issued := b.Issued[l.AssetID]
+	l.mu.Lock()
+	for _, iss := range l.history {
+		if iss.time.After(b.Time.Add(-l.Window)) {
+			issued += iss.amount
+		}
+	}
+	l.mu.Unlock()
+
+	if issued+amt > l.Amount {
+		return errors.WithDetailf(ErrBlockFull, "%d units of asset %s already issued of limit %d", issued, l.AssetID, l.Amount)
+	}
+	return nil
+}
+
+func (l *IssuanceLimit) Committed(b *bc.Block) {
+	if l.Window == 0 {
+		return
+	}
+	var amt uint64
+	for _, tx := range b.Transactions {
+		amt += issuances(tx)[l.AssetID]
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if amt > 0 {
+		l.history = append(l.history, issuance{time: b.Time(), amount: amt})
+	}
+	cutoff := b.Time().Add(-l.Window)
+	for len(l.history) > 0 && !l.history[0].time.After(cutoff) {
+		l.history = l.history[1:]
+	}
+}
+
+func issuances(tx *bc.Tx) map[bc.AssetID]uint64 {
+	var m map[bc.AssetID]uint64
+	for _, in := range tx.Inputs {
+		if !in.IsIssuance() {
+			continue
+		}
+		if m == nil {
+			m = make(map[bc.AssetID]uint64)
+		}
+		m[in.AssetID()] += in.Amount()
+	}
+	return m
+}
@@ -0,0 +1,108 @@
+package generator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"chain/errors"
+	"chain/protocol"
+	"chain/protocol/bc"
+	"chain/protocol/mempool"
+)
+
+func TestGateAdmit(t *testing.T) {
+	ctx := context.Background()
+
+	issue := func(nonce byte, amount uint64) *bc.Tx {
+		in := bc.NewIssuanceInput([]byte{nonce}, amount, nil, bc.Hash{}, []byte{1}, nil)
+		return bc.NewTx(bc.TxData{
+			Version: 1,
+			Inputs:  []*bc.TxInput{in},
+			Outputs: []*bc.TxOutput{bc.NewTxOutput(in.AssetID(), amount, []byte{2}, nil)},
+		})
+	}
+	spend := func(prev *bc.Tx, prog []byte) *bc.Tx {
+		out := prev.Outputs[0]
+		return bc.NewTx(bc.TxData{
+			Version: 1,
+			Inputs:  []*bc.TxInput{bc.NewSpendInput(prev.Hash, 0, nil, out.AssetID, out.Amount, out.ControlProgram, nil)},
+			Outputs: []*bc.TxOutput{bc.NewTxOutput(out.AssetID, out.Amount, prog, nil)},
+		})
+	}
+
+	tx1, tx2, tx3 := issue(1, 5), issue(2, 5), issue(3, 5)
+	denied := spend(tx1, []byte("denied"))
+	child := spend(denied, []byte{3})
+	assetID := tx1.Inputs[0].AssetID()
+
+	gate := NewGate(mempool.New(),
+		MaxBlockTxs(3),
+		&DenyList{ControlPrograms: [][]byte{[]byte("denied")}},
+		&IssuanceLimit{AssetID: assetID, Amount: 10},
+	)
+	admitted, deferred := gate.admit(ctx, 2, time.Now(), []*bc.Tx{tx1, denied, child, tx2, tx3})
+
+	if len(admitted) != 2 || admitted[0] != tx1 || admitted[1] != tx2 {
+		t.Errorf("admitted %v want [%v %v]", admitted, tx1.Hash, tx2.Hash)
+	}
+	if len(deferred) != 1 || deferred[0] != tx3 {
+		t.Errorf("deferred %v want [%v]", deferred, tx3.Hash)
+	}
+	for _, tx := range []*bc.Tx{denied, child} {
+		if err := gate.Refusal(tx.Hash); errors.Root(err) != ErrRefused {
+			t.Errorf("refusal of %s = %v want %v", tx.Hash, err, ErrRefused)
+		}
+	}
+
+	// Resubmitting a refused transaction reports why it was refused.
+	err := gate.Submit(ctx, denied)
+	if errors.Root(err) != ErrRefused {
+		t.Errorf("resubmit refused tx: got error %v want %v", err, ErrRefused)
+	}
+
+	// A transaction that could never fit is refused on submission.
+	err = gate.Submit(ctx, issue(4, 11))
+	if errors.Root(err) != ErrRefused {
+		t.Errorf("submit oversized issuance: got error %v want %v", err, ErrRefused)
+	}
+	err = gate.Submit(ctx, tx3)
+	if err != nil {
+		t.Errorf("submit tx3: got error %v", err)
+	}
+
+	// So is a transaction too big for any block.
+	big := issue(5, 1)
+	gate.SetBlockLimits(func() protocol.BlockLimits {
+		return protocol.BlockLimits{MaxBytes: big.SerializedSize() - 1}
+	})
+	err = gate.Submit(ctx, big)
+	if errors.Root(err) != ErrRefused {
+		t.Errorf("submit oversized tx: got error %v want %v", err, ErrRefused)
+	}
+}
+
+func TestIssuanceLimitWindow(t *testing.T) {
+	ctx := context.Background()
+	in := bc.NewIssuanceInput([]byte{1}, 6, nil, bc.Hash{}, []byte{1}, nil)
+	l := &IssuanceLimit{AssetID: in.AssetID(), Amount: 10, Window: time.Hour}
+	tx := bc.NewTx(bc.TxData{Version: 1, Inputs: []*bc.TxInput{in}})
+
+	t0 := time.Now()
+	l.Committed(&bc.Block{
+		BlockHeader:  bc.BlockHeader{TimestampMS: bc.Millis(t0)},
+		Transactions: []*bc.Tx{tx},
+	})
+
+	b := &PendingBlock{Time: t0.Add(time.Minute), Issued: make(map[bc.AssetID]uint64)}
+	err := l.Admit(ctx, b, tx)
+	if errors.Root(err) != ErrBlockFull {
+		t.Errorf("within window: got error %v want %v", err, ErrBlockFull)
+	}
+
+	b.Time = t0.Add(2 * time.Hour)
+	err = l.Admit(ctx, b, tx)
+	if err != nil {
+		t.Errorf("after window: got error %v", err)
+	}
+}
@@ -4,6 +4,7 @@ package leader
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"time"
 
@@ -15,9 +16,25 @@ import (
 
 var (
 	isLeading bool
+	epoch     uint64
+	current   *leader
 	lock      sync.Mutex
 )
 
+// handoverPeriod is how long a process that steps down
+// waits before trying to become leader again, and how long
+// only the process it handed over to may become leader.
+// StepDown's query must use the same interval.
+const handoverPeriod = 30 * time.Second
+
+// ErrNotLeader is returned by StepDown when this
+// process is not the core leader.
+var ErrNotLeader = errors.New("not the core leader")
+
+// ErrFenced is returned by writes made on behalf of a
+// leader that has since been deposed. See Fence.
+var ErrFenced = errors.New("no longer the core leader")
+
 // IsLeading returns true if this process is
 // the core leader.
 func IsLeading() bool {
@@ -27,6 +44,18 @@ func IsLeading() bool {
 	return l
 }
 
+// Epoch returns the fencing epoch of this process's
+// leadership, or 0 if it is not the core leader. Each
+// time a process becomes leader, the epoch increases.
+func Epoch() uint64 {
+	lock.Lock()
+	defer lock.Unlock()
+	if !isLeading {
+		return 0
+	}
+	return epoch
+}
+
 // Run runs as a goroutine, trying once every five seconds to become
 // the leader for the core.  If it succeeds, then it calls the
 // function lead (for generating or fetching blocks, and for
@@ -34,6 +63,8 @@ func IsLeading() bool {
 //
 // Function lead is called when the local process becomes the leader.
 // Its context is canceled when the process is deposed as leader.
+// Writes that only the leader may make should be fenced with the
+// context; see Fence.
 //
 // The Chain Core has up to a 10-second refractory period after
 // shutdown, during which no process can become the new leader.
@@ -50,6 +81,10 @@ func Run(db *sql.DB, addr string, lead func(context.Context)) {
 	}
 	log.Messagef(ctx, "Using leaderKey: %q", l.key)
 
+	lock.Lock()
+	current = l
+	lock.Unlock()
+
 	update(ctx, l)
 	for range time.Tick(5 * time.Second) {
 		update(ctx, l)
@@ -64,25 +99,41 @@ type leader struct {
 	address string
 
 	// state
-	leading bool
-	cancel  func()
+	mu        sync.Mutex
+	leading   bool
+	epoch     uint64
+	cancel    func()
+	idleUntil time.Time // after stepping down
+}
+
+type fenceKey struct{}
+
+type fence struct {
+	key   string
+	epoch uint64
 }
 
 func update(ctx context.Context, l *leader) {
 	const (
 		insertQ = `
-			INSERT INTO leader (leader_key, address, expiry) VALUES ($1, $2, CURRENT_TIMESTAMP + INTERVAL '10 seconds')
-			ON CONFLICT (singleton) DO UPDATE SET leader_key = $1, address = $2, expiry = CURRENT_TIMESTAMP + INTERVAL '10 seconds'
+			INSERT INTO leader (leader_key, address, expiry, epoch) VALUES ($1, $2, CURRENT_TIMESTAMP + INTERVAL '10 seconds', 1)
+			ON CONFLICT (singleton) DO UPDATE SET leader_key = $1, address = $2, expiry = CURRENT_TIMESTAMP + INTERVAL '10 seconds',
+				epoch = leader.epoch + 1, handover_address = NULL
 				WHERE leader.expiry < CURRENT_TIMESTAMP
+				AND (leader.handover_address IS NULL OR leader.handover_address = $2 OR leader.handover_expiry < CURRENT_TIMESTAMP)
+			RETURNING epoch
 		`
 		updateQ = `
 			UPDATE leader SET expiry = CURRENT_TIMESTAMP + INTERVAL '10 seconds'
-				WHERE leader_key = $1
+				WHERE leader_key = $1 AND epoch = $2
 		`
 	)
 
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	if l.leading {
-		res, err := l.db.Exec(ctx, updateQ, l.key)
+		res, err := l.db.Exec(ctx, updateQ, l.key, l.epoch)
 		if err == nil {
 			rowsAffected, err := res.RowsAffected()
 			if err == nil && rowsAffected > 0 {
@@ -97,51 +148,137 @@ func update(ctx context.Context, l *leader) {
 		if err != nil {
 			log.Error(ctx, err)
 		}
-		log.Messagef(ctx, "No longer core leader")
-		l.cancel()
-		l.leading = false
-
-		lock.Lock()
-		isLeading = false
-		lock.Unlock()
-
-		l.cancel = nil
+		l.depose(ctx)
 	} else {
+		if time.Now().Before(l.idleUntil) {
+			return
+		}
+
 		// Try to put this process's key into the leader table.  It
 		// succeeds if the table's empty or the existing row (there can be
-		// only one) is expired.  It fails otherwise.
+		// only one) is expired, and leadership isn't being handed over
+		// to another process.  It fails otherwise.
 		//
 		// On success, this process's leadership expires in 10 seconds
 		// unless it's renewed in the UPDATE query above.
 		// That extends it for another 10 seconds.
-		res, err := l.db.Exec(ctx, insertQ, l.key, l.address)
-		if err != nil {
-			log.Error(ctx, err)
+		err := l.db.QueryRow(ctx, insertQ, l.key, l.address).Scan(&l.epoch)
+		if err == sql.ErrNoRows {
 			return
-		}
-		rowsAffected, err := res.RowsAffected()
-		if err != nil {
+		} else if err != nil {
 			log.Error(ctx, err)
 			return
 		}
 
-		if rowsAffected == 0 {
-			return
-		}
-
-		log.Messagef(ctx, "I am the core leader")
+		log.Messagef(ctx, "I am the core leader (epoch %d)", l.epoch)
 
 		l.leading = true
 
 		lock.Lock()
 		isLeading = true
+		epoch = l.epoch
 		lock.Unlock()
 
+		ctx = context.WithValue(ctx, fenceKey{}, fence{key: l.key, epoch: l.epoch})
 		ctx, l.cancel = context.WithCancel(ctx)
 		go l.lead(ctx)
 	}
 }
 
+// depose ends this process's leadership.
+// l.mu must be held.
+func (l *leader) depose(ctx context.Context) {
+	log.Messagef(ctx, "No longer core leader")
+	l.cancel()
+	l.leading = false
+
+	lock.Lock()
+	isLeading = false
+	lock.Unlock()
+
+	l.cancel = nil
+}
+
+// StepDown gives up this process's leadership, if it is
+// the core leader. If to is not empty, it is the address of
+// the process to hand over to, and only that process may
+// become leader for the next 30 seconds. Otherwise any other
+// process may. This process doesn't try to become leader
+// again for 30 seconds either way.
+func StepDown(ctx context.Context, to string) error {
+	lock.Lock()
+	l := current
+	lock.Unlock()
+	if l == nil {
+		return ErrNotLeader
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.leading {
+		return ErrNotLeader
+	}
+	if to == l.address {
+		return nil
+	}
+
+	const q = `
+		UPDATE leader SET expiry = CURRENT_TIMESTAMP, handover_address = NULLIF($3, ''),
+			handover_expiry = CURRENT_TIMESTAMP + INTERVAL '30 seconds'
+			WHERE leader_key = $1 AND epoch = $2
+	`
+	_, err := l.db.Exec(ctx, q, l.key, l.epoch, to)
+	if err != nil {
+		return errors.Wrap(err, "giving up leadership")
+	}
+	if to == "" {
+		log.Messagef(ctx, "Stepping down as core leader")
+	} else {
+		log.Messagef(ctx, "Handing over core leadership to %s", to)
+	}
+	l.depose(ctx)
+	l.idleUntil = time.Now().Add(handoverPeriod)
+	return nil
+}
+
+// Fence returns a SQL condition that is true only while ctx's
+// leadership is current, and the arguments it refers to, numbered
+// from $n. A write that only the leader may make should include
+// the condition, so it has no effect if made by a process that has
+// been deposed, even one that was paused and hasn't yet noticed.
+// The condition locks the leader row until the end of the
+// transaction, so no other process can become leader meanwhile.
+//
+// If ctx doesn't belong to a leader, the condition is always true.
+func Fence(ctx context.Context, n int) (string, []interface{}) {
+	f, ok := ctx.Value(fenceKey{}).(fence)
+	if !ok {
+		return "TRUE", nil
+	}
+	cond := fmt.Sprintf("EXISTS (SELECT 1 FROM leader WHERE leader_key = $%d AND epoch = $%d FOR SHARE)", n, n+1)
+	return cond, []interface{}{f.key, f.epoch}
+}
+
+// CheckFence returns ErrFenced if ctx belongs to a leader
+// that has been deposed. Writes that include the condition
+// from Fence can call it to learn why they had no effect.
+func CheckFence(ctx context.Context, db pg.DB) error {
+	f, ok := ctx.Value(fenceKey{}).(fence)
+	if !ok {
+		return nil
+	}
+	const q = `SELECT EXISTS (SELECT 1 FROM leader WHERE leader_key = $1 AND epoch = $2)`
+	var leading bool
+	err := db.QueryRow(ctx, q, f.key, f.epoch).Scan(&leading)
+	if err != nil {
+		return errors.Wrap(err, "checking leader epoch")
+	}
+	if !leading {
+		return errors.Wrapf(ErrFenced, "epoch %d", f.epoch)
+	}
+	return nil
+}
+
 // Address retrieves the IP address of the current
 // core leader.
 func Address(ctx context.Context, db pg.DB) (string, error) {
@@ -155,3 +292,19 @@ func Address(ctx context.Context, db pg.DB) (string, error) {
 
 	return addr, nil
 }
+
+// Other returns the address of a process other than addr
+// that currently holds the leadership lease, or "" if
+// there is none.
+func Other(ctx context.Context, db pg.DB, addr string) (string, error) {
+	const q = `SELECT address FROM leader WHERE expiry > CURRENT_TIMESTAMP AND address <> $1`
+
+	var other string
+	err := db.QueryRow(ctx, q, addr).Scan(&other)
+	if err == sql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", errors.Wrap(err, "could not fetch leader address")
+	}
+	return other, nil
+}
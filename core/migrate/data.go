@@ -72,4 +72,125 @@ var migrations = []migration{
 			ALTER COLUMN tx_id SET DATA TYPE bytea USING decode(tx_id,'hex');
 		ALTER TABLE submitted_txs RENAME COLUMN tx_id TO tx_hash;
 	`},
+	{Name: "2016-11-29.0.core.config-block-params.sql", SQL: `
+		ALTER TABLE config
+			ADD COLUMN block_period_ms bigint DEFAULT 1000 NOT NULL,
+			ADD COLUMN max_block_txs integer DEFAULT 0 NOT NULL,
+			ADD COLUMN max_block_bytes integer DEFAULT 0 NOT NULL;
+	`},
+	{Name: "2016-11-30.0.txdb.snapshot-deltas.sql", SQL: `
+		ALTER TABLE snapshots ADD COLUMN base_height bigint;
+	`},
+	{Name: "2016-12-01.0.core.leader-epoch.sql", SQL: `
+		ALTER TABLE leader
+			ADD COLUMN epoch bigint DEFAULT 0 NOT NULL,
+			ADD COLUMN handover_address text,
+			ADD COLUMN handover_expiry timestamp with time zone;
+	`},
+	{Name: "2016-12-02.0.account.reservations.sql", SQL: `
+		CREATE TABLE reservations (
+			reservation_id bigint DEFAULT nextval('reservation_seq'::regclass) PRIMARY KEY,
+			account_id text NOT NULL,
+			asset_id text NOT NULL,
+			change bigint NOT NULL,
+			expiry timestamp with time zone NOT NULL,
+			client_token text UNIQUE
+		);
+		CREATE INDEX ON reservations (expiry);
+		CREATE TABLE reserved_utxos (
+			tx_hash text NOT NULL,
+			index integer NOT NULL,
+			reservation_id bigint NOT NULL REFERENCES reservations ON DELETE CASCADE,
+			PRIMARY KEY (tx_hash, index)
+		);
+		CREATE INDEX ON reserved_utxos (reservation_id);
+	`},
+	{Name: "2016-12-05.0.core.tag-versions.sql", SQL: `
+		ALTER TABLE accounts ADD COLUMN version bigint DEFAULT 1 NOT NULL;
+		ALTER TABLE assets ADD COLUMN version bigint DEFAULT 1 NOT NULL;
+		UPDATE annotated_accounts SET data = data || '{"version":1}';
+		UPDATE annotated_assets SET data = data || '{"version":1}';
+	`},
+	{Name: "2016-12-06.0.core.archived.sql", SQL: `
+		ALTER TABLE accounts ADD COLUMN archived boolean DEFAULT false NOT NULL;
+		ALTER TABLE assets ADD COLUMN archived boolean DEFAULT false NOT NULL;
+		UPDATE annotated_accounts SET data = data || '{"is_archived":"no"}';
+		UPDATE annotated_assets SET data = data || '{"is_archived":"no"}';
+	`},
+	{Name: "2016-12-07.0.core.refdata-schemas.sql", SQL: `
+		CREATE TABLE reference_data_schemas (
+			asset_id text NOT NULL PRIMARY KEY,
+			schema jsonb NOT NULL
+		);
+	`},
+	{Name: "2016-12-08.0.account.spend-policy.sql", SQL: `
+		ALTER TABLE accounts ADD COLUMN spend_policy jsonb;
+		CREATE TABLE account_spends (
+			reservation_id bigint NOT NULL PRIMARY KEY,
+			account_id text NOT NULL,
+			asset_id text NOT NULL,
+			amount bigint NOT NULL,
+			spent_at timestamp with time zone DEFAULT now() NOT NULL
+		);
+		CREATE INDEX ON account_spends (account_id, asset_id, spent_at);
+		CREATE TABLE spend_approvals (
+			id text DEFAULT next_chain_id('apr'::text) NOT NULL PRIMARY KEY,
+			account_id text NOT NULL,
+			asset_id text NOT NULL,
+			amount bigint NOT NULL,
+			requested_by text NOT NULL,
+			approved_by text,
+			expires_at timestamp with time zone NOT NULL,
+			used boolean DEFAULT false NOT NULL
+		);
+	`},
+	{Name: "2016-12-09.0.core.submitted-tx-status.sql", SQL: `
+		ALTER TABLE submitted_txs
+			ADD COLUMN confirmed_in bigint,
+			ADD COLUMN failure text;
+	`},
+	{Name: "2016-12-10.0.core.submitted-tx-data.sql", SQL: `
+		ALTER TABLE submitted_txs ADD COLUMN data bytea;
+	`},
+	{Name: "2016-12-11.0.core.scheduled-txs.sql", SQL: `
+		CREATE TABLE scheduled_txs (
+			id text DEFAULT next_chain_id('sch'::text) NOT NULL PRIMARY KEY,
+			alias text UNIQUE,
+			actions jsonb NOT NULL,
+			ttl bigint NOT NULL,
+			start_time timestamp with time zone NOT NULL,
+			period bigint NOT NULL,
+			next_run timestamp with time zone,
+			max_retries integer NOT NULL,
+			retry_delay bigint NOT NULL,
+			failures integer DEFAULT 0 NOT NULL,
+			client_token text UNIQUE
+		);
+		CREATE INDEX ON scheduled_txs (next_run);
+		CREATE TABLE scheduled_tx_runs (
+			id text DEFAULT next_chain_id('run'::text) NOT NULL PRIMARY KEY,
+			scheduled_tx_id text NOT NULL REFERENCES scheduled_txs (id) ON DELETE CASCADE,
+			run_at timestamp with time zone DEFAULT now() NOT NULL,
+			attempt integer NOT NULL,
+			tx_id text,
+			error text
+		);
+		CREATE INDEX ON scheduled_tx_runs (scheduled_tx_id, run_at);
+	`},
+	{Name: "2016-12-12.0.account.spend-approval-used-by.sql", SQL: `
+		ALTER TABLE spend_approvals ADD COLUMN used_by bigint;
+	`},
+	{Name: "2016-12-13.0.account.policy-approvals.sql", SQL: `
+		ALTER TABLE spend_approvals ADD COLUMN requested_at timestamp with time zone DEFAULT now() NOT NULL;
+		CREATE TABLE policy_approvals (
+			id text DEFAULT next_chain_id('pap'::text) NOT NULL PRIMARY KEY,
+			account_id text NOT NULL,
+			policy jsonb,
+			requested_by text NOT NULL,
+			requested_at timestamp with time zone DEFAULT now() NOT NULL,
+			approved_by text,
+			expires_at timestamp with time zone NOT NULL,
+			used boolean DEFAULT false NOT NULL
+		);
+	`},
 }
@@ -0,0 +1,193 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"chain/core/txbuilder"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+)
+
+var errUnsignedTemplate = errors.New("template could not be fully signed")
+
+type createOfferRequest struct {
+	AccountID    string `json:"account_id"`
+	AccountAlias string `json:"account_alias"`
+
+	// Offered and Requested each hold an asset_id or asset_alias and
+	// an amount. Requested may also hold a control_program to receive
+	// the requested assets; by default they are paid to a new control
+	// program of the offering account.
+	Offered   map[string]interface{} `json:"offered"`
+	Requested map[string]interface{} `json:"requested"`
+
+	TTL         chainjson.Duration `json:"ttl"`
+	ClientToken *string            `json:"client_token"`
+}
+
+// POST /create-offer
+//
+// create-offer builds a partial transaction that pays the offered
+// assets from an account and receives the requested assets in
+// exchange. The template is signed with allow_additional_actions
+// set, so it can be completed by any counterparty through
+// /accept-offer without being able to alter its terms.
+func (h *Handler) createOffer(ctx context.Context, req createOfferRequest) (*txbuilder.Offer, error) {
+	var missing []string
+	if req.AccountID == "" && req.AccountAlias == "" {
+		missing = append(missing, "account_id")
+	}
+	if req.Offered == nil {
+		missing = append(missing, "offered")
+	}
+	if req.Requested == nil {
+		missing = append(missing, "requested")
+	}
+	if len(missing) > 0 {
+		return nil, txbuilder.MissingFieldsError(missing...)
+	}
+
+	spend := copyParams(req.Offered)
+	spend["type"] = "spend_account"
+	spend["account_id"] = req.AccountID
+	spend["account_alias"] = req.AccountAlias
+	if req.ClientToken != nil {
+		spend["client_token"] = *req.ClientToken
+	}
+
+	receive := copyParams(req.Requested)
+	if _, ok := receive["control_program"]; ok {
+		receive["type"] = "control_program"
+	} else {
+		receive["type"] = "control_account"
+		receive["account_id"] = req.AccountID
+		receive["account_alias"] = req.AccountAlias
+	}
+
+	tpl, err := h.buildSingle(ctx, &buildRequest{
+		Actions: []map[string]interface{}{spend, receive},
+		TTL:     req.TTL,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tpl.AllowAdditional = true
+	err = h.signLocal(ctx, tpl)
+	if err != nil {
+		return nil, err
+	}
+	return txbuilder.NewOffer(tpl)
+}
+
+// POST /accept-offer
+//
+// accept-offer completes an offer made with /create-offer by paying
+// the requested assets from an account and receiving the offered
+// assets into it, then signs and submits the resulting transaction.
+func (h *Handler) acceptOffer(ctx context.Context, req struct {
+	Offer        *txbuilder.Offer   `json:"offer"`
+	AccountID    string             `json:"account_id"`
+	AccountAlias string             `json:"account_alias"`
+	TTL          chainjson.Duration `json:"ttl"`
+	WaitUntil    string             `json:"wait_until"` // values none, confirmed, processed. default: processed
+}) (interface{}, error) {
+	var missing []string
+	if req.Offer == nil {
+		missing = append(missing, "offer")
+	}
+	if req.AccountID == "" && req.AccountAlias == "" {
+		missing = append(missing, "account_id")
+	}
+	if len(missing) > 0 {
+		return nil, txbuilder.MissingFieldsError(missing...)
+	}
+
+	var actions []map[string]interface{}
+	for _, amt := range req.Offer.Requested {
+		actions = append(actions, map[string]interface{}{
+			"type":          "spend_account",
+			"account_id":    req.AccountID,
+			"account_alias": req.AccountAlias,
+			"asset_id":      amt.AssetID,
+			"amount":        amt.Amount,
+		})
+	}
+	for _, amt := range req.Offer.Offered {
+		actions = append(actions, map[string]interface{}{
+			"type":          "control_account",
+			"account_id":    req.AccountID,
+			"account_alias": req.AccountAlias,
+			"asset_id":      amt.AssetID,
+			"amount":        amt.Amount,
+		})
+	}
+
+	tpl, err := h.buildSingle(ctx, &buildRequest{
+		Tx:      req.Offer.Template.Transaction,
+		Actions: actions,
+		TTL:     req.TTL,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The accepting signatures commit to the whole transaction,
+	// which makes it final.
+	tpl.AllowAdditional = false
+	err = h.signLocal(ctx, tpl)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	return h.submitSingle(ctx, tpl, req.WaitUntil)
+}
+
+// signLocal signs tpl with every key named in its signing
+// instructions that is held by this Core's MockHSM, and returns
+// errUnsignedTemplate if that does not satisfy every quorum.
+func (h *Handler) signLocal(ctx context.Context, tpl *txbuilder.Template) error {
+	var xpubs []string
+	for _, si := range tpl.SigningInstructions {
+		for _, c := range si.WitnessComponents {
+			if sw, ok := c.(*txbuilder.SignatureWitness); ok {
+				for _, k := range sw.Keys {
+					xpubs = append(xpubs, k.XPub)
+				}
+			}
+		}
+	}
+	err := txbuilder.Sign(ctx, tpl, xpubs, h.mockhsmSignTemplate)
+	if err != nil {
+		return err
+	}
+	for i, si := range tpl.SigningInstructions {
+		for _, c := range si.WitnessComponents {
+			sw, ok := c.(*txbuilder.SignatureWitness)
+			if !ok {
+				continue
+			}
+			var nsigs int
+			for _, sig := range sw.Sigs {
+				if len(sig) > 0 {
+					nsigs++
+				}
+			}
+			if nsigs < sw.Quorum {
+				return errors.WithDetailf(errUnsignedTemplate, "input %d has %d of %d required signatures", i, nsigs, sw.Quorum)
+			}
+		}
+	}
+	return nil
+}
+
+func copyParams(m map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(m)+3)
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"sync"
 
+	"chain/core/leader"
 	"chain/database/pg"
 	"chain/errors"
 	"chain/log"
@@ -15,6 +16,10 @@ import (
 
 const processorWorkers = 10
 
+// ErrNoPin is returned by ResetPin when
+// the named pin doesn't exist.
+var ErrNoPin = errors.New("no such pin")
+
 type Store struct {
 	db pg.DB
 
@@ -34,19 +39,23 @@ func NewStore(db pg.DB) *Store {
 
 func (s *Store) ProcessBlocks(ctx context.Context, c *protocol.Chain, pinName string, cb func(context.Context, *bc.Block) error) {
 	p := <-s.pin(pinName)
-	height := p.getHeight()
+	height, gen, reset := p.state()
 	for {
 		select {
 		case <-ctx.Done(): // leader deposed
 			log.Error(ctx, ctx.Err())
 			return
+		case <-reset:
+			// The pin was moved back by ResetPin;
+			// start again from its new height.
+			height, gen, reset = p.state()
 		case <-c.BlockWaiter(height + 1):
 			select {
 			case <-ctx.Done():
 				log.Error(ctx, ctx.Err())
 				return
 			case p.sem <- true:
-				go p.processBlock(ctx, c, height+1, cb)
+				go p.processBlock(ctx, c, height+1, gen, cb)
 				height++
 			}
 		}
@@ -72,6 +81,48 @@ func (s *Store) CreatePin(ctx context.Context, name string, height uint64) error
 	return nil
 }
 
+// ResetPin moves the named pin back to the given height, so
+// that its block processor, if running, processes every block
+// after height again. Blocks being processed when the pin is
+// reset don't advance it.
+func (s *Store) ResetPin(ctx context.Context, name string, height uint64) error {
+	s.mu.Lock()
+	p, ok := s.pins[name]
+	s.mu.Unlock()
+	if !ok {
+		return errors.Wrapf(ErrNoPin, "pin %s", name)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Only the leader may move the pin.
+	fence, fenceArgs := leader.Fence(ctx, 3)
+	q := `UPDATE block_processors SET height=$1 WHERE name=$2 AND ` + fence
+	res, err := p.db.Exec(ctx, q, append([]interface{}{height, name}, fenceArgs...)...)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if n == 0 {
+		err = leader.CheckFence(ctx, p.db)
+		if err != nil {
+			return err
+		}
+	}
+
+	p.height = height
+	p.completed = nil
+	p.gen++
+	close(p.reset)
+	p.reset = make(chan struct{})
+	p.cond.Broadcast()
+	return nil
+}
+
 func (s *Store) Height(name string) uint64 {
 	p := <-s.pin(name)
 	return p.getHeight()
@@ -186,13 +237,24 @@ type pin struct {
 	height    uint64
 	completed []uint64
 
+	// gen counts the times the pin has been reset.
+	// Reset closes and replaces the reset channel.
+	gen   uint64
+	reset chan struct{}
+
 	db   pg.DB
 	name string
 	sem  chan bool
 }
 
 func newPin(db pg.DB, name string, height uint64) *pin {
-	p := &pin{db: db, name: name, height: height, sem: make(chan bool, processorWorkers)}
+	p := &pin{
+		db:     db,
+		name:   name,
+		height: height,
+		reset:  make(chan struct{}),
+		sem:    make(chan bool, processorWorkers),
+	}
 	p.cond.L = &p.mu
 	return p
 }
@@ -203,7 +265,13 @@ func (p *pin) getHeight() uint64 {
 	return p.height
 }
 
-func (p *pin) processBlock(ctx context.Context, c *protocol.Chain, height uint64, cb func(context.Context, *bc.Block) error) {
+func (p *pin) state() (height, gen uint64, reset <-chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.height, p.gen, p.reset
+}
+
+func (p *pin) processBlock(ctx context.Context, c *protocol.Chain, height, gen uint64, cb func(context.Context, *bc.Block) error) {
 	defer func() { <-p.sem }()
 	for {
 		block, err := c.GetBlock(ctx, height)
@@ -216,7 +284,7 @@ func (p *pin) processBlock(ctx context.Context, c *protocol.Chain, height uint64
 			log.Error(ctx, err)
 			continue
 		}
-		err = p.complete(ctx, block.Height)
+		err = p.complete(ctx, block.Height, gen)
 		if err != nil {
 			log.Error(ctx, err)
 		}
@@ -224,10 +292,16 @@ func (p *pin) processBlock(ctx context.Context, c *protocol.Chain, height uint64
 	}
 }
 
-func (p *pin) complete(ctx context.Context, height uint64) error {
+func (p *pin) complete(ctx context.Context, height, gen uint64) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	if gen != p.gen {
+		// The pin was reset while this block was being
+		// processed; it will be processed again.
+		return nil
+	}
+
 	p.completed = append(p.completed, height)
 	sort.Sort(uint64s(p.completed))
 
@@ -248,11 +322,23 @@ func (p *pin) complete(ctx context.Context, height uint64) error {
 		return nil
 	}
 
-	const q = `UPDATE block_processors SET height=$1 WHERE height<$1 AND name=$2`
-	_, err := p.db.Exec(ctx, q, max, p.name)
+	// Only the leader may advance the pin.
+	fence, fenceArgs := leader.Fence(ctx, 3)
+	q := `UPDATE block_processors SET height=$1 WHERE height<$1 AND name=$2 AND ` + fence
+	res, err := p.db.Exec(ctx, q, append([]interface{}{max, p.name}, fenceArgs...)...)
 	if err != nil {
 		return err
 	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		err = leader.CheckFence(ctx, p.db)
+		if err != nil {
+			return err
+		}
+	}
 
 	const notifyQ = `SELECT pg_notify($1, $2)`
 	_, err = p.db.Exec(ctx, notifyQ, "pin-"+p.name, max)
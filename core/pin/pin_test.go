@@ -27,7 +27,7 @@ func TestWaitForPin(t *testing.T) {
 		}
 	}(sctx)
 
-	err := p.complete(ctx, 1)
+	err := p.complete(ctx, 1, 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -37,3 +37,57 @@ func TestWaitForPin(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestResetPin(t *testing.T) {
+	dbtx := pgtest.NewTx(t)
+	ctx := context.Background()
+
+	s := NewStore(dbtx)
+	err := s.CreatePin(ctx, "test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := <-s.pin("test")
+	for h := uint64(1); h <= 2; h++ {
+		err = p.complete(ctx, h, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, _, reset := p.state()
+	err = s.ResetPin(ctx, "test", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-reset:
+	default:
+		t.Error("reset channel not closed")
+	}
+	if h := s.Height("test"); h != 1 {
+		t.Errorf("height = %d want 1", h)
+	}
+
+	// A block processed before the reset doesn't advance the pin.
+	err = p.complete(ctx, 3, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := s.Height("test"); h != 1 {
+		t.Errorf("height after stale completion = %d want 1", h)
+	}
+
+	err = p.complete(ctx, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got uint64
+	err = dbtx.QueryRow(ctx, `SELECT height FROM block_processors WHERE name='test'`).Scan(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 2 {
+		t.Errorf("stored height = %d want 2", got)
+	}
+}
@@ -0,0 +1,132 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+
+	"chain/core/txdb"
+	"chain/database/pg"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/patricia"
+	"chain/protocol/state"
+	"chain/protocol/validation"
+)
+
+type outputProofResp struct {
+	BlockHeader *bc.BlockHeader `json:"block_header"`
+	Unspent     bool            `json:"unspent"`
+	Proof       *patricia.Proof `json:"proof"`
+}
+
+// POST /get-output-proof
+//
+// get-output-proof returns a Merkle proof that an output is,
+// or is not, unspent as of a block. The proof is against the
+// block's AssetsMerkleRoot, and the block's signed header is
+// returned with it, so the proof can be checked against the
+// signed root. To check an inclusion proof, the caller supplies
+// the output it expects. The state tree doesn't commit to
+// outpoints, so the proof doesn't fully bind the outpoint; see
+// state.VerifyOutputInclusion and state.VerifyOutputExclusion.
+//
+// If block_height is omitted, the proof is against the most
+// recent block. Otherwise this core must have a snapshot of
+// the state tree at that height.
+func (h *Handler) getOutputProof(ctx context.Context, req struct {
+	TxID        bc.Hash `json:"transaction_id"`
+	Position    uint32  `json:"position"`
+	BlockHeight uint64  `json:"block_height"`
+}) (*outputProofResp, error) {
+	block, snapshot := h.Chain.State()
+	if block == nil {
+		return nil, errors.WithDetail(pg.ErrUserInputNotFound, "this core has no blocks")
+	}
+	if snapshot == nil {
+		return nil, errors.WithDetail(pg.ErrUserInputNotFound, "this core does not keep the state tree")
+	}
+
+	if req.BlockHeight != 0 && req.BlockHeight != block.Height {
+		if req.BlockHeight > block.Height {
+			return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "block %d has not been created", req.BlockHeight)
+		}
+		data, err := h.Store.GetSnapshot(ctx, req.BlockHeight)
+		if errors.Root(err) == pg.ErrUserInputNotFound {
+			return nil, errors.WithDetailf(err, "no state snapshot at height %d", req.BlockHeight)
+		} else if err != nil {
+			return nil, err
+		}
+		snapshot, err = txdb.DecodeSnapshot(data)
+		if err != nil {
+			return nil, err
+		}
+		block, err = h.Chain.GetBlock(ctx, req.BlockHeight)
+		if err != nil {
+			return nil, err
+		}
+		if snapshot.Tree.RootHash() != block.AssetsMerkleRoot {
+			return nil, errors.Wrapf(errors.New("snapshot does not match block"), "height %d", block.Height)
+		}
+	}
+
+	outpoint := bc.Outpoint{Hash: req.TxID, Index: req.Position}
+	proof := snapshot.Tree.Prove(state.OutputKey(outpoint))
+	resp := &outputProofResp{
+		BlockHeader: &block.BlockHeader,
+		Unspent:     proof.Found,
+		Proof:       proof,
+	}
+	return resp, nil
+}
+
+type txProofResp struct {
+	BlockHeader *bc.BlockHeader     `json:"block_header"`
+	Proof       *validation.TxProof `json:"proof"`
+}
+
+// POST /get-transaction-proof
+//
+// get-transaction-proof returns a Merkle proof that a
+// transaction is included in a block, together with the
+// block's signed header. A client that knows the consensus
+// program of the previous block can check both with
+// validation.VerifyTxInBlock, without running a core.
+//
+// If block_height is omitted, the block is found using
+// the transaction index.
+func (h *Handler) getTxProof(ctx context.Context, req struct {
+	TxID        bc.Hash `json:"transaction_id"`
+	BlockHeight uint64  `json:"block_height"`
+}) (*txProofResp, error) {
+	height := req.BlockHeight
+	if height == 0 {
+		// Match on the transaction's ID in its annotated data,
+		// which uses the GIN index on data; tx_hash isn't indexed.
+		const q = `SELECT block_height FROM annotated_txs WHERE data @> jsonb_build_object('id', $1::text)`
+		err := h.DB.QueryRow(ctx, q, req.TxID.String()).Scan(&height)
+		if err == sql.ErrNoRows {
+			return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "transaction %s has not been confirmed", req.TxID)
+		} else if err != nil {
+			return nil, errors.Wrap(err, "looking up transaction")
+		}
+	}
+	if height > h.Chain.Height() {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "block %d has not been created", height)
+	}
+
+	block, err := h.Chain.GetBlock(ctx, height)
+	if err != nil {
+		return nil, err
+	}
+	for i, tx := range block.Transactions {
+		if tx.Hash != req.TxID {
+			continue
+		}
+		proof, err := validation.CalcTxProof(block.Transactions, i)
+		if err != nil {
+			return nil, err
+		}
+		return &txProofResp{BlockHeader: &block.BlockHeader, Proof: proof}, nil
+	}
+	return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "transaction %s is not in block %d", req.TxID, height)
+}
@@ -26,7 +26,9 @@ type (
 		SpentOutput     interface{} `json:"spent_output,omitempty"`
 		*txAccount
 		ReferenceData interface{} `json:"reference_data"`
+		RefDataOK     interface{} `json:"reference_data_conforms,omitempty"`
 		IsLocal       interface{} `json:"is_local"`
+		Custom        interface{} `json:"custom,omitempty"`
 	}
 	txoutResp struct {
 		Type            interface{} `json:"type"`
@@ -41,7 +43,9 @@ type (
 		*txAccount
 		ControlProgram interface{} `json:"control_program"`
 		ReferenceData  interface{} `json:"reference_data"`
+		RefDataOK      interface{} `json:"reference_data_conforms,omitempty"`
 		IsLocal        interface{} `json:"is_local"`
+		Custom         interface{} `json:"custom,omitempty"`
 	}
 	txResp struct {
 		ID            interface{} `json:"id"`
@@ -50,7 +54,9 @@ type (
 		BlockHeight   interface{} `json:"block_height"`
 		Position      interface{} `json:"position"`
 		ReferenceData interface{} `json:"reference_data"`
+		RefDataOK     interface{} `json:"reference_data_conforms,omitempty"`
 		IsLocal       interface{} `json:"is_local"`
+		Custom        interface{} `json:"custom,omitempty"`
 		Inputs        interface{} `json:"inputs"`
 		Outputs       interface{} `json:"outputs"`
 	}
@@ -165,7 +171,9 @@ func (h *Handler) listTransactions(ctx context.Context, in requestQuery) (result
 				SpentOutput:     in["spent_output"],
 				txAccount:       txAccountFromMap(in),
 				ReferenceData:   in["reference_data"],
+				RefDataOK:       in[query.RefDataConformsField],
 				IsLocal:         in["is_local"],
+				Custom:          in[query.CustomField],
 			}
 			inResps = append(inResps, r)
 		}
@@ -184,7 +192,9 @@ func (h *Handler) listTransactions(ctx context.Context, in requestQuery) (result
 				txAccount:       txAccountFromMap(out),
 				ControlProgram:  out["control_program"],
 				ReferenceData:   out["reference_data"],
+				RefDataOK:       out[query.RefDataConformsField],
 				IsLocal:         out["is_local"],
+				Custom:          out[query.CustomField],
 			}
 			outResps = append(outResps, r)
 		}
@@ -195,7 +205,9 @@ func (h *Handler) listTransactions(ctx context.Context, in requestQuery) (result
 			BlockHeight:   tx["block_height"],
 			Position:      tx["position"],
 			ReferenceData: tx["reference_data"],
+			RefDataOK:     tx[query.RefDataConformsField],
 			IsLocal:       tx["is_local"],
+			Custom:        tx[query.CustomField],
 			Inputs:        inResps,
 			Outputs:       outResps,
 		}
@@ -249,11 +261,13 @@ func (h *Handler) listAccounts(ctx context.Context, in requestQuery) (page, erro
 			}
 		}
 		r := &accountResponse{
-			ID:     a["id"],
-			Alias:  a["alias"],
-			Keys:   orderedKeys,
-			Quorum: a["quorum"],
-			Tags:   a["tags"],
+			ID:         a["id"],
+			Alias:      a["alias"],
+			Keys:       orderedKeys,
+			Quorum:     a["quorum"],
+			Tags:       a["tags"],
+			IsArchived: a["is_archived"],
+			Version:    a["version"],
 		}
 		result = append(result, r)
 	}
@@ -327,7 +341,9 @@ type utxoResp struct {
 	AccountTags     interface{} `json:"account_tags"`
 	ControlProgram  interface{} `json:"control_program"`
 	ReferenceData   interface{} `json:"reference_data"`
+	RefDataOK       interface{} `json:"reference_data_conforms,omitempty"`
 	IsLocal         interface{} `json:"is_local"`
+	Custom          interface{} `json:"custom,omitempty"`
 }
 
 // POST /list-unspent-outputs
@@ -388,7 +404,9 @@ func (h *Handler) listUnspentOutputs(ctx context.Context, in requestQuery) (resu
 			AccountTags:     out["account_tags"],
 			ControlProgram:  out["control_program"],
 			ReferenceData:   out["reference_data"],
+			RefDataOK:       out[query.RefDataConformsField],
 			IsLocal:         out["is_local"],
+			Custom:          out[query.CustomField],
 		}
 		resp = append(resp, r)
 	}
@@ -448,6 +466,8 @@ func (h *Handler) listAssets(ctx context.Context, in requestQuery) (page, error)
 			Definition:      a["definition"],
 			Tags:            a["tags"],
 			IsLocal:         a["is_local"],
+			IsArchived:      a["is_archived"],
+			Version:         a["version"],
 		}
 		if alias, ok := a["alias"].(string); ok && alias != "" {
 			r.Alias = &alias
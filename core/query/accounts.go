@@ -12,6 +12,7 @@ import (
 )
 
 // SaveAnnotatedAccount saves an annotated account to the query indexes.
+// It doesn't replace an annotated account with a later version.
 func (ind *Indexer) SaveAnnotatedAccount(ctx context.Context, accountID string, account map[string]interface{}) error {
 	b, err := json.Marshal(account)
 	if err != nil {
@@ -21,6 +22,7 @@ func (ind *Indexer) SaveAnnotatedAccount(ctx context.Context, accountID string,
 	const q = `
 		INSERT INTO annotated_accounts (id, data) VALUES($1, $2)
 		ON CONFLICT (id) DO UPDATE SET data = $2
+		WHERE COALESCE((annotated_accounts.data->>'version')::bigint, 0) <= COALESCE(($2::jsonb->>'version')::bigint, 0)
 	`
 	_, err = ind.db.Exec(ctx, q, accountID, b)
 	return errors.Wrap(err, "saving annotated account")
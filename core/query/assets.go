@@ -13,6 +13,7 @@ import (
 )
 
 // SaveAnnotatedAsset saves an annotated asset to the query indexes.
+// It doesn't replace an annotated asset with a later version.
 func (ind *Indexer) SaveAnnotatedAsset(ctx context.Context, assetID bc.AssetID, asset map[string]interface{}, sortID string) error {
 	b, err := json.Marshal(asset)
 	if err != nil {
@@ -22,6 +23,7 @@ func (ind *Indexer) SaveAnnotatedAsset(ctx context.Context, assetID bc.AssetID,
 	const q = `
 		INSERT INTO annotated_assets (id, data, sort_id) VALUES($1, $2, $3)
 		ON CONFLICT (id) DO UPDATE SET data = $2, sort_id = $3
+		WHERE COALESCE((annotated_assets.data->>'version')::bigint, 0) <= COALESCE(($2::jsonb->>'version')::bigint, 0)
 	`
 	_, err = ind.db.Exec(ctx, q, assetID.String(), b, sortID)
 	return errors.Wrap(err, "saving annotated asset")
@@ -0,0 +1,155 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"chain/core/rpc"
+	"chain/errors"
+	"chain/log"
+)
+
+// CustomField is the field of annotated transactions, inputs
+// and outputs that holds the fields added by HTTP annotators.
+// They can be filtered like any other field, as in
+// "custom.invoice_id=$1" or "outputs(custom.invoice_id=$1)".
+const CustomField = "custom"
+
+// FailurePolicy says what happens to a block's indexing
+// when an HTTP annotator fails or times out.
+type FailurePolicy int
+
+const (
+	// RetryOnFailure fails the block's indexing, so it's retried
+	// until the annotator succeeds. No later blocks are indexed
+	// meanwhile.
+	RetryOnFailure FailurePolicy = iota
+
+	// SkipOnFailure logs the error and indexes the block without
+	// the annotator's fields. They can be added later by
+	// re-indexing the block; see Indexer.Reindex.
+	SkipOnFailure
+)
+
+// ErrBadAnnotations is returned by an HTTP annotator when
+// the annotations it receives don't match the transactions
+// it sent.
+var ErrBadAnnotations = errors.New("bad annotations from annotator")
+
+// annotation is the custom fields of one transaction
+// and its inputs and outputs, as returned by an HTTP annotator.
+// Inputs and outputs may be shorter than the transaction's;
+// missing and null entries add no fields.
+type annotation struct {
+	Fields  map[string]interface{}   `json:"fields"`
+	Inputs  []map[string]interface{} `json:"inputs"`
+	Outputs []map[string]interface{} `json:"outputs"`
+}
+
+// NewHTTPAnnotator returns an Annotator that sends each block's
+// annotated transactions to an out-of-process annotator at the
+// given URL, as the JSON object {"transactions": [...]}. It
+// expects the response {"annotations": [...]}, with one object
+// per transaction, in the same order, of the form
+//
+//	{"fields": {...}, "inputs": [{...}, ...], "outputs": [{...}, ...]}
+//
+// The fields in each object are added to the CustomField of the
+// transaction, input or output. If the annotator doesn't respond
+// within timeout, or responds with an error, the policy says
+// whether the block is indexed anyway.
+func NewHTTPAnnotator(annotatorURL string, timeout time.Duration, policy FailurePolicy) (Annotator, error) {
+	u, err := url.Parse(annotatorURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing annotator URL")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("annotator URL %q must be http or https", annotatorURL)
+	}
+	client := &rpc.Client{BaseURL: annotatorURL}
+
+	return func(ctx context.Context, txs []map[string]interface{}) error {
+		if len(txs) == 0 {
+			return nil
+		}
+		err := callAnnotator(ctx, client, u.Path, timeout, txs)
+		if err != nil && policy == SkipOnFailure {
+			log.Error(ctx, err, "indexing without annotator ", u.Host)
+			return nil
+		}
+		return errors.Wrapf(err, "annotator %s", u.Host)
+	}, nil
+}
+
+func callAnnotator(ctx context.Context, client *rpc.Client, path string, timeout time.Duration, txs []map[string]interface{}) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	req := struct {
+		Transactions []map[string]interface{} `json:"transactions"`
+	}{txs}
+	var resp struct {
+		Annotations []*annotation `json:"annotations"`
+	}
+	err := client.Call(ctx, path, req, &resp)
+	if err != nil {
+		return err
+	}
+
+	// Check every annotation before applying any,
+	// so a bad response adds no fields.
+	if len(resp.Annotations) != len(txs) {
+		return errors.WithDetailf(ErrBadAnnotations, "got %d annotations for %d transactions", len(resp.Annotations), len(txs))
+	}
+	for i, a := range resp.Annotations {
+		if a == nil {
+			continue
+		}
+		ins, _ := txs[i]["inputs"].([]interface{})
+		outs, _ := txs[i]["outputs"].([]interface{})
+		if len(a.Inputs) > len(ins) || len(a.Outputs) > len(outs) {
+			return errors.WithDetailf(ErrBadAnnotations, "transaction %d: too many input or output annotations", i)
+		}
+	}
+
+	for i, a := range resp.Annotations {
+		if a == nil {
+			continue
+		}
+		addCustomFields(txs[i], a.Fields)
+		ins, _ := txs[i]["inputs"].([]interface{})
+		for j, fields := range a.Inputs {
+			if in, ok := ins[j].(map[string]interface{}); ok {
+				addCustomFields(in, fields)
+			}
+		}
+		outs, _ := txs[i]["outputs"].([]interface{})
+		for j, fields := range a.Outputs {
+			if out, ok := outs[j].(map[string]interface{}); ok {
+				addCustomFields(out, fields)
+			}
+		}
+	}
+	return nil
+}
+
+// addCustomFields adds fields to obj's CustomField. Fields
+// already set, by an earlier annotator, are replaced.
+func addCustomFields(obj, fields map[string]interface{}) {
+	if len(fields) == 0 {
+		return
+	}
+	custom, ok := obj[CustomField].(map[string]interface{})
+	if !ok {
+		custom = make(map[string]interface{}, len(fields))
+		obj[CustomField] = custom
+	}
+	for k, v := range fields {
+		custom[k] = v
+	}
+}
@@ -0,0 +1,92 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"chain/errors"
+)
+
+func TestHTTPAnnotator(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Transactions []map[string]interface{}
+		}
+		err := json.NewDecoder(req.Body).Decode(&body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var annotations []interface{}
+		for _, tx := range body.Transactions {
+			refdata := tx["reference_data"].(map[string]interface{})
+			annotations = append(annotations, map[string]interface{}{
+				"fields":  map[string]interface{}{"invoice_id": refdata["invoice"]},
+				"outputs": []interface{}{nil, map[string]interface{}{"line": 2}},
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"annotations": annotations})
+	}))
+	defer srv.Close()
+
+	annotate, err := NewHTTPAnnotator(srv.URL+"/annotate", time.Second, RetryOnFailure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txs := []map[string]interface{}{{
+		"reference_data": map[string]interface{}{"invoice": "inv-1"},
+		"inputs":         []interface{}{map[string]interface{}{}},
+		"outputs":        []interface{}{map[string]interface{}{}, map[string]interface{}{}},
+	}}
+	err = annotate(context.Background(), txs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []map[string]interface{}{{
+		"reference_data": map[string]interface{}{"invoice": "inv-1"},
+		"custom":         map[string]interface{}{"invoice_id": "inv-1"},
+		"inputs":         []interface{}{map[string]interface{}{}},
+		"outputs": []interface{}{
+			map[string]interface{}{},
+			map[string]interface{}{"custom": map[string]interface{}{"line": float64(2)}},
+		},
+	}}
+	if !reflect.DeepEqual(txs, want) {
+		t.Errorf("got %v want %v", txs, want)
+	}
+}
+
+func TestHTTPAnnotatorFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// One annotation for two transactions.
+		w.Write([]byte(`{"annotations": [{"fields": {"a": 1}}]}`))
+	}))
+	defer srv.Close()
+
+	txs := []map[string]interface{}{{}, {}}
+	retry, err := NewHTTPAnnotator(srv.URL, time.Second, RetryOnFailure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = retry(context.Background(), txs)
+	if errors.Root(err) != ErrBadAnnotations {
+		t.Errorf("got error %v want %s", err, ErrBadAnnotations)
+	}
+
+	skip, err := NewHTTPAnnotator(srv.URL, time.Second, SkipOnFailure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = skip(context.Background(), txs)
+	if err != nil {
+		t.Errorf("got error %v with SkipOnFailure", err)
+	}
+	if !reflect.DeepEqual(txs, []map[string]interface{}{{}, {}}) {
+		t.Errorf("bad response added fields: %v", txs)
+	}
+}
@@ -82,6 +82,13 @@ func (ind *Indexer) insertAnnotatedTxs(ctx context.Context, b *bc.Block) ([]map[
 			return nil, errors.Wrap(err, "adding external annotations")
 		}
 	}
+	if ind.refData != nil {
+		schemas, err := ind.refData.Load(ctx)
+		if err != nil {
+			return nil, err
+		}
+		flagReferenceData(b, annotatedTxsDecoded, schemas)
+	}
 	localAnnotator(ctx, annotatedTxsDecoded)
 
 	for _, decoded := range annotatedTxsDecoded {
@@ -92,11 +99,12 @@ func (ind *Indexer) insertAnnotatedTxs(ctx context.Context, b *bc.Block) ([]map[
 		annotatedTxs = append(annotatedTxs, string(b))
 	}
 
-	// Save the annotated txs to the database.
+	// Save the annotated txs to the database. A block that's
+	// indexed again, as by Reindex, replaces its annotations.
 	const insertQ = `
 		INSERT INTO annotated_txs(block_height, tx_pos, tx_hash, data)
 		SELECT $1, unnest($2::integer[]), unnest($3::text[]), unnest($4::jsonb[])
-		ON CONFLICT (block_height, tx_pos) DO NOTHING;
+		ON CONFLICT (block_height, tx_pos) DO UPDATE SET data = EXCLUDED.data;
 	`
 	_, err := ind.db.Exec(ctx, insertQ, b.Height, positions, hashes, annotatedTxs)
 	if err != nil {
@@ -162,7 +170,7 @@ func (ind *Indexer) insertAnnotatedOutputs(ctx context.Context, b *bc.Block, ann
 		INSERT INTO annotated_outputs (block_height, tx_pos, output_index, tx_hash, data, timespan)
 		SELECT $1, unnest($2::integer[]), unnest($3::integer[]), unnest($4::text[]),
 		           unnest($5::jsonb[]),   int8range($6, NULL)
-		ON CONFLICT (block_height, tx_pos, output_index) DO NOTHING;
+		ON CONFLICT (block_height, tx_pos, output_index) DO UPDATE SET data = EXCLUDED.data;
 	`
 	_, err := ind.db.Exec(ctx, insertQ, b.Height, outputTxPositions,
 		outputIndexes, outputTxHashes, outputData, b.TimestampMS)
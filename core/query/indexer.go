@@ -1,7 +1,10 @@
 package query
 
 import (
+	"sync"
+
 	"chain/core/pin"
+	"chain/core/refdata"
 	"chain/database/pg"
 	"chain/protocol"
 )
@@ -22,4 +25,8 @@ type Indexer struct {
 	c          *protocol.Chain
 	pinStore   *pin.Store
 	annotators []Annotator
+	refData    *refdata.Registry
+
+	reindexMu sync.Mutex
+	reindex   *ReindexProgress // latest re-index, if any
 }
@@ -0,0 +1,89 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/lib/pq"
+
+	"chain/errors"
+)
+
+// reannotateBatchBlocks is how many blocks' transactions and
+// outputs each statement run by Reannotate updates, so that
+// none locks more than a small part of the index at once.
+const reannotateBatchBlocks = 1000
+
+// Reannotate changes the annotations of indexed transactions
+// and outputs, after the object they describe has changed. In
+// every input and output whose field key has the given value,
+// it deletes the fields named in remove, then sets the fields
+// in set.
+//
+// It's used to back-fill account and asset annotations, which
+// are otherwise fixed when a transaction is indexed. It updates
+// the index in batches of blocks, each in its own transaction,
+// so queries may briefly see some blocks reannotated and others
+// not.
+func (ind *Indexer) Reannotate(ctx context.Context, key, value string, remove []string, set map[string]interface{}) error {
+	setJSON, err := json.Marshal(set)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	// Each of these rewrites the matching elements of an array,
+	// keeping an empty array empty rather than making it null.
+	// Postgres 9.5 can't delete a list of keys from a jsonb
+	// object, so the keys are filtered out with jsonb_each.
+	const (
+		stripKeys = `COALESCE((
+			SELECT jsonb_object_agg(k, v) FROM jsonb_each(e) AS fields(k, v) WHERE k <> ALL($3::text[])
+		), '{}'::jsonb)`
+		reannotateInputs = `COALESCE((
+			SELECT jsonb_agg(CASE WHEN e->>$1 = $2 THEN ` + stripKeys + ` || $4::jsonb ELSE e END ORDER BY i)
+			FROM jsonb_array_elements(data->'inputs') WITH ORDINALITY AS elems(e, i)
+		), '[]'::jsonb)`
+		reannotateOutputs = `COALESCE((
+			SELECT jsonb_agg(CASE WHEN e->>$1 = $2 THEN ` + stripKeys + ` || $4::jsonb ELSE e END ORDER BY i)
+			FROM jsonb_array_elements(data->'outputs') WITH ORDINALITY AS elems(e, i)
+		), '[]'::jsonb)`
+	)
+	const txsQ = `
+		UPDATE annotated_txs
+		SET data = jsonb_set(jsonb_set(data, '{inputs}', ` + reannotateInputs + `), '{outputs}', ` + reannotateOutputs + `)
+		WHERE block_height >= $5 AND block_height < $6 AND (
+			data @> jsonb_build_object('inputs', jsonb_build_array(jsonb_build_object($1::text, $2::text)))
+			OR data @> jsonb_build_object('outputs', jsonb_build_array(jsonb_build_object($1::text, $2::text)))
+		)
+	`
+	const outputsQ = `
+		UPDATE annotated_outputs
+		SET data = COALESCE((
+			SELECT jsonb_object_agg(k, v) FROM jsonb_each(data) AS fields(k, v) WHERE k <> ALL($3::text[])
+		), '{}'::jsonb) || $4::jsonb
+		WHERE block_height >= $5 AND block_height < $6
+			AND data @> jsonb_build_object($1::text, $2::text)
+	`
+	const heightsQ = `
+		SELECT COALESCE(LEAST((SELECT MIN(block_height) FROM annotated_txs), (SELECT MIN(block_height) FROM annotated_outputs)), 0),
+			COALESCE(GREATEST((SELECT MAX(block_height) FROM annotated_txs), (SELECT MAX(block_height) FROM annotated_outputs)), 0)
+	`
+	var lo, hi uint64
+	err = ind.db.QueryRow(ctx, heightsQ).Scan(&lo, &hi)
+	if err != nil {
+		return errors.Wrap(err, "looking up indexed heights")
+	}
+
+	for from := lo; from <= hi; from += reannotateBatchBlocks {
+		to := from + reannotateBatchBlocks
+		_, err = ind.db.Exec(ctx, txsQ, key, value, pq.StringArray(remove), string(setJSON), from, to)
+		if err != nil {
+			return errors.Wrapf(err, "reannotating transactions in blocks %d to %d", from, to-1)
+		}
+		_, err = ind.db.Exec(ctx, outputsQ, key, value, pq.StringArray(remove), string(setJSON), from, to)
+		if err != nil {
+			return errors.Wrapf(err, "reannotating outputs in blocks %d to %d", from, to-1)
+		}
+	}
+	return nil
+}
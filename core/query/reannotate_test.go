@@ -0,0 +1,47 @@
+package query
+
+import (
+	"context"
+	"testing"
+
+	"chain/database/pg/pgtest"
+	"chain/testutil"
+)
+
+func TestReannotate(t *testing.T) {
+	ctx := context.Background()
+	db := pgtest.NewTx(t)
+	ind := &Indexer{db: db}
+
+	// Blocks far enough apart to be updated in separate batches.
+	heights := []uint64{1, reannotateBatchBlocks + 1, 3*reannotateBatchBlocks + 7}
+	for _, h := range heights {
+		pgtest.Exec(ctx, db, t, `
+			INSERT INTO annotated_txs (block_height, tx_pos, tx_hash, data) VALUES ($1, 0, 'tx', $2)
+		`, h, `{"inputs":[{"account_id":"acc1","account_alias":"old"}],"outputs":[{"account_id":"acc2","account_alias":"other"}]}`)
+		pgtest.Exec(ctx, db, t, `
+			INSERT INTO annotated_outputs (block_height, tx_pos, output_index, tx_hash, data, timespan)
+			VALUES ($1, 0, 0, 'tx', $2, int8range(1, NULL))
+		`, h, `{"account_id":"acc1","account_alias":"old"}`)
+	}
+
+	err := ind.Reannotate(ctx, "account_id", "acc1", []string{"account_alias"}, map[string]interface{}{"account_alias": "new"})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	for _, h := range heights {
+		var in, out, output string
+		err = db.QueryRow(ctx, `
+			SELECT t.data->'inputs'->0->>'account_alias', t.data->'outputs'->0->>'account_alias', o.data->>'account_alias'
+			FROM annotated_txs t JOIN annotated_outputs o USING (block_height)
+			WHERE block_height = $1
+		`, h).Scan(&in, &out, &output)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if in != "new" || out != "other" || output != "new" {
+			t.Errorf("block %d: got input alias %q, output alias %q, indexed output alias %q, want new, other, new", h, in, out, output)
+		}
+	}
+}
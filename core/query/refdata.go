@@ -0,0 +1,45 @@
+package query
+
+import (
+	"chain/core/refdata"
+	"chain/protocol/bc"
+)
+
+// RefDataConformsField is the field of annotated transactions,
+// inputs and outputs that says, "yes" or "no", whether their
+// reference data conforms to its registered schema.
+const RefDataConformsField = "reference_data_conforms"
+
+// CheckReferenceData makes the indexer annotate transactions,
+// inputs and outputs with whether their reference data conforms
+// to the schemas in reg, as of when they're indexed.
+func (ind *Indexer) CheckReferenceData(reg *refdata.Registry) {
+	ind.refData = reg
+}
+
+func flagReferenceData(b *bc.Block, txs []map[string]interface{}, schemas *refdata.Schemas) {
+	for pos, tx := range b.Transactions {
+		txs[pos][RefDataConformsField] = conforms(schemas, nil, tx.ReferenceData)
+
+		ins, _ := txs[pos]["inputs"].([]interface{})
+		for i, in := range tx.Inputs {
+			if obj, ok := ins[i].(map[string]interface{}); ok {
+				assetID := in.AssetID()
+				obj[RefDataConformsField] = conforms(schemas, &assetID, in.ReferenceData)
+			}
+		}
+		outs, _ := txs[pos]["outputs"].([]interface{})
+		for i, out := range tx.Outputs {
+			if obj, ok := outs[i].(map[string]interface{}); ok {
+				obj[RefDataConformsField] = conforms(schemas, &out.AssetID, out.ReferenceData)
+			}
+		}
+	}
+}
+
+func conforms(schemas *refdata.Schemas, assetID *bc.AssetID, data []byte) string {
+	if schemas.Check(assetID, data) != nil {
+		return "no"
+	}
+	return "yes"
+}
@@ -0,0 +1,88 @@
+package query
+
+import (
+	"context"
+	"time"
+
+	"chain/errors"
+)
+
+// ErrBadReindexHeight is returned by Reindex when
+// there are no blocks to re-index from the given height.
+var ErrBadReindexHeight = errors.New("bad re-index height")
+
+// ReindexProgress describes a re-index started by Reindex.
+type ReindexProgress struct {
+	FromHeight uint64    // first block re-indexed
+	ToHeight   uint64    // chain height when the re-index started
+	Height     uint64    // last block re-indexed so far
+	StartedAt  time.Time // when the re-index started
+}
+
+// InProgress returns true if blocks up to ToHeight
+// have not all been re-indexed yet.
+func (p *ReindexProgress) InProgress() bool {
+	return p.Height < p.ToHeight
+}
+
+// ETA estimates when the re-index will finish, from the rate
+// at which blocks have been re-indexed so far. It returns the
+// zero time if the re-index is finished or no blocks have been
+// re-indexed yet.
+func (p *ReindexProgress) ETA() time.Time {
+	if !p.InProgress() || p.Height < p.FromHeight {
+		return time.Time{}
+	}
+	var (
+		done      = p.Height - p.FromHeight + 1
+		elapsed   = time.Since(p.StartedAt)
+		remaining = time.Duration(float64(elapsed) * float64(p.ToHeight-p.Height) / float64(done))
+	)
+	return time.Now().Add(remaining)
+}
+
+// Reindex rebuilds the annotated transactions and outputs of
+// blocks from the given height onward, using the annotators
+// currently registered. It resets the transaction pin to the
+// block before height, so the indexer started by ProcessBlocks
+// replays IndexTransactions for each stored block. Replayed
+// blocks overwrite their earlier annotations; until they're
+// replayed, queries return the earlier annotations.
+//
+// Reindex returns once the pin is reset. Progress reports
+// the re-index's progress.
+func (ind *Indexer) Reindex(ctx context.Context, height uint64) error {
+	if height < 1 {
+		height = 1
+	}
+	to := ind.c.Height()
+	if height > to {
+		return errors.WithDetailf(ErrBadReindexHeight, "height %d is above the chain height %d", height, to)
+	}
+
+	ind.reindexMu.Lock()
+	defer ind.reindexMu.Unlock()
+	err := ind.pinStore.ResetPin(ctx, TxPinName, height-1)
+	if err != nil {
+		return errors.Wrap(err, "resetting transaction pin")
+	}
+	ind.reindex = &ReindexProgress{
+		FromHeight: height,
+		ToHeight:   to,
+		StartedAt:  time.Now(),
+	}
+	return nil
+}
+
+// Progress returns the progress of the latest re-index
+// started by this process, or nil if there hasn't been one.
+func (ind *Indexer) Progress() *ReindexProgress {
+	ind.reindexMu.Lock()
+	defer ind.reindexMu.Unlock()
+	if ind.reindex == nil {
+		return nil
+	}
+	p := *ind.reindex
+	p.Height = ind.pinStore.Height(TxPinName)
+	return &p
+}
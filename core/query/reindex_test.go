@@ -0,0 +1,37 @@
+package query
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReindexProgressETA(t *testing.T) {
+	start := time.Now().Add(-10 * time.Second)
+	cases := []struct {
+		height     uint64
+		inProgress bool
+		wantETA    time.Duration // from now; -1 means the zero time
+	}{
+		{height: 9, inProgress: true, wantETA: -1},                // nothing re-indexed yet
+		{height: 14, inProgress: true, wantETA: 12 * time.Second}, // 5 blocks in 10s, 6 to go
+		{height: 19, inProgress: true, wantETA: time.Second},
+		{height: 20, inProgress: false, wantETA: -1},
+	}
+	for _, c := range cases {
+		p := &ReindexProgress{FromHeight: 10, ToHeight: 20, Height: c.height, StartedAt: start}
+		if got := p.InProgress(); got != c.inProgress {
+			t.Errorf("height %d: InProgress() = %t want %t", c.height, got, c.inProgress)
+		}
+		eta := p.ETA()
+		if c.wantETA < 0 {
+			if !eta.IsZero() {
+				t.Errorf("height %d: ETA() = %s want zero time", c.height, eta)
+			}
+			continue
+		}
+		got := eta.Sub(time.Now())
+		if got < c.wantETA-time.Second || got > c.wantETA+time.Second {
+			t.Errorf("height %d: ETA() is %s from now, want about %s", c.height, got, c.wantETA)
+		}
+	}
+}
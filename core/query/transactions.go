@@ -3,6 +3,7 @@ package query
 import (
 	"bytes"
 	"context"
+	stdsql "database/sql"
 	"encoding/json"
 	"fmt"
 	"math"
@@ -10,6 +11,7 @@ import (
 
 	"chain/core/query/filter"
 	"chain/errors"
+	"chain/protocol/bc"
 )
 
 var (
@@ -69,6 +71,24 @@ func (ind *Indexer) LookupTxAfter(ctx context.Context, begin, end uint64) (TxAft
 	}, nil
 }
 
+// TxBlockHeight returns the height of the block containing the
+// indexed transaction with the given hash. Its second result is
+// false if the transaction isn't indexed.
+func (ind *Indexer) TxBlockHeight(ctx context.Context, hash bc.Hash) (uint64, bool, error) {
+	const q = `
+		SELECT block_height FROM annotated_txs
+		WHERE data @> jsonb_build_object('id', $1::text)
+	`
+	var height uint64
+	err := ind.db.QueryRow(ctx, q, hash.String()).Scan(&height)
+	if err == stdsql.ErrNoRows {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, errors.Wrap(err, "looking up indexed tx")
+	}
+	return height, true, nil
+}
+
 // Transactions queries the blockchain for transactions matching the
 // filter predicate `p`.
 func (ind *Indexer) Transactions(ctx context.Context, p filter.Predicate, vals []interface{}, after TxAfter, limit int, asc bool) ([]interface{}, *TxAfter, error) {
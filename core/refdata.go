@@ -0,0 +1,58 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+
+	"chain/core/refdata"
+	"chain/core/txbuilder"
+	"chain/encoding/jsonschema"
+	"chain/protocol/bc"
+)
+
+// POST /set-reference-data-schema
+//
+// set-reference-data-schema registers a JSON schema for the
+// reference data of the given asset's inputs and outputs, or,
+// if asset_id is omitted, a global schema for all other
+// reference data. /build-transaction rejects reference data
+// that doesn't conform, and indexed transactions, inputs and
+// outputs with nonconforming reference data are annotated with
+// reference_data_conforms='no'.
+func (h *Handler) setRefDataSchema(ctx context.Context, req struct {
+	AssetID *bc.AssetID     `json:"asset_id"`
+	Schema  json.RawMessage `json:"schema"`
+}) (*refdata.Schema, error) {
+	if len(req.Schema) == 0 {
+		return nil, txbuilder.MissingFieldsError("schema")
+	}
+	schema, err := jsonschema.Parse(req.Schema)
+	if err != nil {
+		return nil, err
+	}
+	err = h.RefData.Set(ctx, req.AssetID, schema)
+	if err != nil {
+		return nil, err
+	}
+	return &refdata.Schema{AssetID: req.AssetID, Schema: schema}, nil
+}
+
+// POST /delete-reference-data-schema
+func (h *Handler) deleteRefDataSchema(ctx context.Context, req struct {
+	AssetID *bc.AssetID `json:"asset_id"`
+}) error {
+	return h.RefData.Delete(ctx, req.AssetID)
+}
+
+// POST /list-reference-data-schemas
+func (h *Handler) listRefDataSchemas(ctx context.Context) ([]*refdata.Schema, error) {
+	schemas, err := h.RefData.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// ensure null is never returned
+	if schemas == nil {
+		schemas = []*refdata.Schema{}
+	}
+	return schemas, nil
+}
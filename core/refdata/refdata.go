@@ -0,0 +1,201 @@
+// Package refdata checks transaction reference data
+// against JSON schemas registered by the Core's operator.
+//
+// A schema is registered either for an asset or globally.
+// The reference data of an input or output must conform to
+// its asset's schema, or to the global schema if its asset
+// has none. A transaction's own reference data must conform
+// to the global schema. Empty reference data is checked as
+// an empty JSON object.
+package refdata
+
+import (
+	"context"
+	"fmt"
+
+	"chain/database/pg"
+	"chain/encoding/jsonschema"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+// ErrNonconforming is returned when reference data
+// doesn't conform to its schema.
+var ErrNonconforming = errors.New("reference data does not conform to schema")
+
+// Registry stores reference data schemas.
+type Registry struct {
+	DB pg.DB
+}
+
+// Schema is a reference data schema. AssetID
+// is nil for the global schema.
+type Schema struct {
+	AssetID *bc.AssetID        `json:"asset_id"`
+	Schema  *jsonschema.Schema `json:"schema"`
+}
+
+// The global schema is stored with an empty asset ID.
+const globalKey = ""
+
+func key(assetID *bc.AssetID) string {
+	if assetID == nil {
+		return globalKey
+	}
+	return assetID.String()
+}
+
+// Set registers schema for the given asset, or globally if
+// assetID is nil, replacing any schema already registered.
+// It doesn't affect transactions already built or indexed.
+func (r *Registry) Set(ctx context.Context, assetID *bc.AssetID, schema *jsonschema.Schema) error {
+	raw, err := schema.MarshalJSON()
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	const q = `
+		INSERT INTO reference_data_schemas (asset_id, schema) VALUES ($1, $2)
+		ON CONFLICT (asset_id) DO UPDATE SET schema = EXCLUDED.schema
+	`
+	_, err = r.DB.Exec(ctx, q, key(assetID), raw)
+	return errors.Wrap(err, "saving reference data schema")
+}
+
+// Delete removes the schema registered for the given
+// asset, or the global schema if assetID is nil.
+func (r *Registry) Delete(ctx context.Context, assetID *bc.AssetID) error {
+	const q = `DELETE FROM reference_data_schemas WHERE asset_id = $1`
+	res, err := r.DB.Exec(ctx, q, key(assetID))
+	if err != nil {
+		return errors.Wrap(err, "deleting reference data schema")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if n == 0 {
+		return errors.WithDetail(pg.ErrUserInputNotFound, "no reference data schema registered")
+	}
+	return nil
+}
+
+// List returns every registered schema,
+// the global schema first.
+func (r *Registry) List(ctx context.Context) ([]*Schema, error) {
+	schemas, err := r.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var list []*Schema
+	if schemas.global != nil {
+		list = append(list, &Schema{Schema: schemas.global})
+	}
+	for _, id := range schemas.order {
+		id := id
+		list = append(list, &Schema{AssetID: &id, Schema: schemas.assets[id]})
+	}
+	return list, nil
+}
+
+// Load loads the registered schemas, so that many
+// items of reference data can be checked at once.
+func (r *Registry) Load(ctx context.Context) (*Schemas, error) {
+	s := &Schemas{assets: make(map[bc.AssetID]*jsonschema.Schema)}
+	const q = `SELECT asset_id, schema FROM reference_data_schemas ORDER BY asset_id`
+	err := pg.ForQueryRows(ctx, r.DB, q, func(assetID string, raw []byte) error {
+		schema, err := jsonschema.Parse(raw)
+		if err != nil {
+			return err
+		}
+		if assetID == globalKey {
+			s.global = schema
+			return nil
+		}
+		var id bc.AssetID
+		err = id.UnmarshalText([]byte(assetID))
+		if err != nil {
+			return err
+		}
+		s.assets[id] = schema
+		s.order = append(s.order, id)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "loading reference data schemas")
+	}
+	return s, nil
+}
+
+// CheckTx checks the reference data of tx against the
+// registered schemas. It skips the inputs and outputs of
+// base, the transaction tx was built on, which were checked
+// by whoever added them, and the reference data of tx if it
+// came from base. Base may be nil. It has the signature of
+// txbuilder.RefDataCheck.
+func (r *Registry) CheckTx(ctx context.Context, tx, base *bc.TxData) error {
+	schemas, err := r.Load(ctx)
+	if err != nil {
+		return err
+	}
+	var baseIns, baseOuts int
+	if base != nil {
+		baseIns, baseOuts = len(base.Inputs), len(base.Outputs)
+	}
+	if base == nil || len(base.ReferenceData) == 0 {
+		err = schemas.Check(nil, tx.ReferenceData)
+		if err != nil {
+			return describe(err, "transaction")
+		}
+	}
+	for i := baseIns; i < len(tx.Inputs); i++ {
+		assetID := tx.Inputs[i].AssetID()
+		err = schemas.Check(&assetID, tx.Inputs[i].ReferenceData)
+		if err != nil {
+			return describe(err, "input %d", i)
+		}
+	}
+	for i := baseOuts; i < len(tx.Outputs); i++ {
+		err = schemas.Check(&tx.Outputs[i].AssetID, tx.Outputs[i].ReferenceData)
+		if err != nil {
+			return describe(err, "output %d", i)
+		}
+	}
+	return nil
+}
+
+// describe says which reference data a nonconforming error is about.
+func describe(err error, format string, args ...interface{}) error {
+	if errors.Root(err) != ErrNonconforming {
+		return err
+	}
+	return errors.WithDetailf(ErrNonconforming, "%s reference data: %s", fmt.Sprintf(format, args...), errors.Detail(err))
+}
+
+// Schemas is a set of reference data schemas,
+// as loaded by Registry.Load.
+type Schemas struct {
+	global *jsonschema.Schema
+	assets map[bc.AssetID]*jsonschema.Schema
+	order  []bc.AssetID
+}
+
+// Check checks data against the schema for the given asset,
+// or the global schema if the asset has none or assetID is
+// nil. Data with no schema always conforms.
+func (s *Schemas) Check(assetID *bc.AssetID, data []byte) error {
+	schema := s.global
+	if assetID != nil && s.assets[*assetID] != nil {
+		schema = s.assets[*assetID]
+	}
+	if schema == nil {
+		return nil
+	}
+	if len(data) == 0 {
+		data = []byte(`{}`)
+	}
+	err := schema.Validate(data)
+	if errors.Root(err) == jsonschema.ErrMismatch {
+		return errors.WithDetail(ErrNonconforming, errors.Detail(err))
+	}
+	return err
+}
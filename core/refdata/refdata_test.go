@@ -0,0 +1,89 @@
+package refdata
+
+import (
+	"context"
+	"testing"
+
+	"chain/database/pg/pgtest"
+	"chain/encoding/jsonschema"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+func mustParse(t *testing.T, s string) *jsonschema.Schema {
+	schema, err := jsonschema.Parse([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+func TestSchemasCheck(t *testing.T) {
+	gold, silver := bc.AssetID{1}, bc.AssetID{2}
+	schemas := &Schemas{
+		global: mustParse(t, `{"type": "object", "properties": {"memo": {"type": "string"}}}`),
+		assets: map[bc.AssetID]*jsonschema.Schema{
+			gold: mustParse(t, `{"type": "object", "required": ["invoice"]}`),
+		},
+	}
+	cases := []struct {
+		assetID *bc.AssetID
+		data    string
+		ok      bool
+	}{
+		{nil, ``, true},
+		{nil, `{"memo": "hi"}`, true},
+		{nil, `{"memo": 1}`, false},
+		{nil, `not json`, false},
+		{&silver, `{"memo": 1}`, false}, // no asset schema; global applies
+		{&gold, `{"memo": 1}`, false},
+		{&gold, `{"invoice": 7, "memo": 1}`, true},
+	}
+	for _, c := range cases {
+		err := schemas.Check(c.assetID, []byte(c.data))
+		if c.ok && err != nil {
+			t.Errorf("Check(%v, %q) = %v want nil", c.assetID, c.data, err)
+		} else if !c.ok && errors.Root(err) != ErrNonconforming {
+			t.Errorf("Check(%v, %q) = %v want %s", c.assetID, c.data, err, ErrNonconforming)
+		}
+	}
+
+	var none Schemas
+	if err := none.Check(nil, []byte(`not json`)); err != nil {
+		t.Errorf("with no schemas, got error %v", err)
+	}
+}
+
+func TestCheckTx(t *testing.T) {
+	ctx := context.Background()
+	r := &Registry{DB: pgtest.NewTx(t)}
+	gold := bc.AssetID{1}
+	err := r.Set(ctx, &gold, mustParse(t, `{"type": "object", "required": ["invoice"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := &bc.TxData{Outputs: []*bc.TxOutput{bc.NewTxOutput(gold, 1, nil, nil)}}
+	tx := &bc.TxData{Outputs: []*bc.TxOutput{
+		base.Outputs[0],
+		bc.NewTxOutput(gold, 1, nil, []byte(`{"invoice": "x"}`)),
+	}}
+	// The base transaction's output isn't checked.
+	err = r.CheckTx(ctx, tx, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.CheckTx(ctx, tx, nil)
+	if errors.Root(err) != ErrNonconforming {
+		t.Errorf("got error %v want %s", err, ErrNonconforming)
+	}
+
+	err = r.Delete(ctx, &gold)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.CheckTx(ctx, tx, nil)
+	if err != nil {
+		t.Errorf("after Delete, got error %v", err)
+	}
+}
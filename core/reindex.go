@@ -0,0 +1,49 @@
+package core
+
+import (
+	"context"
+
+	"chain/core/leader"
+	"chain/core/query"
+	"chain/core/txdb"
+	"chain/errors"
+)
+
+var errIndexingDisabled = errors.New("transaction indexing is disabled")
+
+// POST /reindex-transactions
+//
+// reindex-transactions rebuilds the annotated transactions and
+// outputs of every block from height onward, or of every stored
+// block if height is omitted. It returns once the re-index has
+// started; /info reports its progress. Blocks that have been
+// pruned can't be re-indexed.
+func (h *Handler) reindexTransactions(ctx context.Context, req struct {
+	Height uint64 `json:"height"`
+}) error {
+	if !h.IndexTxs {
+		return errIndexingDisabled
+	}
+	if !leader.IsLeading() {
+		return h.forwardToLeader(ctx, "/reindex-transactions", req, nil)
+	}
+
+	pruned, err := h.Store.PrunedHeight(ctx)
+	if err != nil {
+		return err
+	}
+	height := req.Height
+	if height == 0 {
+		height = pruned
+	} else if pruned > 0 && height < pruned {
+		return errors.WithDetailf(txdb.ErrPruned, "this core has no blocks below height %d except the initial block", pruned)
+	}
+	return h.Indexer.Reindex(ctx, height)
+}
+
+func (h *Handler) reindexProgress() *query.ReindexProgress {
+	if h.Indexer == nil {
+		return nil
+	}
+	return h.Indexer.Progress()
+}
@@ -5,8 +5,12 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"chain/core/fetch"
+	"chain/core/txdb"
+	"chain/encoding/blockchain"
 	chainjson "chain/encoding/json"
 	"chain/errors"
+	"chain/log"
 	"chain/net/http/httpjson"
 	"chain/protocol/bc"
 )
@@ -29,6 +33,71 @@ func (h *Handler) getBlockRPC(ctx context.Context, height uint64) (chainjson.Hex
 	return rawBlock, nil
 }
 
+// maxBlockRange is the most blocks returned by
+// one get-block-range request.
+const maxBlockRange = 1000
+
+// getBlockRangeRPC streams the blocks in a range of heights,
+// starting at the requested height. Each block is written in
+// its binary serialization, prefixed with its length as a
+// varint (see blockchain.WriteVarstr31). Like getBlockRPC, it
+// waits if necessary until the first block is created. It
+// sends only blocks that exist, so the response may hold
+// fewer blocks than were requested.
+//
+// This handler doesn't use the httpjson.Handler format so that
+// it can stream blocks as they are read from the store.
+func (h *Handler) getBlockRangeRPC(rw http.ResponseWriter, req *http.Request) {
+	if h.Config == nil {
+		alwaysError(errUnconfigured).ServeHTTP(rw, req)
+		return
+	}
+
+	ctx := req.Context()
+	var x struct {
+		Height uint64 `json:"height"`
+		Count  uint64 `json:"count"`
+	}
+	err := json.NewDecoder(req.Body).Decode(&x)
+	if err != nil || x.Height == 0 || x.Count == 0 {
+		WriteHTTPError(ctx, rw, httpjson.ErrBadRequest)
+		return
+	}
+	if x.Count > maxBlockRange {
+		x.Count = maxBlockRange
+	}
+
+	err = <-h.Chain.BlockSoonWaiter(ctx, x.Height)
+	if err != nil {
+		WriteHTTPError(ctx, rw, errors.Wrapf(err, "waiting for block at height %d", x.Height))
+		return
+	}
+
+	end := x.Height + x.Count - 1
+	if tip := h.Chain.Height(); end > tip {
+		end = tip
+	}
+	for height := x.Height; height <= end; height++ {
+		rawBlock, err := h.Store.GetRawBlock(ctx, height)
+		if err != nil && height == x.Height {
+			WriteHTTPError(ctx, rw, err)
+			return
+		} else if err != nil {
+			// The client will see the stream end early
+			// and ask for the remaining blocks again.
+			log.Error(ctx, err)
+			return
+		}
+		if height == x.Height {
+			rw.Header().Set("Content-Type", "application/octet-stream")
+		}
+		_, err = blockchain.WriteVarstr31(rw, rawBlock)
+		if err != nil {
+			return // the client went away
+		}
+	}
+}
+
 // getBlocksRPC -- DEPRECATED: use getBlock instead
 func (h *Handler) getBlocksRPC(ctx context.Context, afterHeight uint64) ([]chainjson.HexBytes, error) {
 	block, err := h.getBlockRPC(ctx, afterHeight+1)
@@ -39,16 +108,45 @@ func (h *Handler) getBlocksRPC(ctx context.Context, afterHeight uint64) ([]chain
 	return []chainjson.HexBytes{block}, nil
 }
 
+// getLightBlockRPC returns the header of the block at the
+// requested height, with the transactions a light client
+// asked for and proofs of their inclusion. Like getBlockRPC,
+// it waits if necessary until the block is created.
+func (h *Handler) getLightBlockRPC(ctx context.Context, req fetch.LightBlockRequest) (*fetch.LightBlock, error) {
+	err := <-h.Chain.BlockSoonWaiter(ctx, req.Height)
+	if err != nil {
+		return nil, errors.Wrapf(err, "waiting for block at height %d", req.Height)
+	}
+
+	block, err := h.Chain.GetBlock(ctx, req.Height)
+	if err != nil {
+		return nil, err
+	}
+	return fetch.MakeLightBlock(block, &req)
+}
+
 type snapshotInfoResp struct {
-	Height       uint64  `json:"height"`
-	Size         uint64  `json:"size"`
-	BlockchainID bc.Hash `json:"blockchain_id"`
+	Height       uint64              `json:"height"`
+	Size         uint64              `json:"size"`
+	BlockchainID bc.Hash             `json:"blockchain_id"`
+	Parts        []txdb.SnapshotPart `json:"parts"`
 }
 
 func (h *Handler) getSnapshotInfoRPC(ctx context.Context) (resp snapshotInfoResp, err error) {
 	// TODO(jackson): cache latest snapshot and its height & size in-memory.
 	resp.Height, resp.Size, err = h.Store.LatestSnapshotInfo(ctx)
 	resp.BlockchainID = h.Config.BlockchainID
+	if err != nil {
+		return resp, err
+	}
+
+	// Peers that understand deltas can download the
+	// parts of the snapshot instead of the whole thing.
+	resp.Parts, err = h.Store.SnapshotChain(ctx, resp.Height)
+	resp.Size = 0
+	for _, p := range resp.Parts {
+		resp.Size += p.Size
+	}
 	return resp, err
 }
 
@@ -59,6 +157,17 @@ func (h *Handler) getSnapshotInfoRPC(ctx context.Context) (resp snapshotInfoResp
 // This handler doesn't use the httpjson.Handler format so that it can return
 // raw protobuf bytes on the wire.
 func (h *Handler) getSnapshotRPC(rw http.ResponseWriter, req *http.Request) {
+	h.serveSnapshot(rw, req, h.Store.GetSnapshot)
+}
+
+// getSnapshotPartRPC is like getSnapshotRPC, but returns the
+// full or delta snapshot stored at the provided height, as
+// listed in the parts returned by get-snapshot-info.
+func (h *Handler) getSnapshotPartRPC(rw http.ResponseWriter, req *http.Request) {
+	h.serveSnapshot(rw, req, h.Store.GetSnapshotPart)
+}
+
+func (h *Handler) serveSnapshot(rw http.ResponseWriter, req *http.Request, get func(context.Context, uint64) ([]byte, error)) {
 	if h.Config == nil {
 		alwaysError(errUnconfigured).ServeHTTP(rw, req)
 		return
@@ -71,7 +180,7 @@ func (h *Handler) getSnapshotRPC(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	data, err := h.Store.GetSnapshot(req.Context(), height)
+	data, err := get(req.Context(), height)
 	if err != nil {
 		WriteHTTPError(req.Context(), rw, err)
 		return
@@ -45,15 +45,34 @@ func (c Client) userAgent() string {
 }
 
 // errStatusCode is an error returned when an rpc fails with a non-200
-// response code.
+// response code. If the response body was a Chain Core error, Code
+// and Detail hold its error code and detail.
 type errStatusCode struct {
 	URL        string
 	StatusCode int
+	Code       string
+	Detail     string
 }
 
 func (e errStatusCode) Error() string {
-	return fmt.Sprintf("Request to `%s` responded with %d %s",
+	msg := fmt.Sprintf("Request to `%s` responded with %d %s",
 		e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Code != "" {
+		msg += fmt.Sprintf(" (%s: %s)", e.Code, e.Detail)
+	}
+	return msg
+}
+
+// ClientError reports whether err is the result of the remote node
+// refusing a request with a 4xx response code, such as when it
+// rejects a transaction. It also returns the error code and detail
+// from the response, if any.
+func ClientError(err error) (code, detail string, ok bool) {
+	e, ok := errors.Root(err).(errStatusCode)
+	if !ok || e.StatusCode < 400 || e.StatusCode >= 500 {
+		return "", "", false
+	}
+	return e.Code, e.Detail, true
 }
 
 // Call calls a remote procedure on another node, specified by the path.
@@ -130,10 +149,17 @@ func (c *Client) CallRaw(ctx context.Context, path string, request interface{})
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		resp.Body.Close()
+		defer resp.Body.Close()
+		var body struct {
+			Code   string `json:"code"`
+			Detail string `json:"detail"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body) // best effort
 		return nil, errStatusCode{
 			URL:        cleanedURLString(u),
 			StatusCode: resp.StatusCode,
+			Code:       body.Code,
+			Detail:     body.Detail,
 		}
 	}
 	return resp.Body, nil
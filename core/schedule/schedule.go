@@ -0,0 +1,452 @@
+// Package schedule runs transactions on a schedule.
+//
+// A scheduled transaction holds build actions, like those accepted
+// by /build-transaction. Each time it's due, the leader builds a
+// transaction from them, signs it with this Core's MockHSM, and
+// submits it. The schedule is stored in the database, so a run that
+// falls due while leadership is moving isn't missed: the next leader
+// runs it as soon as it's elected. Runs missed while there was no
+// leader at all are run once, not once per missed period.
+package schedule
+
+import (
+	"bytes"
+	"context"
+	stdsql "database/sql"
+	"encoding/json"
+	"time"
+
+	"chain/core/txbuilder"
+	"chain/core/txstatus"
+	"chain/database/pg"
+	"chain/database/sql"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/log"
+)
+
+// ErrDuplicateAlias is returned when a scheduled transaction
+// is created with an alias that's already in use.
+var ErrDuplicateAlias = errors.New("duplicate scheduled transaction alias")
+
+// Executor builds and submits the transactions
+// of scheduled runs.
+type Executor interface {
+	// Build builds a transaction from actions, with
+	// the given time to live, and signs it.
+	Build(ctx context.Context, actions []map[string]interface{}, ttl time.Duration) (*txbuilder.Template, error)
+
+	// Submit submits a transaction returned by Build.
+	Submit(ctx context.Context, tpl *txbuilder.Template) error
+}
+
+// ScheduledTx is a transaction run on a schedule.
+//
+// It's first run at StartTime, then every Period, unless
+// Period is zero. A run that fails before its transaction
+// is accepted is retried after RetryDelay, up to MaxRetries
+// times, before it's given up until the next period.
+// NextRun is nil once there are no more runs.
+type ScheduledTx struct {
+	ID         string                   `json:"id"`
+	Alias      *string                  `json:"alias"`
+	Actions    []map[string]interface{} `json:"actions"`
+	TTL        chainjson.Duration       `json:"ttl"`
+	StartTime  time.Time                `json:"start_time"`
+	Period     chainjson.Duration       `json:"period"`
+	NextRun    *time.Time               `json:"next_run"`
+	MaxRetries int                      `json:"max_retries"`
+	RetryDelay chainjson.Duration       `json:"retry_delay"`
+	Failures   int                      `json:"failures"`
+}
+
+// Run is the outcome of one attempt to run a
+// scheduled transaction. TxID is the ID of the
+// transaction submitted, whose status is reported
+// by /get-transaction-status.
+type Run struct {
+	ID      string    `json:"id"`
+	RunAt   time.Time `json:"run_at"`
+	Attempt int       `json:"attempt"`
+	TxID    string    `json:"transaction_id,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// Scheduler stores scheduled transactions and runs them.
+type Scheduler struct {
+	DB *sql.DB
+}
+
+const scheduledTxCols = `
+	id, alias, actions, ttl, start_time, period,
+	next_run, max_retries, retry_delay, failures
+`
+
+func scanScheduledTx(scan func(...interface{}) error) (*ScheduledTx, error) {
+	var (
+		stx                     ScheduledTx
+		alias                   stdsql.NullString
+		actions                 []byte
+		ttl, period, retryDelay int64
+	)
+	err := scan(
+		&stx.ID, &alias, &actions, &ttl, &stx.StartTime, &period,
+		&stx.NextRun, &stx.MaxRetries, &retryDelay, &stx.Failures,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if alias.Valid {
+		stx.Alias = &alias.String
+	}
+	// Keep amounts exact; they may not fit in a float64.
+	dec := json.NewDecoder(bytes.NewReader(actions))
+	dec.UseNumber()
+	err = dec.Decode(&stx.Actions)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding actions")
+	}
+	stx.TTL.Duration = time.Duration(ttl) * time.Millisecond
+	stx.Period.Duration = time.Duration(period) * time.Millisecond
+	stx.RetryDelay.Duration = time.Duration(retryDelay) * time.Millisecond
+	return &stx, nil
+}
+
+func ms(d chainjson.Duration) int64 {
+	return int64(d.Duration / time.Millisecond)
+}
+
+// Create saves stx and schedules its first run at
+// stx.StartTime. If clientToken is not nil and a scheduled
+// transaction was already created with it, Create returns
+// that one instead.
+func (s *Scheduler) Create(ctx context.Context, stx *ScheduledTx, clientToken *string) (*ScheduledTx, error) {
+	actions, err := json.Marshal(stx.Actions)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	q := `
+		INSERT INTO scheduled_txs
+			(alias, actions, ttl, start_time, period, next_run,
+			max_retries, retry_delay, client_token)
+		VALUES ($1, $2, $3, $4, $5, $4, $6, $7, $8)
+		ON CONFLICT (client_token) DO NOTHING
+		RETURNING ` + scheduledTxCols
+	created, err := scanScheduledTx(s.DB.QueryRow(
+		ctx, q, stx.Alias, actions, ms(stx.TTL), stx.StartTime, ms(stx.Period),
+		stx.MaxRetries, ms(stx.RetryDelay), clientToken,
+	).Scan)
+	if pg.IsUniqueViolation(err) {
+		return nil, errors.WithDetail(ErrDuplicateAlias, "a scheduled transaction with the provided alias already exists")
+	} else if err == stdsql.ErrNoRows && clientToken != nil {
+		// There is already a scheduled transaction with
+		// the provided client token; return it.
+		q = `SELECT ` + scheduledTxCols + ` FROM scheduled_txs WHERE client_token = $1`
+		created, err = scanScheduledTx(s.DB.QueryRow(ctx, q, *clientToken).Scan)
+		return created, errors.Wrap(err, "retrieving existing scheduled tx")
+	}
+	return created, errors.Wrap(err, "saving scheduled tx")
+}
+
+// where returns a condition selecting the scheduled
+// transaction with the given id, or, if id is empty,
+// the given alias, and the value to compare.
+func where(id, alias string) (string, string) {
+	if id != "" {
+		return `id = $1`, id
+	}
+	return `alias = $1`, alias
+}
+
+func notFound(id, alias string) error {
+	if id == "" {
+		id = alias
+	}
+	return errors.WithDetailf(pg.ErrUserInputNotFound, "scheduled transaction id/alias=%s", id)
+}
+
+// Find returns the scheduled transaction with
+// the given id or, if id is empty, alias.
+func (s *Scheduler) Find(ctx context.Context, id, alias string) (*ScheduledTx, error) {
+	cond, val := where(id, alias)
+	q := `SELECT ` + scheduledTxCols + ` FROM scheduled_txs WHERE ` + cond
+	stx, err := scanScheduledTx(s.DB.QueryRow(ctx, q, val).Scan)
+	if err == stdsql.ErrNoRows {
+		return nil, notFound(id, alias)
+	}
+	return stx, errors.Wrap(err, "loading scheduled tx")
+}
+
+// List returns up to limit scheduled transactions, newest
+// first, created before the one with ID after, if it's not
+// empty. It also returns the after value for the next page.
+func (s *Scheduler) List(ctx context.Context, after string, limit int) ([]*ScheduledTx, string, error) {
+	q := `
+		SELECT ` + scheduledTxCols + ` FROM scheduled_txs
+		WHERE ($1 = '' OR id < $1)
+		ORDER BY id DESC LIMIT $2
+	`
+	rows, err := s.DB.Query(ctx, q, after, limit)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "listing scheduled txs")
+	}
+	defer rows.Close()
+
+	stxs := make([]*ScheduledTx, 0, limit)
+	for rows.Next() {
+		stx, err := scanScheduledTx(rows.Scan)
+		if err != nil {
+			return nil, "", errors.Wrap(err, "scanning scheduled tx")
+		}
+		after = stx.ID
+		stxs = append(stxs, stx)
+	}
+	return stxs, after, errors.Wrap(rows.Err())
+}
+
+// Update replaces the actions and schedule of the scheduled
+// transaction with stx's ID or, if that's empty, alias, and
+// resets its count of failures. If reschedule is true, its
+// start time is replaced too, and its next run is moved to
+// the new start time; otherwise both are kept.
+func (s *Scheduler) Update(ctx context.Context, stx *ScheduledTx, reschedule bool) (*ScheduledTx, error) {
+	var alias string
+	if stx.Alias != nil {
+		alias = *stx.Alias
+	}
+	actions, err := json.Marshal(stx.Actions)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	cond, val := where(stx.ID, alias)
+	q := `
+		UPDATE scheduled_txs SET
+			actions = $2, ttl = $3, period = $5,
+			start_time = CASE WHEN $8 THEN $4 ELSE start_time END,
+			next_run = CASE WHEN $8 THEN $4 ELSE next_run END,
+			max_retries = $6, retry_delay = $7, failures = 0
+		WHERE ` + cond + `
+		RETURNING ` + scheduledTxCols
+	updated, err := scanScheduledTx(s.DB.QueryRow(
+		ctx, q, val, actions, ms(stx.TTL), stx.StartTime, ms(stx.Period),
+		stx.MaxRetries, ms(stx.RetryDelay), reschedule,
+	).Scan)
+	if err == stdsql.ErrNoRows {
+		return nil, notFound(stx.ID, alias)
+	}
+	return updated, errors.Wrap(err, "updating scheduled tx")
+}
+
+// Delete deletes the scheduled transaction with the
+// given id or, if id is empty, alias, and its runs.
+func (s *Scheduler) Delete(ctx context.Context, id, alias string) error {
+	cond, val := where(id, alias)
+	res, err := s.DB.Exec(ctx, `DELETE FROM scheduled_txs WHERE `+cond, val)
+	if err != nil {
+		return errors.Wrap(err, "deleting scheduled tx")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if n == 0 {
+		return notFound(id, alias)
+	}
+	return nil
+}
+
+// Runs returns up to limit runs of the scheduled transaction
+// with the given ID, newest first, made before the run with
+// ID after, if it's not empty. It also returns the after
+// value for the next page.
+func (s *Scheduler) Runs(ctx context.Context, scheduledTxID, after string, limit int) ([]*Run, string, error) {
+	const q = `
+		SELECT id, run_at, attempt, tx_id, error FROM scheduled_tx_runs
+		WHERE scheduled_tx_id = $1 AND ($2 = '' OR id < $2)
+		ORDER BY id DESC LIMIT $3
+	`
+	runs := make([]*Run, 0, limit)
+	err := pg.ForQueryRows(ctx, s.DB, q, scheduledTxID, after, limit,
+		func(id string, runAt time.Time, attempt int, txID, runErr stdsql.NullString) {
+			runs = append(runs, &Run{
+				ID:      id,
+				RunAt:   runAt,
+				Attempt: attempt,
+				TxID:    txID.String,
+				Error:   runErr.String,
+			})
+			after = id
+		})
+	if err != nil {
+		return nil, "", errors.Wrap(err, "listing scheduled tx runs")
+	}
+	return runs, after, nil
+}
+
+// Run runs the scheduled transactions that are due every
+// period, using exec to build and submit their transactions.
+// It's run by the leader, and blocks until the context is
+// canceled.
+func (s *Scheduler) Run(ctx context.Context, exec Executor, period time.Duration) {
+	ticks := time.Tick(period)
+	for {
+		err := s.runDue(ctx, exec)
+		if err != nil {
+			log.Error(ctx, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Messagef(ctx, "Deposed, Scheduler exiting")
+			return
+		case <-ticks:
+		}
+	}
+}
+
+func (s *Scheduler) runDue(ctx context.Context, exec Executor) error {
+	q := `
+		SELECT ` + scheduledTxCols + ` FROM scheduled_txs
+		WHERE next_run <= now() ORDER BY next_run
+	`
+	rows, err := s.DB.Query(ctx, q)
+	if err != nil {
+		return errors.Wrap(err, "loading due scheduled txs")
+	}
+	defer rows.Close()
+
+	var due []*ScheduledTx
+	for rows.Next() {
+		stx, err := scanScheduledTx(rows.Scan)
+		if err != nil {
+			return errors.Wrap(err, "scanning scheduled tx")
+		}
+		due = append(due, stx)
+	}
+	err = rows.Err()
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	rows.Close()
+
+	for _, stx := range due {
+		if ctx.Err() != nil {
+			return nil
+		}
+		err = s.runOne(ctx, exec, stx)
+		if err != nil {
+			log.Error(ctx, err, "running scheduled tx ", stx.ID)
+		}
+	}
+	return nil
+}
+
+// runOne makes one attempt to run stx, and records it.
+func (s *Scheduler) runOne(ctx context.Context, exec Executor, stx *ScheduledTx) error {
+	now := time.Now()
+	run := &Run{Attempt: stx.Failures + 1}
+	tpl, err := exec.Build(ctx, stx.Actions, stx.TTL.Duration)
+	if err != nil {
+		return s.fail(ctx, stx, run, now, err)
+	}
+	run.TxID = tpl.Transaction.Hash().String()
+
+	// Record the run before submitting its transaction. If this
+	// process loses leadership in between, the run is lost, but
+	// it's never submitted twice.
+	ok, err := s.record(ctx, stx, run, nextRun(stx, now), 0)
+	if err != nil || !ok {
+		return err
+	}
+
+	err = exec.Submit(ctx, tpl)
+	if txstatus.Final(err) {
+		return s.fail(ctx, stx, run, now, err)
+	} else if err != nil {
+		// The transaction is saved and resubmitted until it's
+		// confirmed or fails; retrying the run could pay twice.
+		log.Error(ctx, err, "submitting scheduled tx ", stx.ID)
+	}
+	return nil
+}
+
+// fail records that run failed with err, and schedules
+// a retry, or, if there are no retries left, the next run.
+func (s *Scheduler) fail(ctx context.Context, stx *ScheduledTx, run *Run, now time.Time, err error) error {
+	run.Error = err.Error()
+	if detail := errors.Detail(err); detail != "" {
+		run.Error = detail
+	}
+	if run.Attempt <= stx.MaxRetries {
+		retry := now.Add(stx.RetryDelay.Duration)
+		_, err = s.record(ctx, stx, run, &retry, run.Attempt)
+	} else {
+		_, err = s.record(ctx, stx, run, nextRun(stx, now), 0)
+	}
+	return err
+}
+
+// record saves run, and moves stx's next run to next, with
+// the given count of failures. If stx was updated or deleted
+// since it was loaded, record saves nothing and returns false.
+func (s *Scheduler) record(ctx context.Context, stx *ScheduledTx, run *Run, next *time.Time, failures int) (bool, error) {
+	const (
+		updateQ = `
+			UPDATE scheduled_txs SET next_run = $2, failures = $3
+			WHERE id = $1 AND next_run IS NOT DISTINCT FROM $4::timestamptz AND failures = $5
+			RETURNING next_run
+		`
+		insertRunQ = `
+			INSERT INTO scheduled_tx_runs (scheduled_tx_id, attempt, tx_id, error)
+			VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''))
+			RETURNING id, run_at
+		`
+		updateRunQ = `UPDATE scheduled_tx_runs SET error = $2 WHERE id = $1`
+	)
+
+	dbtx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "begin transaction")
+	}
+	defer dbtx.Rollback(ctx)
+
+	var nextRun *time.Time
+	err = dbtx.QueryRow(ctx, updateQ, stx.ID, next, failures, stx.NextRun, stx.Failures).Scan(&nextRun)
+	if err == stdsql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrap(err, "updating scheduled tx")
+	}
+
+	if run.ID == "" {
+		err = dbtx.QueryRow(ctx, insertRunQ, stx.ID, run.Attempt, run.TxID, run.Error).Scan(&run.ID, &run.RunAt)
+	} else {
+		_, err = dbtx.Exec(ctx, updateRunQ, run.ID, run.Error)
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "saving scheduled tx run")
+	}
+
+	err = dbtx.Commit(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "commit transaction")
+	}
+	stx.NextRun = nextRun
+	stx.Failures = failures
+	return true, nil
+}
+
+// nextRun returns the first time after t in stx's
+// schedule, or nil if stx doesn't repeat.
+func nextRun(stx *ScheduledTx, t time.Time) *time.Time {
+	period := stx.Period.Duration
+	if period == 0 {
+		return nil
+	}
+	next := stx.StartTime
+	if t.Before(next) {
+		return &next
+	}
+	next = next.Add((t.Sub(next)/period + 1) * period)
+	return &next
+}
@@ -0,0 +1,206 @@
+package schedule
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"chain/core/txbuilder"
+	"chain/database/pg"
+	"chain/database/pg/pgtest"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/testutil"
+)
+
+// testExecutor builds an empty transaction, and
+// fails to submit it while fail is true.
+type testExecutor struct {
+	fail      bool
+	submitted []*txbuilder.Template
+}
+
+func (e *testExecutor) Build(ctx context.Context, actions []map[string]interface{}, ttl time.Duration) (*txbuilder.Template, error) {
+	return &txbuilder.Template{Transaction: &bc.TxData{Version: 1, ReferenceData: []byte("scheduled")}}, nil
+}
+
+func (e *testExecutor) Submit(ctx context.Context, tpl *txbuilder.Template) error {
+	if e.fail {
+		return errors.WithDetail(txbuilder.ErrRejected, "bad signature")
+	}
+	e.submitted = append(e.submitted, tpl)
+	return nil
+}
+
+func TestRunSchedule(t *testing.T) {
+	var (
+		_, db = pgtest.NewDB(t, pgtest.SchemaPath)
+		ctx   = context.Background()
+		s     = &Scheduler{DB: db}
+		exec  = &testExecutor{fail: true}
+		token = "sweep-token"
+		start = time.Now().Add(-90 * time.Minute)
+	)
+
+	stx, err := s.Create(ctx, &ScheduledTx{
+		Actions:    []map[string]interface{}{{"type": "set_transaction_reference_data"}},
+		TTL:        chainjson.Duration{Duration: time.Minute},
+		StartTime:  start,
+		Period:     chainjson.Duration{Duration: time.Hour},
+		MaxRetries: 1,
+	}, &token)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	again, err := s.Create(ctx, &ScheduledTx{StartTime: start}, &token)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if again.ID != stx.ID {
+		t.Errorf("created with same client token: got id %s want %s", again.ID, stx.ID)
+	}
+
+	// The first attempt fails, and is retried
+	// immediately, since the retry delay is zero.
+	err = s.runDue(ctx, exec)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	stx, err = s.Find(ctx, stx.ID, "")
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if stx.Failures != 1 || stx.NextRun == nil || stx.NextRun.After(time.Now()) {
+		t.Errorf("after failed run: got failures %d next run %v, want 1 failure and a retry now", stx.Failures, stx.NextRun)
+	}
+
+	exec.fail = false
+	err = s.runDue(ctx, exec)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(exec.submitted) != 1 {
+		t.Fatalf("got %d submitted txs, want 1", len(exec.submitted))
+	}
+	stx, err = s.Find(ctx, stx.ID, "")
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	wantNext := start.Add(2 * time.Hour)
+	if stx.Failures != 0 || stx.NextRun == nil || !stx.NextRun.Equal(wantNext.Truncate(time.Microsecond)) {
+		t.Errorf("after run: got failures %d next run %v, want 0 failures and next run %v", stx.Failures, stx.NextRun, wantNext)
+	}
+
+	// It isn't due again for another half hour.
+	err = s.runDue(ctx, exec)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(exec.submitted) != 1 {
+		t.Errorf("got %d submitted txs, want 1", len(exec.submitted))
+	}
+
+	runs, _, err := s.Runs(ctx, stx.ID, "", 10)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	txID := exec.submitted[0].Transaction.Hash().String()
+	if len(runs) != 2 {
+		t.Fatalf("got %d runs, want 2", len(runs))
+	}
+	if runs[0].Attempt != 2 || runs[0].TxID != txID || runs[0].Error != "" {
+		t.Errorf("got latest run %+v, want attempt 2 submitting %s", *runs[0], txID)
+	}
+	if runs[1].Attempt != 1 || runs[1].Error != "bad signature" {
+		t.Errorf("got first run %+v, want attempt 1 failing with bad signature", *runs[1])
+	}
+
+	err = s.Delete(ctx, stx.ID, "")
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	_, err = s.Find(ctx, stx.ID, "")
+	if errors.Root(err) != pg.ErrUserInputNotFound {
+		t.Errorf("got error %v after delete, want %s", err, pg.ErrUserInputNotFound)
+	}
+}
+
+func TestUpdateSchedule(t *testing.T) {
+	var (
+		_, db = pgtest.NewDB(t, pgtest.SchemaPath)
+		ctx   = context.Background()
+		s     = &Scheduler{DB: db}
+		start = time.Now().Add(time.Hour).Truncate(time.Microsecond)
+	)
+
+	stx, err := s.Create(ctx, &ScheduledTx{
+		Actions:   []map[string]interface{}{{"type": "set_transaction_reference_data"}},
+		TTL:       chainjson.Duration{Duration: time.Minute},
+		StartTime: start,
+		Period:    chainjson.Duration{Duration: time.Hour},
+	}, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	// Updating only the actions leaves the schedule as it was.
+	stx, err = s.Update(ctx, &ScheduledTx{
+		ID:        stx.ID,
+		Actions:   []map[string]interface{}{{"type": "set_transaction_reference_data", "reference_data": "x"}},
+		TTL:       chainjson.Duration{Duration: time.Minute},
+		StartTime: time.Now(),
+		Period:    chainjson.Duration{Duration: time.Hour},
+	}, false)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(stx.Actions) != 1 || stx.Actions[0]["reference_data"] != "x" {
+		t.Errorf("got actions %v, want the new actions", stx.Actions)
+	}
+	if !stx.StartTime.Equal(start) || stx.NextRun == nil || !stx.NextRun.Equal(start) {
+		t.Errorf("got start time %v next run %v, want both %v", stx.StartTime, stx.NextRun, start)
+	}
+
+	// A new start time moves the next run.
+	newStart := start.Add(time.Hour)
+	stx, err = s.Update(ctx, &ScheduledTx{
+		ID:        stx.ID,
+		Actions:   stx.Actions,
+		TTL:       chainjson.Duration{Duration: time.Minute},
+		StartTime: newStart,
+		Period:    chainjson.Duration{Duration: time.Hour},
+	}, true)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if !stx.StartTime.Equal(newStart) || stx.NextRun == nil || !stx.NextRun.Equal(newStart) {
+		t.Errorf("got start time %v next run %v, want both %v", stx.StartTime, stx.NextRun, newStart)
+	}
+}
+
+func TestNextRun(t *testing.T) {
+	start := time.Date(2016, 12, 1, 9, 0, 0, 0, time.UTC)
+	cases := []struct {
+		period time.Duration
+		t      time.Time
+		want   *time.Time
+	}{
+		{0, start, nil},
+		{time.Hour, start.Add(-time.Minute), &start},
+		{time.Hour, start, timePtr(start.Add(time.Hour))},
+		{time.Hour, start.Add(150 * time.Minute), timePtr(start.Add(3 * time.Hour))},
+		{24 * time.Hour, start.Add(72 * time.Hour), timePtr(start.Add(96 * time.Hour))},
+	}
+	for _, c := range cases {
+		stx := &ScheduledTx{StartTime: start, Period: chainjson.Duration{Duration: c.period}}
+		got := nextRun(stx, c.t)
+		if (got == nil) != (c.want == nil) || got != nil && !got.Equal(*c.want) {
+			t.Errorf("nextRun(period %s, %s) = %v want %v", c.period, c.t, got, c.want)
+		}
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
@@ -0,0 +1,207 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"chain/core/schedule"
+	"chain/core/txbuilder"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/net/http/httpjson"
+)
+
+// defaultRetryDelay is how long a failed scheduled
+// run waits to be retried if the request doesn't say.
+const defaultRetryDelay = time.Minute
+
+type scheduledTxRequest struct {
+	ID      string                   `json:"id"`
+	Alias   string                   `json:"alias"`
+	Actions []map[string]interface{} `json:"actions"`
+	TTL     chainjson.Duration       `json:"ttl"`
+
+	// StartTime is when the transaction first runs; by default,
+	// now. Period is how often it runs after that; if it's zero,
+	// the transaction runs once.
+	StartTime *time.Time         `json:"start_time"`
+	Period    chainjson.Duration `json:"period"`
+
+	MaxRetries int                `json:"max_retries"`
+	RetryDelay chainjson.Duration `json:"retry_delay"`
+
+	// ClientToken is the application's unique token for the
+	// scheduled transaction. Duplicate create requests with
+	// the same client_token only create one.
+	ClientToken *string `json:"client_token"`
+}
+
+// scheduledTx validates req and returns the
+// scheduled transaction it describes.
+func (h *Handler) scheduledTx(req scheduledTxRequest) (*schedule.ScheduledTx, error) {
+	if len(req.Actions) == 0 {
+		return nil, txbuilder.MissingFieldsError("actions")
+	}
+	if req.MaxRetries < 0 {
+		return nil, errors.WithDetail(httpjson.ErrBadRequest, "max_retries cannot be negative")
+	}
+	// Catch bad actions now, rather than on the first run.
+	_, err := h.decodeActions(req.Actions)
+	if err != nil {
+		return nil, err
+	}
+
+	stx := &schedule.ScheduledTx{
+		ID:         req.ID,
+		Actions:    req.Actions,
+		TTL:        req.TTL,
+		StartTime:  time.Now(),
+		Period:     req.Period,
+		MaxRetries: req.MaxRetries,
+		RetryDelay: req.RetryDelay,
+	}
+	if req.Alias != "" {
+		stx.Alias = &req.Alias
+	}
+	if stx.TTL.Duration == 0 {
+		stx.TTL.Duration = defaultTxTTL
+	}
+	if req.StartTime != nil {
+		stx.StartTime = *req.StartTime
+	}
+	if stx.RetryDelay.Duration == 0 {
+		stx.RetryDelay.Duration = defaultRetryDelay
+	}
+	return stx, nil
+}
+
+// POST /create-scheduled-transaction
+//
+// create-scheduled-transaction saves build actions, like those of
+// /build-transaction, to be built into a transaction, signed with
+// this Core's MockHSM and submitted at start_time, and every period
+// after that. The leader runs them, so runs aren't missed when
+// leadership moves. A run that fails before its transaction is
+// accepted is retried after retry_delay, up to max_retries times.
+func (h *Handler) createScheduledTx(ctx context.Context, req scheduledTxRequest) (*schedule.ScheduledTx, error) {
+	stx, err := h.scheduledTx(req)
+	if err != nil {
+		return nil, err
+	}
+	return h.Schedule.Create(ctx, stx, req.ClientToken)
+}
+
+// POST /get-scheduled-transaction
+func (h *Handler) getScheduledTx(ctx context.Context, req struct {
+	ID    string `json:"id"`
+	Alias string `json:"alias"`
+}) (*schedule.ScheduledTx, error) {
+	if req.ID == "" && req.Alias == "" {
+		return nil, txbuilder.MissingFieldsError("id")
+	}
+	return h.Schedule.Find(ctx, req.ID, req.Alias)
+}
+
+// POST /update-scheduled-transaction
+//
+// update-scheduled-transaction replaces the actions and schedule
+// of the scheduled transaction with the given id or alias. If
+// start_time is given, its next run is moved to it; otherwise,
+// its start time and next run are unchanged.
+func (h *Handler) updateScheduledTx(ctx context.Context, req scheduledTxRequest) (*schedule.ScheduledTx, error) {
+	if req.ID == "" && req.Alias == "" {
+		return nil, txbuilder.MissingFieldsError("id")
+	}
+	stx, err := h.scheduledTx(req)
+	if err != nil {
+		return nil, err
+	}
+	return h.Schedule.Update(ctx, stx, req.StartTime != nil)
+}
+
+// POST /delete-scheduled-transaction
+func (h *Handler) deleteScheduledTx(ctx context.Context, req struct {
+	ID    string `json:"id"`
+	Alias string `json:"alias"`
+}) error {
+	if req.ID == "" && req.Alias == "" {
+		return txbuilder.MissingFieldsError("id")
+	}
+	return h.Schedule.Delete(ctx, req.ID, req.Alias)
+}
+
+// POST /list-scheduled-transactions
+func (h *Handler) listScheduledTxs(ctx context.Context, in requestQuery) (page, error) {
+	limit := defGenericPageSize
+
+	stxs, after, err := h.Schedule.List(ctx, in.After, limit)
+	if err != nil {
+		return page{}, err
+	}
+
+	out := in
+	out.After = after
+	return page{
+		Items:    httpjson.Array(stxs),
+		LastPage: len(stxs) < limit,
+		Next:     out,
+	}, nil
+}
+
+// POST /list-scheduled-transaction-runs
+//
+// list-scheduled-transaction-runs lists the runs of a scheduled
+// transaction, newest first, with the ID of the transaction each
+// submitted or the reason it failed.
+func (h *Handler) listScheduledTxRuns(ctx context.Context, in requestQuery) (page, error) {
+	if in.ID == "" {
+		return page{}, txbuilder.MissingFieldsError("id")
+	}
+	limit := defGenericPageSize
+
+	runs, after, err := h.Schedule.Runs(ctx, in.ID, in.After, limit)
+	if err != nil {
+		return page{}, err
+	}
+
+	out := in
+	out.After = after
+	return page{
+		Items:    httpjson.Array(runs),
+		LastPage: len(runs) < limit,
+		Next:     out,
+	}, nil
+}
+
+// RunSchedule runs due scheduled transactions every period.
+// It's run by the leader, and blocks until the context is
+// canceled.
+func (h *Handler) RunSchedule(ctx context.Context, period time.Duration) {
+	h.Schedule.Run(ctx, scheduleExecutor{h}, period)
+}
+
+// scheduleExecutor builds scheduled transactions like
+// /build-transaction, signs them with the MockHSM, and
+// submits them like /submit-transaction.
+type scheduleExecutor struct {
+	h *Handler
+}
+
+func (e scheduleExecutor) Build(ctx context.Context, actions []map[string]interface{}, ttl time.Duration) (*txbuilder.Template, error) {
+	tpl, err := e.h.buildSingle(ctx, &buildRequest{
+		Actions: actions,
+		TTL:     chainjson.Duration{Duration: ttl},
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = e.h.signLocal(ctx, tpl)
+	if err != nil {
+		return nil, err
+	}
+	return tpl, nil
+}
+
+func (e scheduleExecutor) Submit(ctx context.Context, tpl *txbuilder.Template) error {
+	return e.h.finalizeTxWait(ctx, tpl, "none")
+}
@@ -182,6 +182,19 @@ CREATE TABLE account_control_programs (
 );
 
 
+--
+-- Name: account_spends; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE account_spends (
+    reservation_id bigint NOT NULL,
+    account_id text NOT NULL,
+    asset_id text NOT NULL,
+    amount bigint NOT NULL,
+    spent_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
 --
 -- Name: account_utxos; Type: TABLE; Schema: public; Owner: -
 --
@@ -205,7 +218,10 @@ CREATE TABLE account_utxos (
 CREATE TABLE accounts (
     account_id text NOT NULL,
     tags jsonb,
-    alias text
+    alias text,
+    version bigint DEFAULT 1 NOT NULL,
+    archived boolean DEFAULT false NOT NULL,
+    spend_policy jsonb
 );
 
 
@@ -281,7 +297,9 @@ CREATE TABLE assets (
     signer_id text,
     definition jsonb,
     alias text,
-    first_block_height bigint
+    first_block_height bigint,
+    version bigint DEFAULT 1 NOT NULL,
+    archived boolean DEFAULT false NOT NULL
 );
 
 
@@ -347,6 +365,9 @@ CREATE TABLE config (
     generator_access_token text DEFAULT ''::text NOT NULL,
     max_issuance_window_ms bigint,
     id text NOT NULL,
+    block_period_ms bigint DEFAULT 1000 NOT NULL,
+    max_block_txs integer DEFAULT 0 NOT NULL,
+    max_block_bytes integer DEFAULT 0 NOT NULL,
     CONSTRAINT config_singleton CHECK (singleton)
 );
 
@@ -371,6 +392,9 @@ CREATE TABLE leader (
     leader_key text NOT NULL,
     expiry timestamp with time zone DEFAULT '1970-01-01 00:00:00-08'::timestamp with time zone NOT NULL,
     address text NOT NULL,
+    epoch bigint DEFAULT 0 NOT NULL,
+    handover_address text,
+    handover_expiry timestamp with time zone,
     CONSTRAINT leader_singleton CHECK (singleton)
 );
 
@@ -411,6 +435,22 @@ CREATE TABLE mockhsm (
 );
 
 
+--
+-- Name: policy_approvals; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE policy_approvals (
+    id text DEFAULT next_chain_id('pap'::text) NOT NULL,
+    account_id text NOT NULL,
+    policy jsonb,
+    requested_by text NOT NULL,
+    requested_at timestamp with time zone DEFAULT now() NOT NULL,
+    approved_by text,
+    expires_at timestamp with time zone NOT NULL,
+    used boolean DEFAULT false NOT NULL
+);
+
+
 --
 -- Name: pool_tx_sort_id_seq; Type: SEQUENCE; Schema: public; Owner: -
 --
@@ -433,6 +473,16 @@ CREATE TABLE query_blocks (
 );
 
 
+--
+-- Name: reference_data_schemas; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE reference_data_schemas (
+    asset_id text NOT NULL,
+    schema jsonb NOT NULL
+);
+
+
 --
 -- Name: reservation_seq; Type: SEQUENCE; Schema: public; Owner: -
 --
@@ -445,6 +495,64 @@ CREATE SEQUENCE reservation_seq
     CACHE 1;
 
 
+--
+-- Name: reservations; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE reservations (
+    reservation_id bigint DEFAULT nextval('reservation_seq'::regclass) NOT NULL,
+    account_id text NOT NULL,
+    asset_id text NOT NULL,
+    change bigint NOT NULL,
+    expiry timestamp with time zone NOT NULL,
+    client_token text
+);
+
+
+--
+-- Name: reserved_utxos; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE reserved_utxos (
+    tx_hash text NOT NULL,
+    index integer NOT NULL,
+    reservation_id bigint NOT NULL
+);
+
+
+--
+-- Name: scheduled_tx_runs; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE scheduled_tx_runs (
+    id text DEFAULT next_chain_id('run'::text) NOT NULL,
+    scheduled_tx_id text NOT NULL,
+    run_at timestamp with time zone DEFAULT now() NOT NULL,
+    attempt integer NOT NULL,
+    tx_id text,
+    error text
+);
+
+
+--
+-- Name: scheduled_txs; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE scheduled_txs (
+    id text DEFAULT next_chain_id('sch'::text) NOT NULL,
+    alias text,
+    actions jsonb NOT NULL,
+    ttl bigint NOT NULL,
+    start_time timestamp with time zone NOT NULL,
+    period bigint NOT NULL,
+    next_run timestamp with time zone,
+    max_retries integer NOT NULL,
+    retry_delay bigint NOT NULL,
+    failures integer DEFAULT 0 NOT NULL,
+    client_token text
+);
+
+
 --
 -- Name: signed_blocks; Type: TABLE; Schema: public; Owner: -
 --
@@ -494,7 +602,26 @@ ALTER SEQUENCE signers_key_index_seq OWNED BY signers.key_index;
 
 CREATE TABLE snapshots (
     height bigint NOT NULL,
-    data bytea NOT NULL
+    data bytea NOT NULL,
+    base_height bigint
+);
+
+
+--
+-- Name: spend_approvals; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE spend_approvals (
+    id text DEFAULT next_chain_id('apr'::text) NOT NULL,
+    account_id text NOT NULL,
+    asset_id text NOT NULL,
+    amount bigint NOT NULL,
+    requested_by text NOT NULL,
+    approved_by text,
+    expires_at timestamp with time zone NOT NULL,
+    used boolean DEFAULT false NOT NULL,
+    used_by bigint,
+    requested_at timestamp with time zone DEFAULT now() NOT NULL
 );
 
 
@@ -505,7 +632,10 @@ CREATE TABLE snapshots (
 CREATE TABLE submitted_txs (
     tx_hash bytea NOT NULL,
     height bigint NOT NULL,
-    submitted_at timestamp without time zone DEFAULT now() NOT NULL
+    submitted_at timestamp without time zone DEFAULT now() NOT NULL,
+    confirmed_in bigint,
+    failure text,
+    data bytea
 );
 
 
@@ -545,6 +675,14 @@ ALTER TABLE ONLY account_control_programs
     ADD CONSTRAINT account_control_programs_pkey PRIMARY KEY (control_program);
 
 
+--
+-- Name: account_spends_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY account_spends
+    ADD CONSTRAINT account_spends_pkey PRIMARY KEY (reservation_id);
+
+
 --
 -- Name: account_tags_pkey; Type: CONSTRAINT; Schema: public; Owner: -
 --
@@ -705,6 +843,14 @@ ALTER TABLE ONLY mockhsm
     ADD CONSTRAINT mockhsm_pkey PRIMARY KEY (pub);
 
 
+--
+-- Name: policy_approvals_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY policy_approvals
+    ADD CONSTRAINT policy_approvals_pkey PRIMARY KEY (id);
+
+
 --
 -- Name: query_blocks_pkey; Type: CONSTRAINT; Schema: public; Owner: -
 --
@@ -713,6 +859,70 @@ ALTER TABLE ONLY query_blocks
     ADD CONSTRAINT query_blocks_pkey PRIMARY KEY (height);
 
 
+--
+-- Name: reference_data_schemas_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY reference_data_schemas
+    ADD CONSTRAINT reference_data_schemas_pkey PRIMARY KEY (asset_id);
+
+
+--
+-- Name: reservations_client_token_key; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY reservations
+    ADD CONSTRAINT reservations_client_token_key UNIQUE (client_token);
+
+
+--
+-- Name: reservations_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY reservations
+    ADD CONSTRAINT reservations_pkey PRIMARY KEY (reservation_id);
+
+
+--
+-- Name: reserved_utxos_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY reserved_utxos
+    ADD CONSTRAINT reserved_utxos_pkey PRIMARY KEY (tx_hash, index);
+
+
+--
+-- Name: scheduled_tx_runs_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY scheduled_tx_runs
+    ADD CONSTRAINT scheduled_tx_runs_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: scheduled_txs_alias_key; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY scheduled_txs
+    ADD CONSTRAINT scheduled_txs_alias_key UNIQUE (alias);
+
+
+--
+-- Name: scheduled_txs_client_token_key; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY scheduled_txs
+    ADD CONSTRAINT scheduled_txs_client_token_key UNIQUE (client_token);
+
+
+--
+-- Name: scheduled_txs_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY scheduled_txs
+    ADD CONSTRAINT scheduled_txs_pkey PRIMARY KEY (id);
+
+
 --
 -- Name: signers_client_token_key; Type: CONSTRAINT; Schema: public; Owner: -
 --
@@ -737,6 +947,14 @@ ALTER TABLE ONLY mockhsm
     ADD CONSTRAINT sort_id_index UNIQUE (sort_id);
 
 
+--
+-- Name: spend_approvals_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY spend_approvals
+    ADD CONSTRAINT spend_approvals_pkey PRIMARY KEY (id);
+
+
 --
 -- Name: state_trees_pkey; Type: CONSTRAINT; Schema: public; Owner: -
 --
@@ -777,6 +995,13 @@ ALTER TABLE ONLY txfeeds
     ADD CONSTRAINT txfeeds_pkey PRIMARY KEY (id);
 
 
+--
+-- Name: account_spends_account_id_asset_id_spent_at_idx; Type: INDEX; Schema: public; Owner: -
+--
+
+CREATE INDEX account_spends_account_id_asset_id_spent_at_idx ON account_spends USING btree (account_id, asset_id, spent_at);
+
+
 --
 -- Name: account_utxos_asset_id_account_id_confirmed_in_idx; Type: INDEX; Schema: public; Owner: -
 --
@@ -847,6 +1072,34 @@ CREATE INDEX assets_sort_id ON assets USING btree (sort_id);
 CREATE INDEX query_blocks_timestamp_idx ON query_blocks USING btree ("timestamp");
 
 
+--
+-- Name: reservations_expiry_idx; Type: INDEX; Schema: public; Owner: -
+--
+
+CREATE INDEX reservations_expiry_idx ON reservations USING btree (expiry);
+
+
+--
+-- Name: reserved_utxos_reservation_id_idx; Type: INDEX; Schema: public; Owner: -
+--
+
+CREATE INDEX reserved_utxos_reservation_id_idx ON reserved_utxos USING btree (reservation_id);
+
+
+--
+-- Name: scheduled_tx_runs_scheduled_tx_id_run_at_idx; Type: INDEX; Schema: public; Owner: -
+--
+
+CREATE INDEX scheduled_tx_runs_scheduled_tx_id_run_at_idx ON scheduled_tx_runs USING btree (scheduled_tx_id, run_at);
+
+
+--
+-- Name: scheduled_txs_next_run_idx; Type: INDEX; Schema: public; Owner: -
+--
+
+CREATE INDEX scheduled_txs_next_run_idx ON scheduled_txs USING btree (next_run);
+
+
 --
 -- Name: signed_blocks_block_height_idx; Type: INDEX; Schema: public; Owner: -
 --
@@ -861,6 +1114,22 @@ CREATE UNIQUE INDEX signed_blocks_block_height_idx ON signed_blocks USING btree
 CREATE INDEX signers_type_id_idx ON signers USING btree (type, id);
 
 
+--
+-- Name: reserved_utxos_reservation_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY reserved_utxos
+    ADD CONSTRAINT reserved_utxos_reservation_id_fkey FOREIGN KEY (reservation_id) REFERENCES reservations(reservation_id) ON DELETE CASCADE;
+
+
+--
+-- Name: scheduled_tx_runs_scheduled_tx_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY scheduled_tx_runs
+    ADD CONSTRAINT scheduled_tx_runs_scheduled_tx_id_fkey FOREIGN KEY (scheduled_tx_id) REFERENCES scheduled_txs(id) ON DELETE CASCADE;
+
+
 --
 -- PostgreSQL database dump complete
 --
@@ -876,3 +1145,16 @@ insert into migrations (filename, hash) values ('2016-11-18.0.account.confirmed-
 insert into migrations (filename, hash) values ('2016-11-22.0.account.utxos-indexes.sql', 'f3ea43f592cb06a36b040f0b0b9626ee9174d26d36abef44e68114d0c0aace98');
 insert into migrations (filename, hash) values ('2016-11-23.0.query.jsonb-path-ops.sql', 'adb15b9a6b7b223a17dbfd5f669e44c500b343568a563f87e1ae67ba0f938d55');
 insert into migrations (filename, hash) values ('2016-11-28.0.core.submitted-txs-hash.sql', 'cabbd7fd79a2b672b2d3c854783bde3b8245fe666c50261c3335a0c0501ff2ea');
+insert into migrations (filename, hash) values ('2016-11-29.0.core.config-block-params.sql', '70cea354d2995b68cd7cd5b553fd749baa661a096f9794d225869bb9de9925b6');
+insert into migrations (filename, hash) values ('2016-11-30.0.txdb.snapshot-deltas.sql', '786ca47c0690991bb6f6277def5684d67b916aebd8690f0689527bb733ff1916');
+insert into migrations (filename, hash) values ('2016-12-01.0.core.leader-epoch.sql', 'd9ae99d36b6f9c57fe800b6d36d71216ba010d50503de212b394360a95e0c213');
+insert into migrations (filename, hash) values ('2016-12-02.0.account.reservations.sql', '45ef94143ab35b5c19e5be1b8987cb805c334269d2af064556fb9cdb7c9462ea');
+insert into migrations (filename, hash) values ('2016-12-05.0.core.tag-versions.sql', 'b90c2604b597fc5947f7bb297dbdb78705c3722054888c7a4d16976ac2874409');
+insert into migrations (filename, hash) values ('2016-12-06.0.core.archived.sql', 'ae64c4bb225b6186d9d6f55baa94155540b4353d17e89eaae620441695eade09');
+insert into migrations (filename, hash) values ('2016-12-07.0.core.refdata-schemas.sql', 'f5f4ab5aec2bb925c160048eda0ee2c32bc86d43fd558f63a027bd1fbb264b89');
+insert into migrations (filename, hash) values ('2016-12-08.0.account.spend-policy.sql', '55a3aa535098c64d630737f982e4741e237b832f0e8efc2da8f736806af874a1');
+insert into migrations (filename, hash) values ('2016-12-09.0.core.submitted-tx-status.sql', '54dc393fe86bcc8f6f4e8ddd6462b42c45c11cae24a1bc44d927722cc9c2552a');
+insert into migrations (filename, hash) values ('2016-12-10.0.core.submitted-tx-data.sql', '6fd68c3df713430878c7da2cd72ed3c723e808bc14d5b1c7089eb095d31fc818');
+insert into migrations (filename, hash) values ('2016-12-11.0.core.scheduled-txs.sql', 'c2b9a1c41eb83c16e092a7d394e931b5abfbbaa672d82a6a4507f49472df4f2c');
+insert into migrations (filename, hash) values ('2016-12-12.0.account.spend-approval-used-by.sql', '2fc5924acae72e579707a5a7db5a74fcbdaf5f957070e9ecdd4dfb286520c380');
+insert into migrations (filename, hash) values ('2016-12-13.0.account.policy-approvals.sql', '53d6b5f19ca91823ddc8c66a5d7351c6925360588d5d575d0d422243495d085f');
@@ -9,6 +9,7 @@ import (
 	"chain/core/fetch"
 	"chain/core/leader"
 	"chain/core/txbuilder"
+	"chain/core/txstatus"
 	"chain/database/pg"
 	chainjson "chain/encoding/json"
 	"chain/errors"
@@ -24,8 +25,40 @@ func (h *Handler) buildSingle(ctx context.Context, req *buildRequest) (*txbuilde
 	if err != nil {
 		return nil, err
 	}
-	actions := make([]txbuilder.Action, 0, len(req.Actions))
-	for i, act := range req.Actions {
+	actions, err := h.decodeActions(req.Actions)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := req.TTL.Duration
+	if ttl == 0 {
+		ttl = defaultTxTTL
+	}
+	maxTime := time.Now().Add(ttl)
+	var checkRefData txbuilder.RefDataCheck
+	if h.RefData != nil {
+		checkRefData = h.RefData.CheckTx
+	}
+	tpl, err := txbuilder.BuildChecked(ctx, req.Tx, actions, maxTime, checkRefData)
+	if errors.Root(err) == txbuilder.ErrAction {
+		err = errors.WithData(err, "actions", errInfoBodyList(errors.Data(err)["actions"].([]error)))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// ensure null is never returned for signing instructions
+	if tpl.SigningInstructions == nil {
+		tpl.SigningInstructions = []*txbuilder.SigningInstruction{}
+	}
+	return tpl, nil
+}
+
+// decodeActions decodes build request actions
+// using the decoder for each action's type.
+func (h *Handler) decodeActions(reqActions []map[string]interface{}) ([]txbuilder.Action, error) {
+	actions := make([]txbuilder.Action, 0, len(reqActions))
+	for i, act := range reqActions {
 		typ, ok := act["type"].(string)
 		if !ok {
 			return nil, errors.WithDetailf(errBadActionType, "no action type provided on action %d", i)
@@ -47,38 +80,11 @@ func (h *Handler) buildSingle(ctx context.Context, req *buildRequest) (*txbuilde
 		}
 		actions = append(actions, a)
 	}
-
-	ttl := req.TTL.Duration
-	if ttl == 0 {
-		ttl = defaultTxTTL
-	}
-	maxTime := time.Now().Add(ttl)
-	tpl, err := txbuilder.Build(ctx, req.Tx, actions, maxTime)
-	if errors.Root(err) == txbuilder.ErrAction {
-		err = errors.WithData(err, "actions", errInfoBodyList(errors.Data(err)["actions"].([]error)))
-	}
-	if err != nil {
-		return nil, err
-	}
-
-	// ensure null is never returned for signing instructions
-	if tpl.SigningInstructions == nil {
-		tpl.SigningInstructions = []*txbuilder.SigningInstruction{}
-	}
-	return tpl, nil
+	return actions, nil
 }
 
 // POST /build-transaction
 func (h *Handler) build(ctx context.Context, buildReqs []*buildRequest) (interface{}, error) {
-	// If we're not the leader, we don't have access to the current
-	// reservations. Forward the build call to the leader process.
-	// TODO(jackson): Distribute reservations across cored processes.
-	if !leader.IsLeading() {
-		var resp map[string]interface{}
-		err := h.forwardToLeader(ctx, "/build-transaction", buildReqs, &resp)
-		return resp, err
-	}
-
 	responses := make([]interface{}, len(buildReqs))
 	var wg sync.WaitGroup
 	wg.Add(len(responses))
@@ -146,8 +152,8 @@ func recordSubmittedTx(ctx context.Context, db pg.DB, txHash bc.Hash, currentHei
 }
 
 // CleanupSubmittedTxs will periodically delete records of submitted txs
-// older than a day. This function blocks and only exits when its context
-// is cancelled.
+// older than a day, unless they're still pending resubmission. This
+// function blocks and only exits when its context is cancelled.
 //
 // TODO(jackson): unexport this and start it in a goroutine in a core.New()
 // function?
@@ -160,7 +166,10 @@ func CleanupSubmittedTxs(ctx context.Context, db pg.DB) {
 			// the table and DROP-ing tables of expired rows. Partitioning doesn't
 			// play well with ON CONFLICT clauses though, so we would need to rework
 			// how we guarantee uniqueness.
-			const q = `DELETE FROM submitted_txs WHERE submitted_at < now() - interval '1 day'`
+			const q = `
+				DELETE FROM submitted_txs WHERE submitted_at < now() - interval '1 day'
+					AND (data IS NULL OR confirmed_in IS NOT NULL OR failure IS NOT NULL)
+			`
 			_, err := db.Exec(ctx, q)
 			if err != nil {
 				log.Error(ctx, err)
@@ -196,9 +205,22 @@ func (h *Handler) finalizeTxWait(ctx context.Context, txTemplate *txbuilder.Temp
 	if err != nil {
 		return errors.Wrap(err, "saving tx submitted height")
 	}
+	if h.TxStatus != nil {
+		// Save it, so it's resubmitted if it's lost
+		// before it's confirmed.
+		err = h.TxStatus.Track(ctx, tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	// A light client only fetches the transactions it knows
+	// it needs. Watch this one before it can be confirmed.
+	defer fetch.WatchTx(tx.Hash)()
 
 	err = txbuilder.FinalizeTx(ctx, h.Chain, h.Submitter, tx)
 	if err != nil {
+		h.recordTxFailure(ctx, tx.Hash, err)
 		return err
 	}
 	if waitUntil == "none" {
@@ -207,6 +229,7 @@ func (h *Handler) finalizeTxWait(ctx context.Context, txTemplate *txbuilder.Temp
 
 	height, err = h.waitForTxInBlock(ctx, tx, height)
 	if err != nil {
+		h.recordTxFailure(ctx, tx.Hash, err)
 		return err
 	}
 	if waitUntil == "confirmed" {
@@ -260,6 +283,18 @@ func (h *Handler) waitForTxInBlock(ctx context.Context, tx *bc.Tx, height uint64
 	}
 }
 
+// recordTxFailure records that the submitted tx failed,
+// if err means it can never be confirmed.
+func (h *Handler) recordTxFailure(ctx context.Context, hash bc.Hash, err error) {
+	if !txstatus.Final(err) || h.TxStatus == nil {
+		return
+	}
+	err = h.TxStatus.Fail(ctx, hash, err)
+	if err != nil {
+		log.Error(ctx, err)
+	}
+}
+
 type submitArg struct {
 	Transactions []txbuilder.Template
 	wait         chainjson.Duration
@@ -303,3 +338,36 @@ func (h *Handler) submit(ctx context.Context, x submitArg) (interface{}, error)
 	wg.Wait()
 	return responses, nil
 }
+
+// POST /get-transaction-status
+//
+// get-transaction-status reports the state of a transaction
+// submitted with /submit-transaction: pending, in_pool (waiting
+// in the generator's pool), confirmed (with its block_height), or
+// failed (with the error that keeps it from being confirmed). A
+// transaction submitted too long ago to be tracked is reported
+// confirmed if it's been indexed.
+func (h *Handler) getTxStatus(ctx context.Context, req struct {
+	ID bc.Hash `json:"id"`
+}) (interface{}, error) {
+	if req.ID == (bc.Hash{}) {
+		return nil, txbuilder.MissingFieldsError("id")
+	}
+	if !leader.IsLeading() {
+		var resp json.RawMessage
+		err := h.forwardToLeader(ctx, "/get-transaction-status", req, &resp)
+		return resp, err
+	}
+
+	status, err := h.TxStatus.Status(ctx, req.ID)
+	if errors.Root(err) == pg.ErrUserInputNotFound && h.IndexTxs {
+		height, ok, indexErr := h.Indexer.TxBlockHeight(ctx, req.ID)
+		if indexErr != nil {
+			return nil, indexErr
+		}
+		if ok {
+			return &txstatus.Status{ID: req.ID, Status: txstatus.Confirmed, BlockHeight: height}, nil
+		}
+	}
+	return status, err
+}
@@ -38,6 +38,30 @@ func (b *TemplateBuilder) AddOutput(o *bc.TxOutput) error {
 	return nil
 }
 
+// Inputs returns the inputs of the transaction being
+// built: those of the base transaction, if any, followed
+// by those added so far by the actions.
+func (b *TemplateBuilder) Inputs() []*bc.TxInput {
+	if b.base == nil {
+		return b.inputs
+	}
+	ins := make([]*bc.TxInput, 0, len(b.base.Inputs)+len(b.inputs))
+	ins = append(ins, b.base.Inputs...)
+	return append(ins, b.inputs...)
+}
+
+// Outputs returns the outputs of the transaction being
+// built: those of the base transaction, if any, followed
+// by those added so far by the actions.
+func (b *TemplateBuilder) Outputs() []*bc.TxOutput {
+	if b.base == nil {
+		return b.outputs
+	}
+	outs := make([]*bc.TxOutput, 0, len(b.base.Outputs)+len(b.outputs))
+	outs = append(outs, b.base.Outputs...)
+	return append(outs, b.outputs...)
+}
+
 func (b *TemplateBuilder) RestrictMinTime(t time.Time) {
 	if t.After(b.minTime) {
 		b.minTime = t
@@ -0,0 +1,302 @@
+package txbuilder
+
+import (
+	"context"
+	stdjson "encoding/json"
+	"time"
+
+	"chain/crypto/ed25519"
+	"chain/crypto/sha3pool"
+	"chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/vm"
+	"chain/protocol/vmutil"
+)
+
+// ErrBadContract is returned when a contract action's parameters
+// don't describe a valid contract, or the output being spent does
+// not hold a known contract.
+var ErrBadContract = errors.New("invalid contract")
+
+func DecodeControlTimeLockAction(data []byte) (Action, error) {
+	a := new(controlTimeLockAction)
+	err := stdjson.Unmarshal(data, a)
+	return a, err
+}
+
+type controlTimeLockAction struct {
+	bc.AssetAmount
+	Pubkeys       []json.HexBytes `json:"pubkeys"`
+	Quorum        int             `json:"quorum"`
+	UnlockTime    time.Time       `json:"unlock_time"`
+	ReferenceData json.Map        `json:"reference_data"`
+}
+
+func (a *controlTimeLockAction) Build(ctx context.Context, b *TemplateBuilder) error {
+	var missing []string
+	if len(a.Pubkeys) == 0 {
+		missing = append(missing, "pubkeys")
+	}
+	if a.UnlockTime.IsZero() {
+		missing = append(missing, "unlock_time")
+	}
+	if a.AssetID == (bc.AssetID{}) {
+		missing = append(missing, "asset_id")
+	}
+	if len(missing) > 0 {
+		return MissingFieldsError(missing...)
+	}
+
+	pubkeys, err := parsePubkeys(a.Pubkeys)
+	if err != nil {
+		return err
+	}
+	prog, err := vmutil.TimeLockedMultiSigProgram(pubkeys, a.Quorum, bc.Millis(a.UnlockTime))
+	if err != nil {
+		return errors.WithDetail(ErrBadContract, errors.Detail(err))
+	}
+	return b.AddOutput(bc.NewTxOutput(a.AssetID, a.Amount, prog, a.ReferenceData))
+}
+
+func DecodeControlHashLockAction(data []byte) (Action, error) {
+	a := new(controlHashLockAction)
+	err := stdjson.Unmarshal(data, a)
+	return a, err
+}
+
+type controlHashLockAction struct {
+	bc.AssetAmount
+	Hash          *bc.Hash        `json:"hash"`
+	Pubkeys       []json.HexBytes `json:"pubkeys"`
+	Quorum        int             `json:"quorum"`
+	ReferenceData json.Map        `json:"reference_data"`
+}
+
+func (a *controlHashLockAction) Build(ctx context.Context, b *TemplateBuilder) error {
+	var missing []string
+	if a.Hash == nil {
+		missing = append(missing, "hash")
+	}
+	if len(a.Pubkeys) == 0 {
+		missing = append(missing, "pubkeys")
+	}
+	if a.AssetID == (bc.AssetID{}) {
+		missing = append(missing, "asset_id")
+	}
+	if len(missing) > 0 {
+		return MissingFieldsError(missing...)
+	}
+
+	pubkeys, err := parsePubkeys(a.Pubkeys)
+	if err != nil {
+		return err
+	}
+	prog, err := vmutil.HashLockedProgram(*a.Hash, pubkeys, a.Quorum)
+	if err != nil {
+		return errors.WithDetail(ErrBadContract, errors.Detail(err))
+	}
+	return b.AddOutput(bc.NewTxOutput(a.AssetID, a.Amount, prog, a.ReferenceData))
+}
+
+func DecodeControlEscrowAction(data []byte) (Action, error) {
+	a := new(controlEscrowAction)
+	err := stdjson.Unmarshal(data, a)
+	return a, err
+}
+
+type controlEscrowAction struct {
+	bc.AssetAmount
+	Parties       []json.HexBytes `json:"parties"`
+	Refund        json.HexBytes   `json:"refund_pubkey"`
+	Deadline      time.Time       `json:"deadline"`
+	ReferenceData json.Map        `json:"reference_data"`
+}
+
+func (a *controlEscrowAction) Build(ctx context.Context, b *TemplateBuilder) error {
+	var missing []string
+	if len(a.Parties) == 0 {
+		missing = append(missing, "parties")
+	}
+	if len(a.Refund) == 0 {
+		missing = append(missing, "refund_pubkey")
+	}
+	if a.Deadline.IsZero() {
+		missing = append(missing, "deadline")
+	}
+	if a.AssetID == (bc.AssetID{}) {
+		missing = append(missing, "asset_id")
+	}
+	if len(missing) > 0 {
+		return MissingFieldsError(missing...)
+	}
+
+	parties, err := parsePubkeys(a.Parties)
+	if err != nil {
+		return err
+	}
+	prog, err := vmutil.EscrowProgram(parties, ed25519.PublicKey(a.Refund), bc.Millis(a.Deadline))
+	if err != nil {
+		return errors.WithDetail(ErrBadContract, errors.Detail(err))
+	}
+	return b.AddOutput(bc.NewTxOutput(a.AssetID, a.Amount, prog, a.ReferenceData))
+}
+
+func DecodeControlPredicateAction(data []byte) (Action, error) {
+	a := new(controlPredicateAction)
+	err := stdjson.Unmarshal(data, a)
+	return a, err
+}
+
+type controlPredicateAction struct {
+	bc.AssetAmount
+	Predicate     json.HexBytes `json:"predicate"`
+	ReferenceData json.Map      `json:"reference_data"`
+}
+
+func (a *controlPredicateAction) Build(ctx context.Context, b *TemplateBuilder) error {
+	var missing []string
+	if len(a.Predicate) == 0 {
+		missing = append(missing, "predicate")
+	}
+	if a.AssetID == (bc.AssetID{}) {
+		missing = append(missing, "asset_id")
+	}
+	if len(missing) > 0 {
+		return MissingFieldsError(missing...)
+	}
+
+	var h [32]byte
+	sha3pool.Sum256(h[:], a.Predicate)
+	prog := vmutil.PayToPredicateProgram(h)
+	return b.AddOutput(bc.NewTxOutput(a.AssetID, a.Amount, prog, a.ReferenceData))
+}
+
+func DecodeSpendContractAction(data []byte) (Action, error) {
+	a := new(spendContractAction)
+	err := stdjson.Unmarshal(data, a)
+	return a, err
+}
+
+// spendContractAction spends an output locked by one of the
+// contract templates in package vmutil. The caller supplies the
+// output being spent along with whatever the contract requires to
+// unlock it: keys to sign with, a hash preimage, the escrow clause,
+// or a predicate and its arguments. A quorum, if given, must match
+// the number of signatures the contract requires.
+type spendContractAction struct {
+	bc.AssetAmount
+	TxHash         *bc.Hash      `json:"transaction_id"`
+	TxOut          *uint32       `json:"position"`
+	ControlProgram json.HexBytes `json:"control_program"`
+	ReferenceData  json.Map      `json:"reference_data"`
+
+	Keys      []KeyID         `json:"keys"`
+	Quorum    int             `json:"quorum"`
+	Preimage  json.HexBytes   `json:"preimage"`
+	Refund    bool            `json:"refund"`
+	Predicate json.HexBytes   `json:"predicate"`
+	Arguments []json.HexBytes `json:"arguments"`
+}
+
+func (a *spendContractAction) Build(ctx context.Context, b *TemplateBuilder) error {
+	var missing []string
+	if a.TxHash == nil {
+		missing = append(missing, "transaction_id")
+	}
+	if a.TxOut == nil {
+		missing = append(missing, "position")
+	}
+	if len(a.ControlProgram) == 0 {
+		missing = append(missing, "control_program")
+	}
+	if a.AssetID == (bc.AssetID{}) {
+		missing = append(missing, "asset_id")
+	}
+	if len(missing) > 0 {
+		return MissingFieldsError(missing...)
+	}
+
+	sigInst := &SigningInstruction{AssetAmount: a.AssetAmount}
+	prog := a.ControlProgram
+	if _, nrequired, unlockTimeMS, err := vmutil.ParseTimeLockedMultiSigProgram(prog); err == nil {
+		if unlockTimeMS > bc.Millis(b.MaxTime()) {
+			return errors.WithDetailf(ErrBadContract, "output is locked until %s", bc.Time(unlockTimeMS))
+		}
+		err = a.checkQuorum(nrequired)
+		if err != nil {
+			return err
+		}
+		b.RestrictMinTime(bc.Time(unlockTimeMS))
+		sigInst.AddWitnessKeys(a.Keys, nrequired)
+	} else if hash, _, nrequired, err := vmutil.ParseHashLockedProgram(prog); err == nil {
+		err = a.checkQuorum(nrequired)
+		if err != nil {
+			return err
+		}
+		var h [32]byte
+		sha3pool.Sum256(h[:], a.Preimage)
+		if h != hash {
+			return errors.WithDetail(ErrBadContract, "preimage does not match hash lock")
+		}
+		sigInst.AddWitnessKeys(a.Keys, nrequired)
+		sigInst.AddWitnessData(a.Preimage)
+	} else if _, _, deadlineMS, err := vmutil.ParseEscrowProgram(prog); err == nil {
+		nrequired := 2
+		if a.Refund {
+			nrequired = 1
+		}
+		err = a.checkQuorum(nrequired)
+		if err != nil {
+			return err
+		}
+		if a.Refund {
+			if deadlineMS > bc.Millis(b.MaxTime()) {
+				return errors.WithDetailf(ErrBadContract, "refund is not available until %s", bc.Time(deadlineMS))
+			}
+			b.RestrictMinTime(bc.Time(deadlineMS))
+		}
+		sigInst.AddWitnessKeys(a.Keys, nrequired)
+		sigInst.AddWitnessData(vm.BoolBytes(a.Refund))
+	} else if hash, err := vmutil.ParsePayToPredicateProgram(prog); err == nil {
+		err = a.checkQuorum(0)
+		if err != nil {
+			return err
+		}
+		var h [32]byte
+		sha3pool.Sum256(h[:], a.Predicate)
+		if h != hash {
+			return errors.WithDetail(ErrBadContract, "predicate does not match predicate hash")
+		}
+		for _, arg := range a.Arguments {
+			sigInst.AddWitnessData(arg)
+		}
+		sigInst.AddWitnessData(vm.Int64Bytes(int64(len(a.Arguments))))
+		sigInst.AddWitnessData(a.Predicate)
+	} else {
+		return errors.WithDetail(ErrBadContract, "control program is not a known contract")
+	}
+
+	in := bc.NewSpendInput(*a.TxHash, *a.TxOut, nil, a.AssetID, a.Amount, prog, a.ReferenceData)
+	return b.AddInput(in, sigInst)
+}
+
+// checkQuorum checks the action's quorum, if any, against
+// nrequired, the number of signatures the contract requires.
+func (a *spendContractAction) checkQuorum(nrequired int) error {
+	if a.Quorum != 0 && a.Quorum != nrequired {
+		return errors.WithDetailf(ErrBadContract, "quorum is %d, but the contract requires %d signatures", a.Quorum, nrequired)
+	}
+	return nil
+}
+
+func parsePubkeys(hexKeys []json.HexBytes) ([]ed25519.PublicKey, error) {
+	pubkeys := make([]ed25519.PublicKey, 0, len(hexKeys))
+	for i, k := range hexKeys {
+		if len(k) != ed25519.PublicKeySize {
+			return nil, errors.WithDetailf(ErrBadContract, "pubkey %d has length %d, want %d", i, len(k), ed25519.PublicKeySize)
+		}
+		pubkeys = append(pubkeys, ed25519.PublicKey(k))
+	}
+	return pubkeys, nil
+}
@@ -0,0 +1,132 @@
+package txbuilder
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"chain/crypto/ed25519"
+	"chain/crypto/sha3pool"
+	"chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/vm"
+	"chain/protocol/vmutil"
+)
+
+func TestSpendContract(t *testing.T) {
+	ctx := context.Background()
+	pub, _, _ := ed25519.GenerateKey(nil)
+	maxTime := time.Now().Add(time.Hour)
+	unlock := time.Now().Add(time.Minute)
+
+	preimage := []byte("preimage")
+	var hash [32]byte
+	sha3pool.Sum256(hash[:], preimage)
+
+	predicate := []byte{byte(vm.OP_TRUE)}
+	var predHash [32]byte
+	sha3pool.Sum256(predHash[:], predicate)
+
+	timeLock, _ := vmutil.TimeLockedMultiSigProgram([]ed25519.PublicKey{pub}, 1, bc.Millis(unlock))
+	hashLock, _ := vmutil.HashLockedProgram(hash, []ed25519.PublicKey{pub}, 1)
+	escrow, _ := vmutil.EscrowProgram([]ed25519.PublicKey{pub, pub, pub}, pub, bc.Millis(unlock))
+	p2p := vmutil.PayToPredicateProgram(predHash)
+	lockedForever, _ := vmutil.TimeLockedMultiSigProgram([]ed25519.PublicKey{pub}, 1, bc.Millis(maxTime.Add(time.Hour)))
+
+	cases := []struct {
+		name        string
+		action      *spendContractAction
+		wantMinTime uint64
+		wantData    [][]byte
+		wantErr     error
+	}{
+		{
+			name:        "time lock",
+			action:      &spendContractAction{ControlProgram: timeLock},
+			wantMinTime: bc.Millis(unlock),
+		},
+		{
+			name:        "time lock with quorum",
+			action:      &spendContractAction{ControlProgram: timeLock, Quorum: 1},
+			wantMinTime: bc.Millis(unlock),
+		},
+		{
+			name:    "time lock wrong quorum",
+			action:  &spendContractAction{ControlProgram: timeLock, Quorum: 2},
+			wantErr: ErrBadContract,
+		},
+		{
+			name:     "hash lock",
+			action:   &spendContractAction{ControlProgram: hashLock, Preimage: preimage},
+			wantData: [][]byte{preimage},
+		},
+		{
+			name:    "hash lock bad preimage",
+			action:  &spendContractAction{ControlProgram: hashLock, Preimage: []byte("nope")},
+			wantErr: ErrBadContract,
+		},
+		{
+			name:     "escrow",
+			action:   &spendContractAction{ControlProgram: escrow},
+			wantData: [][]byte{vm.BoolBytes(false)},
+		},
+		{
+			name:        "escrow refund",
+			action:      &spendContractAction{ControlProgram: escrow, Refund: true},
+			wantMinTime: bc.Millis(unlock),
+			wantData:    [][]byte{vm.BoolBytes(true)},
+		},
+		{
+			name:    "escrow refund wrong quorum",
+			action:  &spendContractAction{ControlProgram: escrow, Refund: true, Quorum: 2},
+			wantErr: ErrBadContract,
+		},
+		{
+			name:     "pay to predicate",
+			action:   &spendContractAction{ControlProgram: p2p, Predicate: predicate, Arguments: []json.HexBytes{{5}}},
+			wantData: [][]byte{{5}, vm.Int64Bytes(1), predicate},
+		},
+		{
+			name:    "still locked",
+			action:  &spendContractAction{ControlProgram: lockedForever},
+			wantErr: ErrBadContract,
+		},
+		{
+			name:    "unknown program",
+			action:  &spendContractAction{ControlProgram: []byte{byte(vm.OP_TRUE)}},
+			wantErr: ErrBadContract,
+		},
+	}
+	for _, c := range cases {
+		var (
+			txHash bc.Hash
+			pos    uint32
+		)
+		c.action.AssetAmount = bc.AssetAmount{AssetID: bc.AssetID{1}, Amount: 5}
+		c.action.TxHash = &txHash
+		c.action.TxOut = &pos
+
+		b := &TemplateBuilder{maxTime: maxTime}
+		err := c.action.Build(ctx, b)
+		if errors.Root(err) != c.wantErr {
+			t.Errorf("%s: got error %v want %v", c.name, err, c.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got := bc.Millis(b.minTime); b.minTime.IsZero() && c.wantMinTime != 0 || !b.minTime.IsZero() && got != c.wantMinTime {
+			t.Errorf("%s: got mintime %d want %d", c.name, got, c.wantMinTime)
+		}
+		var data [][]byte
+		for _, w := range b.signingInstructions[0].WitnessComponents {
+			if d, ok := w.(DataWitness); ok {
+				data = append(data, d)
+			}
+		}
+		if len(data) != len(c.wantData) {
+			t.Errorf("%s: got %d data witnesses want %d", c.name, len(data), len(c.wantData))
+		}
+	}
+}
@@ -112,6 +112,12 @@ type RemoteGenerator struct {
 
 func (rg *RemoteGenerator) Submit(ctx context.Context, tx *bc.Tx) error {
 	err := rg.Peer.Call(ctx, "/rpc/submit", tx, nil)
+	if _, detail, ok := rpc.ClientError(err); ok {
+		// The generator refused the transaction; pass its
+		// reason on to the submitter.
+		err = errors.Wrap(ErrRejected, err)
+		return errors.WithDetail(err, detail)
+	}
 	err = errors.Wrap(err, "generator transaction notice")
 	return err
 }
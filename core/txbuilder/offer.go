@@ -0,0 +1,118 @@
+package txbuilder
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"time"
+
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+// ErrBadOffer is returned when an offer's template does not describe
+// a signed, partial trade, or does not match the offer's terms.
+var ErrBadOffer = errors.New("invalid offer")
+
+// Offer is a partial transaction in which one party pays some assets
+// in exchange for receiving others. The offering party builds the
+// template with allow_additional_actions set, then signs it. The
+// signatures commit to the offering party's inputs and to every
+// output already in the template, including the payment the offering
+// party expects to receive, so any counterparty can complete the
+// transaction by adding inputs and outputs, but cannot alter the
+// terms.
+//
+// The Offered and Requested terms are always derived from the
+// template itself: Offered is the amount of each asset left unclaimed
+// by the template's outputs, and Requested is the amount of each
+// asset its outputs pay without a matching input.
+type Offer struct {
+	Offered   []bc.AssetAmount `json:"offered"`
+	Requested []bc.AssetAmount `json:"requested"`
+	ExpiresAt time.Time        `json:"expires_at"`
+	Template  *Template        `json:"template"`
+}
+
+// NewOffer produces an Offer from a signed partial template.
+func NewOffer(tpl *Template) (*Offer, error) {
+	if tpl == nil || tpl.Transaction == nil {
+		return nil, errors.Wrap(ErrMissingRawTx)
+	}
+	if !tpl.AllowAdditional {
+		return nil, errors.WithDetail(ErrBadOffer, "template does not allow additional actions")
+	}
+	tx := tpl.Transaction
+	for i, in := range tx.Inputs {
+		if len(in.Arguments()) == 0 {
+			return nil, errors.WithDetailf(ErrBadOffer, "input %d is not signed", i)
+		}
+	}
+
+	balances, err := assetBalances(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	offer := &Offer{Template: tpl}
+	for assetID, amt := range balances {
+		if amt > 0 {
+			offer.Offered = append(offer.Offered, bc.AssetAmount{AssetID: assetID, Amount: uint64(amt)})
+		} else if amt < 0 {
+			offer.Requested = append(offer.Requested, bc.AssetAmount{AssetID: assetID, Amount: uint64(-amt)})
+		}
+	}
+	if len(offer.Offered) == 0 || len(offer.Requested) == 0 {
+		return nil, errors.WithDetail(ErrBadOffer, "template must both offer and request assets")
+	}
+	sortAssetAmounts(offer.Offered)
+	sortAssetAmounts(offer.Requested)
+	if tx.MaxTime > 0 {
+		offer.ExpiresAt = bc.Time(tx.MaxTime)
+	}
+	return offer, nil
+}
+
+// UnmarshalJSON decodes an offer and checks that its stated terms
+// match its template.
+func (o *Offer) UnmarshalJSON(b []byte) error {
+	type offer Offer // drop methods to avoid recursion
+	var stated offer
+	err := json.Unmarshal(b, &stated)
+	if err != nil {
+		return err
+	}
+	tpl := stated.Template
+	if tpl != nil {
+		tpl.Local = false
+	}
+	actual, err := NewOffer(tpl)
+	if err != nil {
+		return err
+	}
+	if stated.Offered != nil && !reflect.DeepEqual(sorted(stated.Offered), actual.Offered) {
+		return errors.WithDetail(ErrBadOffer, "offered amounts do not match template")
+	}
+	if stated.Requested != nil && !reflect.DeepEqual(sorted(stated.Requested), actual.Requested) {
+		return errors.WithDetail(ErrBadOffer, "requested amounts do not match template")
+	}
+	*o = *actual
+	return nil
+}
+
+func sorted(a []bc.AssetAmount) []bc.AssetAmount {
+	b := append([]bc.AssetAmount(nil), a...)
+	sortAssetAmounts(b)
+	return b
+}
+
+func sortAssetAmounts(a []bc.AssetAmount) {
+	sort.Sort(byAssetID(a))
+}
+
+type byAssetID []bc.AssetAmount
+
+func (a byAssetID) Len() int           { return len(a) }
+func (a byAssetID) Less(i, j int) bool { return bytes.Compare(a[i].AssetID[:], a[j].AssetID[:]) < 0 }
+func (a byAssetID) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
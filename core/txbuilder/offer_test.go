@@ -0,0 +1,102 @@
+package txbuilder
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+func TestOffer(t *testing.T) {
+	assetA, assetB := bc.AssetID{1}, bc.AssetID{2}
+	tpl := &Template{
+		Transaction: &bc.TxData{
+			Version: 1,
+			MaxTime: 1000,
+			Inputs: []*bc.TxInput{
+				bc.NewSpendInput(bc.Hash{9}, 0, [][]byte{{1}}, assetA, 12, nil, nil),
+			},
+			Outputs: []*bc.TxOutput{
+				bc.NewTxOutput(assetB, 5, []byte("alice"), nil),
+				bc.NewTxOutput(assetA, 2, []byte("alice change"), nil),
+			},
+		},
+		AllowAdditional: true,
+	}
+
+	offer, err := NewOffer(tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantOffered := []bc.AssetAmount{{AssetID: assetA, Amount: 10}}
+	wantRequested := []bc.AssetAmount{{AssetID: assetB, Amount: 5}}
+	if !reflect.DeepEqual(offer.Offered, wantOffered) {
+		t.Errorf("offered = %v want %v", offer.Offered, wantOffered)
+	}
+	if !reflect.DeepEqual(offer.Requested, wantRequested) {
+		t.Errorf("requested = %v want %v", offer.Requested, wantRequested)
+	}
+	if offer.ExpiresAt != bc.Time(1000) {
+		t.Errorf("expires at %s want %s", offer.ExpiresAt, bc.Time(1000))
+	}
+
+	b, err := json.Marshal(offer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Offer
+	err = json.Unmarshal(b, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Offered, wantOffered) || !reflect.DeepEqual(got.Requested, wantRequested) {
+		t.Errorf("decoded offer terms = (%v, %v) want (%v, %v)", got.Offered, got.Requested, wantOffered, wantRequested)
+	}
+
+	// Stated terms that don't match the template are rejected.
+	offer.Offered[0].Amount = 11
+	b, err = json.Marshal(offer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = json.Unmarshal(b, &got)
+	if errors.Root(err) != ErrBadOffer {
+		t.Errorf("decoding tampered offer: got error %v want %v", err, ErrBadOffer)
+	}
+}
+
+func TestBadOffer(t *testing.T) {
+	cases := []struct {
+		name string
+		tpl  *Template
+	}{
+		{
+			name: "final template",
+			tpl: &Template{Transaction: &bc.TxData{
+				Inputs:  []*bc.TxInput{bc.NewSpendInput(bc.Hash{}, 0, [][]byte{{1}}, bc.AssetID{1}, 1, nil, nil)},
+				Outputs: []*bc.TxOutput{bc.NewTxOutput(bc.AssetID{2}, 1, nil, nil)},
+			}},
+		},
+		{
+			name: "unsigned input",
+			tpl: &Template{AllowAdditional: true, Transaction: &bc.TxData{
+				Inputs:  []*bc.TxInput{bc.NewSpendInput(bc.Hash{}, 0, nil, bc.AssetID{1}, 1, nil, nil)},
+				Outputs: []*bc.TxOutput{bc.NewTxOutput(bc.AssetID{2}, 1, nil, nil)},
+			}},
+		},
+		{
+			name: "nothing requested",
+			tpl: &Template{AllowAdditional: true, Transaction: &bc.TxData{
+				Inputs: []*bc.TxInput{bc.NewSpendInput(bc.Hash{}, 0, [][]byte{{1}}, bc.AssetID{1}, 1, nil, nil)},
+			}},
+		},
+	}
+	for _, c := range cases {
+		_, err := NewOffer(c.tpl)
+		if errors.Root(err) != ErrBadOffer {
+			t.Errorf("%s: got error %v want %v", c.name, err, ErrBadOffer)
+		}
+	}
+}
@@ -23,12 +23,32 @@ var (
 	ErrMissingFields       = errors.New("required field is missing")
 )
 
+// A RefDataCheck checks the reference data of a transaction
+// built by Build. Its arguments are the built transaction and
+// the base transaction it was built on, which may be nil.
+type RefDataCheck func(ctx context.Context, tx, base *bc.TxData) error
+
 // Build builds or adds on to a transaction.
 // Initially, inputs are left unconsumed, and destinations unsatisfied.
 // Build partners then satisfy and consume inputs and destinations.
 // The final party must ensure that the transaction is
 // balanced before calling finalize.
 func Build(ctx context.Context, tx *bc.TxData, actions []Action, maxTime time.Time) (*Template, error) {
+	return BuildChecked(ctx, tx, actions, maxTime, nil)
+}
+
+// BuildChecked is like Build, but if checkRefData is not nil,
+// it also fails if checkRefData returns an error for the
+// built transaction.
+func BuildChecked(ctx context.Context, tx *bc.TxData, actions []Action, maxTime time.Time, checkRefData RefDataCheck) (*Template, error) {
+	// The builder adds to tx in place, so keep a copy of
+	// the base as it was for checkRefData.
+	var base *bc.TxData
+	if tx != nil {
+		baseCopy := *tx
+		base = &baseCopy
+	}
+
 	builder := TemplateBuilder{
 		base:    tx,
 		maxTime: maxTime,
@@ -63,6 +83,14 @@ func Build(ctx context.Context, tx *bc.TxData, actions []Action, maxTime time.Ti
 		return nil, err
 	}
 
+	if checkRefData != nil {
+		err = checkRefData(ctx, tpl.Transaction, base)
+		if err != nil {
+			builder.rollback()
+			return nil, err
+		}
+	}
+
 	return tpl, nil
 }
 
@@ -92,22 +120,32 @@ func Sign(ctx context.Context, tpl *Template, xpubs []string, signFn SignFunc) e
 	return materializeWitnesses(tpl)
 }
 
-func checkBlankCheck(tx *bc.TxData) error {
+// assetBalances returns, for each asset in tx, the amount
+// its inputs supply less the amount its outputs pay.
+func assetBalances(tx *bc.TxData) (map[bc.AssetID]int64, error) {
 	assetMap := make(map[bc.AssetID]int64)
 	var ok bool
 	for _, in := range tx.Inputs {
 		asset := in.AssetID() // AssetID() is calculated for IssuanceInputs, so grab once
 		assetMap[asset], ok = checked.AddInt64(assetMap[asset], int64(in.Amount()))
 		if !ok {
-			return errors.WithDetailf(ErrBadAmount, "cumulative amounts for asset %s overflow the allowed asset amount 2^63", asset)
+			return nil, errors.WithDetailf(ErrBadAmount, "cumulative amounts for asset %s overflow the allowed asset amount 2^63", asset)
 		}
 	}
 	for _, out := range tx.Outputs {
 		assetMap[out.AssetID], ok = checked.SubInt64(assetMap[out.AssetID], int64(out.Amount))
 		if !ok {
-			return errors.WithDetailf(ErrBadAmount, "cumulative amounts for asset %s overflow the allowed asset amount 2^63", out.AssetID)
+			return nil, errors.WithDetailf(ErrBadAmount, "cumulative amounts for asset %s overflow the allowed asset amount 2^63", out.AssetID)
 		}
 	}
+	return assetMap, nil
+}
+
+func checkBlankCheck(tx *bc.TxData) error {
+	assetMap, err := assetBalances(tx)
+	if err != nil {
+		return err
+	}
 
 	var requiresOutputs, requiresInputs bool
 	for _, amt := range assetMap {
@@ -112,6 +112,45 @@ func TestBuild(t *testing.T) {
 	}
 }
 
+func TestBuildCheckedBase(t *testing.T) {
+	ctx := context.Background()
+	base := &bc.TxData{
+		Version: 1,
+		Inputs: []*bc.TxInput{
+			bc.NewSpendInput([32]byte{254}, 0, nil, [32]byte{1}, 5, nil, nil),
+		},
+		Outputs: []*bc.TxOutput{
+			bc.NewTxOutput([32]byte{1}, 5, []byte("dest"), nil),
+		},
+	}
+	actions := []Action{
+		testAction(bc.AssetAmount{AssetID: [32]byte{2}, Amount: 6}),
+		&setTxRefDataAction{Data: []byte("xyz")},
+	}
+
+	var gotBase *bc.TxData
+	check := func(ctx context.Context, tx, base *bc.TxData) error {
+		gotBase = base
+		return nil
+	}
+	tpl, err := BuildChecked(ctx, base, actions, time.Now().Add(time.Minute), check)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(tpl.Transaction.Inputs) != 2 || len(tpl.Transaction.Outputs) != 2 {
+		t.Fatalf("built tx has %d inputs and %d outputs, want 2 and 2", len(tpl.Transaction.Inputs), len(tpl.Transaction.Outputs))
+	}
+
+	// The check must see the base as it was
+	// before the build added to it.
+	if len(gotBase.Inputs) != 1 || len(gotBase.Outputs) != 1 {
+		t.Errorf("checked base has %d inputs and %d outputs, want 1 and 1", len(gotBase.Inputs), len(gotBase.Outputs))
+	}
+	if len(gotBase.ReferenceData) != 0 {
+		t.Errorf("checked base has reference data %q, want none", gotBase.ReferenceData)
+	}
+}
+
 func TestMaterializeWitnesses(t *testing.T) {
 	var initialBlockHash bc.Hash
 	privkey, pubkey, err := chainkd.NewXKeys(nil)
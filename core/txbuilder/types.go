@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 
+	chainjson "chain/encoding/json"
 	"chain/errors"
 	"chain/protocol/bc"
 )
@@ -50,6 +51,7 @@ func (si *SigningInstruction) UnmarshalJSON(b []byte) error {
 		WitnessComponents []struct {
 			Type string
 			SignatureWitness
+			Value chainjson.HexBytes `json:"value"`
 		} `json:"witness_components"`
 	}
 	err := json.Unmarshal(b, &pre)
@@ -61,10 +63,14 @@ func (si *SigningInstruction) UnmarshalJSON(b []byte) error {
 	si.Position = pre.Position
 	si.WitnessComponents = make([]WitnessComponent, 0, len(pre.WitnessComponents))
 	for i, w := range pre.WitnessComponents {
-		if w.Type != "signature" {
+		switch w.Type {
+		case "signature":
+			si.WitnessComponents = append(si.WitnessComponents, &w.SignatureWitness)
+		case "data":
+			si.WitnessComponents = append(si.WitnessComponents, DataWitness(w.Value))
+		default:
 			return errors.WithDetailf(ErrBadWitnessComponent, "witness component %d has unknown type '%s'", i, w.Type)
 		}
-		si.WitnessComponents = append(si.WitnessComponents, &w.SignatureWitness)
 	}
 	return nil
 }
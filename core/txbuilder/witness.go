@@ -241,3 +241,32 @@ func (si *SigningInstruction) AddWitnessKeys(keys []KeyID, quorum int) {
 	}
 	si.WitnessComponents = append(si.WitnessComponents, sw)
 }
+
+// DataWitness is a witness component that contributes a single,
+// fixed item to the input witness, such as a hash preimage or an
+// argument to a predicate.
+type DataWitness chainjson.HexBytes
+
+func (DataWitness) Sign(context.Context, *Template, int, []string, SignFunc) error {
+	return nil
+}
+
+func (d DataWitness) Materialize(tpl *Template, index int, args *[][]byte) error {
+	*args = append(*args, d)
+	return nil
+}
+
+func (d DataWitness) MarshalJSON() ([]byte, error) {
+	obj := struct {
+		Type  string             `json:"type"`
+		Value chainjson.HexBytes `json:"value"`
+	}{
+		Type:  "data",
+		Value: chainjson.HexBytes(d),
+	}
+	return json.Marshal(obj)
+}
+
+func (si *SigningInstruction) AddWitnessData(data []byte) {
+	si.WitnessComponents = append(si.WitnessComponents, DataWitness(data))
+}
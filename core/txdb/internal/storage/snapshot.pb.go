@@ -10,6 +10,7 @@ It is generated from these files:
 
 It has these top-level messages:
 	Snapshot
+	SnapshotDelta
 */
 package storage
 
@@ -78,29 +79,69 @@ func (m *Snapshot_StateTreeNode) String() string            { return proto.Compa
 func (*Snapshot_StateTreeNode) ProtoMessage()               {}
 func (*Snapshot_StateTreeNode) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0, 1} }
 
+// SnapshotDelta represents the changes to the state tree since a base
+// snapshot, which may itself be a delta.
+type SnapshotDelta struct {
+	// BaseHeight is the height of the snapshot this delta applies to.
+	BaseHeight uint64 `protobuf:"varint,1,opt,name=base_height,json=baseHeight" json:"base_height,omitempty"`
+	// Added contains the state tree leaves inserted or changed since the
+	// base snapshot.
+	Added []*Snapshot_StateTreeNode `protobuf:"bytes,2,rep,name=added" json:"added,omitempty"`
+	// Removed contains the keys of the state tree leaves deleted since the
+	// base snapshot.
+	Removed [][]byte `protobuf:"bytes,3,rep,name=removed,proto3" json:"removed,omitempty"`
+	// Issuances contains the complete record of recent issuances. It is
+	// small enough that it isn't worth storing as a delta.
+	Issuances []*Snapshot_Issuance `protobuf:"bytes,4,rep,name=issuances" json:"issuances,omitempty"`
+}
+
+func (m *SnapshotDelta) Reset()                    { *m = SnapshotDelta{} }
+func (m *SnapshotDelta) String() string            { return proto.CompactTextString(m) }
+func (*SnapshotDelta) ProtoMessage()               {}
+func (*SnapshotDelta) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *SnapshotDelta) GetAdded() []*Snapshot_StateTreeNode {
+	if m != nil {
+		return m.Added
+	}
+	return nil
+}
+
+func (m *SnapshotDelta) GetIssuances() []*Snapshot_Issuance {
+	if m != nil {
+		return m.Issuances
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*Snapshot)(nil), "chain.core.txdb.internal.storage.Snapshot")
 	proto.RegisterType((*Snapshot_Issuance)(nil), "chain.core.txdb.internal.storage.Snapshot.Issuance")
 	proto.RegisterType((*Snapshot_StateTreeNode)(nil), "chain.core.txdb.internal.storage.Snapshot.StateTreeNode")
+	proto.RegisterType((*SnapshotDelta)(nil), "chain.core.txdb.internal.storage.SnapshotDelta")
 }
 
 func init() { proto.RegisterFile("snapshot.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 227 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xe2, 0xe2, 0x2b, 0xce, 0x4b, 0x2c,
-	0x28, 0xce, 0xc8, 0x2f, 0xd1, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x52, 0x48, 0xce, 0x48, 0xcc,
-	0xcc, 0xd3, 0x4b, 0xce, 0x2f, 0x4a, 0xd5, 0x2b, 0xa9, 0x48, 0x49, 0xd2, 0xcb, 0xcc, 0x2b, 0x49,
-	0x2d, 0xca, 0x4b, 0xcc, 0xd1, 0x2b, 0x2e, 0xc9, 0x2f, 0x4a, 0x4c, 0x4f, 0x55, 0x5a, 0xc8, 0xc4,
-	0xc5, 0x11, 0x0c, 0xd5, 0x24, 0xe4, 0xc7, 0xc5, 0x9a, 0x97, 0x9f, 0x92, 0x5a, 0x2c, 0xc1, 0xa8,
-	0xc0, 0xac, 0xc1, 0x6d, 0x64, 0xa1, 0x47, 0x48, 0xbb, 0x1e, 0x4c, 0xab, 0x5e, 0x70, 0x49, 0x62,
-	0x49, 0x6a, 0x48, 0x51, 0x6a, 0xaa, 0x1f, 0xd0, 0x80, 0x20, 0x88, 0x31, 0x42, 0x81, 0x5c, 0x9c,
-	0x99, 0xc5, 0xc5, 0xa5, 0x89, 0x79, 0xc9, 0x40, 0x33, 0x99, 0xc0, 0x66, 0x1a, 0x93, 0x60, 0xa6,
-	0x27, 0x54, 0x6f, 0x10, 0xc2, 0x14, 0x29, 0x6b, 0x2e, 0x0e, 0x98, 0xb0, 0x90, 0x10, 0x17, 0x4b,
-	0x46, 0x62, 0x71, 0x06, 0xd0, 0xb5, 0x8c, 0x1a, 0x3c, 0x41, 0x60, 0xb6, 0x90, 0x34, 0x17, 0x67,
-	0x6a, 0x45, 0x41, 0x66, 0x51, 0x65, 0x7c, 0x2e, 0xc8, 0x4a, 0x46, 0x0d, 0x96, 0x20, 0x0e, 0x88,
-	0x80, 0x6f, 0xb1, 0x94, 0x29, 0x17, 0x2f, 0x8a, 0x3b, 0x85, 0x04, 0xb8, 0x98, 0xb3, 0x53, 0x2b,
-	0xa1, 0x06, 0x80, 0x98, 0x70, 0x33, 0x99, 0x10, 0x66, 0x3a, 0x71, 0x46, 0xb1, 0x43, 0xdd, 0x96,
-	0xc4, 0x06, 0x0e, 0x57, 0x63, 0x40, 0x00, 0x00, 0x00, 0xff, 0xff, 0x2c, 0x20, 0xad, 0x97, 0x69,
-	0x01, 0x00, 0x00,
+	// 293 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x92, 0xcd, 0x4a, 0x33, 0x31,
+	0x14, 0x86, 0x99, 0x9f, 0xef, 0x6b, 0x7b, 0xda, 0x8a, 0x64, 0x15, 0xea, 0xc2, 0xa1, 0xab, 0x59,
+	0x65, 0x61, 0x11, 0x04, 0x77, 0xe2, 0x42, 0x17, 0x16, 0x4c, 0x5d, 0xb9, 0x29, 0x99, 0xc9, 0xa1,
+	0x19, 0x6c, 0x93, 0x21, 0x89, 0xd2, 0x5e, 0x8e, 0x17, 0xe8, 0x3d, 0xc8, 0xa4, 0x33, 0x96, 0xae,
+	0x44, 0x74, 0x77, 0xf2, 0x92, 0xe7, 0xc9, 0xe1, 0x25, 0x70, 0xe2, 0xb4, 0xa8, 0x9d, 0x32, 0x9e,
+	0xd5, 0xd6, 0x78, 0x43, 0xb2, 0x52, 0x89, 0x4a, 0xb3, 0xd2, 0x58, 0x64, 0x7e, 0x2b, 0x0b, 0x56,
+	0x69, 0x8f, 0x56, 0x8b, 0x35, 0x73, 0xde, 0x58, 0xb1, 0xc2, 0xe9, 0x7b, 0x0c, 0xfd, 0x45, 0x0b,
+	0x91, 0x39, 0xfc, 0xd3, 0x46, 0xa2, 0xa3, 0x51, 0x96, 0xe4, 0xc3, 0x8b, 0x2b, 0xf6, 0x1d, 0xce,
+	0x3a, 0x94, 0x2d, 0xbc, 0xf0, 0xf8, 0x64, 0x11, 0xe7, 0x46, 0x22, 0xdf, 0x6b, 0xc8, 0x23, 0x0c,
+	0x2a, 0xe7, 0x5e, 0x85, 0x2e, 0xd1, 0xd1, 0x38, 0x38, 0x67, 0x3f, 0x70, 0xde, 0xb7, 0x2c, 0x3f,
+	0x58, 0x26, 0xd7, 0xd0, 0xef, 0x62, 0x42, 0x20, 0x55, 0xc2, 0x29, 0x1a, 0x65, 0x51, 0x3e, 0xe2,
+	0x61, 0x26, 0x67, 0x30, 0xc0, 0x6d, 0x5d, 0xd9, 0xdd, 0x72, 0xd3, 0x3c, 0x19, 0xe5, 0x29, 0xef,
+	0xef, 0x83, 0x07, 0x37, 0xb9, 0x84, 0xf1, 0xd1, 0x9e, 0xe4, 0x14, 0x92, 0x17, 0xdc, 0xb5, 0x82,
+	0x66, 0xfc, 0x72, 0xc6, 0x07, 0xe7, 0xf4, 0x23, 0x82, 0x71, 0xb7, 0xd4, 0x2d, 0xae, 0xbd, 0x20,
+	0xe7, 0x30, 0x2c, 0x84, 0xc3, 0xa5, 0xc2, 0x6a, 0xa5, 0x7c, 0xe0, 0x53, 0x0e, 0x4d, 0x74, 0x17,
+	0x92, 0xa6, 0x49, 0x21, 0x25, 0x4a, 0x1a, 0xff, 0xb6, 0xc9, 0xa0, 0x21, 0x14, 0x7a, 0x16, 0x37,
+	0xe6, 0x0d, 0x25, 0x4d, 0xb2, 0x24, 0x1f, 0xf1, 0xee, 0x78, 0xdc, 0x71, 0xfa, 0x17, 0x1d, 0xdf,
+	0x0c, 0x9e, 0x7b, 0xed, 0xbd, 0xe2, 0x7f, 0xf8, 0x47, 0xb3, 0xcf, 0x01, 0x00, 0xc4, 0xed, 0x80,
+	0x1b, 0x59, 0x02, 0x00, 0x00,
 }
@@ -0,0 +1,90 @@
+package txdb
+
+import (
+	"context"
+	"time"
+
+	"chain/database/sql"
+	"chain/errors"
+	"chain/log"
+)
+
+// ErrPruned is returned when a block is requested
+// that is no longer stored.
+var ErrPruned = errors.New("block pruned")
+
+// PruneBlocks deletes old blocks every period until ctx is done.
+// See pruneBlocks.
+func (s *Store) PruneBlocks(ctx context.Context, retain uint64, period time.Duration) {
+	ticker := time.NewTicker(period)
+	for {
+		select {
+		case <-ticker.C:
+			n, err := s.pruneBlocks(ctx, retain)
+			if err != nil {
+				log.Error(ctx, err)
+			} else if n > 0 {
+				log.Messagef(ctx, "pruned %d blocks", n)
+			}
+		case <-ctx.Done():
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+// pruneBlocks deletes the blocks more than retain blocks below
+// the tip of the blockchain that are no longer needed: the latest
+// state snapshot must be later than them, and every pin must have
+// processed them. It keeps the initial block, and the block before
+// the latest snapshot, which peers need to verify the snapshot.
+// It returns the number of blocks deleted.
+func (s *Store) pruneBlocks(ctx context.Context, retain uint64) (int64, error) {
+	// LEAST ignores NULLs, so there's no limit from
+	// the pins if there are none. There must be a
+	// snapshot, though.
+	const q = `
+		DELETE FROM blocks WHERE height > 1 AND height < LEAST(
+			(SELECT MAX(height) FROM blocks) - $1::bigint,
+			(SELECT COALESCE(MAX(height), 0) FROM snapshots) - 1,
+			(SELECT MIN(height) FROM block_processors) + 1
+		)
+	`
+	res, err := s.db.Exec(ctx, q, retain)
+	if err != nil {
+		return 0, errors.Wrap(err, "deleting old blocks")
+	}
+	n, err := res.RowsAffected()
+	return n, errors.Wrap(err)
+}
+
+// PrunedHeight returns the height below which this store no
+// longer has blocks, other than the initial block, or 0 if
+// it has every block up to its height. Blocks are missing if
+// they've been pruned, or if the Core started from a snapshot.
+func (s *Store) PrunedHeight(ctx context.Context) (uint64, error) {
+	const q = `SELECT COALESCE(MIN(height), 0) FROM blocks WHERE height > 1`
+	var height uint64
+	err := s.db.QueryRow(ctx, q).Scan(&height)
+	if err != nil {
+		return 0, errors.Wrap(err, "querying lowest block height")
+	}
+	if height <= 2 {
+		return 0, nil
+	}
+	return height, nil
+}
+
+// missingBlock returns ErrPruned if the block at the given
+// height, which the query that returned err didn't find, is no
+// longer stored. Otherwise it returns err.
+func (s *Store) missingBlock(ctx context.Context, height uint64, err error) error {
+	if err != sql.ErrNoRows || height <= 1 {
+		return err
+	}
+	pruned, perr := s.PrunedHeight(ctx)
+	if perr != nil || height >= pruned {
+		return err
+	}
+	return errors.WithDetailf(ErrPruned, "block %d is not stored; this core has no blocks below height %d except the initial block", height, pruned)
+}
@@ -0,0 +1,63 @@
+package txdb
+
+import (
+	"context"
+	"testing"
+
+	"chain/database/pg/pgtest"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/state"
+)
+
+func TestPruneBlocks(t *testing.T) {
+	dbtx := pgtest.NewTx(t)
+	ctx := context.Background()
+	store := NewStore(dbtx)
+
+	for h := uint64(1); h <= 10; h++ {
+		err := store.SaveBlock(ctx, &bc.Block{BlockHeader: bc.BlockHeader{Version: 1, Height: h}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	pgtest.Exec(ctx, dbtx, t, `INSERT INTO block_processors (name, height) VALUES ('a', 9), ('b', 5)`)
+
+	// Without a snapshot, nothing can be pruned.
+	n, err := store.pruneBlocks(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("pruned %d blocks with no snapshot, want 0", n)
+	}
+
+	err = store.SaveSnapshot(ctx, 8, state.Empty())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Pin b has only processed block 5.
+	n, err = store.pruneBlocks(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Errorf("pruned %d blocks, want 4", n)
+	}
+	pruned, err := store.PrunedHeight(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned != 6 {
+		t.Errorf("pruned height = %d want 6", pruned)
+	}
+
+	_, err = NewStore(dbtx).GetBlock(ctx, 3)
+	if errors.Root(err) != ErrPruned {
+		t.Errorf("got error %v for block 3, want %s", err, ErrPruned)
+	}
+	_, err = store.GetRawBlock(ctx, 1)
+	if err != nil {
+		t.Errorf("getting initial block: %v", err)
+	}
+}
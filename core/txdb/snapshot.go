@@ -46,7 +46,55 @@ func DecodeSnapshot(data []byte) (*state.Snapshot, error) {
 	}, nil
 }
 
-func storeStateSnapshot(ctx context.Context, db pg.DB, snapshot *state.Snapshot, blockHeight uint64) error {
+// SnapshotPart describes a stored snapshot, either a full
+// snapshot or a delta from the snapshot at BaseHeight.
+type SnapshotPart struct {
+	Height     uint64 `json:"height"`
+	BaseHeight uint64 `json:"base_height"` // 0 for a full snapshot
+	Size       uint64 `json:"size"`
+}
+
+// ApplySnapshotDelta applies data, a delta snapshot in the Chain
+// Core's binary, protobuf representation, to snapshot, which must
+// be the state at baseHeight.
+func ApplySnapshotDelta(snapshot *state.Snapshot, baseHeight uint64, data []byte) error {
+	var delta storage.SnapshotDelta
+	err := proto.Unmarshal(data, &delta)
+	if err != nil {
+		return errors.Wrap(err, "unmarshaling state snapshot delta proto")
+	}
+	if delta.BaseHeight != baseHeight {
+		return errors.Wrapf(errors.New("wrong base snapshot"), "delta is from height %d, not %d", delta.BaseHeight, baseHeight)
+	}
+
+	for _, key := range delta.Removed {
+		err = snapshot.Tree.Delete(key)
+		if err != nil {
+			return errors.Wrap(err, "deleting from state tree")
+		}
+	}
+	for _, node := range delta.Added {
+		var l patricia.Leaf
+		l.Key = node.Key
+		copy(l.Hash[:], node.Hash)
+		err = snapshot.Tree.InsertLeaf(l)
+		if err != nil {
+			return errors.Wrap(err, "inserting into state tree")
+		}
+	}
+
+	snapshot.Issuances = make(state.PriorIssuances, len(delta.Issuances))
+	for _, issuance := range delta.Issuances {
+		var hash bc.Hash
+		copy(hash[:], issuance.Hash)
+		snapshot.Issuances[hash] = issuance.ExpiryMs
+	}
+	return nil
+}
+
+// EncodeSnapshot encodes a snapshot in the Chain Core's binary,
+// protobuf representation. See DecodeSnapshot.
+func EncodeSnapshot(snapshot *state.Snapshot) ([]byte, error) {
 	var storedSnapshot storage.Snapshot
 	err := patricia.Walk(snapshot.Tree, func(l patricia.Leaf) error {
 		storedSnapshot.Nodes = append(storedSnapshot.Nodes, &storage.Snapshot_StateTreeNode{
@@ -56,58 +104,181 @@ func storeStateSnapshot(ctx context.Context, db pg.DB, snapshot *state.Snapshot,
 		return nil
 	})
 	if err != nil {
-		return errors.Wrap(err, "walking patricia tree")
+		return nil, errors.Wrap(err, "walking patricia tree")
 	}
 
-	storedSnapshot.Issuances = make([]*storage.Snapshot_Issuance, 0, len(snapshot.Issuances))
-	for k, v := range snapshot.Issuances {
+	storedSnapshot.Issuances = encodeIssuances(snapshot.Issuances)
+
+	b, err := proto.Marshal(&storedSnapshot)
+	return b, errors.Wrap(err, "marshaling state snapshot")
+}
+
+func encodeSnapshotDelta(base *state.Snapshot, baseHeight uint64, snapshot *state.Snapshot) ([]byte, error) {
+	delta := storage.SnapshotDelta{BaseHeight: baseHeight}
+	added, removed := patricia.Diff(base.Tree, snapshot.Tree)
+	for _, l := range added {
+		hash := l.Hash
+		delta.Added = append(delta.Added, &storage.Snapshot_StateTreeNode{
+			Key:  l.Key,
+			Hash: hash[:],
+		})
+	}
+	delta.Removed = removed
+	delta.Issuances = encodeIssuances(snapshot.Issuances)
+
+	b, err := proto.Marshal(&delta)
+	return b, errors.Wrap(err, "marshaling state snapshot delta")
+}
+
+func encodeIssuances(issuances state.PriorIssuances) []*storage.Snapshot_Issuance {
+	stored := make([]*storage.Snapshot_Issuance, 0, len(issuances))
+	for k, v := range issuances {
 		hash := k
-		storedSnapshot.Issuances = append(storedSnapshot.Issuances, &storage.Snapshot_Issuance{
+		stored = append(stored, &storage.Snapshot_Issuance{
 			Hash:     hash[:],
 			ExpiryMs: v,
 		})
 	}
+	return stored
+}
 
-	b, err := proto.Marshal(&storedSnapshot)
+func storeStateSnapshot(ctx context.Context, db pg.DB, snapshot *state.Snapshot, blockHeight uint64) error {
+	b, err := EncodeSnapshot(snapshot)
 	if err != nil {
-		return errors.Wrap(err, "marshaling state snapshot")
+		return err
 	}
 
 	const insertQ = `
 		INSERT INTO snapshots (height, data) VALUES($1, $2)
-		ON CONFLICT (height) DO UPDATE SET data = $2
+		ON CONFLICT (height) DO UPDATE SET data = $2, base_height = NULL
 	`
 
 	_, err = db.Exec(ctx, insertQ, blockHeight, b)
 	return errors.Wrap(err, "writing state snapshot to database")
 }
 
-func getStateSnapshot(ctx context.Context, db pg.DB) (*state.Snapshot, uint64, error) {
-	const q = `
-		SELECT data, height FROM snapshots ORDER BY height DESC LIMIT 1
+// storeSnapshotDelta stores the changes from base, the snapshot
+// at baseHeight, to snapshot, at blockHeight.
+func storeSnapshotDelta(ctx context.Context, db pg.DB, base *state.Snapshot, baseHeight uint64, snapshot *state.Snapshot, blockHeight uint64) error {
+	b, err := encodeSnapshotDelta(base, baseHeight, snapshot)
+	if err != nil {
+		return err
+	}
+
+	const insertQ = `
+		INSERT INTO snapshots (height, data, base_height) VALUES($1, $2, $3)
+		ON CONFLICT (height) DO UPDATE SET data = $2, base_height = $3
 	`
-	var (
-		data   []byte
-		height uint64
-	)
 
-	err := db.QueryRow(ctx, q).Scan(&data, &height)
+	_, err = db.Exec(ctx, insertQ, blockHeight, b, baseHeight)
+	return errors.Wrap(err, "writing state snapshot delta to database")
+}
+
+// compactSnapshots deletes the delta snapshots from before
+// the full snapshot at height. They are no longer needed to
+// restore the latest state.
+func compactSnapshots(ctx context.Context, db pg.DB, height uint64) error {
+	const q = `DELETE FROM snapshots WHERE height < $1 AND base_height IS NOT NULL`
+	_, err := db.Exec(ctx, q, height)
+	return errors.Wrap(err, "deleting old snapshot deltas")
+}
+
+// getStateSnapshot returns the most recent state snapshot,
+// its height, and the number of deltas that were applied to
+// a full snapshot to produce it.
+func getStateSnapshot(ctx context.Context, db pg.DB) (*state.Snapshot, uint64, int, error) {
+	const q = `
+		SELECT height FROM snapshots ORDER BY height DESC LIMIT 1
+	`
+	var height uint64
+	err := db.QueryRow(ctx, q).Scan(&height)
 	if err == sql.ErrNoRows {
-		return state.Empty(), 0, nil
+		return state.Empty(), 0, 0, nil
 	} else if err != nil {
-		return nil, height, errors.Wrap(err, "retrieving state snapshot blob")
+		return nil, height, 0, errors.Wrap(err, "retrieving state snapshot height")
 	}
 
-	snapshot, err := DecodeSnapshot(data)
+	snapshot, parts, err := loadSnapshot(ctx, db, height)
 	if err != nil {
-		return nil, height, errors.Wrap(err, "decoding snapshot")
+		return nil, height, 0, err
+	}
+	return snapshot, height, len(parts) - 1, nil
+}
+
+// loadSnapshot returns the state snapshot at the provided height,
+// applying deltas to a full snapshot as necessary, and the parts
+// it was made from, oldest first.
+func loadSnapshot(ctx context.Context, db pg.DB, height uint64) (*state.Snapshot, []SnapshotPart, error) {
+	parts, err := getSnapshotChain(ctx, db, height)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var snapshot *state.Snapshot
+	for _, part := range parts {
+		data, err := getSnapshotPart(ctx, db, part.Height)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "retrieving state snapshot at height %d", part.Height)
+		}
+		if snapshot == nil {
+			snapshot, err = DecodeSnapshot(data)
+		} else {
+			err = ApplySnapshotDelta(snapshot, part.BaseHeight, data)
+		}
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "decoding state snapshot at height %d", part.Height)
+		}
+	}
+	return snapshot, parts, nil
+}
+
+// getSnapshotChain returns the parts needed to restore the
+// snapshot at the provided height, oldest first: a full
+// snapshot followed by zero or more deltas.
+func getSnapshotChain(ctx context.Context, db pg.DB, height uint64) ([]SnapshotPart, error) {
+	const q = `
+		SELECT COALESCE(base_height, 0), octet_length(data) FROM snapshots WHERE height = $1
+	`
+	var parts []SnapshotPart
+	for {
+		part := SnapshotPart{Height: height}
+		err := db.QueryRow(ctx, q, height).Scan(&part.BaseHeight, &part.Size)
+		if err == sql.ErrNoRows {
+			return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "no state snapshot at height %d", height)
+		} else if err != nil {
+			return nil, errors.Wrap(err, "retrieving state snapshot info")
+		}
+		parts = append([]SnapshotPart{part}, parts...)
+		if part.BaseHeight == 0 {
+			return parts, nil
+		}
+		height = part.BaseHeight
 	}
-	return snapshot, height, nil
 }
 
 // getRawSnapshot returns the raw, protobuf-encoded snapshot data at the
-// provided height.
+// provided height. If the snapshot is stored as a delta, it is restored
+// and encoded in full.
 func getRawSnapshot(ctx context.Context, db pg.DB, height uint64) (data []byte, err error) {
+	const q = `SELECT data, base_height IS NULL FROM snapshots WHERE height = $1`
+	var full bool
+	err = db.QueryRow(ctx, q, height).Scan(&data, &full)
+	if err == sql.ErrNoRows {
+		return nil, pg.ErrUserInputNotFound
+	} else if err != nil || full {
+		return data, err
+	}
+
+	snapshot, _, err := loadSnapshot(ctx, db, height)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeSnapshot(snapshot)
+}
+
+// getSnapshotPart returns the raw, protobuf-encoded data of the
+// snapshot or delta stored at the provided height.
+func getSnapshotPart(ctx context.Context, db pg.DB, height uint64) (data []byte, err error) {
 	const q = `SELECT data FROM snapshots WHERE height = $1`
 	err = db.QueryRow(ctx, q, height).Scan(&data)
 	if err == sql.ErrNoRows {
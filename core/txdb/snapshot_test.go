@@ -6,7 +6,9 @@ import (
 	"reflect"
 	"testing"
 
+	"chain/database/pg"
 	"chain/database/pg/pgtest"
+	"chain/errors"
 	"chain/protocol/bc"
 	"chain/protocol/state"
 )
@@ -97,7 +99,7 @@ func TestReadWriteStateSnapshot(t *testing.T) {
 			t.Fatalf("Error writing state snapshot to db: %s\n", err)
 		}
 
-		loadedSnapshot, height, err := getStateSnapshot(ctx, dbtx)
+		loadedSnapshot, height, _, err := getStateSnapshot(ctx, dbtx)
 		if err != nil {
 			t.Fatalf("Error reading state snapshot from db: %s\n", err)
 		}
@@ -121,6 +123,82 @@ func TestReadWriteStateSnapshot(t *testing.T) {
 	}
 }
 
+func TestSnapshotDelta(t *testing.T) {
+	base := state.Empty()
+	base.Tree.Insert([]byte("sup"), []byte{0x01})
+	base.Tree.Insert([]byte("dup"), []byte{0x02})
+	base.Issuances[bc.Hash{0x01}] = 1000
+
+	snapshot := state.Copy(base)
+	snapshot.Tree.Insert([]byte("sup"), []byte{0x03})
+	snapshot.Tree.Insert([]byte("hello"), []byte{0x04})
+	snapshot.Tree.Delete([]byte("dup"))
+	snapshot.Issuances[bc.Hash{0x02}] = 2000
+
+	data, err := encodeSnapshotDelta(base, 5, snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ApplySnapshotDelta(state.Copy(base), 4, data)
+	if err == nil {
+		t.Error("applying delta to the wrong base succeeded")
+	}
+
+	got := state.Copy(base)
+	err = ApplySnapshotDelta(got, 5, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Tree.RootHash() != snapshot.Tree.RootHash() {
+		t.Errorf("got root %s want %s", got.Tree.RootHash(), snapshot.Tree.RootHash())
+	}
+	if !reflect.DeepEqual(got.Issuances, snapshot.Issuances) {
+		t.Errorf("got issuances %#v want %#v", got.Issuances, snapshot.Issuances)
+	}
+}
+
+func TestSaveSnapshotDeltas(t *testing.T) {
+	dbtx := pgtest.NewTx(t)
+	ctx := context.Background()
+	store := NewStore(dbtx)
+
+	snapshot := state.Empty()
+	for i := uint64(1); i <= maxSnapshotDeltas+3; i++ {
+		snapshot = state.Copy(snapshot)
+		err := snapshot.Tree.Insert([]byte{byte(i)}, []byte{byte(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = store.SaveSnapshot(ctx, i, snapshot)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, height, err := NewStore(dbtx).LatestSnapshot(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if height != i || got.Tree.RootHash() != snapshot.Tree.RootHash() {
+			t.Fatalf("%d: got snapshot at %d with root %s, want root %s", i, height, got.Tree.RootHash(), snapshot.Tree.RootHash())
+		}
+	}
+
+	// The first snapshot was stored in full, followed by
+	// deltas, then another full snapshot that replaced them.
+	parts, err := store.SnapshotChain(ctx, maxSnapshotDeltas+3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 2 || parts[0].Height != maxSnapshotDeltas+2 || parts[0].BaseHeight != 0 {
+		t.Errorf("got snapshot parts %+v, want a full snapshot at %d and one delta", parts, maxSnapshotDeltas+2)
+	}
+	_, err = store.GetSnapshotPart(ctx, 2)
+	if errors.Root(err) != pg.ErrUserInputNotFound {
+		t.Errorf("got error %v for compacted delta, want %s", err, pg.ErrUserInputNotFound)
+	}
+}
+
 func BenchmarkStoreSnapshot100(b *testing.B) {
 	benchmarkStoreSnapshot(100, 100, b)
 }
@@ -2,9 +2,12 @@ package txdb
 
 import (
 	"context"
+	"sync"
 
+	"chain/core/leader"
 	"chain/database/pg"
 	"chain/errors"
+	"chain/log"
 	"chain/protocol"
 	"chain/protocol/bc"
 	"chain/protocol/state"
@@ -17,8 +20,20 @@ type Store struct {
 	db pg.DB
 
 	cache blockCache
+
+	// The most recently stored or loaded snapshot, from
+	// which the next snapshot is stored as a delta.
+	snapshotMu     sync.Mutex
+	lastSnapshot   *state.Snapshot
+	lastSnapHeight uint64
+	deltas         int // since the last full snapshot
 }
 
+// maxSnapshotDeltas is the most delta snapshots stored
+// after a full snapshot. The next snapshot is stored in
+// full, and the deltas before it are deleted.
+const maxSnapshotDeltas = 10
+
 var _ protocol.Store = (*Store)(nil)
 
 // NewStore creates and returns a new Store object.
@@ -27,18 +42,18 @@ var _ protocol.Store = (*Store)(nil)
 // and more convenient to use package chain/protocol/memstore
 // instead.
 func NewStore(db pg.DB) *Store {
-	return &Store{
-		db: db,
-		cache: newBlockCache(func(height uint64) (*bc.Block, error) {
-			const q = `SELECT data FROM blocks WHERE height = $1`
-			var b bc.Block
-			err := db.QueryRow(context.Background(), q, height).Scan(&b)
-			if err != nil {
-				return nil, errors.Wrap(err, "select query")
-			}
-			return &b, nil
-		}),
-	}
+	s := &Store{db: db}
+	s.cache = newBlockCache(func(height uint64) (*bc.Block, error) {
+		ctx := context.Background()
+		const q = `SELECT data FROM blocks WHERE height = $1`
+		var b bc.Block
+		err := db.QueryRow(ctx, q, height).Scan(&b)
+		if err != nil {
+			return nil, errors.Wrap(s.missingBlock(ctx, height, err), "select query")
+		}
+		return &b, nil
+	})
+	return s
 }
 
 // Height returns the height of the blockchain.
@@ -59,7 +74,17 @@ func (s *Store) GetBlock(ctx context.Context, height uint64) (*bc.Block, error)
 // LatestSnapshot returns the most recent state snapshot stored in
 // the database and its corresponding block height.
 func (s *Store) LatestSnapshot(ctx context.Context) (*state.Snapshot, uint64, error) {
-	return getStateSnapshot(ctx, s.db)
+	snapshot, height, deltas, err := getStateSnapshot(ctx, s.db)
+	if err != nil || height == 0 {
+		return snapshot, height, err
+	}
+
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+	s.lastSnapshot = state.Copy(snapshot)
+	s.lastSnapHeight = height
+	s.deltas = deltas
+	return snapshot, height, nil
 }
 
 // LatestSnapshotInfo returns the height and size of the most recent
@@ -79,26 +104,81 @@ func (s *Store) GetSnapshot(ctx context.Context, height uint64) ([]byte, error)
 	return getRawSnapshot(ctx, s.db, height)
 }
 
+// SnapshotChain returns the stored parts needed to restore the
+// state snapshot at the provided height, oldest first: a full
+// snapshot followed by zero or more deltas. See GetSnapshotPart,
+// DecodeSnapshot and ApplySnapshotDelta.
+func (s *Store) SnapshotChain(ctx context.Context, height uint64) ([]SnapshotPart, error) {
+	return getSnapshotChain(ctx, s.db, height)
+}
+
+// GetSnapshotPart returns the full or delta snapshot stored at
+// the provided height, in Chain Core's binary protobuf representation.
+func (s *Store) GetSnapshotPart(ctx context.Context, height uint64) ([]byte, error) {
+	return getSnapshotPart(ctx, s.db, height)
+}
+
 // SaveBlock persists a new block in the database.
+// If ctx belongs to a leader that has since been deposed,
+// it returns leader.ErrFenced.
 func (s *Store) SaveBlock(ctx context.Context, block *bc.Block) error {
-	const q = `
+	fence, fenceArgs := leader.Fence(ctx, 5)
+	q := `
 		INSERT INTO blocks (block_hash, height, data, header)
-		VALUES ($1, $2, $3, $4)
+		SELECT $1::text, $2::bigint, $3::bytea, $4::bytea WHERE ` + fence + `
 		ON CONFLICT (block_hash) DO NOTHING
 	`
-	_, err := s.db.Exec(ctx, q, block.Hash(), block.Height, block, &block.BlockHeader)
+	args := append([]interface{}{block.Hash(), block.Height, block, &block.BlockHeader}, fenceArgs...)
+	res, err := s.db.Exec(ctx, q, args...)
+	if err != nil {
+		return errors.Wrap(err, "insert block")
+	}
+	n, err := res.RowsAffected()
 	if err != nil {
 		return errors.Wrap(err, "insert block")
 	}
+	if n == 0 {
+		// Either the block was already saved, or
+		// this process is no longer the leader.
+		err = leader.CheckFence(ctx, s.db)
+		if err != nil {
+			return err
+		}
+	}
 
 	s.cache.add(block)
 	return nil
 }
 
 // SaveSnapshot saves a state snapshot to the database.
+// Most snapshots are stored as deltas from the previous one;
+// see maxSnapshotDeltas.
 func (s *Store) SaveSnapshot(ctx context.Context, height uint64, snapshot *state.Snapshot) error {
-	err := storeStateSnapshot(ctx, s.db, snapshot, height)
-	return errors.Wrap(err, "saving state tree")
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+
+	var err error
+	if s.lastSnapshot == nil || height <= s.lastSnapHeight || s.deltas >= maxSnapshotDeltas {
+		err = storeStateSnapshot(ctx, s.db, snapshot, height)
+		if err != nil {
+			return errors.Wrap(err, "saving state tree")
+		}
+		s.deltas = 0
+		err = compactSnapshots(ctx, s.db, height)
+		if err != nil {
+			// The deltas can be deleted next time.
+			log.Error(ctx, err)
+		}
+	} else {
+		err = storeSnapshotDelta(ctx, s.db, s.lastSnapshot, s.lastSnapHeight, snapshot, height)
+		if err != nil {
+			return errors.Wrap(err, "saving state tree delta")
+		}
+		s.deltas++
+	}
+	s.lastSnapshot = snapshot
+	s.lastSnapHeight = height
+	return nil
 }
 
 func (s *Store) FinalizeBlock(ctx context.Context, height uint64) error {
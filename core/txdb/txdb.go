@@ -49,5 +49,8 @@ func (s *Store) GetRawBlock(ctx context.Context, height uint64) ([]byte, error)
 	const q = `SELECT data FROM blocks WHERE height = $1`
 	var block []byte
 	err := s.db.QueryRow(ctx, q, height).Scan(&block)
-	return block, errors.Wrap(err, "querying blocks from the db")
+	if err != nil {
+		return nil, errors.Wrap(s.missingBlock(ctx, height, err), "querying blocks from the db")
+	}
+	return block, nil
 }
@@ -0,0 +1,266 @@
+// Package txstatus tracks transactions submitted to this Core
+// until they're confirmed or fail.
+//
+// Submitted transactions are saved, so that the leader can
+// resubmit them until they're confirmed or fail. A transaction
+// dropped from the generator's pool, because the generator
+// restarted or leadership moved, isn't lost.
+package txstatus
+
+import (
+	"context"
+	stdsql "database/sql"
+	"time"
+
+	"github.com/lib/pq"
+
+	"chain/core/fetch"
+	"chain/core/generator"
+	"chain/core/pin"
+	"chain/core/txbuilder"
+	"chain/database/pg"
+	"chain/errors"
+	"chain/log"
+	"chain/protocol"
+	"chain/protocol/bc"
+)
+
+// PinName is used to identify the pin associated
+// with the submitted transaction tracker.
+const PinName = "submitted-txs"
+
+// The states of a submitted transaction.
+const (
+	// Pending means the transaction was submitted, but
+	// isn't known to be in the pool or a block yet.
+	Pending = "pending"
+
+	// InPool means the transaction is waiting in the
+	// generator's pool to be included in a block.
+	InPool = "in_pool"
+
+	// Confirmed means the transaction is in a block.
+	Confirmed = "confirmed"
+
+	// Failed means the transaction can't be confirmed,
+	// because it's invalid, was refused by the generator,
+	// or its max time has passed.
+	Failed = "failed"
+)
+
+// Pool is the generator's transaction pool.
+// It's satisfied by *generator.Gate.
+type Pool interface {
+	Contains(bc.Hash) bool
+	Refusal(bc.Hash) error
+}
+
+// Status is the state of a submitted transaction.
+type Status struct {
+	ID              bc.Hash `json:"id"`
+	Status          string  `json:"status"`
+	SubmittedHeight uint64  `json:"submitted_height"`
+	BlockHeight     uint64  `json:"block_height,omitempty"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// Tracker tracks the state of submitted transactions.
+type Tracker struct {
+	db       pg.DB
+	chain    *protocol.Chain
+	pinStore *pin.Store
+	pool     Pool
+}
+
+// NewTracker returns a Tracker. The pool is nil
+// unless this Core is the generator.
+func NewTracker(db pg.DB, chain *protocol.Chain, pinStore *pin.Store, pool Pool) *Tracker {
+	return &Tracker{
+		db:       db,
+		chain:    chain,
+		pinStore: pinStore,
+		pool:     pool,
+	}
+}
+
+// ProcessBlocks marks submitted transactions confirmed as
+// the blocks they're in land. It blocks until the context
+// is canceled.
+func (t *Tracker) ProcessBlocks(ctx context.Context) {
+	if t.pinStore == nil {
+		return
+	}
+	t.pinStore.ProcessBlocks(ctx, t.chain, PinName, t.markConfirmed)
+}
+
+func (t *Tracker) markConfirmed(ctx context.Context, b *bc.Block) error {
+	var hashes pq.ByteaArray
+	for _, tx := range b.Transactions {
+		hashes = append(hashes, tx.Hash[:])
+	}
+	const q = `
+		UPDATE submitted_txs SET confirmed_in = $1, failure = NULL
+		WHERE tx_hash = ANY($2::bytea[]) AND confirmed_in IS NULL
+	`
+	_, err := t.db.Exec(ctx, q, b.Height, hashes)
+	return errors.Wrap(err, "marking submitted txs confirmed")
+}
+
+// Final returns whether err, returned when submitting a
+// transaction, means the transaction can never be confirmed.
+func Final(err error) bool {
+	switch errors.Root(err) {
+	case txbuilder.ErrRejected, generator.ErrRefused:
+		return true
+	}
+	return false
+}
+
+// Track saves tx, which must already be recorded in
+// submitted_txs, so that Resubmit can resubmit it.
+func (t *Tracker) Track(ctx context.Context, tx *bc.Tx) error {
+	const q = `UPDATE submitted_txs SET data = $2 WHERE tx_hash = $1 AND data IS NULL`
+	_, err := t.db.Exec(ctx, q, tx.Hash[:], &tx.TxData)
+	return errors.Wrap(err, "saving submitted tx")
+}
+
+// Fail records that the submitted transaction with the
+// given hash failed with err, unless it's confirmed.
+func (t *Tracker) Fail(ctx context.Context, hash bc.Hash, err error) error {
+	reason := err.Error()
+	if detail := errors.Detail(err); detail != "" {
+		reason = detail
+	}
+	const q = `
+		UPDATE submitted_txs SET failure = $2
+		WHERE tx_hash = $1 AND confirmed_in IS NULL
+	`
+	_, err = t.db.Exec(ctx, q, hash[:], reason)
+	return errors.Wrap(err, "recording failed tx")
+}
+
+// Status returns the state of the submitted transaction with
+// the given hash. If the transaction wasn't submitted to this
+// Core, or was submitted too long ago to be tracked, it returns
+// pg.ErrUserInputNotFound.
+func (t *Tracker) Status(ctx context.Context, hash bc.Hash) (*Status, error) {
+	const q = `
+		SELECT height, confirmed_in, failure FROM submitted_txs WHERE tx_hash = $1
+	`
+	var (
+		s           = &Status{ID: hash, Status: Pending}
+		confirmedIn stdsql.NullInt64
+		failure     stdsql.NullString
+	)
+	err := t.db.QueryRow(ctx, q, hash[:]).Scan(&s.SubmittedHeight, &confirmedIn, &failure)
+	if err == stdsql.ErrNoRows {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "transaction id: %s", hash)
+	} else if err != nil {
+		return nil, errors.Wrap(err, "loading submitted tx")
+	}
+
+	switch {
+	case confirmedIn.Valid:
+		s.Status = Confirmed
+		s.BlockHeight = uint64(confirmedIn.Int64)
+	case failure.Valid:
+		s.Status = Failed
+		s.Error = failure.String
+	case t.pool != nil && t.pool.Refusal(hash) != nil:
+		s.Status = Failed
+		s.Error = errors.Detail(t.pool.Refusal(hash))
+	case t.pool != nil && t.pool.Contains(hash):
+		s.Status = InPool
+	}
+	return s, nil
+}
+
+// Resubmit resubmits the pending transactions saved by Track
+// every period, until each is confirmed, is rejected or refused,
+// or its max time passes. Those that fail are marked failed, so
+// Status reports why. It's run by the leader, and blocks until
+// the context is canceled.
+func (t *Tracker) Resubmit(ctx context.Context, s txbuilder.Submitter, period time.Duration) {
+	// A light client must watch the pending
+	// transactions to see them confirmed.
+	watches := make(map[bc.Hash]func())
+	defer func() {
+		for _, unwatch := range watches {
+			unwatch()
+		}
+	}()
+
+	ticks := time.Tick(period)
+	for {
+		pending, err := t.resubmitPending(ctx, s)
+		if err != nil {
+			log.Error(ctx, err)
+		} else {
+			for hash, unwatch := range watches {
+				if !pending[hash] {
+					unwatch()
+					delete(watches, hash)
+				}
+			}
+			for hash := range pending {
+				if watches[hash] == nil {
+					watches[hash] = fetch.WatchTx(hash)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Messagef(ctx, "Deposed, Resubmit exiting")
+			return
+		case <-ticks:
+		}
+	}
+}
+
+// resubmitPending resubmits each pending transaction once,
+// and returns the hashes of those still pending.
+func (t *Tracker) resubmitPending(ctx context.Context, s txbuilder.Submitter) (map[bc.Hash]bool, error) {
+	// Wait for the confirmations in the blocks this Core has to be
+	// recorded, so confirmed transactions aren't resubmitted and
+	// rejected as double spends.
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-t.pinStore.PinWaiter(PinName, t.chain.Height()):
+	}
+
+	const q = `
+		SELECT data FROM submitted_txs
+		WHERE data IS NOT NULL AND confirmed_in IS NULL AND failure IS NULL
+	`
+	var txs []*bc.Tx
+	err := pg.ForQueryRows(ctx, t.db, q, func(data bc.TxData) {
+		txs = append(txs, bc.NewTx(data))
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "loading pending txs")
+	}
+
+	latest, _ := t.chain.State()
+	pending := make(map[bc.Hash]bool, len(txs))
+	for _, tx := range txs {
+		if latest != nil && tx.MaxTime > 0 && tx.MaxTime < latest.TimestampMS {
+			err = errors.WithDetail(txbuilder.ErrRejected, "transaction max time exceeded")
+		} else {
+			err = txbuilder.FinalizeTx(ctx, t.chain, s, tx)
+		}
+		if Final(err) {
+			err = t.Fail(ctx, tx.Hash, err)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		} else if err != nil {
+			// Try again next time.
+			log.Error(ctx, err, "resubmitting tx ", tx.Hash)
+		}
+		pending[tx.Hash] = true
+	}
+	return pending, nil
+}
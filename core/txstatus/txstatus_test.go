@@ -0,0 +1,118 @@
+package txstatus
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"chain/core/pin"
+	"chain/database/pg"
+	"chain/database/pg/pgtest"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/mempool"
+	"chain/protocol/prottest"
+	"chain/testutil"
+)
+
+type testPool map[bc.Hash]bool
+
+func (p testPool) Contains(hash bc.Hash) bool { return p[hash] }
+func (p testPool) Refusal(hash bc.Hash) error { return nil }
+
+func TestStatus(t *testing.T) {
+	var (
+		_, db   = pgtest.NewDB(t, pgtest.SchemaPath)
+		ctx     = context.Background()
+		pool    = make(testPool)
+		tracker = NewTracker(db, prottest.NewChain(t), nil, pool)
+		tx      = bc.NewTx(bc.TxData{Version: 1, ReferenceData: []byte("status")})
+	)
+
+	_, err := tracker.Status(ctx, tx.Hash)
+	if errors.Root(err) != pg.ErrUserInputNotFound {
+		t.Errorf("got error %v for unsubmitted tx, want %s", err, pg.ErrUserInputNotFound)
+	}
+
+	_, err = db.Exec(ctx, `INSERT INTO submitted_txs (tx_hash, height) VALUES ($1, 3)`, tx.Hash[:])
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	check := func(want Status) {
+		got, err := tracker.Status(ctx, tx.Hash)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if *got != want {
+			t.Errorf("got status %+v want %+v", *got, want)
+		}
+	}
+	check(Status{ID: tx.Hash, Status: Pending, SubmittedHeight: 3})
+
+	pool[tx.Hash] = true
+	check(Status{ID: tx.Hash, Status: InPool, SubmittedHeight: 3})
+
+	err = tracker.Fail(ctx, tx.Hash, errors.WithDetail(errors.New("rejected"), "bad signature"))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	check(Status{ID: tx.Hash, Status: Failed, SubmittedHeight: 3, Error: "bad signature"})
+
+	err = tracker.markConfirmed(ctx, &bc.Block{
+		BlockHeader:  bc.BlockHeader{Height: 5},
+		Transactions: []*bc.Tx{tx},
+	})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	check(Status{ID: tx.Hash, Status: Confirmed, SubmittedHeight: 3, BlockHeight: 5})
+}
+
+func TestResubmitPending(t *testing.T) {
+	var (
+		_, db    = pgtest.NewDB(t, pgtest.SchemaPath)
+		ctx      = context.Background()
+		c        = prottest.NewChain(t)
+		pinStore = pin.NewStore(db)
+		tracker  = NewTracker(db, c, pinStore, nil)
+
+		expired = bc.NewTx(bc.TxData{Version: 1, MaxTime: 1})
+		// Without a sighash commitment, FinalizeTx fails,
+		// but not finally, so this one stays pending.
+		pending = bc.NewTx(bc.TxData{
+			Version: 1,
+			Inputs:  []*bc.TxInput{bc.NewSpendInput(bc.Hash{1}, 0, nil, bc.AssetID{}, 1, nil, nil)},
+		})
+	)
+	err := pinStore.CreatePin(ctx, PinName, c.Height())
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	for _, tx := range []*bc.Tx{expired, pending} {
+		_, err = db.Exec(ctx, `INSERT INTO submitted_txs (tx_hash, height) VALUES ($1, 1)`, tx.Hash[:])
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		err = tracker.Track(ctx, tx)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+	}
+
+	got, err := tracker.resubmitPending(ctx, mempool.New())
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	want := map[bc.Hash]bool{pending.Hash: true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got pending %v want %v", got, want)
+	}
+
+	status, err := tracker.Status(ctx, expired.Hash)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if status.Status != Failed || status.Error != "transaction max time exceeded" {
+		t.Errorf("got expired tx status %+v, want failed", *status)
+	}
+}
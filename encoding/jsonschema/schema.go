@@ -0,0 +1,391 @@
+// Package jsonschema validates JSON documents against
+// a subset of JSON Schema (draft 4).
+//
+// The supported keywords are type, enum, properties,
+// required, additionalProperties (as a boolean), items
+// (as a single schema), minItems, maxItems, minLength,
+// maxLength, pattern, minimum and maximum.
+//
+// Parse rejects schemas that use other draft 4 keywords,
+// such as $ref, anyOf, or format, since silently ignoring
+// them would accept documents the schema's author meant
+// to refuse. Keywords that aren't part of draft 4 are
+// ignored, as the spec requires.
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"unicode/utf8"
+
+	"chain/errors"
+)
+
+var (
+	// ErrBadSchema is returned when a schema is malformed,
+	// uses a supported keyword incorrectly, or uses a
+	// draft 4 keyword this package does not support.
+	ErrBadSchema = errors.New("invalid JSON schema")
+
+	// ErrMismatch is returned when a document does not
+	// conform to a schema. The error's detail says where
+	// and how.
+	ErrMismatch = errors.New("document does not match JSON schema")
+)
+
+// Schema is a parsed JSON schema. It marshals to and from
+// its original JSON text.
+type Schema struct {
+	raw []byte
+
+	types      []string
+	enum       []interface{}
+	properties map[string]*Schema
+	required   []string
+	noExtra    bool // additionalProperties is false
+	items      *Schema
+	minItems   *int
+	maxItems   *int
+	minLength  *int
+	maxLength  *int
+	pattern    *regexp.Regexp
+	minimum    *float64
+	maximum    *float64
+}
+
+type schemaJSON struct {
+	Type                 json.RawMessage            `json:"type"`
+	Enum                 []interface{}              `json:"enum"`
+	Properties           map[string]json.RawMessage `json:"properties"`
+	Required             []string                   `json:"required"`
+	AdditionalProperties json.RawMessage            `json:"additionalProperties"`
+	Items                json.RawMessage            `json:"items"`
+	MinItems             *int                       `json:"minItems"`
+	MaxItems             *int                       `json:"maxItems"`
+	MinLength            *int                       `json:"minLength"`
+	MaxLength            *int                       `json:"maxLength"`
+	Pattern              *string                    `json:"pattern"`
+	Minimum              *float64                   `json:"minimum"`
+	Maximum              *float64                   `json:"maximum"`
+}
+
+// unsupported lists the draft 4 keywords this
+// package recognizes but does not implement.
+var unsupported = []string{
+	"$ref",
+	"additionalItems",
+	"allOf",
+	"anyOf",
+	"dependencies",
+	"exclusiveMaximum",
+	"exclusiveMinimum",
+	"format",
+	"maxProperties",
+	"minProperties",
+	"multipleOf",
+	"not",
+	"oneOf",
+	"patternProperties",
+	"uniqueItems",
+}
+
+var knownTypes = map[string]bool{
+	"array":   true,
+	"boolean": true,
+	"integer": true,
+	"null":    true,
+	"number":  true,
+	"object":  true,
+	"string":  true,
+}
+
+// Parse parses a JSON schema.
+func Parse(b []byte) (*Schema, error) {
+	s := new(Schema)
+	err := s.parse(b, "")
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Schema) parse(b []byte, path string) error {
+	var j schemaJSON
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	err := dec.Decode(&j)
+	if err != nil {
+		return errors.WithDetailf(ErrBadSchema, "at %s: %s", pathOrRoot(path), err)
+	}
+	s.raw = append([]byte(nil), b...)
+
+	var keywords map[string]json.RawMessage
+	json.Unmarshal(b, &keywords) // b is known to be an object
+	for _, k := range unsupported {
+		if _, ok := keywords[k]; ok {
+			return errors.WithDetailf(ErrBadSchema, "at %s: keyword %s is not supported", pathOrRoot(path), k)
+		}
+	}
+
+	if len(j.Type) > 0 {
+		var one string
+		if json.Unmarshal(j.Type, &one) == nil {
+			s.types = []string{one}
+		} else if err := json.Unmarshal(j.Type, &s.types); err != nil {
+			return errors.WithDetailf(ErrBadSchema, "at %s: type must be a string or array of strings", pathOrRoot(path))
+		}
+		for _, t := range s.types {
+			if !knownTypes[t] {
+				return errors.WithDetailf(ErrBadSchema, "at %s: unknown type %q", pathOrRoot(path), t)
+			}
+		}
+	}
+
+	s.enum = j.Enum
+	s.required = j.Required
+	if len(j.Properties) > 0 {
+		s.properties = make(map[string]*Schema, len(j.Properties))
+		for name, raw := range j.Properties {
+			sub := new(Schema)
+			err := sub.parse(raw, path+"/properties/"+name)
+			if err != nil {
+				return err
+			}
+			s.properties[name] = sub
+		}
+	}
+	if len(j.AdditionalProperties) > 0 {
+		var allowed bool
+		if err := json.Unmarshal(j.AdditionalProperties, &allowed); err != nil {
+			return errors.WithDetailf(ErrBadSchema, "at %s: additionalProperties must be a boolean", pathOrRoot(path))
+		}
+		s.noExtra = !allowed
+	}
+	if len(j.Items) > 0 {
+		s.items = new(Schema)
+		err := s.items.parse(j.Items, path+"/items")
+		if err != nil {
+			return err
+		}
+	}
+
+	s.minItems, s.maxItems = j.MinItems, j.MaxItems
+	s.minLength, s.maxLength = j.MinLength, j.MaxLength
+	s.minimum, s.maximum = j.Minimum, j.Maximum
+	if j.Pattern != nil {
+		s.pattern, err = regexp.Compile(*j.Pattern)
+		if err != nil {
+			return errors.WithDetailf(ErrBadSchema, "at %s: bad pattern: %s", pathOrRoot(path), err)
+		}
+	}
+	return nil
+}
+
+// MarshalJSON returns the schema's original JSON text.
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	if s == nil || len(s.raw) == 0 {
+		return []byte("null"), nil
+	}
+	return s.raw, nil
+}
+
+// UnmarshalJSON parses a JSON schema.
+func (s *Schema) UnmarshalJSON(b []byte) error {
+	*s = Schema{}
+	return s.parse(b, "")
+}
+
+// Validate checks that the JSON document doc conforms to s.
+func (s *Schema) Validate(doc []byte) error {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+	err := dec.Decode(&v)
+	if err != nil {
+		return errors.WithDetailf(ErrMismatch, "document is not valid JSON: %s", err)
+	}
+	return s.ValidateValue(v)
+}
+
+// ValidateValue checks that v conforms to s. The value v
+// is of the form produced by encoding/json when decoding
+// into an interface{}, with or without UseNumber.
+func (s *Schema) ValidateValue(v interface{}) error {
+	return s.validate(v, "")
+}
+
+func (s *Schema) validate(v interface{}, path string) error {
+	mismatch := func(format string, args ...interface{}) error {
+		return errors.WithDetailf(ErrMismatch, "at %s: %s", pathOrRoot(path), fmt.Sprintf(format, args...))
+	}
+
+	if len(s.types) > 0 {
+		var ok bool
+		for _, t := range s.types {
+			if hasType(v, t) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return mismatch("got %s, want %s", typeName(v), typeList(s.types))
+		}
+	}
+
+	if s.enum != nil {
+		var ok bool
+		for _, e := range s.enum {
+			if equal(v, e) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return mismatch("value is not one of the allowed values")
+		}
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, name := range s.required {
+			if _, ok := v[name]; !ok {
+				return mismatch("missing required property %q", name)
+			}
+		}
+		for name, pv := range v {
+			sub, ok := s.properties[name]
+			if !ok {
+				if s.noExtra {
+					return mismatch("property %q is not allowed", name)
+				}
+				continue
+			}
+			err := sub.validate(pv, path+"/"+name)
+			if err != nil {
+				return err
+			}
+		}
+
+	case []interface{}:
+		if s.minItems != nil && len(v) < *s.minItems {
+			return mismatch("array has %d items, want at least %d", len(v), *s.minItems)
+		}
+		if s.maxItems != nil && len(v) > *s.maxItems {
+			return mismatch("array has %d items, want at most %d", len(v), *s.maxItems)
+		}
+		if s.items != nil {
+			for i, item := range v {
+				err := s.items.validate(item, path+"/"+strconv.Itoa(i))
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.minLength != nil && n < *s.minLength {
+			return mismatch("string has length %d, want at least %d", n, *s.minLength)
+		}
+		if s.maxLength != nil && n > *s.maxLength {
+			return mismatch("string has length %d, want at most %d", n, *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			return mismatch("string does not match pattern %q", s.pattern.String())
+		}
+
+	case json.Number, float64:
+		f, _ := toFloat(v)
+		if s.minimum != nil && f < *s.minimum {
+			return mismatch("%v is less than the minimum %v", f, *s.minimum)
+		}
+		if s.maximum != nil && f > *s.maximum {
+			return mismatch("%v is greater than the maximum %v", f, *s.maximum)
+		}
+	}
+	return nil
+}
+
+func hasType(v interface{}, t string) bool {
+	switch t {
+	case "null":
+		return v == nil
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "object":
+		_, ok := v.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := v.([]interface{})
+		return ok
+	case "number":
+		_, ok := toFloat(v)
+		return ok
+	case "integer":
+		if n, ok := v.(json.Number); ok {
+			_, err := n.Int64()
+			return err == nil
+		}
+		f, ok := v.(float64)
+		return ok && f == float64(int64(f))
+	}
+	return false
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	return "number"
+}
+
+func typeList(types []string) string {
+	if len(types) == 1 {
+		return types[0]
+	}
+	return fmt.Sprintf("one of %v", types)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func equal(a, b interface{}) bool {
+	fa, aNum := toFloat(a)
+	fb, bNum := toFloat(b)
+	if aNum || bNum {
+		return aNum && bNum && fa == fb
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func pathOrRoot(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
@@ -0,0 +1,112 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"testing"
+
+	"chain/errors"
+)
+
+func TestValidate(t *testing.T) {
+	schema, err := Parse([]byte(`{
+		"type": "object",
+		"required": ["invoice", "lines"],
+		"additionalProperties": false,
+		"properties": {
+			"invoice": {"type": "string", "pattern": "^INV-[0-9]+$"},
+			"memo": {"type": ["string", "null"], "maxLength": 5},
+			"priority": {"enum": ["low", "high"]},
+			"lines": {
+				"type": "array",
+				"minItems": 1,
+				"items": {"type": "integer", "minimum": 1, "maximum": 100}
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		doc  string
+		want error
+	}{
+		{`{"invoice": "INV-1", "lines": [1, 2]}`, nil},
+		{`{"invoice": "INV-1", "lines": [1], "memo": null, "priority": "high"}`, nil},
+		{`{"invoice": "INV-1"}`, ErrMismatch},
+		{`{"invoice": "1", "lines": [1]}`, ErrMismatch},
+		{`{"invoice": "INV-1", "lines": []}`, ErrMismatch},
+		{`{"invoice": "INV-1", "lines": [1.5]}`, ErrMismatch},
+		{`{"invoice": "INV-1", "lines": [101]}`, ErrMismatch},
+		{`{"invoice": "INV-1", "lines": [1], "memo": "too long"}`, ErrMismatch},
+		{`{"invoice": "INV-1", "lines": [1], "priority": "medium"}`, ErrMismatch},
+		{`{"invoice": "INV-1", "lines": [1], "extra": true}`, ErrMismatch},
+		{`[]`, ErrMismatch},
+		{`not json`, ErrMismatch},
+	}
+	for _, c := range cases {
+		err := schema.Validate([]byte(c.doc))
+		if errors.Root(err) != c.want {
+			t.Errorf("Validate(%s) = %v want %v", c.doc, err, c.want)
+		}
+	}
+}
+
+func TestBadSchema(t *testing.T) {
+	cases := []string{
+		`[]`,
+		`{"type": "widget"}`,
+		`{"type": 5}`,
+		`{"pattern": "("}`,
+		`{"properties": {"a": {"type": "widget"}}}`,
+		`{"additionalProperties": {}}`,
+		`{"additionalProperties": {"type": "string"}}`,
+		`{"$ref": "#/definitions/a"}`,
+		`{"allOf": [{"type": "string"}]}`,
+		`{"anyOf": [{"type": "string"}]}`,
+		`{"oneOf": [{"type": "string"}]}`,
+		`{"not": {"type": "string"}}`,
+		`{"minimum": 0, "exclusiveMinimum": true}`,
+		`{"maximum": 0, "exclusiveMaximum": true}`,
+		`{"uniqueItems": true}`,
+		`{"format": "date-time"}`,
+		`{"patternProperties": {"^a": {}}}`,
+		`{"properties": {"a": {"format": "email"}}}`,
+		`{"items": {"$ref": "#"}}`,
+	}
+	for _, c := range cases {
+		_, err := Parse([]byte(c))
+		if errors.Root(err) != ErrBadSchema {
+			t.Errorf("Parse(%s) = %v want %v", c, err, ErrBadSchema)
+		}
+	}
+}
+
+func TestIgnoreUnknownKeywords(t *testing.T) {
+	schema, err := Parse([]byte(`{"title": "t", "x-extension": 1, "type": "string"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errors.Root(schema.Validate([]byte(`5`))) != ErrMismatch {
+		t.Error("schema with unknown keywords accepted a number")
+	}
+}
+
+func TestSchemaJSON(t *testing.T) {
+	const text = `{"type":"object","required":["a"]}`
+	var s Schema
+	err := json.Unmarshal([]byte(text), &s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != text {
+		t.Errorf("marshaled schema = %s want %s", b, text)
+	}
+	if errors.Root(s.Validate([]byte(`{}`))) != ErrMismatch {
+		t.Error("unmarshaled schema accepted document missing required property")
+	}
+}
@@ -56,6 +56,11 @@ func (b *Block) UnmarshalText(text []byte) error {
 	return b.readFrom(bytes.NewReader(decoded))
 }
 
+// UnmarshalBinary fulfills the encoding.BinaryUnmarshaler interface.
+func (b *Block) UnmarshalBinary(data []byte) error {
+	return b.readFrom(bytes.NewReader(data))
+}
+
 // Scan fulfills the sql.Scanner interface.
 func (b *Block) Scan(val interface{}) error {
 	buf, ok := val.([]byte)
@@ -181,6 +186,32 @@ func (bh *BlockHeader) Value() (driver.Value, error) {
 	return buf.Bytes(), nil
 }
 
+// MarshalText fulfills the json.Marshaler interface.
+// The header is encoded as hex, including its witness.
+func (bh *BlockHeader) MarshalText() ([]byte, error) {
+	buf := bufpool.Get()
+	defer bufpool.Put(buf)
+	_, err := bh.WriteTo(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	enc := make([]byte, hex.EncodedLen(buf.Len()))
+	hex.Encode(enc, buf.Bytes())
+	return enc, nil
+}
+
+// UnmarshalText fulfills the encoding.TextUnmarshaler interface.
+func (bh *BlockHeader) UnmarshalText(text []byte) error {
+	decoded := make([]byte, hex.DecodedLen(len(text)))
+	_, err := hex.Decode(decoded, text)
+	if err != nil {
+		return err
+	}
+	_, err = bh.readFrom(bytes.NewReader(decoded))
+	return err
+}
+
 // Hash returns complete hash of the block header.
 func (bh *BlockHeader) Hash() Hash {
 	h := sha3pool.Get256()
@@ -85,6 +85,30 @@ func TestMarshalBlock(t *testing.T) {
 	}
 }
 
+func TestMarshalBlockHeader(t *testing.T) {
+	bh := &BlockHeader{
+		Version:          1,
+		Height:           2,
+		TimestampMS:      3,
+		AssetsMerkleRoot: Hash{4},
+		ConsensusProgram: []byte{5},
+		Witness:          [][]byte{{6}},
+	}
+	got, err := json.Marshal(bh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var c BlockHeader
+	err = json.Unmarshal(got, &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*bh, c) {
+		t.Errorf("expected marshaled/unmarshaled block header to be:\n%sgot:\n%s", spew.Sdump(*bh), spew.Sdump(c))
+	}
+}
+
 func TestEmptyBlock(t *testing.T) {
 	block := Block{
 		BlockHeader: BlockHeader{
@@ -7,6 +7,11 @@ func Millis(t time.Time) uint64 {
 	return uint64(t.UnixNano()) / uint64(time.Millisecond)
 }
 
+// Time converts a number of milliseconds since 1970 to a time.Time.
+func Time(ms uint64) time.Time {
+	return time.Unix(0, int64(ms*uint64(time.Millisecond))).UTC()
+}
+
 // DurationMillis converts a time.Duration to a number of milliseconds.
 func DurationMillis(d time.Duration) uint64 {
 	return uint64(d / time.Millisecond)
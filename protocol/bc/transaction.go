@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"strconv"
 
 	"chain/crypto/sha3pool"
@@ -210,23 +211,41 @@ func (tx *TxData) Hash() Hash {
 // transactions hash and signature data hash.
 // It is used to compute the TxRoot of a block.
 func (tx *Tx) WitnessHash() (hash Hash) {
-	hasher := sha3pool.Get256()
-	defer sha3pool.Put256(hasher)
+	return WitnessHashFromDigests(tx.Hash, tx.WitnessDigests())
+}
 
-	hasher.Write(tx.Hash[:])
+// WitnessDigests returns the hashes of tx's input and
+// output witnesses, in the form in which they are combined
+// with tx's hash to compute its witness hash. Together with
+// the transaction hash, they let a verifier recompute the
+// witness hash without the full transaction.
+func (tx *Tx) WitnessDigests() []byte {
+	var buf bytes.Buffer
 
-	blockchain.WriteVarint31(hasher, uint64(len(tx.Inputs))) // TODO(bobg): check and return error
+	blockchain.WriteVarint31(&buf, uint64(len(tx.Inputs))) // TODO(bobg): check and return error
 	for _, txin := range tx.Inputs {
 		h := txin.witnessHash()
-		hasher.Write(h[:])
+		buf.Write(h[:])
 	}
 
-	blockchain.WriteVarint31(hasher, uint64(len(tx.Outputs))) // TODO(bobg): check and return error
+	blockchain.WriteVarint31(&buf, uint64(len(tx.Outputs))) // TODO(bobg): check and return error
 	for _, txout := range tx.Outputs {
 		h := txout.witnessHash()
-		hasher.Write(h[:])
+		buf.Write(h[:])
 	}
 
+	return buf.Bytes()
+}
+
+// WitnessHashFromDigests computes the witness hash of the
+// transaction with hash txHash and witness digests digests,
+// as returned by Tx.WitnessDigests.
+func WitnessHashFromDigests(txHash Hash, digests []byte) (hash Hash) {
+	hasher := sha3pool.Get256()
+	defer sha3pool.Put256(hasher)
+
+	hasher.Write(txHash[:])
+	hasher.Write(digests)
 	hasher.Read(hash[:])
 	return hash
 }
@@ -320,6 +339,13 @@ func (tx *TxData) WriteTo(w io.Writer) (int64, error) {
 	return ew.Written(), ew.Err()
 }
 
+// SerializedSize returns the number of bytes WriteTo
+// writes for tx.
+func (tx *TxData) SerializedSize() int {
+	n, _ := tx.WriteTo(ioutil.Discard)
+	return int(n)
+}
+
 // assumes w has sticky errors
 func (tx *TxData) writeTo(w io.Writer, serflags byte) {
 	w.Write([]byte{serflags})
@@ -15,7 +15,8 @@ import (
 )
 
 // maxBlockTxs limits the number of transactions
-// included in each block.
+// included in each block, unless the Chain's
+// BlockLimits set a lower limit.
 const maxBlockTxs = 10000
 
 // saveSnapshotFrequency stores how often to save a state
@@ -61,10 +62,16 @@ func (c *Chain) GenerateBlock(ctx context.Context, prev *bc.Block, snapshot *sta
 		},
 	}
 
+	limits := c.BlockLimits()
+	var nbytes int
 	for _, tx := range txs {
-		if len(b.Transactions) >= maxBlockTxs {
+		if len(b.Transactions) >= limits.MaxTxs {
 			break
 		}
+		size := tx.SerializedSize()
+		if limits.MaxBytes > 0 && nbytes+size > limits.MaxBytes {
+			continue
+		}
 
 		// TODO(jackson): Should this go in ConfirmTx too?
 		err = c.checkIssuanceWindow(tx)
@@ -78,6 +85,7 @@ func (c *Chain) GenerateBlock(ctx context.Context, prev *bc.Block, snapshot *sta
 				return nil, nil, err
 			}
 			b.Transactions = append(b.Transactions, tx)
+			nbytes += size
 		}
 	}
 	b.TransactionsMerkleRoot = validation.CalcMerkleRoot(b.Transactions)
@@ -109,7 +117,8 @@ func (c *Chain) ValidateBlock(ctx context.Context, prevState *state.Snapshot, pr
 //   * executes all new-block callbacks.
 //
 // The block parameter must have already been validated before
-// being committed.
+// being committed. The snapshot may be nil on a core that does
+// not keep the state tree, such as a light client.
 func (c *Chain) CommitBlock(ctx context.Context, block *bc.Block, snapshot *state.Snapshot) error {
 	// SaveBlock is the linearization point. Once the block is committed
 	// to persistent storage, the block has been applied and everything
@@ -118,7 +127,7 @@ func (c *Chain) CommitBlock(ctx context.Context, block *bc.Block, snapshot *stat
 	if err != nil {
 		return errors.Wrap(err, "storing block")
 	}
-	if block.Time().After(c.lastQueuedSnapshot.Add(saveSnapshotFrequency)) {
+	if snapshot != nil && block.Time().After(c.lastQueuedSnapshot.Add(saveSnapshotFrequency)) {
 		c.queueSnapshot(ctx, block.Height, block.Time(), snapshot)
 	}
 
@@ -174,13 +183,17 @@ func (c *Chain) setHeight(h uint64) {
 // block in preparation for signing it. By definition it does not
 // execute the sigscript.
 func (c *Chain) ValidateBlockForSig(ctx context.Context, block *bc.Block) error {
+	err := c.checkBlockLimits(block)
+	if err != nil {
+		return errors.Wrap(err, "validation")
+	}
+
 	var (
 		prev     *bc.Block
 		snapshot = state.Empty()
 	)
 
 	if block.Height > 1 {
-		var err error
 		prev, err = c.store.GetBlock(ctx, block.Height-1)
 		if err != nil {
 			return errors.Wrap(err, "getting previous block")
@@ -195,10 +208,30 @@ func (c *Chain) ValidateBlockForSig(ctx context.Context, block *bc.Block) error
 	// TODO(kr): cache the applied snapshot, and maybe
 	// we can skip re-applying it later
 	snapshot = state.Copy(snapshot)
-	err := validation.ValidateBlock(ctx, snapshot, c.InitialBlockHash, prev, block, validation.CheckTxWellFormed)
+	err = validation.ValidateBlock(ctx, snapshot, c.InitialBlockHash, prev, block, validation.CheckTxWellFormed)
 	return errors.Wrap(err, "validation")
 }
 
+// checkBlockLimits checks that block is within c's BlockLimits.
+// The limits aren't part of consensus, so they apply only to
+// blocks this Core generates or signs, never to signed blocks.
+func (c *Chain) checkBlockLimits(block *bc.Block) error {
+	limits := c.BlockLimits()
+	if len(block.Transactions) > limits.MaxTxs {
+		return fmt.Errorf("block has %d transactions, more than the maximum %d", len(block.Transactions), limits.MaxTxs)
+	}
+	if limits.MaxBytes > 0 {
+		var nbytes int
+		for _, tx := range block.Transactions {
+			nbytes += tx.SerializedSize()
+		}
+		if nbytes > limits.MaxBytes {
+			return fmt.Errorf("block has %d bytes of transactions, more than the maximum %d", nbytes, limits.MaxBytes)
+		}
+	}
+	return nil
+}
+
 func NewInitialBlock(pubkeys []ed25519.PublicKey, nSigs int, timestamp time.Time) (*bc.Block, error) {
 	script, err := vmutil.BlockMultiSigProgram(pubkeys, nSigs)
 	if err != nil {
@@ -11,6 +11,7 @@ import (
 	"chain/protocol/mempool"
 	"chain/protocol/memstore"
 	"chain/protocol/state"
+	"chain/protocol/vm"
 	"chain/testutil"
 )
 
@@ -197,6 +198,68 @@ func TestGenerateBlock(t *testing.T) {
 	}
 }
 
+func TestBlockLimits(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	c, b1 := newTestChain(t, now)
+
+	issuanceProg := []byte{byte(vm.OP_TRUE)}
+	assetID := bc.ComputeAssetID(issuanceProg, b1.Hash(), 1)
+	var txs []*bc.Tx
+	for i := byte(0); i < 3; i++ {
+		txs = append(txs, bc.NewTx(bc.TxData{
+			Version: 1,
+			MinTime: bc.Millis(now),
+			MaxTime: bc.Millis(now.Add(time.Hour)),
+			Inputs:  []*bc.TxInput{bc.NewIssuanceInput([]byte{i}, 50, nil, b1.Hash(), issuanceProg, nil)},
+			Outputs: []*bc.TxOutput{bc.NewTxOutput(assetID, 50, []byte{i}, nil)},
+		}))
+	}
+	size := txs[0].SerializedSize()
+
+	cases := []struct {
+		limits BlockLimits
+		want   int
+	}{
+		{BlockLimits{}, 3},
+		{BlockLimits{MaxTxs: 2}, 2},
+		{BlockLimits{MaxBytes: 2*size + 1}, 2},
+		{BlockLimits{MaxBytes: size - 1}, 0},
+	}
+	for _, tc := range cases {
+		c.SetBlockLimits(tc.limits)
+		b, _, err := c.GenerateBlock(ctx, b1, state.Empty(), now, txs)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if len(b.Transactions) != tc.want {
+			t.Errorf("limits %+v: got %d txs want %d", tc.limits, len(b.Transactions), tc.want)
+		}
+	}
+
+	c.SetBlockLimits(BlockLimits{})
+	b, _, err := c.GenerateBlock(ctx, b1, state.Empty(), now, txs)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = c.ValidateBlockForSig(ctx, b)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	// The limits are local, not consensus rules. A block
+	// beyond them isn't signed, but once signed, it's valid.
+	c.SetBlockLimits(BlockLimits{MaxTxs: 2})
+	err = c.ValidateBlockForSig(ctx, b)
+	if err == nil {
+		t.Error("validating oversized block for signing: got no error")
+	}
+	_, err = c.ValidateBlock(ctx, state.Empty(), b1, b)
+	if err != nil {
+		t.Errorf("validating oversized block: got error %v", err)
+	}
+}
+
 func TestValidateBlockForSig(t *testing.T) {
 	initialBlock, err := NewInitialBlock(testutil.TestPubs, 1, time.Now())
 	if err != nil {
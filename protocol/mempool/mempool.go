@@ -39,6 +39,14 @@ func (m *MemPool) Submit(ctx context.Context, tx *bc.Tx) error {
 	return nil
 }
 
+// Contains returns whether the tx with the
+// given hash is in the pool.
+func (m *MemPool) Contains(hash bc.Hash) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.hashes[hash]
+}
+
 // Dump returns all pending transactions in the pool and
 // empties the pool.
 func (m *MemPool) Dump(ctx context.Context) []*bc.Tx {
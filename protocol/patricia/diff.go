@@ -0,0 +1,94 @@
+package patricia
+
+import "bytes"
+
+// InsertLeaf is like Insert, but takes the hash of
+// the value, as found in a Leaf, instead of the value.
+func (t *Tree) InsertLeaf(l Leaf) error {
+	key := bitKey(l.Key)
+	hash := l.Hash
+	if t.root == nil {
+		t.root = &node{key: key, hash: &hash, isLeaf: true}
+		return nil
+	}
+
+	var err error
+	t.root, err = t.insert(t.root, key, &hash)
+	return err
+}
+
+// Diff returns the changes that turn tree a into tree b:
+// the leaves of b that are not in a or that have a different
+// hash in a, and the keys of the leaves of a that are not in b.
+//
+// Since trees share structure with the trees they were
+// copied from, Diff skips the subtrees a and b have in
+// common, and is fast when b was derived from a by a
+// small number of changes.
+func Diff(a, b *Tree) (added []Leaf, removed [][]byte) {
+	d := new(differ)
+	d.diff(a.root, b.root)
+	return d.added, d.removed
+}
+
+type differ struct {
+	added   []Leaf
+	removed [][]byte
+}
+
+func (d *differ) diff(a, b *node) {
+	switch {
+	case a == b:
+		return
+	case a == nil:
+		d.add(b)
+		return
+	case b == nil:
+		d.remove(a)
+		return
+	}
+
+	if bytes.Equal(a.key, b.key) {
+		if a.isLeaf && b.isLeaf {
+			if *a.hash != *b.hash {
+				d.added = append(d.added, Leaf{Key: b.Key(), Hash: *b.hash})
+			}
+			return
+		}
+		if !a.isLeaf && !b.isLeaf {
+			d.diff(a.children[0], b.children[0])
+			d.diff(a.children[1], b.children[1])
+			return
+		}
+	} else if !a.isLeaf && bytes.HasPrefix(b.key, a.key) {
+		// b is somewhere under one of a's children.
+		bit := b.key[len(a.key)]
+		d.diff(a.children[bit], b)
+		d.remove(a.children[1-bit])
+		return
+	} else if !b.isLeaf && bytes.HasPrefix(a.key, b.key) {
+		// a is somewhere under one of b's children.
+		bit := a.key[len(b.key)]
+		d.diff(a, b.children[bit])
+		d.add(b.children[1-bit])
+		return
+	}
+
+	// The subtrees have nothing in common.
+	d.remove(a)
+	d.add(b)
+}
+
+func (d *differ) add(n *node) {
+	walk(n, func(l Leaf) error {
+		d.added = append(d.added, l)
+		return nil
+	})
+}
+
+func (d *differ) remove(n *node) {
+	walk(n, func(l Leaf) error {
+		d.removed = append(d.removed, l.Key)
+		return nil
+	})
+}
@@ -495,6 +495,72 @@ func TestByteKey(t *testing.T) {
 	}
 }
 
+func TestDiff(t *testing.T) {
+	r := rand.New(rand.NewSource(12345))
+	randKey := func() []byte {
+		var k [4]byte
+		r.Read(k[:])
+		return k[:]
+	}
+
+	a := new(Tree)
+	var keys [][]byte
+	for i := 0; i < 200; i++ {
+		k := randKey()
+		keys = append(keys, k)
+		a.Insert(k, k)
+	}
+	cases := []struct {
+		name string
+		edit func(b *Tree)
+	}{
+		{"same", func(b *Tree) {}},
+		{"insert", func(b *Tree) { b.Insert(randKey(), []byte("x")) }},
+		{"delete", func(b *Tree) { b.Delete(keys[7]) }},
+		{"change", func(b *Tree) { b.Insert(keys[9], []byte("x")) }},
+		{"delete all", func(b *Tree) {
+			for _, k := range keys {
+				b.Delete(k)
+			}
+		}},
+		{"many", func(b *Tree) {
+			for i := 0; i < 50; i++ {
+				b.Delete(keys[r.Intn(len(keys))])
+				b.Insert(randKey(), []byte("y"))
+			}
+		}},
+	}
+	for _, c := range cases {
+		b := Copy(a)
+		c.edit(b)
+
+		// Also diff against a tree with no shared structure.
+		leaves := []Leaf{}
+		Walk(a, func(l Leaf) error {
+			leaves = append(leaves, l)
+			return nil
+		})
+		rebuilt, err := Reconstruct(leaves)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, base := range []*Tree{a, rebuilt} {
+			added, removed := Diff(base, b)
+			got := Copy(base)
+			for _, k := range removed {
+				got.Delete(k)
+			}
+			for _, l := range added {
+				got.InsertLeaf(l)
+			}
+			if got.RootHash() != b.RootHash() {
+				t.Errorf("%s: applying diff gives root %x want %x", c.name, got.RootHash(), b.RootHash())
+			}
+		}
+	}
+}
+
 func makeVals(num int) (vals [][]byte, hashes []bc.Hash) {
 	for i := 0; i < num; i++ {
 		v := sha3.Sum256([]byte{byte(i)})
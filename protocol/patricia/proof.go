@@ -0,0 +1,199 @@
+package patricia
+
+import (
+	"bytes"
+
+	"chain/crypto/sha3pool"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+// ErrBadProof is returned when a proof does not
+// verify against a root hash.
+var ErrBadProof = errors.New("invalid patricia tree proof")
+
+// Proof is a Merkle proof that a key is present in, or
+// absent from, a tree with a given root hash.
+//
+// The proof follows the path selected by the bits of Key
+// from the root. Each step records the bit position at
+// which the path branches and the hash of the sibling
+// subtree not taken. The path ends at a leaf holding Key,
+// if Key is present, or at the node where the path leaves
+// the tree, if it is not.
+//
+// Note that node hashes in this tree commit to leaf values
+// and to the shape of the tree, but not to keys: a node's
+// key is implied by its position. A proof shows that a node
+// with the given hash lies at the end of a path whose
+// branch directions agree with Key; bits of Key at other
+// positions are not checked. For an absence proof, the key
+// of that final node, NodeKey, is as reported by the
+// prover; the tree hashes cannot confirm it. Callers that
+// need a proof bound to a key should also check that the
+// proven value commits to the key.
+type Proof struct {
+	Key   []byte      `json:"key"`
+	Found bool        `json:"found"`
+	Steps []ProofStep `json:"steps"`
+
+	// NodeHash is the hash of the node at the end of the path.
+	NodeHash bc.Hash `json:"node_hash"`
+
+	// NodeKey and NodeKeyBits give the key of the node at the
+	// end of the path, if Found is false and the tree is not
+	// empty. NodeKeyBits is the length of the key in bits;
+	// NodeKey holds those bits, padded with zeros to a whole
+	// number of bytes.
+	NodeKey     []byte `json:"node_key,omitempty"`
+	NodeKeyBits int    `json:"node_key_bits,omitempty"`
+}
+
+// ProofStep is one branch along a proof's path.
+type ProofStep struct {
+	Bit         int     `json:"bit"`          // position in the key of the branching bit
+	SiblingHash bc.Hash `json:"sibling_hash"` // hash of the subtree not taken
+}
+
+// Prove returns a proof of the presence or absence
+// of bkey in t.
+func (t *Tree) Prove(bkey []byte) *Proof {
+	p := &Proof{Key: append([]byte(nil), bkey...)}
+	if t.root == nil {
+		return p
+	}
+
+	key := bitKey(bkey)
+	n := t.root
+	for !n.isLeaf && bytes.HasPrefix(key, n.key) && len(key) > len(n.key) {
+		bit := key[len(n.key)]
+		p.Steps = append(p.Steps, ProofStep{
+			Bit:         len(n.key),
+			SiblingHash: n.children[1-bit].Hash(),
+		})
+		n = n.children[bit]
+	}
+
+	p.NodeHash = n.Hash()
+	p.Found = n.isLeaf && bytes.Equal(n.key, key)
+	if !p.Found {
+		p.NodeKey = packBits(n.key)
+		p.NodeKeyBits = len(n.key)
+	}
+	return p
+}
+
+// VerifyInclusion checks that p proves that the tree
+// with the given root hash maps p.Key to val.
+func (p *Proof) VerifyInclusion(root bc.Hash, val []byte) error {
+	if !p.Found {
+		return errors.WithDetail(ErrBadProof, "proof is of absence")
+	}
+	if p.NodeHash != leafHash(val) {
+		return errors.WithDetail(ErrBadProof, "value does not match leaf hash")
+	}
+	return p.verifyPath(root)
+}
+
+// VerifyExclusion checks that p proves that the tree
+// with the given root hash does not contain p.Key.
+func (p *Proof) VerifyExclusion(root bc.Hash) error {
+	if p.Found {
+		return errors.WithDetail(ErrBadProof, "proof is of presence")
+	}
+	if len(p.Steps) == 0 && p.NodeKeyBits == 0 {
+		// The tree is empty.
+		if root != (bc.Hash{}) {
+			return errors.WithDetail(ErrBadProof, "tree is not empty")
+		}
+		return nil
+	}
+
+	err := p.checkSteps()
+	if err != nil {
+		return err
+	}
+	key := bitKey(p.Key)
+	if p.NodeKeyBits < 0 || p.NodeKeyBits > len(p.NodeKey)*8 {
+		return errors.WithDetail(ErrBadProof, "bad node key length")
+	}
+	nodeKey := bitKey(p.NodeKey)[:p.NodeKeyBits]
+	if len(p.Steps) > 0 && len(nodeKey) <= p.Steps[len(p.Steps)-1].Bit {
+		return errors.WithDetail(ErrBadProof, "node key is shorter than its path")
+	}
+	if bytes.HasPrefix(key, nodeKey) {
+		// The path would continue into the node, or
+		// end at a leaf with this very key.
+		return errors.WithDetail(ErrBadProof, "node key does not diverge from key")
+	}
+	// Every branch above the node must agree with it.
+	for _, s := range p.Steps {
+		if nodeKey[s.Bit] != key[s.Bit] {
+			return errors.WithDetail(ErrBadProof, "node key disagrees with path")
+		}
+	}
+	return p.verifyPath(root)
+}
+
+// checkSteps checks that the branching bits of p.Steps
+// are strictly increasing positions within p.Key.
+func (p *Proof) checkSteps() error {
+	prev := -1
+	for _, s := range p.Steps {
+		if s.Bit <= prev || s.Bit >= len(p.Key)*8 {
+			return errors.WithDetail(ErrBadProof, "steps out of order")
+		}
+		prev = s.Bit
+	}
+	return nil
+}
+
+// verifyPath hashes p.NodeHash up through p.Steps and
+// compares the result with root.
+func (p *Proof) verifyPath(root bc.Hash) error {
+	err := p.checkSteps()
+	if err != nil {
+		return err
+	}
+	key := bitKey(p.Key)
+	hash := p.NodeHash
+	for i := len(p.Steps) - 1; i >= 0; i-- {
+		s := p.Steps[i]
+		if key[s.Bit] == 0 {
+			hash = interiorHash(hash, s.SiblingHash)
+		} else {
+			hash = interiorHash(s.SiblingHash, hash)
+		}
+	}
+	if hash != root {
+		return errors.WithDetail(ErrBadProof, "root hash mismatch")
+	}
+	return nil
+}
+
+func leafHash(val []byte) (hash bc.Hash) {
+	h := sha3pool.Get256()
+	h.Write(leafPrefix)
+	h.Write(val)
+	h.Read(hash[:])
+	sha3pool.Put256(h)
+	return hash
+}
+
+func interiorHash(left, right bc.Hash) (hash bc.Hash) {
+	h := sha3pool.Get256()
+	h.Write(interiorPrefix)
+	h.Write(left[:])
+	h.Write(right[:])
+	h.Read(hash[:])
+	sha3pool.Put256(h)
+	return hash
+}
+
+// packBits is like byteKey, but accepts bit keys of
+// any length, padding the last byte with zeros.
+func packBits(bits []uint8) []byte {
+	padded := make([]uint8, (len(bits)+7)/8*8)
+	copy(padded, bits)
+	return byteKey(padded)
+}
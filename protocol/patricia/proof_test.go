@@ -0,0 +1,139 @@
+package patricia
+
+import (
+	"testing"
+
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+func TestProof(t *testing.T) {
+	tr := new(Tree)
+	keys := []string{"0000", "0011", "0110", "1010", "1011"}
+	for _, k := range keys {
+		err := tr.Insert(bits(k), []byte(k))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	root := tr.RootHash()
+
+	for _, k := range keys {
+		p := tr.Prove(bits(k))
+		err := p.VerifyInclusion(root, []byte(k))
+		if err != nil {
+			t.Errorf("VerifyInclusion(%s) = %v", k, err)
+		}
+		err = p.VerifyInclusion(root, []byte("other"))
+		if errors.Root(err) != ErrBadProof {
+			t.Errorf("VerifyInclusion(%s) with wrong value = %v want %v", k, err, ErrBadProof)
+		}
+		err = p.VerifyExclusion(root)
+		if errors.Root(err) != ErrBadProof {
+			t.Errorf("VerifyExclusion(%s) = %v want %v", k, err, ErrBadProof)
+		}
+		err = p.VerifyInclusion(bc.Hash{1}, []byte(k))
+		if errors.Root(err) != ErrBadProof {
+			t.Errorf("VerifyInclusion(%s) with wrong root = %v want %v", k, err, ErrBadProof)
+		}
+	}
+
+	for _, k := range []string{"0001", "0100", "1000", "1111"} {
+		p := tr.Prove(bits(k))
+		err := p.VerifyExclusion(root)
+		if err != nil {
+			t.Errorf("VerifyExclusion(%s) = %v", k, err)
+		}
+		err = p.VerifyInclusion(root, []byte(k))
+		if errors.Root(err) != ErrBadProof {
+			t.Errorf("VerifyInclusion(%s) = %v want %v", k, err, ErrBadProof)
+		}
+	}
+
+	// A proof must not verify for a key that takes a
+	// different branch.
+	p := tr.Prove(bits("0011"))
+	p.Key = bits("0111")
+	err := p.VerifyInclusion(root, []byte("0011"))
+	if err == nil {
+		t.Error("inclusion proof verified for a different key")
+	}
+
+	// Steps out of order must be rejected, not panic.
+	p = tr.Prove(bits("0100"))
+	p.Steps = append(p.Steps, ProofStep{Bit: 0})
+	err = p.VerifyExclusion(root)
+	if errors.Root(err) != ErrBadProof {
+		t.Errorf("VerifyExclusion with bad steps = %v want %v", err, ErrBadProof)
+	}
+}
+
+func TestProofEmptyTree(t *testing.T) {
+	tr := new(Tree)
+	p := tr.Prove(bits("0101"))
+	err := p.VerifyExclusion(tr.RootHash())
+	if err != nil {
+		t.Errorf("VerifyExclusion = %v", err)
+	}
+	err = p.VerifyExclusion(bc.Hash{1})
+	if errors.Root(err) != ErrBadProof {
+		t.Errorf("VerifyExclusion with nonempty root = %v want %v", err, ErrBadProof)
+	}
+}
+
+func TestExclusionProofTampered(t *testing.T) {
+	tr := new(Tree)
+	for _, k := range []string{"0000", "0011", "0110", "1010", "1011"} {
+		err := tr.Insert(bits(k), []byte(k))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	root := tr.RootHash()
+
+	// The path for 0100 ends at the leaf 0110.
+	// Node hashes don't commit to keys, so a false
+	// NodeKey is caught only when it contradicts Key
+	// or the path.
+	cases := []struct {
+		name   string
+		tamper func(p *Proof)
+	}{
+		{"node key is key", func(p *Proof) {
+			p.NodeKey = bits("0100")
+		}},
+		{"node key is prefix of key", func(p *Proof) {
+			p.NodeKeyBits = 2
+		}},
+		{"node key disagrees with path", func(p *Proof) {
+			p.NodeKey = bits("1110")
+		}},
+		{"node key shorter than path", func(p *Proof) {
+			p.NodeKey, p.NodeKeyBits = []byte{0x00}, 1
+		}},
+		{"node key length too long", func(p *Proof) {
+			p.NodeKeyBits = 9
+		}},
+		{"node key length negative", func(p *Proof) {
+			p.NodeKeyBits = -1
+		}},
+		{"node hash of another leaf", func(p *Proof) {
+			p.NodeHash = tr.Prove(bits("0011")).NodeHash
+		}},
+		{"sibling hash", func(p *Proof) {
+			p.Steps[0].SiblingHash = bc.Hash{1}
+		}},
+	}
+	for _, c := range cases {
+		p := tr.Prove(bits("0100"))
+		err := p.VerifyExclusion(root)
+		if err != nil {
+			t.Fatalf("untampered proof: VerifyExclusion = %v", err)
+		}
+		c.tamper(p)
+		err = p.VerifyExclusion(root)
+		if errors.Root(err) != ErrBadProof {
+			t.Errorf("%s: VerifyExclusion = %v want %v", c.name, err, ErrBadProof)
+		}
+	}
+}
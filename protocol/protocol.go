@@ -87,6 +87,10 @@ type Chain struct {
 	InitialBlockHash  bc.Hash
 	MaxIssuanceWindow time.Duration // only used by generators
 
+	limits struct {
+		mu sync.Mutex
+		BlockLimits
+	}
 	state struct {
 		cond     sync.Cond // protects height, block, snapshot
 		height   uint64
@@ -102,6 +106,34 @@ type Chain struct {
 	ready        chan struct{}
 }
 
+// BlockLimits bounds the size of the blocks a Chain generates
+// and signs. They're local settings, not consensus rules, so
+// they don't apply to blocks already signed. A zero field means the protocol default.
+type BlockLimits struct {
+	MaxTxs   int // maximum number of transactions per block
+	MaxBytes int // maximum total serialized size of a block's transactions
+}
+
+// SetBlockLimits sets the limits on blocks generated and
+// signed by c. It may be called while c is in use.
+func (c *Chain) SetBlockLimits(l BlockLimits) {
+	c.limits.mu.Lock()
+	c.limits.BlockLimits = l
+	c.limits.mu.Unlock()
+}
+
+// BlockLimits returns the limits on blocks generated and
+// signed by c, with any defaults filled in.
+func (c *Chain) BlockLimits() BlockLimits {
+	c.limits.mu.Lock()
+	l := c.limits.BlockLimits
+	c.limits.mu.Unlock()
+	if l.MaxTxs <= 0 || l.MaxTxs > maxBlockTxs {
+		l.MaxTxs = maxBlockTxs
+	}
+	return l
+}
+
 type pendingSnapshot struct {
 	height   uint64
 	snapshot *state.Snapshot
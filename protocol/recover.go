@@ -72,3 +72,28 @@ func (c *Chain) Recover(ctx context.Context) (*bc.Block, *state.Snapshot, error)
 
 	return b, snapshot, nil
 }
+
+// RecoverHeaders is like Recover, for a core that keeps block
+// headers and only some of their transactions, with no state
+// tree. It returns the latest stored block, which may be nil.
+func (c *Chain) RecoverHeaders(ctx context.Context) (*bc.Block, error) {
+	height, err := c.store.Height(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting blockchain height")
+	}
+	var b *bc.Block
+	if height > 0 {
+		b, err = c.store.GetBlock(ctx, height)
+		if err != nil {
+			return nil, errors.Wrap(err, "getting block")
+		}
+		err = c.CommitBlock(ctx, b, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "committing block")
+		}
+	}
+
+	close(c.ready)
+
+	return b, nil
+}
@@ -5,6 +5,7 @@ import (
 
 	"chain/errors"
 	"chain/protocol/bc"
+	"chain/protocol/patricia"
 )
 
 // Output represents a spent or unspent output
@@ -54,3 +55,32 @@ func outputBytes(o *Output) []byte {
 func OutputTreeItem(o *Output) (bkey, commitment []byte) {
 	return OutputKey(o.Outpoint), outputBytes(o)
 }
+
+// VerifyOutputInclusion checks that proof shows o is an
+// unspent output in a state tree with the given root hash,
+// such as a block's AssetsMerkleRoot.
+//
+// The state tree's hashes commit to output commitments but
+// not to outpoints (see patricia.Proof), so the proof only
+// shows that an unspent output with o's commitment lies on
+// a path consistent with o's outpoint. Another unspent
+// output with the same asset, amount, and control program
+// could stand in for o.
+func VerifyOutputInclusion(proof *patricia.Proof, root bc.Hash, o *Output) error {
+	key, commitment := OutputTreeItem(o)
+	if !bytes.Equal(proof.Key, key) {
+		return errors.WithDetail(patricia.ErrBadProof, "proof is for a different output")
+	}
+	return proof.VerifyInclusion(root, commitment)
+}
+
+// VerifyOutputExclusion checks that proof shows there is no
+// unspent output at outpoint in a state tree with the given
+// root hash. Like VerifyOutputInclusion, it relies on the
+// prover for the key of the node the proof ends at.
+func VerifyOutputExclusion(proof *patricia.Proof, root bc.Hash, outpoint bc.Outpoint) error {
+	if !bytes.Equal(proof.Key, OutputKey(outpoint)) {
+		return errors.WithDetail(patricia.ErrBadProof, "proof is for a different output")
+	}
+	return proof.VerifyExclusion(root)
+}
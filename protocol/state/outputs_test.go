@@ -0,0 +1,53 @@
+package state
+
+import (
+	"testing"
+
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/patricia"
+)
+
+func TestOutputProofs(t *testing.T) {
+	spent := NewOutput(*bc.NewTxOutput(bc.AssetID{1}, 5, []byte{0x51}, nil), bc.Outpoint{Hash: bc.Hash{1}})
+	unspent := NewOutput(*bc.NewTxOutput(bc.AssetID{1}, 6, []byte{0x51}, nil), bc.Outpoint{Hash: bc.Hash{2}})
+
+	tree := new(patricia.Tree)
+	err := tree.Insert(OutputTreeItem(unspent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := tree.RootHash()
+
+	proof := tree.Prove(OutputKey(unspent.Outpoint))
+	err = VerifyOutputInclusion(proof, root, unspent)
+	if err != nil {
+		t.Errorf("VerifyOutputInclusion(unspent) = %v", err)
+	}
+
+	// The proof for the unspent output must not
+	// serve for another output.
+	err = VerifyOutputInclusion(proof, root, spent)
+	if errors.Root(err) != patricia.ErrBadProof {
+		t.Errorf("VerifyOutputInclusion(spent) = %v want %v", err, patricia.ErrBadProof)
+	}
+	proof.Key = OutputKey(spent.Outpoint)
+	err = VerifyOutputInclusion(proof, root, spent)
+	if errors.Root(err) != patricia.ErrBadProof {
+		t.Errorf("VerifyOutputInclusion(spent) with its key = %v want %v", err, patricia.ErrBadProof)
+	}
+
+	proof = tree.Prove(OutputKey(spent.Outpoint))
+	err = VerifyOutputExclusion(proof, root, spent.Outpoint)
+	if err != nil {
+		t.Errorf("VerifyOutputExclusion(spent) = %v", err)
+	}
+	err = VerifyOutputExclusion(proof, root, unspent.Outpoint)
+	if errors.Root(err) != patricia.ErrBadProof {
+		t.Errorf("VerifyOutputExclusion(unspent) = %v want %v", err, patricia.ErrBadProof)
+	}
+	err = VerifyOutputInclusion(proof, root, spent)
+	if errors.Root(err) != patricia.ErrBadProof {
+		t.Errorf("VerifyOutputInclusion(spent) with exclusion proof = %v want %v", err, patricia.ErrBadProof)
+	}
+}
@@ -0,0 +1,191 @@
+package validation
+
+import (
+	"chain/crypto/ed25519"
+	"chain/crypto/sha3pool"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/vmutil"
+)
+
+var (
+	// ErrBadTxProof is returned when a transaction proof
+	// does not verify against a block's TransactionsMerkleRoot.
+	ErrBadTxProof = errors.New("invalid transaction proof")
+
+	// ErrBadBlockSigs is returned when a block header is not
+	// signed by a quorum of the keys in a consensus program.
+	ErrBadBlockSigs = errors.New("invalid block signatures")
+)
+
+// TxProof is a Merkle proof that a transaction is included
+// in a block's TransactionsMerkleRoot.
+//
+// The leaves of the transactions Merkle tree are witness
+// hashes, so the proof carries the transaction's witness
+// digests (see bc.Tx.WitnessDigests) to bind the leaf to
+// TxID.
+type TxProof struct {
+	TxID           bc.Hash   `json:"transaction_id"`
+	WitnessDigests []byte    `json:"witness_digests"`
+	Position       int       `json:"position"`       // index of the transaction in the block
+	Count          int       `json:"count"`          // number of transactions in the block
+	Siblings       []bc.Hash `json:"sibling_hashes"` // from the root down
+}
+
+// CalcTxProof returns a proof that the transaction at
+// position pos is included in the Merkle root of
+// transactions, as computed by CalcMerkleRoot.
+func CalcTxProof(transactions []*bc.Tx, pos int) (*TxProof, error) {
+	if pos < 0 || pos >= len(transactions) {
+		return nil, errors.Wrapf(ErrBadTxProof, "no transaction at position %d", pos)
+	}
+	tx := transactions[pos]
+	p := &TxProof{
+		TxID:           tx.Hash,
+		WitnessDigests: tx.WitnessDigests(),
+		Position:       pos,
+		Count:          len(transactions),
+	}
+	for len(transactions) > 1 {
+		k := prevPowerOfTwo(len(transactions))
+		if pos < k {
+			p.Siblings = append(p.Siblings, CalcMerkleRoot(transactions[k:]))
+			transactions = transactions[:k]
+		} else {
+			p.Siblings = append(p.Siblings, CalcMerkleRoot(transactions[:k]))
+			transactions = transactions[k:]
+			pos -= k
+		}
+	}
+	return p, nil
+}
+
+// Verify checks that p proves the inclusion of p.TxID
+// in a transactions Merkle tree with the given root.
+func (p *TxProof) Verify(root bc.Hash) error {
+	if p.Position < 0 || p.Position >= p.Count {
+		return errors.WithDetail(ErrBadTxProof, "position out of range")
+	}
+
+	// Find which side of each branch the transaction is on,
+	// from the root down. The tree's shape depends only on
+	// the number of transactions.
+	var left []bool
+	for n, pos := p.Count, p.Position; n > 1; {
+		k := prevPowerOfTwo(n)
+		left = append(left, pos < k)
+		if pos < k {
+			n = k
+		} else {
+			n -= k
+			pos -= k
+		}
+	}
+	if len(left) != len(p.Siblings) {
+		return errors.WithDetail(ErrBadTxProof, "wrong number of sibling hashes")
+	}
+
+	hash := merkleHash(leafPrefix, bc.WitnessHashFromDigests(p.TxID, p.WitnessDigests))
+	for i := len(left) - 1; i >= 0; i-- {
+		if left[i] {
+			hash = merkleHash(interiorPrefix, hash, p.Siblings[i])
+		} else {
+			hash = merkleHash(interiorPrefix, p.Siblings[i], hash)
+		}
+	}
+	if hash != root {
+		return errors.WithDetail(ErrBadTxProof, "root hash mismatch")
+	}
+	return nil
+}
+
+func merkleHash(prefix []byte, hashes ...bc.Hash) (hash bc.Hash) {
+	h := sha3pool.Get256()
+	defer sha3pool.Put256(h)
+	h.Write(prefix)
+	for _, x := range hashes {
+		h.Write(x[:])
+	}
+	h.Read(hash[:])
+	return hash
+}
+
+// VerifyBlockSigs checks that the witness of header holds
+// signatures by a quorum of the keys in consensusProgram,
+// the consensus program of the block before header. The
+// program must be of the form made by
+// vmutil.BlockMultiSigProgram.
+//
+// As with OP_CHECKMULTISIG, signatures must appear in the
+// same order as their keys appear in the program.
+func VerifyBlockSigs(header *bc.BlockHeader, consensusProgram []byte) error {
+	pubkeys, quorum, err := vmutil.ParseBlockMultiSigProgram(consensusProgram)
+	if err != nil {
+		return errors.Wrap(err, "parsing consensus program")
+	}
+
+	hash := header.HashForSig()
+	var valid int
+	k := 0
+	for _, sig := range header.Witness {
+		for k < len(pubkeys) && !ed25519.Verify(pubkeys[k], hash[:], sig) {
+			k++
+		}
+		if k == len(pubkeys) {
+			break
+		}
+		valid++
+		k++
+	}
+	if valid < quorum {
+		return errors.WithDetailf(ErrBadBlockSigs, "block has %d valid signatures, need %d", valid, quorum)
+	}
+	return nil
+}
+
+// VerifyTxInBlock checks that proof shows its transaction is
+// included in the block with the given header, and that the
+// header is signed as required by consensusProgram, the
+// consensus program of the block before it. It lets a client
+// that trusts only the consensus program confirm that a
+// transaction has settled.
+func VerifyTxInBlock(proof *TxProof, header *bc.BlockHeader, consensusProgram []byte) error {
+	err := VerifyBlockSigs(header, consensusProgram)
+	if err != nil {
+		return err
+	}
+	return proof.Verify(header.TransactionsMerkleRoot)
+}
+
+// ValidateHeader checks header as a successor to prev
+// without the block's transactions, as a light client must.
+// It checks the header's height, previous block hash and
+// timestamp, and that it is signed as required by prev's
+// consensus program. If prev is nil, header must be the
+// initial block, with hash initialBlockHash.
+func ValidateHeader(initialBlockHash bc.Hash, prev, header *bc.BlockHeader) error {
+	if prev == nil {
+		if header.Height != 1 {
+			return ErrBadHeight
+		}
+		if header.Hash() != initialBlockHash {
+			return errors.WithDetail(ErrBadPrevHash, "initial block hash does not match blockchain ID")
+		}
+		return nil
+	}
+
+	if header.Height != prev.Height+1 {
+		return ErrBadHeight
+	}
+	if header.PreviousBlockHash != prev.Hash() {
+		return ErrBadPrevHash
+	}
+	if header.TimestampMS < prev.TimestampMS {
+		return ErrBadTimestamp
+	}
+	if vmutil.IsUnspendable(header.ConsensusProgram) {
+		return ErrBadScript
+	}
+	return VerifyBlockSigs(header, prev.ConsensusProgram)
+}
@@ -0,0 +1,143 @@
+package validation
+
+import (
+	"testing"
+
+	"chain/crypto/ed25519"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/vm"
+	"chain/protocol/vmutil"
+)
+
+func TestTxProof(t *testing.T) {
+	var txs []*bc.Tx
+	for n := 1; n <= 9; n++ {
+		txs = append(txs, bc.NewTx(bc.TxData{
+			Version: 1,
+			Inputs:  []*bc.TxInput{bc.NewSpendInput(bc.Hash{}, 0, [][]byte{vm.Int64Bytes(1)}, bc.AssetID{}, uint64(n), nil, nil)},
+		}))
+		root := CalcMerkleRoot(txs)
+
+		for pos := range txs {
+			p, err := CalcTxProof(txs, pos)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = p.Verify(root)
+			if err != nil {
+				t.Errorf("%d txs, position %d: Verify = %v", n, pos, err)
+			}
+
+			// The proof must not verify for another transaction.
+			other := *p
+			other.TxID = txs[(pos+1)%n].Hash
+			if n > 1 && errors.Root(other.Verify(root)) != ErrBadTxProof {
+				t.Errorf("%d txs, position %d: proof verified for wrong tx", n, pos)
+			}
+
+			// Nor at another position.
+			other = *p
+			other.Position = (pos + 1) % n
+			if n > 1 && errors.Root(other.Verify(root)) != ErrBadTxProof {
+				t.Errorf("%d txs, position %d: proof verified at wrong position", n, pos)
+			}
+		}
+	}
+
+	_, err := CalcTxProof(txs, len(txs))
+	if errors.Root(err) != ErrBadTxProof {
+		t.Errorf("CalcTxProof out of range = %v want %v", err, ErrBadTxProof)
+	}
+}
+
+func TestVerifyBlockSigs(t *testing.T) {
+	var (
+		pubs  []ed25519.PublicKey
+		privs []ed25519.PrivateKey
+	)
+	for i := 0; i < 3; i++ {
+		pub, priv, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pubs = append(pubs, pub)
+		privs = append(privs, priv)
+	}
+	prog, err := vmutil.BlockMultiSigProgram(pubs, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := &bc.BlockHeader{Version: 1, Height: 2}
+	hash := header.HashForSig()
+	sign := func(i int) []byte { return ed25519.Sign(privs[i], hash[:]) }
+
+	cases := []struct {
+		witness [][]byte
+		want    error
+	}{
+		{[][]byte{sign(0), sign(1)}, nil},
+		{[][]byte{sign(0), sign(2)}, nil},
+		{[][]byte{sign(0), sign(1), sign(2)}, nil},
+		{[][]byte{sign(1)}, ErrBadBlockSigs},
+		{[][]byte{sign(1), sign(0)}, ErrBadBlockSigs}, // out of order
+		{[][]byte{sign(1), sign(1)}, ErrBadBlockSigs},
+		{[][]byte{sign(0), []byte("bogus")}, ErrBadBlockSigs},
+	}
+	for i, c := range cases {
+		h := *header
+		h.Witness = c.witness
+		err := VerifyBlockSigs(&h, prog)
+		if errors.Root(err) != c.want {
+			t.Errorf("case %d: VerifyBlockSigs = %v want %v", i, err, c.want)
+		}
+	}
+}
+
+func TestValidateHeader(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err := vmutil.BlockMultiSigProgram([]ed25519.PublicKey{pub}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	initial := &bc.BlockHeader{Version: 1, Height: 1, ConsensusProgram: prog}
+	err = ValidateHeader(initial.Hash(), nil, initial)
+	if err != nil {
+		t.Fatalf("ValidateHeader(initial) = %v", err)
+	}
+	err = ValidateHeader(bc.Hash{1}, nil, initial)
+	if errors.Root(err) != ErrBadPrevHash {
+		t.Errorf("ValidateHeader(initial) with wrong blockchain ID = %v want %v", err, ErrBadPrevHash)
+	}
+
+	next := &bc.BlockHeader{
+		Version:           1,
+		Height:            2,
+		PreviousBlockHash: initial.Hash(),
+		ConsensusProgram:  prog,
+	}
+	hash := next.HashForSig()
+	next.Witness = [][]byte{ed25519.Sign(priv, hash[:])}
+	err = ValidateHeader(initial.Hash(), initial, next)
+	if err != nil {
+		t.Errorf("ValidateHeader(next) = %v", err)
+	}
+
+	bad := *next
+	bad.Witness = nil
+	err = ValidateHeader(initial.Hash(), initial, &bad)
+	if errors.Root(err) != ErrBadBlockSigs {
+		t.Errorf("ValidateHeader(unsigned) = %v want %v", err, ErrBadBlockSigs)
+	}
+	bad = *next
+	bad.PreviousBlockHash = bc.Hash{}
+	err = ValidateHeader(initial.Hash(), initial, &bad)
+	if errors.Root(err) != ErrBadPrevHash {
+		t.Errorf("ValidateHeader(wrong prev hash) = %v want %v", err, ErrBadPrevHash)
+	}
+}
@@ -1,6 +1,10 @@
 package vmutil
 
-import "chain/protocol/vm"
+import (
+	"encoding/binary"
+
+	"chain/protocol/vm"
+)
 
 type Builder struct {
 	Program []byte
@@ -29,3 +33,22 @@ func (b *Builder) AddOp(op vm.Op) *Builder {
 	b.Program = append(b.Program, byte(op))
 	return b
 }
+
+// AddJump appends an unconditional jump to the given program address.
+func (b *Builder) AddJump(addr uint32) *Builder {
+	return b.addJump(vm.OP_JUMP, addr)
+}
+
+// AddJumpIf appends a jump to the given program address that is
+// taken only if the top stack item is true.
+func (b *Builder) AddJumpIf(addr uint32) *Builder {
+	return b.addJump(vm.OP_JUMPIF, addr)
+}
+
+func (b *Builder) addJump(op vm.Op, addr uint32) *Builder {
+	var a [4]byte
+	binary.LittleEndian.PutUint32(a[:], addr)
+	b.Program = append(b.Program, byte(op))
+	b.Program = append(b.Program, a[:]...)
+	return b
+}
@@ -0,0 +1,225 @@
+package vmutil
+
+import (
+	"encoding/binary"
+
+	"chain/crypto/ed25519"
+	"chain/errors"
+	"chain/protocol/vm"
+)
+
+// ErrContractFormat is returned when a program does not match the
+// layout of the contract template it is parsed as.
+var ErrContractFormat = errors.New("bad contract program format")
+
+// TimeLockedMultiSigProgram returns a P2SP multisig control program
+// that additionally cannot be spent by a transaction whose mintime is
+// earlier than unlockTimeMS. The result is:
+//
+//	MINTIME <unlocktime> GREATERTHANOREQUAL VERIFY <p2sp multisig>
+func TimeLockedMultiSigProgram(pubkeys []ed25519.PublicKey, nrequired int, unlockTimeMS uint64) ([]byte, error) {
+	err := checkMultiSigParams(int64(nrequired), int64(len(pubkeys)))
+	if err != nil {
+		return nil, err
+	}
+	if unlockTimeMS == 0 || unlockTimeMS > 1<<63-1 {
+		return nil, errors.WithDetail(ErrBadValue, "bad unlock time")
+	}
+	builder := NewBuilder()
+	addMinTime(builder, unlockTimeMS)
+	addP2SPMultiSig(builder, pubkeys, nrequired)
+	return builder.Program, nil
+}
+
+// ParseTimeLockedMultiSigProgram parses a program produced by
+// TimeLockedMultiSigProgram.
+func ParseTimeLockedMultiSigProgram(program []byte) (pubkeys []ed25519.PublicKey, nrequired int, unlockTimeMS uint64, err error) {
+	unlockTimeMS, rest, err := parseMinTime(program)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	pubkeys, nrequired, err = ParseP2SPMultiSigProgram(rest)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return pubkeys, nrequired, unlockTimeMS, nil
+}
+
+// HashLockedProgram returns a P2SP multisig control program that can
+// only be spent by also revealing the SHA3-256 preimage of hash.
+// The preimage must be the final witness argument, after the
+// signature program. The result is:
+//
+//	SHA3 <hash> EQUALVERIFY <p2sp multisig>
+func HashLockedProgram(hash [32]byte, pubkeys []ed25519.PublicKey, nrequired int) ([]byte, error) {
+	err := checkMultiSigParams(int64(nrequired), int64(len(pubkeys)))
+	if err != nil {
+		return nil, err
+	}
+	builder := NewBuilder()
+	builder.AddOp(vm.OP_SHA3).AddData(hash[:]).AddOp(vm.OP_EQUALVERIFY)
+	addP2SPMultiSig(builder, pubkeys, nrequired)
+	return builder.Program, nil
+}
+
+// ParseHashLockedProgram parses a program produced by
+// HashLockedProgram.
+func ParseHashLockedProgram(program []byte) (hash [32]byte, pubkeys []ed25519.PublicKey, nrequired int, err error) {
+	pops, err := vm.ParseProgram(program)
+	if err != nil {
+		return hash, nil, 0, err
+	}
+	if len(pops) < 3 {
+		return hash, nil, 0, vm.ErrShortProgram
+	}
+	if pops[0].Op != vm.OP_SHA3 || len(pops[1].Data) != len(hash) || pops[2].Op != vm.OP_EQUALVERIFY {
+		return hash, nil, 0, errors.Wrap(ErrContractFormat, "no hash lock")
+	}
+	copy(hash[:], pops[1].Data)
+	prefixLen := int(pops[0].Len + pops[1].Len + pops[2].Len)
+	pubkeys, nrequired, err = ParseP2SPMultiSigProgram(program[prefixLen:])
+	if err != nil {
+		return hash, nil, 0, err
+	}
+	return hash, pubkeys, nrequired, nil
+}
+
+// EscrowProgram returns a control program for a 2-of-3 escrow among
+// the given parties (typically buyer, seller and escrow agent). Any
+// two parties may spend the output at any time. Once a transaction's
+// mintime reaches deadlineMS, refund alone may also spend it.
+//
+// The final witness argument selects the clause: false for the
+// 2-of-3 clause, true for the refund clause. The result is:
+//
+//	JUMPIF:refund <2-of-3 p2sp multisig> JUMP:end
+//	refund: MINTIME <deadline> GREATERTHANOREQUAL VERIFY <1-of-1 p2sp multisig>
+//	end:
+func EscrowProgram(parties []ed25519.PublicKey, refund ed25519.PublicKey, deadlineMS uint64) ([]byte, error) {
+	if len(parties) != 3 {
+		return nil, errors.WithDetail(ErrBadValue, "escrow requires exactly 3 parties")
+	}
+	if len(refund) != ed25519.PublicKeySize {
+		return nil, errors.WithDetail(ErrBadValue, "bad refund key")
+	}
+	if deadlineMS == 0 || deadlineMS > 1<<63-1 {
+		return nil, errors.WithDetail(ErrBadValue, "bad deadline")
+	}
+
+	multisig := NewBuilder()
+	addP2SPMultiSig(multisig, parties, 2)
+	refundClause := NewBuilder()
+	addMinTime(refundClause, deadlineMS)
+	addP2SPMultiSig(refundClause, []ed25519.PublicKey{refund}, 1)
+
+	refundAddr := uint32(jumpLen + len(multisig.Program) + jumpLen)
+	endAddr := refundAddr + uint32(len(refundClause.Program))
+
+	builder := NewBuilder()
+	builder.AddJumpIf(refundAddr)
+	builder.AddRawBytes(multisig.Program)
+	builder.AddJump(endAddr)
+	builder.AddRawBytes(refundClause.Program)
+	return builder.Program, nil
+}
+
+// ParseEscrowProgram parses a program produced by EscrowProgram.
+func ParseEscrowProgram(program []byte) (parties []ed25519.PublicKey, refund ed25519.PublicKey, deadlineMS uint64, err error) {
+	if len(program) < 2*jumpLen || program[0] != byte(vm.OP_JUMPIF) {
+		return nil, nil, 0, errors.Wrap(ErrContractFormat, "no clause selector")
+	}
+	refundAddr := binary.LittleEndian.Uint32(program[1:jumpLen])
+	if refundAddr < 2*jumpLen || refundAddr > uint32(len(program)) {
+		return nil, nil, 0, errors.Wrap(ErrContractFormat, "bad refund clause address")
+	}
+	jump := program[refundAddr-jumpLen : refundAddr]
+	if jump[0] != byte(vm.OP_JUMP) || binary.LittleEndian.Uint32(jump[1:]) != uint32(len(program)) {
+		return nil, nil, 0, errors.Wrap(ErrContractFormat, "bad multisig clause end")
+	}
+
+	parties, nrequired, err := ParseP2SPMultiSigProgram(program[jumpLen : refundAddr-jumpLen])
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if len(parties) != 3 || nrequired != 2 {
+		return nil, nil, 0, errors.Wrap(ErrContractFormat, "multisig clause is not 2-of-3")
+	}
+
+	deadlineMS, rest, err := parseMinTime(program[refundAddr:])
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	refunds, nrequired, err := ParseP2SPMultiSigProgram(rest)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if len(refunds) != 1 || nrequired != 1 {
+		return nil, nil, 0, errors.Wrap(ErrContractFormat, "refund clause is not 1-of-1")
+	}
+	return parties, refunds[0], deadlineMS, nil
+}
+
+// PayToPredicateProgram returns a control program that can be spent
+// by revealing any predicate program whose SHA3-256 hash is
+// predicateHash, along with arguments that satisfy it. The witness
+// is [... ARGS NARGS PREDICATE]. The result is:
+//
+//	DUP SHA3 <predicatehash> EQUALVERIFY 0 CHECKPREDICATE
+func PayToPredicateProgram(predicateHash [32]byte) []byte {
+	builder := NewBuilder()
+	builder.AddOp(vm.OP_DUP).AddOp(vm.OP_SHA3)
+	builder.AddData(predicateHash[:]).AddOp(vm.OP_EQUALVERIFY)
+	builder.AddInt64(0).AddOp(vm.OP_CHECKPREDICATE)
+	return builder.Program
+}
+
+// ParsePayToPredicateProgram parses a program produced by
+// PayToPredicateProgram, returning the predicate hash.
+func ParsePayToPredicateProgram(program []byte) (predicateHash [32]byte, err error) {
+	pops, err := vm.ParseProgram(program)
+	if err != nil {
+		return predicateHash, err
+	}
+	if len(pops) != 6 {
+		return predicateHash, errors.Wrap(ErrContractFormat, "not a pay-to-predicate program")
+	}
+	if pops[0].Op != vm.OP_DUP || pops[1].Op != vm.OP_SHA3 || len(pops[2].Data) != len(predicateHash) ||
+		pops[3].Op != vm.OP_EQUALVERIFY || pops[4].Op != vm.OP_0 || pops[5].Op != vm.OP_CHECKPREDICATE {
+		return predicateHash, errors.Wrap(ErrContractFormat, "not a pay-to-predicate program")
+	}
+	copy(predicateHash[:], pops[2].Data)
+	return predicateHash, nil
+}
+
+// jumpLen is the encoded length of a JUMP or JUMPIF instruction.
+const jumpLen = 5
+
+func addMinTime(builder *Builder, minTimeMS uint64) {
+	builder.AddOp(vm.OP_MINTIME).AddInt64(int64(minTimeMS))
+	builder.AddOp(vm.OP_GREATERTHANOREQUAL).AddOp(vm.OP_VERIFY)
+}
+
+// parseMinTime parses the clause produced by addMinTime at the
+// beginning of program and returns its time and the remainder of
+// the program.
+func parseMinTime(program []byte) (minTimeMS uint64, rest []byte, err error) {
+	pops, err := vm.ParseProgram(program)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(pops) < 4 {
+		return 0, nil, vm.ErrShortProgram
+	}
+	if pops[0].Op != vm.OP_MINTIME || pops[2].Op != vm.OP_GREATERTHANOREQUAL || pops[3].Op != vm.OP_VERIFY {
+		return 0, nil, errors.Wrap(ErrContractFormat, "no mintime clause")
+	}
+	t, err := vm.AsInt64(pops[1].Data)
+	if err != nil {
+		return 0, nil, errors.Wrap(ErrContractFormat, "parsing mintime")
+	}
+	if t <= 0 {
+		return 0, nil, errors.Wrap(ErrContractFormat, "bad mintime")
+	}
+	prefixLen := pops[0].Len + pops[1].Len + pops[2].Len + pops[3].Len
+	return uint64(t), program[prefixLen:], nil
+}
@@ -0,0 +1,211 @@
+package vmutil
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"chain/crypto/ed25519"
+	"chain/crypto/sha3pool"
+	"chain/protocol/bc"
+	"chain/protocol/vm"
+)
+
+func TestTimeLockedMultiSig(t *testing.T) {
+	pub1, priv1, _ := ed25519.GenerateKey(nil)
+	pub2, _, _ := ed25519.GenerateKey(nil)
+	pubs := []ed25519.PublicKey{pub1, pub2}
+	prog, err := TimeLockedMultiSigProgram(pubs, 1, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotPubs, n, unlock, err := ParseTimeLockedMultiSigProgram(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotPubs, pubs) || n != 1 || unlock != 1000 {
+		t.Errorf("ParseTimeLockedMultiSigProgram = (%x, %d, %d) want (%x, 1, 1000)", gotPubs, n, unlock, pubs)
+	}
+
+	cases := []struct {
+		minTime uint64
+		want    bool
+	}{
+		{999, false},
+		{1000, true},
+	}
+	for _, c := range cases {
+		tx := spendTx(prog, c.minTime)
+		signSpend(tx, priv1)
+		ok, _ := vm.VerifyTxInput(tx, 0)
+		if ok != c.want {
+			t.Errorf("mintime %d: got %v want %v", c.minTime, ok, c.want)
+		}
+	}
+}
+
+func TestHashLocked(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	preimage := []byte("open sesame")
+	var h [32]byte
+	sha3pool.Sum256(h[:], preimage)
+
+	prog, err := HashLockedProgram(h, []ed25519.PublicKey{pub}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotHash, gotPubs, n, err := ParseHashLockedProgram(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotHash != h || len(gotPubs) != 1 || !bytes.Equal(gotPubs[0], pub) || n != 1 {
+		t.Errorf("ParseHashLockedProgram = (%x, %x, %d) want (%x, [%x], 1)", gotHash, gotPubs, n, h, pub)
+	}
+
+	cases := []struct {
+		preimage []byte
+		want     bool
+	}{
+		{[]byte("open barley"), false},
+		{preimage, true},
+	}
+	for _, c := range cases {
+		tx := spendTx(prog, 0)
+		signSpend(tx, priv, c.preimage)
+		ok, _ := vm.VerifyTxInput(tx, 0)
+		if ok != c.want {
+			t.Errorf("preimage %q: got %v want %v", c.preimage, ok, c.want)
+		}
+	}
+}
+
+func TestEscrow(t *testing.T) {
+	buyer, buyerPriv, _ := ed25519.GenerateKey(nil)
+	seller, sellerPriv, _ := ed25519.GenerateKey(nil)
+	agent, _, _ := ed25519.GenerateKey(nil)
+	parties := []ed25519.PublicKey{buyer, seller, agent}
+
+	prog, err := EscrowProgram(parties, buyer, 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotParties, gotRefund, deadline, err := ParseEscrowProgram(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotParties, parties) || !bytes.Equal(gotRefund, buyer) || deadline != 5000 {
+		t.Errorf("ParseEscrowProgram = (%x, %x, %d) want (%x, %x, 5000)", gotParties, gotRefund, deadline, parties, buyer)
+	}
+
+	cases := []struct {
+		name    string
+		minTime uint64
+		refund  bool
+		privs   []ed25519.PrivateKey
+		want    bool
+	}{
+		{"2-of-3", 0, false, []ed25519.PrivateKey{buyerPriv, sellerPriv}, true},
+		{"1-of-3", 0, false, []ed25519.PrivateKey{sellerPriv}, false},
+		{"early refund", 4999, true, []ed25519.PrivateKey{buyerPriv}, false},
+		{"refund", 5000, true, []ed25519.PrivateKey{buyerPriv}, true},
+		{"refund wrong key", 5000, true, []ed25519.PrivateKey{sellerPriv}, false},
+	}
+	for _, c := range cases {
+		tx := spendTx(prog, c.minTime)
+		signSpendMulti(tx, c.privs, vm.BoolBytes(c.refund))
+		ok, _ := vm.VerifyTxInput(tx, 0)
+		if ok != c.want {
+			t.Errorf("%s: got %v want %v", c.name, ok, c.want)
+		}
+	}
+}
+
+func TestPayToPredicate(t *testing.T) {
+	pred, err := vm.Assemble("7 NUMEQUAL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var h [32]byte
+	sha3pool.Sum256(h[:], pred)
+
+	prog := PayToPredicateProgram(h)
+	got, err := ParsePayToPredicateProgram(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != h {
+		t.Errorf("ParsePayToPredicateProgram = %x want %x", got, h)
+	}
+
+	cases := []struct {
+		arg  int64
+		pred []byte
+		want bool
+	}{
+		{7, pred, true},
+		{8, pred, false},
+		{7, []byte{byte(vm.OP_TRUE)}, false},
+	}
+	for _, c := range cases {
+		tx := spendTx(prog, 0)
+		tx.Inputs[0].SetArguments([][]byte{vm.Int64Bytes(c.arg), vm.Int64Bytes(1), c.pred})
+		ok, _ := vm.VerifyTxInput(tx, 0)
+		if ok != c.want {
+			t.Errorf("arg %d, predicate %x: got %v want %v", c.arg, c.pred, ok, c.want)
+		}
+	}
+}
+
+func TestParseContractErrors(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(nil)
+	p2sp, _ := P2SPMultiSigProgram([]ed25519.PublicKey{pub}, 1)
+	if _, _, _, err := ParseTimeLockedMultiSigProgram(p2sp); err == nil {
+		t.Error("ParseTimeLockedMultiSigProgram(p2sp) = success want error")
+	}
+	if _, _, _, err := ParseHashLockedProgram(p2sp); err == nil {
+		t.Error("ParseHashLockedProgram(p2sp) = success want error")
+	}
+	if _, _, _, err := ParseEscrowProgram(p2sp); err == nil {
+		t.Error("ParseEscrowProgram(p2sp) = success want error")
+	}
+	if _, err := ParsePayToPredicateProgram(p2sp); err == nil {
+		t.Error("ParsePayToPredicateProgram(p2sp) = success want error")
+	}
+	if _, err := EscrowProgram([]ed25519.PublicKey{pub, pub}, pub, 1); err == nil {
+		t.Error("EscrowProgram with 2 parties = success want error")
+	}
+}
+
+func spendTx(prog []byte, minTime uint64) *bc.Tx {
+	return bc.NewTx(bc.TxData{
+		Version: 1,
+		MinTime: minTime,
+		Inputs: []*bc.TxInput{
+			bc.NewSpendInput(bc.Hash{1}, 0, nil, bc.AssetID{2}, 10, prog, nil),
+		},
+		Outputs: []*bc.TxOutput{
+			bc.NewTxOutput(bc.AssetID{2}, 10, []byte{byte(vm.OP_TRUE)}, nil),
+		},
+	})
+}
+
+func signSpend(tx *bc.Tx, priv ed25519.PrivateKey, extra ...[]byte) {
+	signSpendMulti(tx, []ed25519.PrivateKey{priv}, extra...)
+}
+
+// signSpendMulti sets the arguments of tx's first input to satisfy a
+// P2SP multisig body, followed by extra.
+func signSpendMulti(tx *bc.Tx, privs []ed25519.PrivateKey, extra ...[]byte) {
+	h := tx.HashForSig(0)
+	pred := NewBuilder().AddData(h[:]).AddOp(vm.OP_TXSIGHASH).AddOp(vm.OP_EQUAL).Program
+	var msg [32]byte
+	sha3pool.Sum256(msg[:], pred)
+
+	args := [][]byte{vm.Int64Bytes(0)}
+	for _, priv := range privs {
+		args = append(args, ed25519.Sign(priv, msg[:]))
+	}
+	args = append(args, pred)
+	args = append(args, extra...)
+	tx.Inputs[0].SetArguments(args)
+}
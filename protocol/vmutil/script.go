@@ -79,6 +79,13 @@ func P2SPMultiSigProgram(pubkeys []ed25519.PublicKey, nrequired int) ([]byte, er
 		return nil, err
 	}
 	builder := NewBuilder()
+	addP2SPMultiSig(builder, pubkeys, nrequired)
+	return builder.Program, nil
+}
+
+// addP2SPMultiSig appends the body of a P2SP multisig program to
+// builder. Callers must have already checked the multisig parameters.
+func addP2SPMultiSig(builder *Builder, pubkeys []ed25519.PublicKey, nrequired int) {
 	// Expected stack: [... NARGS SIG SIG SIG PREDICATE]
 	// Number of sigs must match nrequired.
 	builder.AddOp(vm.OP_DUP).AddOp(vm.OP_TOALTSTACK) // stash a copy of the predicate
@@ -91,7 +98,6 @@ func P2SPMultiSigProgram(pubkeys []ed25519.PublicKey, nrequired int) ([]byte, er
 	builder.AddOp(vm.OP_CHECKMULTISIG).AddOp(vm.OP_VERIFY) // stack is now [... NARGS]
 	builder.AddOp(vm.OP_FROMALTSTACK)                      // stack is now [... NARGS PREDICATE]
 	builder.AddInt64(0).AddOp(vm.OP_CHECKPREDICATE)
-	return builder.Program, nil
 }
 
 func ParseP2SPMultiSigProgram(program []byte) ([]ed25519.PublicKey, int, error) {